@@ -17,6 +17,16 @@ func NewApp(c *Container) *App {
 }
 
 func (a *App) Run() error {
+	if a.Container != nil && a.Container.OrderExpiry != nil {
+		a.Container.OrderExpiry.Start()
+	}
+	if a.Container != nil && a.Container.OutboxRelay != nil {
+		a.Container.OutboxRelay.Start()
+	}
+	if a.Container != nil && a.Container.WebhookDispatcher != nil {
+		a.Container.WebhookDispatcher.Start()
+	}
+
 	return a.Server.Start()
 }
 
@@ -25,9 +35,38 @@ func (a *App) Shutdown(ctx context.Context) error {
 		return err
 	}
 
+	if a.Container != nil && a.Container.OrderExpiry != nil {
+		if err := a.Container.OrderExpiry.Stop(ctx); err != nil {
+			return err
+		}
+	}
+
+	if a.Container != nil && a.Container.OutboxRelay != nil {
+		if err := a.Container.OutboxRelay.Stop(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Before the webhook pool, which runs the attempts the dispatcher submits.
+	if a.Container != nil && a.Container.WebhookDispatcher != nil {
+		if err := a.Container.WebhookDispatcher.Stop(ctx); err != nil {
+			return err
+		}
+	}
+
+	if a.Container != nil && a.Container.WebhookPool != nil {
+		a.Container.WebhookPool.Stop()
+	}
+
 	if a.Container != nil && a.Container.WorkerPool != nil {
 		a.Container.WorkerPool.Stop()
 	}
 
+	if a.Container != nil && a.Container.DB != nil {
+		if err := a.Container.DB.Close(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
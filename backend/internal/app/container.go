@@ -2,14 +2,21 @@ package app
 
 import (
 	"database/sql"
-	"time"
 
+	"go-shop-app-backend/internal/carts"
+	"go-shop-app-backend/internal/categories"
 	"go-shop-app-backend/internal/infra/auth"
 	"go-shop-app-backend/internal/infra/config"
 	"go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/infra/idempotency"
+	"go-shop-app-backend/internal/infra/mail"
+	"go-shop-app-backend/internal/infra/outbox"
+	"go-shop-app-backend/internal/infra/ratelimit"
 	"go-shop-app-backend/internal/orders"
+	"go-shop-app-backend/internal/payments"
 	"go-shop-app-backend/internal/products"
 	"go-shop-app-backend/internal/users"
+	"go-shop-app-backend/internal/webhooks"
 	"go-shop-app-backend/pkg/workerpool"
 )
 
@@ -18,7 +25,20 @@ type Container struct {
 	DB     *sql.DB
 	JWT    *auth.Manager
 
+	TxManager *db.TxManager
+
 	WorkerPool *workerpool.Pool
+	// WebhookPool runs webhook attempts apart from WorkerPool, which sends
+	// mail.
+	WebhookPool *workerpool.Pool
+
+	// RateLimitStore is nil when rate limiting is disabled.
+	RateLimitStore ratelimit.Store
+
+	IdempotencyStore idempotency.Store
+
+	OutboxStore outbox.Store
+	OutboxRelay *outbox.Relay
 
 	UserRepo    users.Repository
 	UserService users.Service
@@ -26,34 +46,186 @@ type Container struct {
 	ProductRepo    products.Repository
 	ProductService products.Service
 
+	CategoryRepo    categories.Repository
+	CategoryService categories.Service
+
 	OrderRepo    orders.Repository
 	OrderService orders.Service
+	// OrderExpiry is nil when order expiry is disabled.
+	OrderExpiry *orders.ExpiryScheduler
+
+	CartRepo    carts.Repository
+	CartService carts.Service
+
+	PaymentRepo     payments.Repository
+	PaymentProvider payments.PaymentProvider
+	PaymentService  payments.Service
+
+	WebhookRepo       webhooks.Repository
+	WebhookDispatcher *webhooks.Dispatcher
+	WebhookService    webhooks.Service
 }
 
 func NewContainer(cfg *config.Config) (*Container, error) {
+	keys, err := newKeySet(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	mailer, err := newMailer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	database, err := db.NewPostgres(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	jwtManager := auth.NewManager(cfg.JWTSecret, 24*time.Hour)
-	workerPool := workerpool.New(5)
+	jwtManager := auth.NewManager(keys, cfg.JWTTTL, cfg.RefreshTTL, auth.NewPostgresRevocationStore(database))
+	workerPool := workerpool.New(cfg.WorkerPoolSize)
 
 	c := &Container{
-		Config:     cfg,
-		DB:         database,
-		JWT:        jwtManager,
-		WorkerPool: workerPool,
+		Config:      cfg,
+		DB:          database,
+		JWT:         jwtManager,
+		WorkerPool:  workerPool,
+		WebhookPool: workerpool.New(cfg.WebhookWorkers),
+		TxManager:   db.NewTxManager(database),
+
+		IdempotencyStore: idempotency.NewPostgresStore(database),
+		OutboxStore:      outbox.NewPostgresStore(database),
+	}
+
+	c.WebhookRepo = webhooks.NewPostgresRepository(database)
+	c.WebhookDispatcher = webhooks.NewDispatcher(c.WebhookRepo, c.WebhookPool, webhooks.Options{
+		Timeout:      cfg.WebhookTimeout,
+		Interval:     cfg.WebhookPollInterval,
+		BatchSize:    cfg.WebhookBatchSize,
+		MaxAttempts:  cfg.WebhookMaxAttempts,
+		BackoffBase:  cfg.WebhookBackoffBase,
+		BackoffMax:   cfg.WebhookBackoffMax,
+		DisableAfter: cfg.WebhookDisableAfter,
+	})
+	c.WebhookService = webhooks.NewService(c.WebhookRepo, c.WebhookDispatcher)
+
+	var sink outbox.Sink = outbox.NewLogSink()
+	if cfg.OutboxSink == "http" {
+		sink = outbox.NewHTTPSink(cfg.OutboxHTTPURL, cfg.OutboxHTTPTimeout)
+	}
+	// Every event also fans out to the merchant webhook subscriptions.
+	sink = outbox.NewMultiSink(sink, c.WebhookDispatcher)
+	c.OutboxRelay = outbox.NewRelay(c.OutboxStore, sink, outbox.RelayOptions{
+		Interval:    cfg.OutboxRelayInterval,
+		BatchSize:   cfg.OutboxBatchSize,
+		Lease:       cfg.OutboxLease,
+		MaxAttempts: cfg.OutboxMaxAttempts,
+		BackoffBase: cfg.OutboxBackoffBase,
+		BackoffMax:  cfg.OutboxBackoffMax,
+	})
+
+	if cfg.RateLimitEnabled {
+		c.RateLimitStore = ratelimit.NewMemoryStore()
+	}
+
+	loginTracker := users.NewPostgresLoginTracker(database)
+	if cfg.LoginTracker == "memory" {
+		loginTracker = users.NewMemoryLoginTracker()
 	}
 
 	c.UserRepo = users.NewPostgresRepository(database)
-	c.UserService = users.NewService(c.UserRepo, jwtManager)
+	c.UserService = users.NewService(c.UserRepo, jwtManager, c.TxManager, users.Options{
+		Mailer:           mailer,
+		Pool:             workerPool,
+		PasswordResetTTL: cfg.PasswordResetTTL,
+		PasswordResetURL: cfg.PasswordResetURL,
+
+		Signer:               auth.NewLinkSigner(cfg.EmailVerificationSecret),
+		EmailVerificationTTL: cfg.EmailVerificationTTL,
+		EmailVerificationURL: cfg.EmailVerificationURL,
+
+		LoginTracker: loginTracker,
+		Lockout: users.LockoutPolicy{
+			MaxAttempts:     cfg.LoginMaxAttempts,
+			IPMaxAttempts:   cfg.LoginIPMaxAttempts,
+			Window:          cfg.LoginWindow,
+			LockoutDuration: cfg.LoginLockoutDuration,
+			BackoffBase:     cfg.LoginBackoffBase,
+			BackoffMax:      cfg.LoginBackoffMax,
+		},
+
+		Events: c.OutboxStore,
+	})
 
 	c.ProductRepo = products.NewPostgresRepository(database)
-	c.ProductService = products.NewService(c.ProductRepo)
+	c.ProductService = products.NewService(c.ProductRepo, c.TxManager)
+
+	c.CategoryRepo = categories.NewPostgresRepository(database)
+	c.CategoryService = categories.NewService(c.CategoryRepo, c.ProductService, c.TxManager)
 
 	c.OrderRepo = orders.NewPostgresRepository(database)
-	c.OrderService = orders.NewService(c.OrderRepo, workerPool)
+	var verifier orders.EmailVerifier
+	if cfg.RequireVerifiedEmail {
+		verifier = c.UserService
+	}
+	c.OrderService = orders.NewService(c.OrderRepo, c.ProductRepo, c.TxManager, verifier, orders.Options{
+		Events:            c.OutboxStore,
+		LowStockThreshold: int64(cfg.LowStockThreshold),
+	})
+	if cfg.OrderExpiryEnabled {
+		c.OrderExpiry = orders.NewExpiryScheduler(c.OrderService, orders.ExpiryOptions{
+			TTL:       cfg.PendingOrderTTL,
+			Interval:  cfg.OrderExpiryInterval,
+			BatchSize: cfg.OrderExpiryBatchSize,
+		})
+	}
+
+	c.CartRepo = carts.NewPostgresRepository(database)
+	c.CartService = carts.NewService(c.CartRepo, c.ProductRepo, c.OrderService, c.TxManager)
+
+	// Only the fake provider exists so far; config validation rejects others.
+	c.PaymentProvider = payments.NewFakeProvider(cfg.PaymentWebhookSecret)
+	c.PaymentRepo = payments.NewPostgresRepository(database)
+	c.PaymentService = payments.NewService(c.PaymentRepo, c.OrderService, c.PaymentProvider, c.TxManager, payments.Options{
+		Currency:      cfg.PaymentCurrency,
+		WebhookSecret: cfg.PaymentWebhookSecret,
+	})
 
 	return c, nil
 }
+
+func newKeySet(cfg *config.Config) (*auth.KeySet, error) {
+	if len(cfg.JWTKeys) == 0 {
+		return auth.NewHMACKeySet(cfg.JWTSecret), nil
+	}
+
+	specs := make([]auth.KeySpec, 0, len(cfg.JWTKeys))
+	for _, k := range cfg.JWTKeys {
+		specs = append(specs, auth.KeySpec{
+			ID:             k.ID,
+			Algorithm:      k.Algorithm,
+			Status:         auth.KeyStatus(k.Status),
+			PrivateKeyPath: k.PrivateKeyPath,
+			PublicKeyPath:  k.PublicKeyPath,
+		})
+	}
+
+	return auth.LoadKeySet(specs)
+}
+
+func newMailer(cfg *config.Config) (mail.Mailer, error) {
+	switch cfg.MailDriver {
+	case "smtp":
+		return mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		})
+	case "file":
+		return mail.NewFileMailer(cfg.MailDir, cfg.MailFrom)
+	default:
+		return mail.NewLogMailer(), nil
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"time"
 
+	"go-shop-app-backend/internal/infra/config"
 	infrahttp "go-shop-app-backend/internal/infra/http"
+	"go-shop-app-backend/internal/infra/ratelimit"
 	"go-shop-app-backend/pkg/logger"
 )
 
@@ -14,7 +16,25 @@ type Server struct {
 }
 
 func NewHTTPServer(c *Container) *Server {
-	router := infrahttp.NewRouter(c.DB, c.Config)
+	router := infrahttp.NewRouter(infrahttp.Deps{
+		DB:              c.DB,
+		JWT:             c.JWT,
+		UserService:     c.UserService,
+		ProductService:  c.ProductService,
+		CategoryService: c.CategoryService,
+		OrderService:    c.OrderService,
+		CartService:     c.CartService,
+		PaymentService:  c.PaymentService,
+		WebhookService:  c.WebhookService,
+
+		RateLimitStore: c.RateLimitStore,
+		RateLimits:     rateLimitPolicies(c.Config),
+		TrustedProxies: c.Config.TrustedProxies,
+
+		IdempotencyStore:       c.IdempotencyStore,
+		IdempotencyTTL:         c.Config.IdempotencyTTL,
+		IdempotencyLockTimeout: c.Config.IdempotencyLockTimeout,
+	})
 
 	srv := &http.Server{
 		Addr:         ":" + c.Config.ServerPort,
@@ -39,3 +59,11 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	logger.Info("server shutting down")
 	return s.httpServer.Shutdown(ctx)
 }
+
+func rateLimitPolicies(cfg *config.Config) map[string]ratelimit.Policy {
+	policies := make(map[string]ratelimit.Policy, len(cfg.RateLimits))
+	for name, p := range cfg.RateLimits {
+		policies[name] = ratelimit.Policy{Requests: p.Requests, Period: p.Period, Burst: p.Burst}
+	}
+	return policies
+}
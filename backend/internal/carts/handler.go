@@ -0,0 +1,198 @@
+package carts
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/middleware"
+)
+
+type Handler struct {
+	service     Service
+	idempotency gin.HandlerFunc
+}
+
+// NewHandler builds the handler. idempotency, typically
+// middleware.Idempotency, guards order creation; nil disables it.
+func NewHandler(service Service, idempotency gin.HandlerFunc) *Handler {
+	if idempotency == nil {
+		idempotency = func(c *gin.Context) { c.Next() }
+	}
+	return &Handler{service: service, idempotency: idempotency}
+}
+
+// RegisterRoutes registers the cart routes. r should use
+// middleware.OptionalAuth so that both guests and users can reach them;
+// checkout additionally requires a signed-in user.
+func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
+	g := r.Group("/cart")
+
+	g.GET("/", h.get)
+	g.POST("/items", h.addItem)
+	g.PUT("/items/:product_id", h.updateItem)
+	g.DELETE("/items/:product_id", h.removeItem)
+	g.POST("/checkout", h.idempotency, h.checkout)
+}
+
+func (h *Handler) get(c *gin.Context) {
+	cart, err := h.service.Get(c.Request.Context(), ownerFromContext(c))
+	if err != nil {
+		writeError(c, err, "failed_to_get_cart")
+		return
+	}
+
+	writeCart(c, http.StatusOK, cart)
+}
+
+func (h *Handler) addItem(c *gin.Context) {
+	var input AddItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	cart, err := h.service.AddItem(c.Request.Context(), ownerFromContext(c), input)
+	if err != nil {
+		writeError(c, err, "failed_to_add_cart_item")
+		return
+	}
+
+	writeCart(c, http.StatusOK, cart)
+}
+
+func (h *Handler) updateItem(c *gin.Context) {
+	productID, err := parseIDParam(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_product_id",
+			"message": "product_id must be a positive integer",
+		})
+		return
+	}
+
+	var input UpdateItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	cart, err := h.service.UpdateItem(c.Request.Context(), ownerFromContext(c), productID, input)
+	if err != nil {
+		writeError(c, err, "failed_to_update_cart_item")
+		return
+	}
+
+	writeCart(c, http.StatusOK, cart)
+}
+
+func (h *Handler) removeItem(c *gin.Context) {
+	productID, err := parseIDParam(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_product_id",
+			"message": "product_id must be a positive integer",
+		})
+		return
+	}
+
+	cart, err := h.service.RemoveItem(c.Request.Context(), ownerFromContext(c), productID)
+	if err != nil {
+		writeError(c, err, "failed_to_remove_cart_item")
+		return
+	}
+
+	writeCart(c, http.StatusOK, cart)
+}
+
+func (h *Handler) checkout(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "sign in to check out",
+		})
+		return
+	}
+
+	order, err := h.service.Checkout(c.Request.Context(), userID)
+	if err != nil {
+		if stockErr, ok := domain.AsOutOfStockError(err); ok {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":       "out_of_stock",
+				"message":     "not enough stock for some products",
+				"product_ids": stockErr.ProductIDs,
+			})
+			return
+		}
+
+		if errors.Is(err, domain.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "email_not_verified",
+				"message": "verify your email address before checking out",
+			})
+			return
+		}
+
+		writeError(c, err, "failed_to_checkout")
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+func writeError(c *gin.Context, err error, code string) {
+	if domain.IsValidationError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "validation_error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, domain.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "cart_item_not_found",
+			"message": "cart item not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   code,
+		"message": err.Error(),
+	})
+}
+
+// ownerFromContext prefers the signed-in user and falls back to the guest
+// token header.
+func ownerFromContext(c *gin.Context) Owner {
+	if userID, ok := middleware.GetUserID(c); ok {
+		return Owner{UserID: userID}
+	}
+	return Owner{Token: c.GetHeader(TokenHeader)}
+}
+
+func writeCart(c *gin.Context, status int, cart *Cart) {
+	if cart.Token != "" {
+		c.Header(TokenHeader, cart.Token)
+	}
+	c.JSON(status, cart)
+}
+
+func parseIDParam(raw string) (int64, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid id")
+	}
+	return id, nil
+}
@@ -0,0 +1,74 @@
+package carts
+
+// TokenHeader carries the anonymous guest cart token. The server issues it
+// on the first write to a guest cart and echoes it on every cart response.
+const TokenHeader = "X-Cart-Token"
+
+// StockWarning flags cart lines that cannot currently be fulfilled.
+type StockWarning string
+
+const (
+	WarningOutOfStock        StockWarning = "out_of_stock"
+	WarningInsufficientStock StockWarning = "insufficient_stock"
+)
+
+// Owner identifies a cart: a signed-in user, or a guest by token.
+type Owner struct {
+	UserID int64
+	Token  string
+}
+
+func (o Owner) IsGuest() bool {
+	return o.UserID == 0
+}
+
+// CartItem is a cart line priced from the current catalog.
+type CartItem struct {
+	ProductID int64        `json:"product_id"`
+	Name      string       `json:"name"`
+	UnitPrice int64        `json:"unit_price"`
+	Quantity  int64        `json:"quantity"`
+	Subtotal  int64        `json:"subtotal"`
+	Stock     int64        `json:"stock"`
+	Warning   StockWarning `json:"warning,omitempty"`
+}
+
+type Cart struct {
+	Token      string     `json:"token,omitempty"`
+	Items      []CartItem `json:"items"`
+	TotalPrice int64      `json:"total_price"`
+	// CanCheckout is false while any line carries a stock warning.
+	CanCheckout bool `json:"can_checkout"`
+}
+
+type AddItemInput struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int64 `json:"quantity"`
+}
+
+type UpdateItemInput struct {
+	Quantity int64 `json:"quantity"`
+}
+
+// newCart prices the lines and attaches stock warnings.
+func newCart(token string, items []CartItem) *Cart {
+	cart := &Cart{Token: token, Items: make([]CartItem, 0, len(items)), CanCheckout: len(items) > 0}
+
+	for _, it := range items {
+		it.Subtotal = it.UnitPrice * it.Quantity
+		switch {
+		case it.Stock <= 0:
+			it.Warning = WarningOutOfStock
+		case it.Stock < it.Quantity:
+			it.Warning = WarningInsufficientStock
+		}
+		if it.Warning != "" {
+			cart.CanCheckout = false
+		}
+
+		cart.TotalPrice += it.Subtotal
+		cart.Items = append(cart.Items, it)
+	}
+
+	return cart
+}
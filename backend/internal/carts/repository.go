@@ -0,0 +1,20 @@
+package carts
+
+import "context"
+
+type Repository interface {
+	// FindID returns the owner's cart id or domain.ErrNotFound.
+	FindID(ctx context.Context, owner Owner) (int64, error)
+	// FindIDForUpdate is FindID that also locks the cart row.
+	FindIDForUpdate(ctx context.Context, owner Owner) (int64, error)
+	// Ensure returns the owner's cart id, creating the cart if needed.
+	Ensure(ctx context.Context, owner Owner) (int64, error)
+	Items(ctx context.Context, cartID int64) ([]CartItem, error)
+	AddItem(ctx context.Context, cartID, productID, quantity int64) error
+	SetItemQuantity(ctx context.Context, cartID, productID, quantity int64) error
+	RemoveItem(ctx context.Context, cartID, productID int64) error
+	Clear(ctx context.Context, cartID int64) error
+	// MoveItems adds the lines of one cart to another, summing quantities,
+	// and deletes the source cart.
+	MoveItems(ctx context.Context, fromCartID, toCartID int64) error
+}
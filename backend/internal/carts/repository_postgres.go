@@ -0,0 +1,208 @@
+package carts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"go-shop-app-backend/internal/domain"
+	infraDB "go-shop-app-backend/internal/infra/db"
+)
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) conn(ctx context.Context) infraDB.DBTX {
+	return infraDB.Conn(ctx, r.db)
+}
+
+// ownerCondition matches the cart by user id, or by token for guests.
+func ownerCondition(owner Owner) (string, any) {
+	if owner.IsGuest() {
+		return "token = $1", owner.Token
+	}
+	return "user_id = $1", owner.UserID
+}
+
+func (r *postgresRepository) FindID(ctx context.Context, owner Owner) (int64, error) {
+	cond, arg := ownerCondition(owner)
+	return r.findID(ctx, "SELECT id FROM carts WHERE "+cond, arg)
+}
+
+func (r *postgresRepository) FindIDForUpdate(ctx context.Context, owner Owner) (int64, error) {
+	cond, arg := ownerCondition(owner)
+	return r.findID(ctx, "SELECT id FROM carts WHERE "+cond+" FOR UPDATE", arg)
+}
+
+func (r *postgresRepository) findID(ctx context.Context, query string, arg any) (int64, error) {
+	var id int64
+	if err := r.conn(ctx).QueryRowContext(ctx, query, arg).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, domain.ErrNotFound
+		}
+		return 0, fmt.Errorf("find cart: %w", err)
+	}
+	return id, nil
+}
+
+func (r *postgresRepository) Ensure(ctx context.Context, owner Owner) (int64, error) {
+	var (
+		userID any
+		token  any
+	)
+	if owner.IsGuest() {
+		token = owner.Token
+	} else {
+		userID = owner.UserID
+	}
+
+	// The no-op update makes RETURNING yield the existing row on conflict.
+	const query = `
+        INSERT INTO carts (user_id, token)
+        VALUES ($1, $2)
+        ON CONFLICT %s DO UPDATE SET updated_at = NOW()
+        RETURNING id
+    `
+
+	target := "(user_id)"
+	if owner.IsGuest() {
+		target = "(token)"
+	}
+
+	var id int64
+	if err := r.conn(ctx).QueryRowContext(ctx, fmt.Sprintf(query, target), userID, token).Scan(&id); err != nil {
+		return 0, fmt.Errorf("ensure cart: %w", err)
+	}
+
+	return id, nil
+}
+
+func (r *postgresRepository) Items(ctx context.Context, cartID int64) ([]CartItem, error) {
+	const query = `
+        SELECT ci.product_id, p.name, p.price, ci.quantity, p.stock
+        FROM cart_items ci
+        JOIN products p ON p.id = ci.product_id
+        WHERE ci.cart_id = $1
+        ORDER BY ci.added_at, ci.product_id
+    `
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, cartID)
+	if err != nil {
+		return nil, fmt.Errorf("query cart items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []CartItem
+	for rows.Next() {
+		var it CartItem
+		if err := rows.Scan(&it.ProductID, &it.Name, &it.UnitPrice, &it.Quantity, &it.Stock); err != nil {
+			return nil, fmt.Errorf("scan cart item: %w", err)
+		}
+		items = append(items, it)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return items, nil
+}
+
+func (r *postgresRepository) AddItem(ctx context.Context, cartID, productID, quantity int64) error {
+	const query = `
+        INSERT INTO cart_items (cart_id, product_id, quantity)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (cart_id, product_id) DO UPDATE
+        SET quantity = cart_items.quantity + EXCLUDED.quantity
+    `
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, cartID, productID, quantity); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return domain.ErrNotFound
+		}
+		return fmt.Errorf("add cart item: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) SetItemQuantity(ctx context.Context, cartID, productID, quantity int64) error {
+	const query = `
+        UPDATE cart_items
+        SET quantity = $1
+        WHERE cart_id = $2 AND product_id = $3
+    `
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, quantity, cartID, productID)
+	if err != nil {
+		return fmt.Errorf("update cart item: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update cart item rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) RemoveItem(ctx context.Context, cartID, productID int64) error {
+	const query = `DELETE FROM cart_items WHERE cart_id = $1 AND product_id = $2`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, cartID, productID)
+	if err != nil {
+		return fmt.Errorf("remove cart item: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("remove cart item rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) Clear(ctx context.Context, cartID int64) error {
+	if _, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM cart_items WHERE cart_id = $1`, cartID); err != nil {
+		return fmt.Errorf("clear cart: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRepository) MoveItems(ctx context.Context, fromCartID, toCartID int64) error {
+	const query = `
+        INSERT INTO cart_items (cart_id, product_id, quantity, added_at)
+        SELECT $2, product_id, quantity, added_at
+        FROM cart_items
+        WHERE cart_id = $1
+        ON CONFLICT (cart_id, product_id) DO UPDATE
+        SET quantity = cart_items.quantity + EXCLUDED.quantity
+    `
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, fromCartID, toCartID); err != nil {
+		return fmt.Errorf("merge cart items: %w", err)
+	}
+
+	if _, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM carts WHERE id = $1`, fromCartID); err != nil {
+		return fmt.Errorf("delete merged cart: %w", err)
+	}
+
+	return nil
+}
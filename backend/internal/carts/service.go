@@ -0,0 +1,293 @@
+package carts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"go-shop-app-backend/internal/domain"
+	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/orders"
+	"go-shop-app-backend/internal/products"
+)
+
+const tokenBytes = 24
+
+type Service interface {
+	Get(ctx context.Context, owner Owner) (*Cart, error)
+	AddItem(ctx context.Context, owner Owner, input AddItemInput) (*Cart, error)
+	UpdateItem(ctx context.Context, owner Owner, productID int64, input UpdateItemInput) (*Cart, error)
+	RemoveItem(ctx context.Context, owner Owner, productID int64) (*Cart, error)
+	Checkout(ctx context.Context, userID int64) (*orders.Order, error)
+	MergeGuestCart(ctx context.Context, token string, userID int64) error
+}
+
+// ProductReader is the part of products.Repository carts need to check that
+// a product exists before it is added.
+type ProductReader interface {
+	GetByID(ctx context.Context, id int64) (*products.Product, error)
+}
+
+type service struct {
+	repo     Repository
+	products ProductReader
+	orders   orders.Service
+	tx       infraDB.Transactor
+}
+
+func NewService(repo Repository, products ProductReader, orders orders.Service, tx infraDB.Transactor) Service {
+	return &service{
+		repo:     repo,
+		products: products,
+		orders:   orders,
+		tx:       tx,
+	}
+}
+
+func (s *service) Get(ctx context.Context, owner Owner) (*Cart, error) {
+	if err := validateOwner(owner); err != nil {
+		return nil, err
+	}
+	if owner.IsGuest() && owner.Token == "" {
+		return newCart("", nil), nil
+	}
+
+	cartID, err := s.repo.FindID(ctx, owner)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return newCart(owner.Token, nil), nil
+		}
+		return nil, fmt.Errorf("find cart: %w", err)
+	}
+
+	return s.load(ctx, owner, cartID)
+}
+
+func (s *service) AddItem(ctx context.Context, owner Owner, input AddItemInput) (*Cart, error) {
+	if err := validateOwner(owner); err != nil {
+		return nil, err
+	}
+	if input.ProductID <= 0 {
+		return nil, domain.NewValidationError("product_id must be positive")
+	}
+	if input.Quantity <= 0 {
+		return nil, domain.NewValidationError("quantity must be positive")
+	}
+
+	if _, err := s.products.GetByID(ctx, input.ProductID); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.NewValidationError(fmt.Sprintf("product %d not found", input.ProductID))
+		}
+		return nil, fmt.Errorf("get product: %w", err)
+	}
+
+	if owner.IsGuest() && owner.Token == "" {
+		token, err := newToken()
+		if err != nil {
+			return nil, err
+		}
+		owner.Token = token
+	}
+
+	var cart *Cart
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		cartID, err := s.repo.Ensure(ctx, owner)
+		if err != nil {
+			return fmt.Errorf("ensure cart: %w", err)
+		}
+
+		if err := s.repo.AddItem(ctx, cartID, input.ProductID, input.Quantity); err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return domain.NewValidationError(fmt.Sprintf("product %d not found", input.ProductID))
+			}
+			return fmt.Errorf("add cart item: %w", err)
+		}
+
+		cart, err = s.load(ctx, owner, cartID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+func (s *service) UpdateItem(ctx context.Context, owner Owner, productID int64, input UpdateItemInput) (*Cart, error) {
+	if input.Quantity <= 0 {
+		return nil, domain.NewValidationError("quantity must be positive")
+	}
+
+	return s.modifyItem(ctx, owner, productID, func(ctx context.Context, cartID int64) error {
+		return s.repo.SetItemQuantity(ctx, cartID, productID, input.Quantity)
+	})
+}
+
+func (s *service) RemoveItem(ctx context.Context, owner Owner, productID int64) (*Cart, error) {
+	return s.modifyItem(ctx, owner, productID, func(ctx context.Context, cartID int64) error {
+		return s.repo.RemoveItem(ctx, cartID, productID)
+	})
+}
+
+// modifyItem runs change against an existing line of the owner's cart. A
+// missing cart or line is reported as domain.ErrNotFound.
+func (s *service) modifyItem(ctx context.Context, owner Owner, productID int64, change func(ctx context.Context, cartID int64) error) (*Cart, error) {
+	if err := validateOwner(owner); err != nil {
+		return nil, err
+	}
+	if productID <= 0 {
+		return nil, domain.NewValidationError("invalid product id")
+	}
+	if owner.IsGuest() && owner.Token == "" {
+		return nil, domain.ErrNotFound
+	}
+
+	var cart *Cart
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		cartID, err := s.repo.FindID(ctx, owner)
+		if err != nil {
+			return err
+		}
+
+		if err := change(ctx, cartID); err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return err
+			}
+			return fmt.Errorf("update cart item: %w", err)
+		}
+
+		cart, err = s.load(ctx, owner, cartID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+// Checkout places an order for the user's cart and empties it in the same
+// transaction, so a failed order leaves the cart untouched.
+func (s *service) Checkout(ctx context.Context, userID int64) (*orders.Order, error) {
+	if userID <= 0 {
+		return nil, domain.NewValidationError("user_id is required")
+	}
+
+	var order *orders.Order
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		cartID, err := s.repo.FindIDForUpdate(ctx, Owner{UserID: userID})
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return domain.NewValidationError("cart is empty")
+			}
+			return fmt.Errorf("lock cart: %w", err)
+		}
+
+		items, err := s.repo.Items(ctx, cartID)
+		if err != nil {
+			return fmt.Errorf("get cart items: %w", err)
+		}
+		if len(items) == 0 {
+			return domain.NewValidationError("cart is empty")
+		}
+
+		input := orders.CreateOrderInput{Items: make([]orders.CreateOrderItemInput, 0, len(items))}
+		for _, it := range items {
+			input.Items = append(input.Items, orders.CreateOrderItemInput{
+				ProductID: it.ProductID,
+				Quantity:  it.Quantity,
+			})
+		}
+
+		order, _, err = s.orders.CreateOrder(ctx, userID, input)
+		if err != nil {
+			return err
+		}
+
+		if err := s.repo.Clear(ctx, cartID); err != nil {
+			return fmt.Errorf("clear cart: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// MergeGuestCart moves the guest cart's lines into the user's cart. It is a
+// no-op when the token has no cart.
+func (s *service) MergeGuestCart(ctx context.Context, token string, userID int64) error {
+	if userID <= 0 {
+		return domain.NewValidationError("user_id is required")
+	}
+	if err := validateToken(token); err != nil {
+		return err
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		guestCartID, err := s.repo.FindIDForUpdate(ctx, Owner{Token: token})
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return nil
+			}
+			return fmt.Errorf("lock guest cart: %w", err)
+		}
+
+		userCartID, err := s.repo.Ensure(ctx, Owner{UserID: userID})
+		if err != nil {
+			return fmt.Errorf("ensure cart: %w", err)
+		}
+
+		if err := s.repo.MoveItems(ctx, guestCartID, userCartID); err != nil {
+			return fmt.Errorf("merge guest cart: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (s *service) load(ctx context.Context, owner Owner, cartID int64) (*Cart, error) {
+	items, err := s.repo.Items(ctx, cartID)
+	if err != nil {
+		return nil, fmt.Errorf("get cart items: %w", err)
+	}
+
+	token := ""
+	if owner.IsGuest() {
+		token = owner.Token
+	}
+
+	return newCart(token, items), nil
+}
+
+func validateOwner(owner Owner) error {
+	if owner.UserID < 0 {
+		return domain.NewValidationError("invalid user_id")
+	}
+	if owner.IsGuest() && owner.Token != "" {
+		return validateToken(owner.Token)
+	}
+	return nil
+}
+
+// validateToken accepts only tokens shaped like the ones newToken issues.
+func validateToken(token string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != tokenBytes {
+		return domain.NewValidationError("invalid cart token")
+	}
+	return nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate cart token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,399 @@
+package carts
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/orders"
+	"go-shop-app-backend/internal/products"
+)
+
+// memoryRepo stores carts in maps keyed by cart id.
+type memoryRepo struct {
+	nextID  int64
+	owners  map[int64]Owner
+	items   map[int64][]CartItem
+	catalog map[int64]*products.Product
+}
+
+func newMemoryRepo(catalog ...*products.Product) *memoryRepo {
+	m := &memoryRepo{
+		nextID:  1,
+		owners:  make(map[int64]Owner),
+		items:   make(map[int64][]CartItem),
+		catalog: make(map[int64]*products.Product),
+	}
+	for _, p := range catalog {
+		m.catalog[p.ID] = p
+	}
+	return m
+}
+
+func (m *memoryRepo) FindID(ctx context.Context, owner Owner) (int64, error) {
+	for id, o := range m.owners {
+		if o == owner {
+			return id, nil
+		}
+	}
+	return 0, domain.ErrNotFound
+}
+
+func (m *memoryRepo) FindIDForUpdate(ctx context.Context, owner Owner) (int64, error) {
+	return m.FindID(ctx, owner)
+}
+
+func (m *memoryRepo) Ensure(ctx context.Context, owner Owner) (int64, error) {
+	if id, err := m.FindID(ctx, owner); err == nil {
+		return id, nil
+	}
+	id := m.nextID
+	m.nextID++
+	m.owners[id] = owner
+	return id, nil
+}
+
+func (m *memoryRepo) Items(ctx context.Context, cartID int64) ([]CartItem, error) {
+	items := make([]CartItem, 0, len(m.items[cartID]))
+	for _, it := range m.items[cartID] {
+		p := m.catalog[it.ProductID]
+		it.Name, it.UnitPrice, it.Stock = p.Name, p.Price, p.Stock
+		items = append(items, it)
+	}
+	return items, nil
+}
+
+func (m *memoryRepo) AddItem(ctx context.Context, cartID, productID, quantity int64) error {
+	for i := range m.items[cartID] {
+		if m.items[cartID][i].ProductID == productID {
+			m.items[cartID][i].Quantity += quantity
+			return nil
+		}
+	}
+	m.items[cartID] = append(m.items[cartID], CartItem{ProductID: productID, Quantity: quantity})
+	return nil
+}
+
+func (m *memoryRepo) SetItemQuantity(ctx context.Context, cartID, productID, quantity int64) error {
+	for i := range m.items[cartID] {
+		if m.items[cartID][i].ProductID == productID {
+			m.items[cartID][i].Quantity = quantity
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (m *memoryRepo) RemoveItem(ctx context.Context, cartID, productID int64) error {
+	for i, it := range m.items[cartID] {
+		if it.ProductID == productID {
+			m.items[cartID] = append(m.items[cartID][:i], m.items[cartID][i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (m *memoryRepo) Clear(ctx context.Context, cartID int64) error {
+	delete(m.items, cartID)
+	return nil
+}
+
+func (m *memoryRepo) MoveItems(ctx context.Context, fromCartID, toCartID int64) error {
+	for _, it := range m.items[fromCartID] {
+		_ = m.AddItem(ctx, toCartID, it.ProductID, it.Quantity)
+	}
+	delete(m.items, fromCartID)
+	delete(m.owners, fromCartID)
+	return nil
+}
+
+func (m *memoryRepo) GetByID(ctx context.Context, id int64) (*products.Product, error) {
+	p, ok := m.catalog[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return p, nil
+}
+
+type mockOrderService struct {
+	orders.Service
+	createOrderFn func(ctx context.Context, userID int64, input orders.CreateOrderInput) (*orders.Order, []orders.OrderItem, error)
+}
+
+func (m *mockOrderService) CreateOrder(ctx context.Context, userID int64, input orders.CreateOrderInput) (*orders.Order, []orders.OrderItem, error) {
+	return m.createOrderFn(ctx, userID, input)
+}
+
+type fakeTx struct {
+	calls int
+}
+
+func (f *fakeTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.calls++
+	return fn(ctx)
+}
+
+func newTestService(repo *memoryRepo, orderService orders.Service) Service {
+	return NewService(repo, repo, orderService, &fakeTx{})
+}
+
+func testCatalog() []*products.Product {
+	return []*products.Product{
+		{ID: 1, Name: "Mug", Price: 500, Stock: 10},
+		{ID: 2, Name: "Poster", Price: 1500, Stock: 1},
+		{ID: 3, Name: "Sticker", Price: 100, Stock: 0},
+	}
+}
+
+func TestService_AddItem(t *testing.T) {
+	repo := newMemoryRepo(testCatalog()...)
+	svc := newTestService(repo, nil)
+	ctx := context.Background()
+
+	invalid := []struct {
+		name  string
+		owner Owner
+		input AddItemInput
+	}{
+		{name: "non-positive quantity", owner: Owner{UserID: 1}, input: AddItemInput{ProductID: 1}},
+		{name: "non-positive product", owner: Owner{UserID: 1}, input: AddItemInput{Quantity: 1}},
+		{name: "unknown product", owner: Owner{UserID: 1}, input: AddItemInput{ProductID: 99, Quantity: 1}},
+		{name: "malformed guest token", owner: Owner{Token: "not-a-token"}, input: AddItemInput{ProductID: 1, Quantity: 1}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.AddItem(ctx, tt.owner, tt.input); !domain.IsValidationError(err) {
+				t.Fatalf("expected validation error, got %v", err)
+			}
+		})
+	}
+
+	if _, err := svc.AddItem(ctx, Owner{UserID: 1}, AddItemInput{ProductID: 1, Quantity: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cart, err := svc.AddItem(ctx, Owner{UserID: 1}, AddItemInput{ProductID: 1, Quantity: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(cart.Items) != 1 || cart.Items[0].Quantity != 5 || cart.TotalPrice != 2500 {
+		t.Fatalf("expected one line of 5 mugs totalling 2500, got %+v", cart)
+	}
+	if cart.Token != "" {
+		t.Fatalf("expected no token for user cart, got %q", cart.Token)
+	}
+}
+
+func TestService_GuestCartToken(t *testing.T) {
+	repo := newMemoryRepo(testCatalog()...)
+	svc := newTestService(repo, nil)
+	ctx := context.Background()
+
+	cart, err := svc.AddItem(ctx, Owner{}, AddItemInput{ProductID: 1, Quantity: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cart.Token == "" {
+		t.Fatalf("expected a guest token to be issued")
+	}
+
+	again, err := svc.Get(ctx, Owner{Token: cart.Token})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(again.Items) != 1 || again.Token != cart.Token {
+		t.Fatalf("expected the same guest cart back, got %+v", again)
+	}
+
+	empty, err := svc.Get(ctx, Owner{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(empty.Items) != 0 || empty.CanCheckout {
+		t.Fatalf("expected empty cart without token, got %+v", empty)
+	}
+}
+
+func TestService_StockWarnings(t *testing.T) {
+	repo := newMemoryRepo(testCatalog()...)
+	svc := newTestService(repo, nil)
+	ctx := context.Background()
+	owner := Owner{UserID: 1}
+
+	for _, in := range []AddItemInput{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 2}, {ProductID: 3, Quantity: 1}} {
+		if _, err := svc.AddItem(ctx, owner, in); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	cart, err := svc.Get(ctx, owner)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[int64]StockWarning{1: "", 2: WarningInsufficientStock, 3: WarningOutOfStock}
+	for _, it := range cart.Items {
+		if it.Warning != want[it.ProductID] {
+			t.Fatalf("product %d: expected warning %q, got %q", it.ProductID, want[it.ProductID], it.Warning)
+		}
+	}
+	if cart.CanCheckout {
+		t.Fatalf("expected can_checkout=false with stock warnings")
+	}
+}
+
+func TestService_UpdateAndRemoveItem(t *testing.T) {
+	repo := newMemoryRepo(testCatalog()...)
+	svc := newTestService(repo, nil)
+	ctx := context.Background()
+	owner := Owner{UserID: 1}
+
+	if _, err := svc.UpdateItem(ctx, owner, 1, UpdateItemInput{Quantity: 1}); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound without a cart, got %v", err)
+	}
+
+	if _, err := svc.AddItem(ctx, owner, AddItemInput{ProductID: 1, Quantity: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := svc.UpdateItem(ctx, owner, 1, UpdateItemInput{Quantity: 0}); !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for zero quantity, got %v", err)
+	}
+
+	cart, err := svc.UpdateItem(ctx, owner, 1, UpdateItemInput{Quantity: 4})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cart.Items[0].Quantity != 4 {
+		t.Fatalf("expected quantity 4, got %d", cart.Items[0].Quantity)
+	}
+
+	if _, err := svc.RemoveItem(ctx, owner, 2); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a product not in the cart, got %v", err)
+	}
+
+	cart, err = svc.RemoveItem(ctx, owner, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cart.Items) != 0 {
+		t.Fatalf("expected empty cart, got %+v", cart.Items)
+	}
+}
+
+func TestService_Checkout(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("empty cart", func(t *testing.T) {
+		svc := newTestService(newMemoryRepo(testCatalog()...), nil)
+		if _, err := svc.Checkout(ctx, 1); !domain.IsValidationError(err) {
+			t.Fatalf("expected validation error, got %v", err)
+		}
+	})
+
+	t.Run("places order and clears cart", func(t *testing.T) {
+		repo := newMemoryRepo(testCatalog()...)
+		var got orders.CreateOrderInput
+		svc := newTestService(repo, &mockOrderService{
+			createOrderFn: func(ctx context.Context, userID int64, input orders.CreateOrderInput) (*orders.Order, []orders.OrderItem, error) {
+				got = input
+				return &orders.Order{ID: 10, UserID: userID, TotalPrice: 1000}, nil, nil
+			},
+		})
+
+		if _, err := svc.AddItem(ctx, Owner{UserID: 1}, AddItemInput{ProductID: 1, Quantity: 2}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		order, err := svc.Checkout(ctx, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if order.ID != 10 {
+			t.Fatalf("expected order 10, got %d", order.ID)
+		}
+		if len(got.Items) != 1 || got.Items[0].ProductID != 1 || got.Items[0].Quantity != 2 {
+			t.Fatalf("unexpected order input: %+v", got)
+		}
+
+		cart, _ := svc.Get(ctx, Owner{UserID: 1})
+		if len(cart.Items) != 0 {
+			t.Fatalf("expected cart to be cleared, got %+v", cart.Items)
+		}
+	})
+
+	t.Run("failed order keeps cart", func(t *testing.T) {
+		repo := newMemoryRepo(testCatalog()...)
+		svc := newTestService(repo, &mockOrderService{
+			createOrderFn: func(ctx context.Context, userID int64, input orders.CreateOrderInput) (*orders.Order, []orders.OrderItem, error) {
+				return nil, nil, domain.NewOutOfStockError([]int64{2})
+			},
+		})
+
+		if _, err := svc.AddItem(ctx, Owner{UserID: 1}, AddItemInput{ProductID: 2, Quantity: 5}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		_, err := svc.Checkout(ctx, 1)
+		if _, ok := domain.AsOutOfStockError(err); !ok {
+			t.Fatalf("expected out of stock error, got %v", err)
+		}
+
+		cart, _ := svc.Get(ctx, Owner{UserID: 1})
+		if len(cart.Items) != 1 {
+			t.Fatalf("expected cart to be kept, got %+v", cart.Items)
+		}
+	})
+}
+
+func TestService_MergeGuestCart(t *testing.T) {
+	repo := newMemoryRepo(testCatalog()...)
+	svc := newTestService(repo, nil)
+	ctx := context.Background()
+
+	if err := svc.MergeGuestCart(ctx, "bogus", 1); !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for malformed token, got %v", err)
+	}
+
+	guest, err := svc.AddItem(ctx, Owner{}, AddItemInput{ProductID: 1, Quantity: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.AddItem(ctx, Owner{Token: guest.Token}, AddItemInput{ProductID: 2, Quantity: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.AddItem(ctx, Owner{UserID: 1}, AddItemInput{ProductID: 1, Quantity: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := svc.MergeGuestCart(ctx, guest.Token, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cart, err := svc.Get(ctx, Owner{UserID: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	quantities := map[int64]int64{}
+	for _, it := range cart.Items {
+		quantities[it.ProductID] = it.Quantity
+	}
+	if quantities[1] != 3 || quantities[2] != 1 {
+		t.Fatalf("expected merged quantities {1:3 2:1}, got %v", quantities)
+	}
+
+	guestAfter, err := svc.Get(ctx, Owner{Token: guest.Token})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(guestAfter.Items) != 0 {
+		t.Fatalf("expected guest cart to be gone, got %+v", guestAfter.Items)
+	}
+
+	if err := svc.MergeGuestCart(ctx, guest.Token, 1); err != nil {
+		t.Fatalf("expected merging a consumed token to be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package categories
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/pagination"
+	"go-shop-app-backend/internal/products"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes registers the public category tree and category listing.
+func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
+	g := r.Group("/categories")
+
+	g.GET("/", h.tree)
+	g.GET("/:slug/products", h.listProducts)
+}
+
+// RegisterAdminRoutes registers category management. r must already be
+// restricted to admins.
+func (h *Handler) RegisterAdminRoutes(r *gin.RouterGroup) {
+	g := r.Group("/categories")
+
+	g.POST("/", h.create)
+	g.GET("/:id", h.getByID)
+	g.PUT("/:id", h.update)
+	g.DELETE("/:id", h.delete)
+}
+
+func (h *Handler) tree(c *gin.Context) {
+	tree, err := h.service.Tree(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_categories",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, tree)
+}
+
+func (h *Handler) listProducts(c *gin.Context) {
+	page, err := pagination.Parse(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_pagination",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	filter, err := products.ParseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_filter",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	list, err := h.service.ListProducts(c.Request.Context(), c.Param("slug"), filter, page)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "category_not_found",
+				"message": "category not found",
+			})
+			return
+		}
+
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_products",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) create(c *gin.Context) {
+	var input CreateCategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	category, err := h.service.Create(c.Request.Context(), input)
+	if err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if domain.IsConflictError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "slug_taken",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_create_category",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+func (h *Handler) getByID(c *gin.Context) {
+	id, err := parseIDParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_id",
+			"message": "id must be a positive integer",
+		})
+		return
+	}
+
+	category, err := h.service.GetByID(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "category_not_found",
+				"message": "category not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_category",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+func (h *Handler) update(c *gin.Context) {
+	id, err := parseIDParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_id",
+			"message": "id must be a positive integer",
+		})
+		return
+	}
+
+	var input UpdateCategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	category, err := h.service.Update(c.Request.Context(), id, input)
+	if err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "category_not_found",
+				"message": "category not found",
+			})
+			return
+		}
+
+		if domain.IsConflictError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "slug_taken",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_update_category",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	id, err := parseIDParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_id",
+			"message": "id must be a positive integer",
+		})
+		return
+	}
+
+	err = h.service.Delete(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "category_not_found",
+				"message": "category not found",
+			})
+			return
+		}
+
+		if domain.IsConflictError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "category_has_children",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_delete_category",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func parseIDParam(raw string) (int64, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid id")
+	}
+	return id, nil
+}
@@ -0,0 +1,58 @@
+package categories
+
+import "time"
+
+type Category struct {
+	ID        int64     `json:"id"`
+	ParentID  *int64    `json:"parent_id,omitempty"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Node is a category with its nested subcategories, as served by the public
+// tree endpoint.
+type Node struct {
+	Category
+	Children []*Node `json:"children"`
+}
+
+type CreateCategoryInput struct {
+	ParentID *int64 `json:"parent_id,omitempty"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+}
+
+type UpdateCategoryInput struct {
+	Name *string `json:"name,omitempty"`
+	Slug *string `json:"slug,omitempty"`
+	// ParentID moves the category when present; 0 makes it a root.
+	ParentID *int64 `json:"parent_id,omitempty"`
+}
+
+// buildTree nests categories under their parents. Roots and children keep
+// the order of the input list.
+func buildTree(list []*Category) []*Node {
+	nodes := make(map[int64]*Node, len(list))
+	for _, c := range list {
+		nodes[c.ID] = &Node{Category: *c, Children: []*Node{}}
+	}
+
+	roots := []*Node{}
+	for _, c := range list {
+		node := nodes[c.ID]
+		if c.ParentID == nil {
+			roots = append(roots, node)
+			continue
+		}
+		parent, ok := nodes[*c.ParentID]
+		if !ok {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	return roots
+}
@@ -0,0 +1,16 @@
+package categories
+
+import "context"
+
+type Repository interface {
+	List(ctx context.Context) ([]*Category, error)
+	GetByID(ctx context.Context, id int64) (*Category, error)
+	GetBySlug(ctx context.Context, slug string) (*Category, error)
+	Create(ctx context.Context, input CreateCategoryInput) (*Category, error)
+	Update(ctx context.Context, category *Category) (*Category, error)
+	Delete(ctx context.Context, id int64) error
+	HasChildren(ctx context.Context, id int64) (bool, error)
+	// LockTree serializes changes to the hierarchy so a cycle check stays
+	// valid until the change it guards commits.
+	LockTree(ctx context.Context) error
+}
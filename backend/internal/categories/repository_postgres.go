@@ -0,0 +1,199 @@
+package categories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"go-shop-app-backend/internal/domain"
+	infraDB "go-shop-app-backend/internal/infra/db"
+)
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) conn(ctx context.Context) infraDB.DBTX {
+	return infraDB.Conn(ctx, r.db)
+}
+
+func (r *postgresRepository) List(ctx context.Context) ([]*Category, error) {
+	const query = `
+        SELECT id, parent_id, name, slug, created_at, updated_at
+        FROM categories
+        ORDER BY name, id
+    `
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query categories: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*Category
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan category: %w", err)
+		}
+		list = append(list, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return list, nil
+}
+
+func (r *postgresRepository) GetByID(ctx context.Context, id int64) (*Category, error) {
+	const query = `
+        SELECT id, parent_id, name, slug, created_at, updated_at
+        FROM categories
+        WHERE id = $1
+    `
+
+	c, err := scanCategory(r.conn(ctx).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get category by id: %w", err)
+	}
+
+	return c, nil
+}
+
+func (r *postgresRepository) GetBySlug(ctx context.Context, slug string) (*Category, error) {
+	const query = `
+        SELECT id, parent_id, name, slug, created_at, updated_at
+        FROM categories
+        WHERE slug = $1
+    `
+
+	c, err := scanCategory(r.conn(ctx).QueryRowContext(ctx, query, slug))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get category by slug: %w", err)
+	}
+
+	return c, nil
+}
+
+func (r *postgresRepository) Create(ctx context.Context, input CreateCategoryInput) (*Category, error) {
+	const query = `
+        INSERT INTO categories (parent_id, name, slug)
+        VALUES ($1, $2, $3)
+        RETURNING id, parent_id, name, slug, created_at, updated_at
+    `
+
+	c, err := scanCategory(r.conn(ctx).QueryRowContext(ctx, query, input.ParentID, input.Name, input.Slug))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, domain.NewConflictError("slug is already in use")
+		}
+		return nil, fmt.Errorf("insert category: %w", err)
+	}
+
+	return c, nil
+}
+
+func (r *postgresRepository) Update(ctx context.Context, category *Category) (*Category, error) {
+	const query = `
+        UPDATE categories
+        SET parent_id = $1,
+            name = $2,
+            slug = $3
+        WHERE id = $4
+        RETURNING id, parent_id, name, slug, created_at, updated_at
+    `
+
+	c, err := scanCategory(r.conn(ctx).QueryRowContext(ctx, query, category.ParentID, category.Name, category.Slug, category.ID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		if isUniqueViolation(err) {
+			return nil, domain.NewConflictError("slug is already in use")
+		}
+		return nil, fmt.Errorf("update category: %w", err)
+	}
+
+	return c, nil
+}
+
+func (r *postgresRepository) Delete(ctx context.Context, id int64) error {
+	const query = `DELETE FROM categories WHERE id = $1`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return domain.NewConflictError("category has subcategories")
+		}
+		return fmt.Errorf("delete category: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete category rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) HasChildren(ctx context.Context, id int64) (bool, error) {
+	const query = `SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = $1)`
+
+	var exists bool
+	if err := r.conn(ctx).QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return false, fmt.Errorf("check category children: %w", err)
+	}
+
+	return exists, nil
+}
+
+// LockTree blocks other moves until the caller's transaction ends. Reads
+// are not blocked. It must be called within a transaction.
+func (r *postgresRepository) LockTree(ctx context.Context) error {
+	if _, err := r.conn(ctx).ExecContext(ctx, `LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("lock categories: %w", err)
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCategory(row rowScanner) (*Category, error) {
+	var (
+		c        Category
+		parentID sql.NullInt64
+	)
+	if err := row.Scan(&c.ID, &parentID, &c.Name, &c.Slug, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		c.ParentID = &parentID.Int64
+	}
+	return &c, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
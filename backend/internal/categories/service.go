@@ -0,0 +1,255 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go-shop-app-backend/internal/domain"
+	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/infra/http/pagination"
+	"go-shop-app-backend/internal/products"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+type Service interface {
+	Tree(ctx context.Context) ([]*Node, error)
+	GetByID(ctx context.Context, id int64) (*Category, error)
+	Create(ctx context.Context, input CreateCategoryInput) (*Category, error)
+	Update(ctx context.Context, id int64, input UpdateCategoryInput) (*Category, error)
+	Delete(ctx context.Context, id int64) error
+	ListProducts(ctx context.Context, slug string, filter products.Filter, page pagination.Params) (*pagination.Page[*products.Product], error)
+}
+
+type service struct {
+	repo     Repository
+	products products.Service
+	tx       infraDB.Transactor
+}
+
+func NewService(repo Repository, products products.Service, tx infraDB.Transactor) Service {
+	return &service{repo: repo, products: products, tx: tx}
+}
+
+func (s *service) Tree(ctx context.Context) ([]*Node, error) {
+	list, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list categories: %w", err)
+	}
+
+	return buildTree(list), nil
+}
+
+func (s *service) GetByID(ctx context.Context, id int64) (*Category, error) {
+	if id <= 0 {
+		return nil, domain.NewValidationError("invalid id")
+	}
+
+	category, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get category by id: %w", err)
+	}
+
+	return category, nil
+}
+
+func (s *service) Create(ctx context.Context, input CreateCategoryInput) (*Category, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Slug = strings.TrimSpace(input.Slug)
+
+	if err := validateNameAndSlug(input.Name, input.Slug); err != nil {
+		return nil, err
+	}
+
+	if input.ParentID != nil {
+		if err := s.checkParent(ctx, 0, *input.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.checkSlugFree(ctx, 0, input.Slug); err != nil {
+		return nil, err
+	}
+
+	category, err := s.repo.Create(ctx, input)
+	if err != nil {
+		if domain.IsConflictError(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("create category: %w", err)
+	}
+
+	return category, nil
+}
+
+// Update locks the tree, then reads, checks and writes the category in one
+// transaction, so two concurrent moves cannot each pass the cycle check and
+// together put a category under its own descendant, and a stale parent is
+// never written back.
+func (s *service) Update(ctx context.Context, id int64, input UpdateCategoryInput) (*Category, error) {
+	if id <= 0 {
+		return nil, domain.NewValidationError("invalid id")
+	}
+
+	var updated *Category
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.LockTree(ctx); err != nil {
+			return err
+		}
+
+		category, err := s.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if input.Name != nil {
+			category.Name = strings.TrimSpace(*input.Name)
+		}
+		if input.Slug != nil {
+			category.Slug = strings.TrimSpace(*input.Slug)
+		}
+		if err := validateNameAndSlug(category.Name, category.Slug); err != nil {
+			return err
+		}
+
+		if input.ParentID != nil {
+			if *input.ParentID == 0 {
+				category.ParentID = nil
+			} else {
+				if err := s.checkParent(ctx, id, *input.ParentID); err != nil {
+					return err
+				}
+				parentID := *input.ParentID
+				category.ParentID = &parentID
+			}
+		}
+
+		if input.Slug != nil {
+			if err := s.checkSlugFree(ctx, id, category.Slug); err != nil {
+				return err
+			}
+		}
+
+		updated, err = s.repo.Update(ctx, category)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) || domain.IsConflictError(err) {
+				return err
+			}
+			return fmt.Errorf("update category: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (s *service) Delete(ctx context.Context, id int64) error {
+	if id <= 0 {
+		return domain.NewValidationError("invalid id")
+	}
+
+	hasChildren, err := s.repo.HasChildren(ctx, id)
+	if err != nil {
+		return fmt.Errorf("delete category: %w", err)
+	}
+	if hasChildren {
+		return domain.NewConflictError("category has subcategories")
+	}
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		if errors.Is(err, domain.ErrNotFound) || domain.IsConflictError(err) {
+			return err
+		}
+		return fmt.Errorf("delete category: %w", err)
+	}
+
+	return nil
+}
+
+// ListProducts lists the catalog restricted to the category and all of its
+// descendants.
+func (s *service) ListProducts(ctx context.Context, slug string, filter products.Filter, page pagination.Params) (*pagination.Page[*products.Product], error) {
+	category, err := s.repo.GetBySlug(ctx, slug)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get category by slug: %w", err)
+	}
+
+	filter.CategoryID = category.ID
+
+	return s.products.GetAll(ctx, filter, page)
+}
+
+func validateNameAndSlug(name, slug string) error {
+	if name == "" {
+		return domain.NewValidationError("name is required")
+	}
+	if !slugPattern.MatchString(slug) {
+		return domain.NewValidationError("slug must contain lowercase letters, digits and single hyphens")
+	}
+	return nil
+}
+
+// checkParent ensures parentID exists and, when id is an existing category,
+// that parentID is not the category itself or one of its descendants.
+func (s *service) checkParent(ctx context.Context, id, parentID int64) error {
+	if parentID <= 0 {
+		return domain.NewValidationError("parent_id must be a positive integer")
+	}
+	if parentID == id {
+		return domain.NewValidationError("category cannot be its own parent")
+	}
+
+	list, err := s.repo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list categories: %w", err)
+	}
+
+	parents := make(map[int64]*int64, len(list))
+	for _, c := range list {
+		parents[c.ID] = c.ParentID
+	}
+
+	if _, ok := parents[parentID]; !ok {
+		return domain.NewValidationError("parent category not found")
+	}
+
+	if id == 0 {
+		return nil
+	}
+
+	for cur := &parentID; cur != nil; cur = parents[*cur] {
+		if *cur == id {
+			return domain.NewValidationError("category cannot be moved under its own descendant")
+		}
+	}
+
+	return nil
+}
+
+func (s *service) checkSlugFree(ctx context.Context, id int64, slug string) error {
+	existing, err := s.repo.GetBySlug(ctx, slug)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("get category by slug: %w", err)
+	}
+	if existing.ID != id {
+		return domain.NewConflictError("slug is already in use")
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package categories
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/pagination"
+	"go-shop-app-backend/internal/products"
+)
+
+// memoryRepo keeps categories in a map; it is enough to exercise the
+// service's tree and validation logic.
+type memoryRepo struct {
+	categories map[int64]*Category
+	nextID     int64
+	// tx, when set, is checked by LockTree, which counts the locks taken.
+	tx    *fakeTx
+	locks int
+}
+
+func newMemoryRepo(list ...*Category) *memoryRepo {
+	m := &memoryRepo{categories: make(map[int64]*Category), nextID: 1}
+	for _, c := range list {
+		m.categories[c.ID] = c
+		if c.ID >= m.nextID {
+			m.nextID = c.ID + 1
+		}
+	}
+	return m
+}
+
+func (m *memoryRepo) List(ctx context.Context) ([]*Category, error) {
+	list := make([]*Category, 0, len(m.categories))
+	for id := int64(1); id < m.nextID; id++ {
+		if c, ok := m.categories[id]; ok {
+			cp := *c
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+
+func (m *memoryRepo) GetByID(ctx context.Context, id int64) (*Category, error) {
+	c, ok := m.categories[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (m *memoryRepo) GetBySlug(ctx context.Context, slug string) (*Category, error) {
+	for _, c := range m.categories {
+		if c.Slug == slug {
+			cp := *c
+			return &cp, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (m *memoryRepo) Create(ctx context.Context, input CreateCategoryInput) (*Category, error) {
+	c := &Category{ID: m.nextID, ParentID: input.ParentID, Name: input.Name, Slug: input.Slug}
+	m.categories[c.ID] = c
+	m.nextID++
+	cp := *c
+	return &cp, nil
+}
+
+func (m *memoryRepo) Update(ctx context.Context, category *Category) (*Category, error) {
+	if _, ok := m.categories[category.ID]; !ok {
+		return nil, domain.ErrNotFound
+	}
+	cp := *category
+	m.categories[category.ID] = &cp
+	return category, nil
+}
+
+func (m *memoryRepo) Delete(ctx context.Context, id int64) error {
+	if _, ok := m.categories[id]; !ok {
+		return domain.ErrNotFound
+	}
+	delete(m.categories, id)
+	return nil
+}
+
+func (m *memoryRepo) HasChildren(ctx context.Context, id int64) (bool, error) {
+	for _, c := range m.categories {
+		if c.ParentID != nil && *c.ParentID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryRepo) LockTree(ctx context.Context) error {
+	if m.tx != nil && m.tx.open == 0 {
+		return errors.New("tree locked outside a transaction")
+	}
+	m.locks++
+	return nil
+}
+
+// fakeTx runs fn inline and tracks how many transactions are open.
+type fakeTx struct {
+	open int
+}
+
+func (f *fakeTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.open++
+	defer func() { f.open-- }()
+	return fn(ctx)
+}
+
+type mockProductService struct {
+	products.Service
+	getAllFn func(ctx context.Context, filter products.Filter, page pagination.Params) (*pagination.Page[*products.Product], error)
+}
+
+func (m *mockProductService) GetAll(ctx context.Context, filter products.Filter, page pagination.Params) (*pagination.Page[*products.Product], error) {
+	return m.getAllFn(ctx, filter, page)
+}
+
+func ptr(v int64) *int64 {
+	return &v
+}
+
+func ptrString(v string) *string {
+	return &v
+}
+
+// electronics(1) -> phones(2) -> smartphones(3); books(4)
+func seededRepo() *memoryRepo {
+	return newMemoryRepo(
+		&Category{ID: 1, Name: "Electronics", Slug: "electronics"},
+		&Category{ID: 2, ParentID: ptr(1), Name: "Phones", Slug: "phones"},
+		&Category{ID: 3, ParentID: ptr(2), Name: "Smartphones", Slug: "smartphones"},
+		&Category{ID: 4, Name: "Books", Slug: "books"},
+	)
+}
+
+func TestService_Tree(t *testing.T) {
+	svc := NewService(seededRepo(), nil, &fakeTx{})
+
+	tree, err := svc.Tree(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(tree) != 2 || tree[0].ID != 1 || tree[1].ID != 4 {
+		t.Fatalf("expected roots [1 4], got %+v", tree)
+	}
+	if len(tree[0].Children) != 1 || tree[0].Children[0].ID != 2 {
+		t.Fatalf("expected phones under electronics, got %+v", tree[0].Children)
+	}
+	if len(tree[0].Children[0].Children) != 1 || tree[0].Children[0].Children[0].ID != 3 {
+		t.Fatalf("expected smartphones under phones, got %+v", tree[0].Children[0].Children)
+	}
+	if tree[1].Children == nil {
+		t.Fatalf("expected empty children slice for leaf, got nil")
+	}
+}
+
+func TestService_Create_Validation(t *testing.T) {
+	svc := NewService(seededRepo(), nil, &fakeTx{})
+
+	tests := []struct {
+		name     string
+		input    CreateCategoryInput
+		conflict bool
+	}{
+		{name: "empty name", input: CreateCategoryInput{Slug: "toys"}},
+		{name: "bad slug", input: CreateCategoryInput{Name: "Toys", Slug: "Toys & Games"}},
+		{name: "unknown parent", input: CreateCategoryInput{Name: "Toys", Slug: "toys", ParentID: ptr(99)}},
+		{name: "duplicate slug", input: CreateCategoryInput{Name: "Phones", Slug: "phones"}, conflict: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Create(context.Background(), tt.input)
+			if tt.conflict {
+				if !domain.IsConflictError(err) {
+					t.Fatalf("expected conflict error, got %v", err)
+				}
+				return
+			}
+			if !domain.IsValidationError(err) {
+				t.Fatalf("expected validation error, got %v", err)
+			}
+		})
+	}
+
+	c, err := svc.Create(context.Background(), CreateCategoryInput{Name: " Tablets ", Slug: "tablets", ParentID: ptr(1)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Name != "Tablets" || c.ParentID == nil || *c.ParentID != 1 {
+		t.Fatalf("unexpected category: %+v", c)
+	}
+}
+
+func TestService_Update_Parent(t *testing.T) {
+	repo := seededRepo()
+	tx := &fakeTx{}
+	repo.tx = tx
+	svc := NewService(repo, nil, tx)
+
+	if _, err := svc.Update(context.Background(), 1, UpdateCategoryInput{ParentID: ptr(1)}); !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for self parent, got %v", err)
+	}
+
+	if _, err := svc.Update(context.Background(), 1, UpdateCategoryInput{ParentID: ptr(3)}); !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for descendant parent, got %v", err)
+	}
+
+	if _, err := svc.Update(context.Background(), 99, UpdateCategoryInput{}); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if _, err := svc.Update(context.Background(), 2, UpdateCategoryInput{Slug: ptrString("books")}); !domain.IsConflictError(err) {
+		t.Fatalf("expected conflict error for taken slug, got %v", err)
+	}
+
+	c, err := svc.Update(context.Background(), 3, UpdateCategoryInput{ParentID: ptr(4)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.ParentID == nil || *c.ParentID != 4 {
+		t.Fatalf("expected parent 4, got %+v", c.ParentID)
+	}
+	if repo.locks == 0 {
+		t.Fatal("expected the move to lock the tree")
+	}
+
+	c, err = svc.Update(context.Background(), 3, UpdateCategoryInput{ParentID: ptr(0)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.ParentID != nil {
+		t.Fatalf("expected root category, got parent %d", *c.ParentID)
+	}
+}
+
+func TestService_Delete(t *testing.T) {
+	svc := NewService(seededRepo(), nil, &fakeTx{})
+
+	if err := svc.Delete(context.Background(), 1); !domain.IsConflictError(err) {
+		t.Fatalf("expected conflict error for category with children, got %v", err)
+	}
+
+	if err := svc.Delete(context.Background(), 99); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := svc.Delete(context.Background(), 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestService_ListProducts(t *testing.T) {
+	var captured products.Filter
+	productService := &mockProductService{
+		getAllFn: func(ctx context.Context, filter products.Filter, page pagination.Params) (*pagination.Page[*products.Product], error) {
+			captured = filter
+			return pagination.NewPage([]*products.Product{}, 0, page, nil), nil
+		},
+	}
+
+	svc := NewService(seededRepo(), productService, &fakeTx{})
+
+	if _, err := svc.ListProducts(context.Background(), "missing", products.Filter{}, pagination.Params{Page: 1, Limit: 20}); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown slug, got %v", err)
+	}
+
+	if _, err := svc.ListProducts(context.Background(), "phones", products.Filter{InStock: true}, pagination.Params{Page: 1, Limit: 20}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if captured.CategoryID != 2 || !captured.InStock {
+		t.Fatalf("unexpected filter passed to products: %+v", captured)
+	}
+}
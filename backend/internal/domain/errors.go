@@ -1,9 +1,15 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrNotFound = errors.New("not found")
 
+// ErrEmailNotVerified is returned when an action requires a verified email.
+var ErrEmailNotVerified = errors.New("email address is not verified")
+
 type ValidationError struct {
 	Message string
 }
@@ -20,3 +26,40 @@ func IsValidationError(err error) bool {
 	_, ok := err.(*ValidationError)
 	return ok
 }
+
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+func NewConflictError(msg string) error {
+	return &ConflictError{Message: msg}
+}
+
+func IsConflictError(err error) bool {
+	var e *ConflictError
+	return errors.As(err, &e)
+}
+
+type OutOfStockError struct {
+	ProductIDs []int64
+}
+
+func (e *OutOfStockError) Error() string {
+	return fmt.Sprintf("insufficient stock for products %v", e.ProductIDs)
+}
+
+func NewOutOfStockError(productIDs []int64) error {
+	return &OutOfStockError{ProductIDs: productIDs}
+}
+
+func AsOutOfStockError(err error) (*OutOfStockError, bool) {
+	var e *OutOfStockError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
@@ -1,44 +1,89 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var (
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrTokenRevoked    = errors.New("token has been revoked")
+	ErrAccountDisabled = errors.New("account is disabled")
+)
+
 type Claims struct {
 	UserID int64  `json:"user_id"`
 	Role   string `json:"role"`
+	// Version must match the user's current token version; bumping it
+	// invalidates every token issued before.
+	Version int64 `json:"ver"`
 	jwt.RegisteredClaims
 }
 
+// RefreshToken is a freshly issued opaque refresh token. Only Hash is stored.
+type RefreshToken struct {
+	Raw       string
+	Hash      string
+	ExpiresAt time.Time
+}
+
 type Manager struct {
-	secret []byte
-	ttl    time.Duration
+	keys        *KeySet
+	ttl         time.Duration
+	refreshTTL  time.Duration
+	revocations RevocationStore
 }
 
-func NewManager(secret string, ttl time.Duration) *Manager {
+// NewManager builds a Manager. revocations may be nil, in which case Verify
+// only checks the signature and expiry.
+func NewManager(keys *KeySet, ttl, refreshTTL time.Duration, revocations RevocationStore) *Manager {
 	return &Manager{
-		secret: []byte(secret),
-		ttl:    ttl,
+		keys:        keys,
+		ttl:         ttl,
+		refreshTTL:  refreshTTL,
+		revocations: revocations,
 	}
 }
 
-func (m *Manager) GenerateToken(userID int64, role string) (string, error) {
+// AccessTTL is the lifetime of access tokens.
+func (m *Manager) AccessTTL() time.Duration {
+	return m.ttl
+}
+
+func (m *Manager) GenerateToken(userID int64, role string, version int64) (string, error) {
 	now := time.Now()
 
+	jti, err := randomString(16)
+	if err != nil {
+		return "", fmt.Errorf("generate jti: %w", err)
+	}
+
 	claims := &Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:  userID,
+		Role:    role,
+		Version: version,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString(m.secret)
+	key := m.keys.active
+	token := jwt.NewWithClaims(key.method, claims)
+	if key.id != "" {
+		token.Header["kid"] = key.id
+	}
+
+	signed, err := token.SignedString(key.private)
 	if err != nil {
 		return "", fmt.Errorf("sign jwt: %w", err)
 	}
@@ -46,25 +91,103 @@ func (m *Manager) GenerateToken(userID int64, role string) (string, error) {
 	return signed, nil
 }
 
+// ParseToken checks the signature and expiry only; use Verify for requests.
 func (m *Manager) ParseToken(tokenStr string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(
-		tokenStr,
-		&Claims{},
-		func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %T", token.Method)
-			}
-			return m.secret, nil
-		},
-	)
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, m.keys.verificationKey)
 	if err != nil {
-		return nil, fmt.Errorf("parse jwt: %w", err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
 	}
 
 	claims, ok := token.Claims.(*Claims)
 	if !ok || !token.Valid {
-		return nil, fmt.Errorf("invalid token")
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// Verify parses the token and rejects it when its user is disabled, its jti
+// is denylisted or its version is older than the user's token version.
+func (m *Manager) Verify(ctx context.Context, tokenStr string) (*Claims, error) {
+	claims, err := m.ParseToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.revocations == nil {
+		return claims, nil
+	}
+
+	status, err := m.revocations.Status(ctx, claims.UserID, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("check token revocation: %w", err)
+	}
+	if status.UserExists && status.Disabled {
+		return nil, ErrAccountDisabled
+	}
+	if !status.UserExists || status.Denied || status.Version != claims.Version {
+		return nil, ErrTokenRevoked
 	}
 
 	return claims, nil
 }
+
+// JWKS returns the public keys other services can verify tokens with.
+func (m *Manager) JWKS() JWKS {
+	return m.keys.JWKS()
+}
+
+// Revoke denylists the token's jti until it would have expired anyway.
+func (m *Manager) Revoke(ctx context.Context, claims *Claims) error {
+	if m.revocations == nil || claims.ID == "" {
+		return nil
+	}
+
+	expiresAt := time.Now().Add(m.ttl)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	if err := m.revocations.Deny(ctx, claims.ID, expiresAt); err != nil {
+		return fmt.Errorf("deny token: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Manager) NewRefreshToken() (RefreshToken, error) {
+	raw, err := randomString(32)
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("generate refresh token: %w", err)
+	}
+
+	return RefreshToken{
+		Raw:       raw,
+		Hash:      HashToken(raw),
+		ExpiresAt: time.Now().Add(m.refreshTTL),
+	}, nil
+}
+
+// NewOpaqueToken returns a random URL-safe secret for single-use links such
+// as password resets, together with the hash to store.
+func NewOpaqueToken() (raw, hash string, err error) {
+	raw, err = randomString(32)
+	if err != nil {
+		return "", "", fmt.Errorf("generate token: %w", err)
+	}
+	return raw, HashToken(raw), nil
+}
+
+// HashToken hashes opaque tokens for storage; only the hash is persisted.
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeRevocationStore struct {
+	versions map[int64]int64
+	disabled map[int64]bool
+	denied   map[string]time.Time
+}
+
+func (s *fakeRevocationStore) Status(ctx context.Context, userID int64, jti string) (TokenStatus, error) {
+	version, ok := s.versions[userID]
+	if !ok {
+		return TokenStatus{}, nil
+	}
+	_, denied := s.denied[jti]
+	return TokenStatus{UserExists: true, Disabled: s.disabled[userID], Version: version, Denied: denied}, nil
+}
+
+func (s *fakeRevocationStore) Deny(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.denied[jti] = expiresAt
+	return nil
+}
+
+func TestManager_Verify(t *testing.T) {
+	store := &fakeRevocationStore{
+		versions: map[int64]int64{1: 0, 2: 3, 4: 0},
+		disabled: map[int64]bool{4: true},
+		denied:   map[string]time.Time{},
+	}
+	m := NewManager(NewHMACKeySet("secret"), time.Minute, time.Hour, store)
+	ctx := context.Background()
+
+	token, err := m.GenerateToken(1, "user", 0)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	claims, err := m.Verify(ctx, token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.ID == "" {
+		t.Fatalf("expected a jti")
+	}
+
+	if err := m.Revoke(ctx, claims); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := m.Verify(ctx, token); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected ErrTokenRevoked for denylisted jti, got %v", err)
+	}
+
+	stale, err := m.GenerateToken(2, "user", 2)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if _, err := m.Verify(ctx, stale); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected ErrTokenRevoked for old token version, got %v", err)
+	}
+
+	orphan, err := m.GenerateToken(3, "user", 0)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if _, err := m.Verify(ctx, orphan); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected ErrTokenRevoked for unknown user, got %v", err)
+	}
+
+	disabled, err := m.GenerateToken(4, "user", 0)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if _, err := m.Verify(ctx, disabled); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("expected ErrAccountDisabled for disabled user, got %v", err)
+	}
+
+	other := NewManager(NewHMACKeySet("other-secret"), time.Minute, time.Hour, store)
+	if _, err := other.Verify(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken for foreign signature, got %v", err)
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	m := NewManager(NewHMACKeySet("secret"), time.Minute, time.Hour, nil)
+
+	rt, err := m.NewRefreshToken()
+	if err != nil {
+		t.Fatalf("new refresh token: %v", err)
+	}
+	if rt.Raw == rt.Hash || HashToken(rt.Raw) != rt.Hash {
+		t.Fatalf("expected Hash to be the digest of Raw")
+	}
+	if !rt.ExpiresAt.After(time.Now().Add(59 * time.Minute)) {
+		t.Fatalf("expected refresh TTL to apply, got %v", rt.ExpiresAt)
+	}
+}
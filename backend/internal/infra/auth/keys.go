@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+	AlgHS256 = "HS256"
+)
+
+// KeyStatus controls what a key may be used for. Exactly one key in a set is
+// active; verify keys are either about to become active or were active
+// recently, and retired keys are ignored.
+type KeyStatus string
+
+const (
+	KeyActive  KeyStatus = "active"
+	KeyVerify  KeyStatus = "verify"
+	KeyRetired KeyStatus = "retired"
+)
+
+// KeySpec describes a key to load from PEM files. PublicKeyPath is only
+// needed for verify-only keys whose private half is no longer available.
+type KeySpec struct {
+	ID             string
+	Algorithm      string
+	Status         KeyStatus
+	PrivateKeyPath string
+	PublicKeyPath  string
+}
+
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	status  KeyStatus
+	private any
+	public  any
+}
+
+// KeySet holds the keys a Manager signs and verifies with.
+type KeySet struct {
+	active *signingKey
+	byID   map[string]*signingKey
+}
+
+// NewHMACKeySet returns a single-key HS256 set. Its key is never published.
+func NewHMACKeySet(secret string) *KeySet {
+	key := &signingKey{
+		method:  jwt.SigningMethodHS256,
+		status:  KeyActive,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+	return &KeySet{active: key, byID: map[string]*signingKey{}}
+}
+
+// LoadKeySet reads the asymmetric keys described by specs.
+func LoadKeySet(specs []KeySpec) (*KeySet, error) {
+	ks := &KeySet{byID: make(map[string]*signingKey, len(specs))}
+
+	for _, spec := range specs {
+		if spec.ID == "" {
+			return nil, errors.New("jwt key id is required")
+		}
+		if _, dup := ks.byID[spec.ID]; dup {
+			return nil, fmt.Errorf("duplicate jwt key id %q", spec.ID)
+		}
+		if spec.Status == KeyRetired {
+			continue
+		}
+
+		key, err := loadKey(spec)
+		if err != nil {
+			return nil, fmt.Errorf("load jwt key %q: %w", spec.ID, err)
+		}
+
+		if key.status == KeyActive {
+			if ks.active != nil {
+				return nil, fmt.Errorf("jwt keys %q and %q are both active", ks.active.id, key.id)
+			}
+			ks.active = key
+		}
+		ks.byID[key.id] = key
+	}
+
+	if ks.active == nil {
+		return nil, errors.New("no active jwt key")
+	}
+
+	return ks, nil
+}
+
+func loadKey(spec KeySpec) (*signingKey, error) {
+	key := &signingKey{id: spec.ID, status: spec.Status}
+
+	switch spec.Status {
+	case KeyActive, KeyVerify:
+	default:
+		return nil, fmt.Errorf("unknown status %q", spec.Status)
+	}
+
+	if spec.PrivateKeyPath == "" && (spec.Status == KeyActive || spec.PublicKeyPath == "") {
+		return nil, errors.New("private_key is required")
+	}
+
+	var privPEM, pubPEM []byte
+	if spec.PrivateKeyPath != "" {
+		b, err := os.ReadFile(spec.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("read private key: %w", err)
+		}
+		privPEM = b
+	} else {
+		b, err := os.ReadFile(spec.PublicKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("read public key: %w", err)
+		}
+		pubPEM = b
+	}
+
+	switch spec.Algorithm {
+	case AlgRS256:
+		key.method = jwt.SigningMethodRS256
+		if privPEM != nil {
+			priv, err := jwt.ParseRSAPrivateKeyFromPEM(privPEM)
+			if err != nil {
+				return nil, fmt.Errorf("parse RSA private key: %w", err)
+			}
+			key.private, key.public = priv, &priv.PublicKey
+		} else {
+			pub, err := jwt.ParseRSAPublicKeyFromPEM(pubPEM)
+			if err != nil {
+				return nil, fmt.Errorf("parse RSA public key: %w", err)
+			}
+			key.public = pub
+		}
+	case AlgEdDSA:
+		key.method = jwt.SigningMethodEdDSA
+		if privPEM != nil {
+			priv, err := jwt.ParseEdPrivateKeyFromPEM(privPEM)
+			if err != nil {
+				return nil, fmt.Errorf("parse Ed25519 private key: %w", err)
+			}
+			signer, ok := priv.(crypto.Signer)
+			if !ok {
+				return nil, errors.New("Ed25519 private key cannot sign")
+			}
+			key.private, key.public = priv, signer.Public()
+		} else {
+			pub, err := jwt.ParseEdPublicKeyFromPEM(pubPEM)
+			if err != nil {
+				return nil, fmt.Errorf("parse Ed25519 public key: %w", err)
+			}
+			key.public = pub
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q (want %s or %s)", spec.Algorithm, AlgRS256, AlgEdDSA)
+	}
+
+	return key, nil
+}
+
+// verificationKey picks the key for a parsed token by its kid header and
+// refuses tokens whose alg does not match that key.
+func (ks *KeySet) verificationKey(token *jwt.Token) (any, error) {
+	key := ks.active
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		key, ok = ks.byID[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+	}
+
+	return key.public, nil
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public halves of all non-retired asymmetric keys.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+
+	for _, key := range ks.byID {
+		jwk := JWK{KeyID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	slices.SortFunc(set.Keys, func(a, b JWK) int { return strings.Compare(a.KeyID, b.KeyID) })
+
+	return set
+}
@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+// testKeys writes an RSA and an Ed25519 key pair and returns their paths.
+func testKeys(t *testing.T) (rsaPriv, rsaPub, edPriv, edPub string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	rsaPriv = writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rk))
+	pubDER, err := x509.MarshalPKIXPublicKey(&rk.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal RSA public key: %v", err)
+	}
+	rsaPub = writePEM(t, dir, "rsa.pub.pem", "PUBLIC KEY", pubDER)
+
+	edPubKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatalf("marshal Ed25519 private key: %v", err)
+	}
+	edPriv = writePEM(t, dir, "ed.pem", "PRIVATE KEY", privDER)
+	pubDER, err = x509.MarshalPKIXPublicKey(edPubKey)
+	if err != nil {
+		t.Fatalf("marshal Ed25519 public key: %v", err)
+	}
+	edPub = writePEM(t, dir, "ed.pub.pem", "PUBLIC KEY", pubDER)
+
+	return rsaPriv, rsaPub, edPriv, edPub
+}
+
+func TestLoadKeySet_Validation(t *testing.T) {
+	rsaPriv, _, edPriv, _ := testKeys(t)
+
+	tests := []struct {
+		name  string
+		specs []KeySpec
+	}{
+		{name: "no keys", specs: nil},
+		{name: "no active key", specs: []KeySpec{{ID: "a", Algorithm: AlgRS256, Status: KeyVerify, PrivateKeyPath: rsaPriv}}},
+		{name: "two active keys", specs: []KeySpec{
+			{ID: "a", Algorithm: AlgRS256, Status: KeyActive, PrivateKeyPath: rsaPriv},
+			{ID: "b", Algorithm: AlgEdDSA, Status: KeyActive, PrivateKeyPath: edPriv},
+		}},
+		{name: "duplicate kid", specs: []KeySpec{
+			{ID: "a", Algorithm: AlgRS256, Status: KeyActive, PrivateKeyPath: rsaPriv},
+			{ID: "a", Algorithm: AlgEdDSA, Status: KeyVerify, PrivateKeyPath: edPriv},
+		}},
+		{name: "wrong algorithm for key", specs: []KeySpec{{ID: "a", Algorithm: AlgEdDSA, Status: KeyActive, PrivateKeyPath: rsaPriv}}},
+		{name: "unsupported algorithm", specs: []KeySpec{{ID: "a", Algorithm: "ES256", Status: KeyActive, PrivateKeyPath: rsaPriv}}},
+		{name: "missing file", specs: []KeySpec{{ID: "a", Algorithm: AlgRS256, Status: KeyActive, PrivateKeyPath: "/nonexistent.pem"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadKeySet(tt.specs); err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestManager_KeyRotation(t *testing.T) {
+	rsaPriv, rsaPub, edPriv, _ := testKeys(t)
+
+	// Before rotation: RS256 "old" signs.
+	before, err := LoadKeySet([]KeySpec{
+		{ID: "old", Algorithm: AlgRS256, Status: KeyActive, PrivateKeyPath: rsaPriv},
+	})
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	// After rotation: EdDSA "new" signs, "old" still verifies from its public key.
+	after, err := LoadKeySet([]KeySpec{
+		{ID: "new", Algorithm: AlgEdDSA, Status: KeyActive, PrivateKeyPath: edPriv},
+		{ID: "old", Algorithm: AlgRS256, Status: KeyVerify, PublicKeyPath: rsaPub},
+	})
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	// Finally "old" is retired.
+	retired, err := LoadKeySet([]KeySpec{
+		{ID: "new", Algorithm: AlgEdDSA, Status: KeyActive, PrivateKeyPath: edPriv},
+		{ID: "old", Algorithm: AlgRS256, Status: KeyRetired},
+	})
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+
+	oldToken, err := NewManager(before, time.Minute, time.Hour, nil).GenerateToken(1, "user", 0)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	m := NewManager(after, time.Minute, time.Hour, nil)
+	if _, err := m.ParseToken(oldToken); err != nil {
+		t.Fatalf("expected token from the previous key to verify, got %v", err)
+	}
+
+	newToken, err := m.GenerateToken(1, "user", 0)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if _, err := m.ParseToken(newToken); err != nil {
+		t.Fatalf("expected token from the active key to verify, got %v", err)
+	}
+
+	r := NewManager(retired, time.Minute, time.Hour, nil)
+	if _, err := r.ParseToken(oldToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected retired key to be rejected, got %v", err)
+	}
+
+	// An HS256 token must not verify against an asymmetric set.
+	hmacToken, err := NewManager(NewHMACKeySet("secret"), time.Minute, time.Hour, nil).GenerateToken(1, "admin", 0)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if _, err := m.ParseToken(hmacToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected HS256 token to be rejected, got %v", err)
+	}
+
+	jwks := m.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 published keys, got %+v", jwks.Keys)
+	}
+	if k := jwks.Keys[0]; k.KeyID != "new" || k.KeyType != "OKP" || k.Curve != "Ed25519" || k.X == "" {
+		t.Fatalf("unexpected Ed25519 JWK: %+v", k)
+	}
+	if k := jwks.Keys[1]; k.KeyID != "old" || k.KeyType != "RSA" || k.Algorithm != AlgRS256 || k.N == "" || k.E != "AQAB" {
+		t.Fatalf("unexpected RSA JWK: %+v", k)
+	}
+
+	if keys := NewManager(NewHMACKeySet("secret"), time.Minute, time.Hour, nil).JWKS().Keys; len(keys) != 0 {
+		t.Fatalf("expected HMAC secret to stay unpublished, got %+v", keys)
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TokenStatus is what Verify needs to know about a token's user and jti.
+type TokenStatus struct {
+	UserExists bool
+	Disabled   bool
+	Version    int64
+	Denied     bool
+}
+
+type RevocationStore interface {
+	Status(ctx context.Context, userID int64, jti string) (TokenStatus, error)
+	Deny(ctx context.Context, jti string, expiresAt time.Time) error
+}
+
+type postgresRevocationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresRevocationStore(db *sql.DB) RevocationStore {
+	return &postgresRevocationStore{db: db}
+}
+
+func (s *postgresRevocationStore) Status(ctx context.Context, userID int64, jti string) (TokenStatus, error) {
+	const query = `
+        SELECT u.token_version,
+               u.disabled_at IS NOT NULL,
+               EXISTS (SELECT 1 FROM revoked_tokens rt WHERE rt.jti = $2 AND rt.expires_at > NOW())
+        FROM users u
+        WHERE u.id = $1
+    `
+
+	status := TokenStatus{UserExists: true}
+	err := s.db.QueryRowContext(ctx, query, userID, jti).Scan(&status.Version, &status.Disabled, &status.Denied)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return TokenStatus{}, nil
+		}
+		return TokenStatus{}, fmt.Errorf("query token status: %w", err)
+	}
+
+	return status, nil
+}
+
+// Deny records the jti and prunes entries whose tokens have expired.
+func (s *postgresRevocationStore) Deny(ctx context.Context, jti string, expiresAt time.Time) error {
+	const query = `
+        INSERT INTO revoked_tokens (jti, expires_at)
+        VALUES ($1, $2)
+        ON CONFLICT (jti) DO NOTHING
+    `
+
+	if _, err := s.db.ExecContext(ctx, query, jti, expiresAt); err != nil {
+		return fmt.Errorf("insert revoked token: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("prune revoked tokens: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLinkSigner(t *testing.T) {
+	s := NewLinkSigner("secret")
+	token := s.Sign("verify_email", "42:user@example.com", time.Now().Add(time.Hour))
+
+	subject, err := s.Verify("verify_email", token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if subject != "42:user@example.com" {
+		t.Fatalf("subject = %q", subject)
+	}
+
+	tests := []struct {
+		name    string
+		signer  *LinkSigner
+		purpose string
+		token   string
+	}{
+		{name: "other purpose", signer: s, purpose: "reset_password", token: token},
+		{name: "other secret", signer: NewLinkSigner("other"), purpose: "verify_email", token: token},
+		{name: "tampered payload", signer: s, purpose: "verify_email", token: "x" + token},
+		{name: "malformed", signer: s, purpose: "verify_email", token: "garbage"},
+		{name: "expired", signer: s, purpose: "verify_email", token: s.Sign("verify_email", "42:user@example.com", time.Now().Add(-time.Second))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.signer.Verify(tt.purpose, tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
@@ -2,22 +2,209 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 const defaultConfigPath = "configs/config.yaml"
 
+// JWTKey references a PEM-encoded signing key. Status is active (signs and
+// verifies), verify (verifies only) or retired (ignored). Without any
+// JWTKeys tokens are signed with JWTSecret using HS256.
+type JWTKey struct {
+	ID             string `yaml:"kid"`
+	Algorithm      string `yaml:"alg"`
+	Status         string `yaml:"status"`
+	PrivateKeyPath string `yaml:"private_key"`
+	PublicKeyPath  string `yaml:"public_key"`
+}
+
+// RateLimitPolicy allows Requests per Period with bursts of up to Burst
+// (Requests when zero).
+type RateLimitPolicy struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Burst    int           `yaml:"burst"`
+}
+
 type Config struct {
-	ServerPort string `yaml:"server_port"`
-	DBDSN      string `yaml:"db_dsn"`
-	JWTSecret  string `yaml:"jwt_secret"`
+	ServerPort     string        `yaml:"server_port"`
+	DBDSN          string        `yaml:"db_dsn"`
+	JWTSecret      string        `yaml:"jwt_secret"`
+	JWTKeys        []JWTKey      `yaml:"jwt_keys"`
+	JWTTTL         time.Duration `yaml:"jwt_ttl"`
+	RefreshTTL     time.Duration `yaml:"refresh_ttl"`
+	WorkerPoolSize int           `yaml:"worker_pool_size"`
+
+	// MailDriver is log, file (writes .eml files to MailDir) or smtp.
+	MailDriver   string `yaml:"mail_driver"`
+	MailFrom     string `yaml:"mail_from"`
+	MailDir      string `yaml:"mail_dir"`
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password"`
+
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"`
+	PasswordResetURL string        `yaml:"password_reset_url"`
+
+	// EmailVerificationSecret signs verification links. It must differ from
+	// JWTSecret so a leak of one does not let an attacker forge the other.
+	EmailVerificationSecret string        `yaml:"email_verification_secret"`
+	EmailVerificationTTL    time.Duration `yaml:"email_verification_ttl"`
+	EmailVerificationURL    string        `yaml:"email_verification_url"`
+	// RequireVerifiedEmail blocks order placement and checkout until the
+	// user has verified their email. Browsing and login are unaffected.
+	RequireVerifiedEmail bool `yaml:"require_verified_email"`
+
+	// LoginTracker stores failed login attempts: postgres or memory (single
+	// instance only). Each failure delays the next attempt by
+	// LoginBackoffBase, doubling up to LoginBackoffMax; reaching the
+	// attempt limit within LoginWindow locks the account or client address
+	// for LoginLockoutDuration.
+	LoginTracker         string        `yaml:"login_tracker"`
+	LoginMaxAttempts     int           `yaml:"login_max_attempts"`
+	LoginIPMaxAttempts   int           `yaml:"login_ip_max_attempts"`
+	LoginWindow          time.Duration `yaml:"login_window"`
+	LoginLockoutDuration time.Duration `yaml:"login_lockout_duration"`
+	LoginBackoffBase     time.Duration `yaml:"login_backoff_base"`
+	LoginBackoffMax      time.Duration `yaml:"login_backoff_max"`
+
+	// RateLimits are keyed by route group: auth (public /auth routes),
+	// catalog (product and category reads) and default (everything else).
+	// Limits are kept in process memory, so they apply per instance.
+	RateLimitEnabled bool                       `yaml:"rate_limit_enabled"`
+	RateLimits       map[string]RateLimitPolicy `yaml:"rate_limits"`
+
+	// TrustedProxies lists the addresses or CIDR ranges of reverse proxies
+	// allowed to report the client address in X-Forwarded-For. With none,
+	// the client address is the connection's peer, so rate limits and login
+	// lockouts cannot be dodged with a forged header.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// IdempotencyTTL is how long responses to requests with an
+	// Idempotency-Key are kept for replay. A request still in flight after
+	// IdempotencyLockTimeout is assumed to have crashed and its key may be
+	// taken over by a retry.
+	IdempotencyTTL         time.Duration `yaml:"idempotency_ttl"`
+	IdempotencyLockTimeout time.Duration `yaml:"idempotency_lock_timeout"`
+
+	// PaymentProvider selects the gateway; only fake (deterministic,
+	// offline) is available. PaymentWebhookSecret is shared with the
+	// provider to sign webhooks.
+	PaymentProvider      string `yaml:"payment_provider"`
+	PaymentCurrency      string `yaml:"payment_currency"`
+	PaymentWebhookSecret string `yaml:"payment_webhook_secret"`
+
+	// Pending orders older than PendingOrderTTL are cancelled and their
+	// stock released; the sweep runs every OrderExpiryInterval.
+	OrderExpiryEnabled   bool          `yaml:"order_expiry_enabled"`
+	PendingOrderTTL      time.Duration `yaml:"pending_order_ttl"`
+	OrderExpiryInterval  time.Duration `yaml:"order_expiry_interval"`
+	OrderExpiryBatchSize int           `yaml:"order_expiry_batch_size"`
+
+	// Domain events are written to the outbox table and relayed to
+	// OutboxSink: log, or http (POST to OutboxHTTPURL). Failed deliveries
+	// are retried with exponential backoff from OutboxBackoffBase up to
+	// OutboxBackoffMax; after OutboxMaxAttempts the event is dead-lettered.
+	// OutboxLease is how long a claimed batch is hidden from other relays.
+	OutboxSink          string        `yaml:"outbox_sink"`
+	OutboxHTTPURL       string        `yaml:"outbox_http_url"`
+	OutboxHTTPTimeout   time.Duration `yaml:"outbox_http_timeout"`
+	OutboxRelayInterval time.Duration `yaml:"outbox_relay_interval"`
+	OutboxBatchSize     int           `yaml:"outbox_batch_size"`
+	OutboxLease         time.Duration `yaml:"outbox_lease"`
+	OutboxMaxAttempts   int           `yaml:"outbox_max_attempts"`
+	OutboxBackoffBase   time.Duration `yaml:"outbox_backoff_base"`
+	OutboxBackoffMax    time.Duration `yaml:"outbox_backoff_max"`
+
+	// LowStockThreshold emits product.stock_low when an order leaves a
+	// product with this many units or fewer; 0 disables the event.
+	LowStockThreshold int `yaml:"low_stock_threshold"`
+
+	// Merchant webhooks are sent from their own pool of WebhookWorkers, so
+	// slow receivers cannot hold up mail sent from the shared worker pool.
+	// A failed attempt is retried with exponential backoff from WebhookBackoffBase up to
+	// WebhookBackoffMax, WebhookMaxAttempts times in all; a subscription is
+	// disabled after WebhookDisableAfter failed attempts in a row.
+	WebhookWorkers      int           `yaml:"webhook_workers"`
+	WebhookTimeout      time.Duration `yaml:"webhook_timeout"`
+	WebhookPollInterval time.Duration `yaml:"webhook_poll_interval"`
+	WebhookBatchSize    int           `yaml:"webhook_batch_size"`
+	WebhookMaxAttempts  int           `yaml:"webhook_max_attempts"`
+	WebhookBackoffBase  time.Duration `yaml:"webhook_backoff_base"`
+	WebhookBackoffMax   time.Duration `yaml:"webhook_backoff_max"`
+	WebhookDisableAfter int           `yaml:"webhook_disable_after"`
 }
 
 func defaultConfig() *Config {
 	return &Config{
-		ServerPort: "8080",
+		ServerPort:     "8080",
+		JWTTTL:         15 * time.Minute,
+		RefreshTTL:     30 * 24 * time.Hour,
+		WorkerPoolSize: 5,
+
+		MailDriver: "log",
+		MailFrom:   "no-reply@go-shop.local",
+		MailDir:    "tmp/mail",
+		SMTPPort:   "587",
+
+		PasswordResetTTL: time.Hour,
+		PasswordResetURL: "http://localhost:3000/reset-password",
+
+		EmailVerificationTTL: 72 * time.Hour,
+		EmailVerificationURL: "http://localhost:8080/api/v1/auth/verify",
+
+		LoginTracker:         "postgres",
+		LoginMaxAttempts:     5,
+		LoginIPMaxAttempts:   50,
+		LoginWindow:          15 * time.Minute,
+		LoginLockoutDuration: 15 * time.Minute,
+		LoginBackoffBase:     time.Second,
+		LoginBackoffMax:      30 * time.Second,
+
+		RateLimitEnabled: true,
+		RateLimits: map[string]RateLimitPolicy{
+			"auth":    {Requests: 20, Period: time.Minute, Burst: 10},
+			"catalog": {Requests: 600, Period: time.Minute, Burst: 100},
+			"default": {Requests: 120, Period: time.Minute, Burst: 60},
+		},
+
+		IdempotencyTTL:         24 * time.Hour,
+		IdempotencyLockTimeout: time.Minute,
+
+		PaymentProvider: "fake",
+		PaymentCurrency: "usd",
+
+		OrderExpiryEnabled:   true,
+		PendingOrderTTL:      30 * time.Minute,
+		OrderExpiryInterval:  time.Minute,
+		OrderExpiryBatchSize: 100,
+
+		OutboxSink:          "log",
+		OutboxHTTPTimeout:   10 * time.Second,
+		OutboxRelayInterval: time.Second,
+		OutboxBatchSize:     100,
+		OutboxLease:         20 * time.Minute,
+		OutboxMaxAttempts:   10,
+		OutboxBackoffBase:   5 * time.Second,
+		OutboxBackoffMax:    time.Hour,
+
+		LowStockThreshold: 5,
+
+		WebhookWorkers:      5,
+		WebhookTimeout:      10 * time.Second,
+		WebhookPollInterval: time.Second,
+		WebhookBatchSize:    50,
+		WebhookMaxAttempts:  8,
+		WebhookBackoffBase:  30 * time.Second,
+		WebhookBackoffMax:   6 * time.Hour,
+		WebhookDisableAfter: 20,
 	}
 }
 
@@ -53,12 +240,264 @@ func Load() (*Config, error) {
 	if v := os.Getenv("JWT_SECRET"); v != "" {
 		cfg.JWTSecret = v
 	}
+	if v := os.Getenv("JWT_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("parse JWT_TTL: %w", err)
+		}
+		cfg.JWTTTL = d
+	}
+	if v := os.Getenv("REFRESH_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("parse REFRESH_TTL: %w", err)
+		}
+		cfg.RefreshTTL = d
+	}
+	if v := os.Getenv("WORKER_POOL_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("parse WORKER_POOL_SIZE: %w", err)
+		}
+		cfg.WorkerPoolSize = n
+	}
+
+	for env, dst := range map[string]*string{
+		"MAIL_DRIVER":        &cfg.MailDriver,
+		"MAIL_FROM":          &cfg.MailFrom,
+		"MAIL_DIR":           &cfg.MailDir,
+		"SMTP_HOST":          &cfg.SMTPHost,
+		"SMTP_PORT":          &cfg.SMTPPort,
+		"SMTP_USERNAME":      &cfg.SMTPUsername,
+		"SMTP_PASSWORD":      &cfg.SMTPPassword,
+		"PASSWORD_RESET_URL": &cfg.PasswordResetURL,
+
+		"EMAIL_VERIFICATION_SECRET": &cfg.EmailVerificationSecret,
+		"EMAIL_VERIFICATION_URL":    &cfg.EmailVerificationURL,
+		"LOGIN_TRACKER":             &cfg.LoginTracker,
+		"PAYMENT_PROVIDER":          &cfg.PaymentProvider,
+		"PAYMENT_CURRENCY":          &cfg.PaymentCurrency,
+		"PAYMENT_WEBHOOK_SECRET":    &cfg.PaymentWebhookSecret,
+		"OUTBOX_SINK":               &cfg.OutboxSink,
+		"OUTBOX_HTTP_URL":           &cfg.OutboxHTTPURL,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*dst = v
+		}
+	}
+	if v := os.Getenv("PASSWORD_RESET_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("parse PASSWORD_RESET_TTL: %w", err)
+		}
+		cfg.PasswordResetTTL = d
+	}
+	if v := os.Getenv("EMAIL_VERIFICATION_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("parse EMAIL_VERIFICATION_TTL: %w", err)
+		}
+		cfg.EmailVerificationTTL = d
+	}
+	if v := os.Getenv("REQUIRE_VERIFIED_EMAIL"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("parse REQUIRE_VERIFIED_EMAIL: %w", err)
+		}
+		cfg.RequireVerifiedEmail = b
+	}
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		cfg.TrustedProxies = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				cfg.TrustedProxies = append(cfg.TrustedProxies, p)
+			}
+		}
+	}
+	if v := os.Getenv("RATE_LIMIT_ENABLED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("parse RATE_LIMIT_ENABLED: %w", err)
+		}
+		cfg.RateLimitEnabled = b
+	}
+	if v := os.Getenv("ORDER_EXPIRY_ENABLED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("parse ORDER_EXPIRY_ENABLED: %w", err)
+		}
+		cfg.OrderExpiryEnabled = b
+	}
+	for env, dst := range map[string]*int{
+		"LOGIN_MAX_ATTEMPTS":    &cfg.LoginMaxAttempts,
+		"LOGIN_IP_MAX_ATTEMPTS": &cfg.LoginIPMaxAttempts,
+
+		"ORDER_EXPIRY_BATCH_SIZE": &cfg.OrderExpiryBatchSize,
+		"OUTBOX_BATCH_SIZE":       &cfg.OutboxBatchSize,
+		"OUTBOX_MAX_ATTEMPTS":     &cfg.OutboxMaxAttempts,
+		"LOW_STOCK_THRESHOLD":     &cfg.LowStockThreshold,
+		"WEBHOOK_WORKERS":         &cfg.WebhookWorkers,
+		"WEBHOOK_BATCH_SIZE":      &cfg.WebhookBatchSize,
+		"WEBHOOK_MAX_ATTEMPTS":    &cfg.WebhookMaxAttempts,
+		"WEBHOOK_DISABLE_AFTER":   &cfg.WebhookDisableAfter,
+	} {
+		if v := os.Getenv(env); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", env, err)
+			}
+			*dst = n
+		}
+	}
+	for env, dst := range map[string]*time.Duration{
+		"LOGIN_WINDOW":             &cfg.LoginWindow,
+		"LOGIN_LOCKOUT_DURATION":   &cfg.LoginLockoutDuration,
+		"LOGIN_BACKOFF_BASE":       &cfg.LoginBackoffBase,
+		"LOGIN_BACKOFF_MAX":        &cfg.LoginBackoffMax,
+		"IDEMPOTENCY_TTL":          &cfg.IdempotencyTTL,
+		"IDEMPOTENCY_LOCK_TIMEOUT": &cfg.IdempotencyLockTimeout,
+		"PENDING_ORDER_TTL":        &cfg.PendingOrderTTL,
+		"ORDER_EXPIRY_INTERVAL":    &cfg.OrderExpiryInterval,
+		"OUTBOX_HTTP_TIMEOUT":      &cfg.OutboxHTTPTimeout,
+		"OUTBOX_RELAY_INTERVAL":    &cfg.OutboxRelayInterval,
+		"OUTBOX_LEASE":             &cfg.OutboxLease,
+		"OUTBOX_BACKOFF_BASE":      &cfg.OutboxBackoffBase,
+		"OUTBOX_BACKOFF_MAX":       &cfg.OutboxBackoffMax,
+		"WEBHOOK_TIMEOUT":          &cfg.WebhookTimeout,
+		"WEBHOOK_POLL_INTERVAL":    &cfg.WebhookPollInterval,
+		"WEBHOOK_BACKOFF_BASE":     &cfg.WebhookBackoffBase,
+		"WEBHOOK_BACKOFF_MAX":      &cfg.WebhookBackoffMax,
+	} {
+		if v := os.Getenv(env); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", env, err)
+			}
+			*dst = d
+		}
+	}
 
 	if cfg.DBDSN == "" {
 		return nil, fmt.Errorf("DB_DSN is required (env or config file)")
 	}
-	if cfg.JWTSecret == "" {
-		return nil, fmt.Errorf("JWT_SECRET is required (env or config file)")
+	if cfg.JWTSecret == "" && len(cfg.JWTKeys) == 0 {
+		return nil, fmt.Errorf("JWT_SECRET or jwt_keys is required (env or config file)")
+	}
+	if cfg.JWTTTL <= 0 {
+		return nil, fmt.Errorf("JWT_TTL must be positive")
+	}
+	if cfg.RefreshTTL <= cfg.JWTTTL {
+		return nil, fmt.Errorf("REFRESH_TTL must be longer than JWT_TTL")
+	}
+	if cfg.WorkerPoolSize <= 0 {
+		return nil, fmt.Errorf("WORKER_POOL_SIZE must be positive")
+	}
+	switch cfg.MailDriver {
+	case "log", "file":
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required when MAIL_DRIVER is smtp")
+		}
+	default:
+		return nil, fmt.Errorf("MAIL_DRIVER must be one of log, file, smtp")
+	}
+	if cfg.PasswordResetTTL <= 0 {
+		return nil, fmt.Errorf("PASSWORD_RESET_TTL must be positive")
+	}
+	if cfg.EmailVerificationSecret == "" {
+		return nil, fmt.Errorf("EMAIL_VERIFICATION_SECRET is required (env or config file)")
+	}
+	if cfg.EmailVerificationSecret == cfg.JWTSecret {
+		return nil, fmt.Errorf("EMAIL_VERIFICATION_SECRET must differ from JWT_SECRET")
+	}
+	if cfg.EmailVerificationTTL <= 0 {
+		return nil, fmt.Errorf("EMAIL_VERIFICATION_TTL must be positive")
+	}
+	if cfg.LoginTracker != "postgres" && cfg.LoginTracker != "memory" {
+		return nil, fmt.Errorf("LOGIN_TRACKER must be one of postgres, memory")
+	}
+	if cfg.LoginMaxAttempts <= 0 || cfg.LoginIPMaxAttempts <= 0 {
+		return nil, fmt.Errorf("LOGIN_MAX_ATTEMPTS and LOGIN_IP_MAX_ATTEMPTS must be positive")
+	}
+	if cfg.LoginWindow <= 0 || cfg.LoginLockoutDuration <= 0 {
+		return nil, fmt.Errorf("LOGIN_WINDOW and LOGIN_LOCKOUT_DURATION must be positive")
+	}
+	if cfg.LoginBackoffBase < 0 || cfg.LoginBackoffMax < cfg.LoginBackoffBase {
+		return nil, fmt.Errorf("LOGIN_BACKOFF_MAX must not be less than LOGIN_BACKOFF_BASE")
+	}
+	if cfg.IdempotencyTTL <= 0 || cfg.IdempotencyLockTimeout <= 0 {
+		return nil, fmt.Errorf("IDEMPOTENCY_TTL and IDEMPOTENCY_LOCK_TIMEOUT must be positive")
+	}
+	if cfg.PaymentProvider != "fake" {
+		return nil, fmt.Errorf("PAYMENT_PROVIDER must be fake")
+	}
+	if cfg.PaymentCurrency == "" {
+		return nil, fmt.Errorf("PAYMENT_CURRENCY is required")
+	}
+	if cfg.PaymentWebhookSecret == "" {
+		return nil, fmt.Errorf("PAYMENT_WEBHOOK_SECRET is required (env or config file)")
+	}
+	if cfg.OrderExpiryEnabled {
+		if cfg.PendingOrderTTL <= 0 || cfg.OrderExpiryInterval <= 0 {
+			return nil, fmt.Errorf("PENDING_ORDER_TTL and ORDER_EXPIRY_INTERVAL must be positive")
+		}
+		if cfg.OrderExpiryBatchSize <= 0 {
+			return nil, fmt.Errorf("ORDER_EXPIRY_BATCH_SIZE must be positive")
+		}
+	}
+	switch cfg.OutboxSink {
+	case "log":
+	case "http":
+		if cfg.OutboxHTTPURL == "" {
+			return nil, fmt.Errorf("OUTBOX_HTTP_URL is required when OUTBOX_SINK is http")
+		}
+		if cfg.OutboxHTTPTimeout <= 0 {
+			return nil, fmt.Errorf("OUTBOX_HTTP_TIMEOUT must be positive")
+		}
+	default:
+		return nil, fmt.Errorf("OUTBOX_SINK must be one of log, http")
+	}
+	if cfg.OutboxRelayInterval <= 0 || cfg.OutboxBatchSize <= 0 || cfg.OutboxMaxAttempts <= 0 {
+		return nil, fmt.Errorf("OUTBOX_RELAY_INTERVAL, OUTBOX_BATCH_SIZE and OUTBOX_MAX_ATTEMPTS must be positive")
+	}
+	if cfg.OutboxLease <= 0 {
+		return nil, fmt.Errorf("OUTBOX_LEASE must be positive")
+	}
+	// A batch is delivered one event at a time, so its lease has to outlast
+	// every request in it timing out; otherwise another relay may claim the
+	// rest of the batch and deliver it twice.
+	if batch := time.Duration(cfg.OutboxBatchSize) * cfg.OutboxHTTPTimeout; cfg.OutboxSink == "http" && cfg.OutboxLease <= batch {
+		return nil, fmt.Errorf("OUTBOX_LEASE must exceed OUTBOX_BATCH_SIZE * OUTBOX_HTTP_TIMEOUT (%s)", batch)
+	}
+	if cfg.OutboxBackoffBase <= 0 || cfg.OutboxBackoffMax < cfg.OutboxBackoffBase {
+		return nil, fmt.Errorf("OUTBOX_BACKOFF_MAX must not be less than a positive OUTBOX_BACKOFF_BASE")
+	}
+	if cfg.LowStockThreshold < 0 {
+		return nil, fmt.Errorf("LOW_STOCK_THRESHOLD cannot be negative")
+	}
+	if cfg.WebhookWorkers <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_WORKERS must be positive")
+	}
+	if cfg.WebhookTimeout <= 0 || cfg.WebhookPollInterval <= 0 || cfg.WebhookBatchSize <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_TIMEOUT, WEBHOOK_POLL_INTERVAL and WEBHOOK_BATCH_SIZE must be positive")
+	}
+	if cfg.WebhookMaxAttempts <= 0 || cfg.WebhookDisableAfter <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS and WEBHOOK_DISABLE_AFTER must be positive")
+	}
+	if cfg.WebhookBackoffBase <= 0 || cfg.WebhookBackoffMax < cfg.WebhookBackoffBase {
+		return nil, fmt.Errorf("WEBHOOK_BACKOFF_MAX must not be less than a positive WEBHOOK_BACKOFF_BASE")
+	}
+	for _, p := range cfg.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				return nil, fmt.Errorf("trusted_proxies: %q is not an IP address or CIDR range", p)
+			}
+		}
+	}
+	for name, p := range cfg.RateLimits {
+		if p.Requests <= 0 || p.Period <= 0 || p.Burst < 0 {
+			return nil, fmt.Errorf("rate_limits.%s: requests and period must be positive", name)
+		}
 	}
 
 	return cfg, nil
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/infra/auth"
+)
+
+const (
+	ctxUserIDKey   = "userID"
+	ctxUserRoleKey = "userRole"
+	ctxClaimsKey   = "authClaims"
+)
+
+func AuthMiddleware(jwtManager *auth.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "missing_authorization_header",
+				"message": "Authorization header is required",
+			})
+			c.Abort()
+			return
+		}
+
+		if !authenticate(c, jwtManager, authHeader) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// OptionalAuth authenticates the request when an Authorization header is
+// present and lets anonymous requests through. A malformed or invalid token
+// is still rejected.
+func OptionalAuth(jwtManager *auth.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader != "" && !authenticate(c, jwtManager, authHeader) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authenticate stores the token's claims in the context, or writes a 401 and
+// aborts (403 for disabled accounts).
+func authenticate(c *gin.Context, jwtManager *auth.Manager, authHeader string) bool {
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "invalid_authorization_header",
+			"message": "Authorization header must be in format: Bearer <token>",
+		})
+		c.Abort()
+		return false
+	}
+
+	tokenStr := strings.TrimSpace(parts[1])
+	if tokenStr == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "empty_token",
+			"message": "Bearer token is empty",
+		})
+		c.Abort()
+		return false
+	}
+
+	claims, err := jwtManager.Verify(c.Request.Context(), tokenStr)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrAccountDisabled):
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "account_disabled",
+				"message": err.Error(),
+			})
+		case errors.Is(err, auth.ErrTokenRevoked):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "token_revoked",
+				"message": err.Error(),
+			})
+		case errors.Is(err, auth.ErrInvalidToken):
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "invalid_token",
+				"message": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "failed_to_authenticate",
+				"message": err.Error(),
+			})
+		}
+		c.Abort()
+		return false
+	}
+
+	c.Set(ctxUserIDKey, claims.UserID)
+	c.Set(ctxUserRoleKey, claims.Role)
+	c.Set(ctxClaimsKey, claims)
+
+	return true
+}
+
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roleVal, ok := c.Get(ctxUserRoleKey)
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "forbidden",
+				"message": "user role not found in context",
+			})
+			c.Abort()
+			return
+		}
+
+		role, _ := roleVal.(string)
+		if role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "forbidden",
+				"message": "admin access required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func GetUserID(c *gin.Context) (int64, bool) {
+	val, ok := c.Get(ctxUserIDKey)
+	if !ok {
+		return 0, false
+	}
+
+	id, ok := val.(int64)
+	if !ok {
+		return 0, false
+	}
+
+	return id, true
+}
+
+func GetUserRole(c *gin.Context) (string, bool) {
+	val, ok := c.Get(ctxUserRoleKey)
+	if !ok {
+		return "", false
+	}
+
+	role, ok := val.(string)
+	if !ok {
+		return "", false
+	}
+
+	return role, true
+}
+
+// GetClaims returns the verified access token claims, e.g. for logout.
+func GetClaims(c *gin.Context) (*auth.Claims, bool) {
+	val, ok := c.Get(ctxClaimsKey)
+	if !ok {
+		return nil, false
+	}
+
+	claims, ok := val.(*auth.Claims)
+	return claims, ok
+}
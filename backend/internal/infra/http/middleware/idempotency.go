@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/infra/idempotency"
+	"go-shop-app-backend/pkg/logger"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency replays the stored response when a signed-in user repeats a
+// request with the same Idempotency-Key. Reusing a key for a different
+// request gets 422 and a retry while the first request is still running
+// gets 409. Server errors are not stored, so they can be retried. Requests
+// without the header or without a user pass through. A key still in flight
+// after lockTimeout is assumed abandoned by a crashed request and may be
+// taken over; the request that lost it can then neither store nor release it.
+func Idempotency(store idempotency.Store, ttl, lockTimeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		userID, ok := GetUserID(c)
+		if key == "" || !ok {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_idempotency_key",
+				"message": "Idempotency-Key must be at most 255 characters",
+			})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_request_body",
+				"message": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		ctx := c.Request.Context()
+		now := time.Now()
+		rec, token, err := store.Acquire(ctx, userID, key, requestHash, now, now.Add(ttl), now.Add(-lockTimeout))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "failed_to_check_idempotency_key",
+				"message": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		if rec != nil {
+			switch {
+			case rec.RequestHash != requestHash:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{
+					"error":   "idempotency_key_reused",
+					"message": "Idempotency-Key was already used for a different request",
+				})
+			case !rec.Completed:
+				c.Header("Retry-After", "1")
+				c.JSON(http.StatusConflict, gin.H{
+					"error":   "idempotency_key_in_flight",
+					"message": "a request with this Idempotency-Key is still being processed",
+				})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(rec.StatusCode, rec.ContentType, rec.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		// The outcome is saved even if the client has gone away.
+		saveCtx := context.WithoutCancel(ctx)
+		keep := false
+		defer func() {
+			if keep {
+				return
+			}
+			if err := store.Release(saveCtx, userID, key, token); err != nil {
+				logger.Error("failed to release idempotency key", "user_id", userID, "error", err)
+			}
+		}()
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+
+		// If the response cannot be stored the key stays locked until the
+		// lock times out rather than allowing an immediate duplicate.
+		keep = true
+		err = store.Complete(saveCtx, userID, key, token, status, c.Writer.Header().Get("Content-Type"), recorder.body.Bytes())
+		if err != nil {
+			logger.Error("failed to store idempotent response", "user_id", userID, "error", err)
+		}
+	}
+}
+
+// bodyRecorder keeps a copy of the response body.
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
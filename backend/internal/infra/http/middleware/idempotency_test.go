@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/infra/idempotency"
+)
+
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*idempotency.Record
+}
+
+func (s *memoryIdempotencyStore) id(userID int64, key string) string {
+	return strconv.FormatInt(userID, 10) + ":" + key
+}
+
+func (s *memoryIdempotencyStore) Acquire(ctx context.Context, userID int64, key, requestHash string, now, expiresAt, staleBefore time.Time) (*idempotency.Record, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.records[s.id(userID, key)]; ok {
+		copied := *rec
+		return &copied, "", nil
+	}
+	s.records[s.id(userID, key)] = &idempotency.Record{RequestHash: requestHash}
+	return nil, "token", nil
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, userID int64, key, token string, statusCode int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := s.records[s.id(userID, key)]
+	rec.Completed = true
+	rec.StatusCode = statusCode
+	rec.ContentType = contentType
+	rec.Body = body
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, userID int64, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, s.id(userID, key))
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := &memoryIdempotencyStore{records: make(map[string]*idempotency.Record)}
+	var calls atomic.Int32
+	entered := make(chan struct{})
+	release := make(chan struct{})
+
+	r := gin.New()
+	r.POST("/orders", func(c *gin.Context) {
+		if userID := c.GetHeader("X-Test-User"); userID != "" {
+			id, _ := strconv.ParseInt(userID, 10, 64)
+			c.Set(ctxUserIDKey, id)
+		}
+	}, Idempotency(store, time.Hour, time.Minute), func(c *gin.Context) {
+		n := calls.Add(1)
+		body := make([]byte, 16)
+		size, _ := c.Request.Body.Read(body)
+
+		switch string(body[:size]) {
+		case "fail":
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "boom"})
+		case "slow":
+			entered <- struct{}{}
+			<-release
+			c.JSON(http.StatusCreated, gin.H{"call": n})
+		default:
+			c.JSON(http.StatusCreated, gin.H{"call": n})
+		}
+	})
+
+	do := func(user, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		if user != "" {
+			req.Header.Set("X-Test-User", user)
+		}
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("replays stored response", func(t *testing.T) {
+		calls.Store(0)
+		first := do("1", "replay", "order")
+		second := do("1", "replay", "order")
+
+		if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+			t.Fatalf("status = %d, %d, want %d", first.Code, second.Code, http.StatusCreated)
+		}
+		if second.Body.String() != first.Body.String() {
+			t.Fatalf("replayed body = %s, want %s", second.Body.String(), first.Body.String())
+		}
+		if second.Header().Get("Idempotent-Replayed") != "true" {
+			t.Fatalf("expected replay header")
+		}
+		if calls.Load() != 1 {
+			t.Fatalf("handler ran %d times, want 1", calls.Load())
+		}
+	})
+
+	t.Run("different body", func(t *testing.T) {
+		do("1", "mismatch", "order")
+		if rec := do("1", "mismatch", "other"); rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+		}
+	})
+
+	t.Run("keys are scoped to the user", func(t *testing.T) {
+		calls.Store(0)
+		do("1", "shared", "order")
+		if rec := do("2", "shared", "other"); rec.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusCreated)
+		}
+		if calls.Load() != 2 {
+			t.Fatalf("handler ran %d times, want 2", calls.Load())
+		}
+	})
+
+	t.Run("server errors are not stored", func(t *testing.T) {
+		calls.Store(0)
+		do("1", "fail", "fail")
+		if rec := do("1", "fail", "fail"); rec.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+		}
+		if calls.Load() != 2 {
+			t.Fatalf("handler ran %d times, want 2", calls.Load())
+		}
+	})
+
+	t.Run("concurrent request", func(t *testing.T) {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- do("1", "slow", "slow") }()
+		<-entered
+
+		rec := do("1", "slow", "slow")
+		close(release)
+		first := <-done
+
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusConflict)
+		}
+		if first.Code != http.StatusCreated {
+			t.Fatalf("first status = %d, want %d", first.Code, http.StatusCreated)
+		}
+	})
+
+	t.Run("without key or user", func(t *testing.T) {
+		calls.Store(0)
+		do("1", "", "order")
+		do("1", "", "order")
+		do("", "anonymous", "order")
+		do("", "anonymous", "order")
+		if calls.Load() != 4 {
+			t.Fatalf("handler ran %d times, want 4", calls.Load())
+		}
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		if rec := do("1", strings.Repeat("k", 256), "order"); rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+	})
+}
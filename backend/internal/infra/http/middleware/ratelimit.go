@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/infra/ratelimit"
+	"go-shop-app-backend/pkg/logger"
+)
+
+// RateLimit throttles requests with the named policy. Requests are keyed by
+// user ID when an earlier middleware authenticated them, otherwise by client
+// IP. Store errors let the request through.
+func RateLimit(store ratelimit.Store, name string, policy ratelimit.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := name + ":ip:" + c.ClientIP()
+		if userID, ok := GetUserID(c); ok {
+			key = name + ":user:" + strconv.FormatInt(userID, 10)
+		}
+
+		res, err := store.Take(c.Request.Context(), key, policy, time.Now())
+		if err != nil {
+			logger.Warn("rate limit store failed", "key", key, "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":   "rate_limited",
+				"message": "too many requests, slow down",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
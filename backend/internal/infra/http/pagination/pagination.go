@@ -0,0 +1,156 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Cursor is a keyset position on (created_at, id). Lists that support it
+// return rows strictly after the cursor in (created_at DESC, id DESC) order.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	ts, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errors.New("invalid cursor")
+	}
+
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	cursorID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || cursorID <= 0 {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return &Cursor{CreatedAt: time.Unix(0, nanos).UTC(), ID: cursorID}, nil
+}
+
+// Params selects a page either by number (OFFSET) or, when Cursor is set,
+// by keyset.
+type Params struct {
+	Page   int
+	Limit  int
+	Cursor *Cursor
+}
+
+func (p Params) WithDefaults() Params {
+	if p.Page <= 0 {
+		p.Page = 1
+	}
+	if p.Limit <= 0 {
+		p.Limit = DefaultLimit
+	}
+	return p
+}
+
+func (p Params) Validate() error {
+	if p.Limit > MaxLimit {
+		return fmt.Errorf("limit must be less than or equal to %d", MaxLimit)
+	}
+	if p.Cursor != nil && p.Page > 1 {
+		return errors.New("page and cursor cannot be combined")
+	}
+	return nil
+}
+
+func (p Params) Offset() int {
+	if p.Cursor != nil || p.Page <= 1 {
+		return 0
+	}
+	return (p.Page - 1) * p.Limit
+}
+
+// Page is the list envelope shared by every paginated endpoint.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewPage builds the envelope. cursorOf may be nil for lists that are not
+// ordered by (created_at, id); otherwise a full page carries a next cursor.
+func NewPage[T any](items []T, total int64, p Params, cursorOf func(T) Cursor) *Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+
+	page := &Page[T]{
+		Items: items,
+		Total: total,
+		Limit: p.Limit,
+	}
+	if p.Cursor == nil {
+		page.Page = p.Page
+	}
+
+	if cursorOf != nil && len(items) > 0 && len(items) == p.Limit {
+		page.NextCursor = cursorOf(items[len(items)-1]).Encode()
+	}
+
+	return page
+}
+
+// Parse reads page, limit and cursor from the query string.
+func Parse(c *gin.Context) (Params, error) {
+	var p Params
+
+	if raw := c.Query("page"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			return Params{}, errors.New("page must be a positive integer")
+		}
+		p.Page = v
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			return Params{}, errors.New("limit must be a positive integer")
+		}
+		p.Limit = v
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := DecodeCursor(raw)
+		if err != nil {
+			return Params{}, err
+		}
+		p.Cursor = cursor
+	}
+
+	p = p.WithDefaults()
+	if err := p.Validate(); err != nil {
+		return Params{}, err
+	}
+
+	return p, nil
+}
@@ -0,0 +1,87 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	want := Cursor{CreatedAt: time.Date(2024, 3, 4, 5, 6, 7, 890, time.UTC), ID: 42}
+
+	got, err := DecodeCursor(want.Encode())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.ID != want.ID || !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	for _, raw := range []string{"", "!!!", "MTIz", "YWJjOjE"} {
+		if _, err := DecodeCursor(raw); err == nil {
+			t.Fatalf("expected error decoding %q", raw)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantErr   bool
+		wantPage  int
+		wantLimit int
+	}{
+		{name: "defaults", query: "", wantPage: 1, wantLimit: DefaultLimit},
+		{name: "explicit", query: "page=3&limit=50", wantPage: 3, wantLimit: 50},
+		{name: "zero page", query: "page=0", wantErr: true},
+		{name: "limit too big", query: "limit=101", wantErr: true},
+		{name: "bad cursor", query: "cursor=nope", wantErr: true},
+		{name: "page with cursor", query: "page=2&cursor=" + Cursor{CreatedAt: time.Now(), ID: 1}.Encode(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/?"+tt.query, nil)
+
+			p, err := Parse(c)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if p.Page != tt.wantPage || p.Limit != tt.wantLimit {
+				t.Fatalf("got page=%d limit=%d, want page=%d limit=%d", p.Page, p.Limit, tt.wantPage, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	type item struct{ id int64 }
+	cursorOf := func(i item) Cursor { return Cursor{ID: i.id} }
+
+	full := NewPage([]item{{1}, {2}}, 5, Params{Page: 1, Limit: 2}, cursorOf)
+	if full.NextCursor == "" || full.Page != 1 || full.Total != 5 {
+		t.Fatalf("unexpected full page: %+v", full)
+	}
+
+	partial := NewPage([]item{{1}}, 1, Params{Page: 1, Limit: 2}, cursorOf)
+	if partial.NextCursor != "" {
+		t.Fatalf("expected no next cursor on a partial page, got %q", partial.NextCursor)
+	}
+
+	empty := NewPage[item](nil, 0, Params{Page: 1, Limit: 2}, nil)
+	if empty.Items == nil {
+		t.Fatalf("expected empty items slice, got nil")
+	}
+}
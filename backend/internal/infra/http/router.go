@@ -10,25 +10,80 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 
 	_ "go-shop-app-backend/docs"
+	"go-shop-app-backend/internal/carts"
+	"go-shop-app-backend/internal/categories"
 	"go-shop-app-backend/internal/infra/auth"
-	"go-shop-app-backend/internal/infra/config"
 	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/infra/http/middleware"
+	"go-shop-app-backend/internal/infra/idempotency"
+	"go-shop-app-backend/internal/infra/ratelimit"
 	"go-shop-app-backend/internal/orders"
+	"go-shop-app-backend/internal/payments"
 	"go-shop-app-backend/internal/products"
 	"go-shop-app-backend/internal/users"
-	"go-shop-app-backend/pkg/workerpool"
+	"go-shop-app-backend/internal/webhooks"
 )
 
+// Deps is everything the router needs; it is built once by app.Container.
+type Deps struct {
+	DB  *sql.DB
+	JWT *auth.Manager
+
+	UserService     users.Service
+	ProductService  products.Service
+	CategoryService categories.Service
+	OrderService    orders.Service
+	CartService     carts.Service
+	PaymentService  payments.Service
+	WebhookService  webhooks.Service
+
+	// RateLimitStore enables rate limiting with the policies in RateLimits,
+	// keyed by route group: auth, catalog and default. A group without a
+	// policy is not limited.
+	RateLimitStore ratelimit.Store
+	RateLimits     map[string]ratelimit.Policy
+
+	// TrustedProxies may report the client address in X-Forwarded-For;
+	// nil trusts none, so ClientIP is always the peer address.
+	TrustedProxies []string
+
+	// IdempotencyStore enables Idempotency-Key support on order creation.
+	IdempotencyStore       idempotency.Store
+	IdempotencyTTL         time.Duration
+	IdempotencyLockTimeout time.Duration
+}
+
+// idempotency returns the Idempotency-Key middleware, or nil when disabled.
+func (d Deps) idempotency() gin.HandlerFunc {
+	if d.IdempotencyStore == nil {
+		return nil
+	}
+	return middleware.Idempotency(d.IdempotencyStore, d.IdempotencyTTL, d.IdempotencyLockTimeout)
+}
 
-func NewRouter(db *sql.DB, cfg *config.Config) *gin.Engine {
+// rateLimit returns the middleware for the named policy, or a no-op.
+func (d Deps) rateLimit(name string) gin.HandlerFunc {
+	policy, ok := d.RateLimits[name]
+	if d.RateLimitStore == nil || !ok {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return middleware.RateLimit(d.RateLimitStore, name, policy)
+}
+
+func NewRouter(deps Deps) *gin.Engine {
 	r := gin.New()
+	// config.Load validates the list; should it still be rejected, trust no
+	// proxy rather than gin's default of trusting every one.
+	if err := r.SetTrustedProxies(deps.TrustedProxies); err != nil {
+		_ = r.SetTrustedProxies(nil)
+	}
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	r.GET("/health", func(c *gin.Context) {
-		if err := infraDB.HealthCheck(db); err != nil {
+		if err := infraDB.HealthCheck(deps.DB); err != nil {
 			c.JSON(http.StatusServiceUnavailable, gin.H{
 				"status": "unhealthy",
 				"error":  err.Error(),
@@ -41,34 +96,59 @@ func NewRouter(db *sql.DB, cfg *config.Config) *gin.Engine {
 		})
 	})
 
+	// Public signing keys, so other services can verify our access tokens.
+	r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, deps.JWT.JWKS())
+	})
+
 	api := r.Group("/api")
 	v1 := api.Group("/v1")
 
-	jwtManager := auth.NewManager(cfg.JWTSecret, 24*time.Hour)
-	orderWorkerPool := workerpool.New(5)
-
+	// Rate limits run after authentication so signed-in users are limited
+	// by user ID rather than by address.
 	authRequired := v1.Group("/")
-	authRequired.Use(AuthMiddleware(jwtManager))
+	authRequired.Use(middleware.AuthMiddleware(deps.JWT), deps.rateLimit("default"))
 
 	adminGroup := v1.Group("/admin")
-	adminGroup.Use(AuthMiddleware(jwtManager), AdminOnly())
+	adminGroup.Use(middleware.AuthMiddleware(deps.JWT), middleware.AdminOnly(), deps.rateLimit("default"))
+
+	optionalAuth := v1.Group("/")
+	optionalAuth.Use(middleware.OptionalAuth(deps.JWT), deps.rateLimit("default"))
+
+	publicAuth := v1.Group("/")
+	publicAuth.Use(deps.rateLimit("auth"))
+
+	catalog := v1.Group("/")
+	catalog.Use(deps.rateLimit("catalog"))
 
-	userRepo := users.NewPostgresRepository(db)
-	userService := users.NewService(userRepo, jwtManager)
-	userHandler := users.NewHandler(userService)
-	userHandler.RegisterRoutes(v1)
+	userHandler := users.NewHandler(deps.UserService, deps.CartService)
+	userHandler.RegisterRoutes(publicAuth)
+	userHandler.RegisterAuthenticatedRoutes(authRequired)
+	userHandler.RegisterAdminRoutes(adminGroup)
 
-	productRepo := products.NewPostgresRepository(db)
-	productService := products.NewService(productRepo)
-	productHandler := products.NewHandler(productService)
-	productHandler.RegisterRoutes(v1)
+	productHandler := products.NewHandler(deps.ProductService)
+	productHandler.RegisterRoutes(catalog)
+	productHandler.RegisterAdminRoutes(adminGroup)
 
-	productHandler.RegisterRoutes(adminGroup)
+	categoryHandler := categories.NewHandler(deps.CategoryService)
+	categoryHandler.RegisterRoutes(catalog)
+	categoryHandler.RegisterAdminRoutes(adminGroup)
 
-	orderRepo := orders.NewPostgresRepository(db)
-	orderService := orders.NewService(orderRepo, orderWorkerPool)
-	orderHandler := orders.NewHandler(orderService)
+	orderHandler := orders.NewHandler(deps.OrderService, deps.idempotency())
 	orderHandler.RegisterRoutes(authRequired)
+	orderHandler.RegisterAdminRoutes(adminGroup)
+
+	cartHandler := carts.NewHandler(deps.CartService, deps.idempotency())
+	cartHandler.RegisterRoutes(optionalAuth)
+
+	paymentHandler := payments.NewHandler(deps.PaymentService, deps.idempotency())
+	paymentHandler.RegisterRoutes(authRequired)
+	paymentHandler.RegisterAdminRoutes(adminGroup)
+	paymentHandler.RegisterWebhookRoutes(v1)
+
+	webhookHandler := webhooks.NewHandler(deps.WebhookService)
+	webhookHandler.RegisterAdminRoutes(adminGroup)
 
 	return r
 }
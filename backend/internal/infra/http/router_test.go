@@ -0,0 +1,371 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/auth"
+	"go-shop-app-backend/internal/infra/ratelimit"
+	"go-shop-app-backend/internal/users"
+)
+
+const testJWTSecret = "router-test-secret"
+
+// newTestRouter builds the real router without services; the requests below
+// are rejected before any handler reaches them.
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	return NewRouter(Deps{JWT: auth.NewManager(auth.NewHMACKeySet(testJWTSecret), time.Minute, time.Hour, nil)})
+}
+
+func bearer(t *testing.T, role string) string {
+	t.Helper()
+
+	token, err := auth.NewManager(auth.NewHMACKeySet(testJWTSecret), time.Minute, time.Hour, nil).GenerateToken(1, role, 0)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	return "Bearer " + token
+}
+
+func TestRouter_ProductWriteRoutes(t *testing.T) {
+	router := newTestRouter(t)
+
+	writes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/products/"},
+		{http.MethodPut, "/products/1"},
+		{http.MethodDelete, "/products/1"},
+	}
+
+	tests := []struct {
+		name       string
+		prefix     string
+		authHeader string
+		wantStatus int
+	}{
+		{name: "public route removed", prefix: "/api/v1", wantStatus: http.StatusNotFound},
+		{name: "public route removed for admin", prefix: "/api/v1", authHeader: bearer(t, "admin"), wantStatus: http.StatusNotFound},
+		{name: "admin route anonymous", prefix: "/api/v1/admin", wantStatus: http.StatusUnauthorized},
+		{name: "admin route invalid token", prefix: "/api/v1/admin", authHeader: "Bearer garbage", wantStatus: http.StatusUnauthorized},
+		{name: "admin route user role", prefix: "/api/v1/admin", authHeader: bearer(t, "user"), wantStatus: http.StatusForbidden},
+		// A malformed body is rejected by the handler, proving the admin got past auth.
+		{name: "admin route admin role", prefix: "/api/v1/admin", authHeader: bearer(t, "admin"), wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		for _, w := range writes {
+			if tt.wantStatus == http.StatusBadRequest && w.method == http.MethodDelete {
+				// DELETE has no body to reject, so it would reach the database.
+				continue
+			}
+
+			t.Run(tt.name+" "+w.method, func(t *testing.T) {
+				req := httptest.NewRequest(w.method, tt.prefix+w.path, strings.NewReader("{"))
+				req.Header.Set("Content-Type", "application/json")
+				if tt.authHeader != "" {
+					req.Header.Set("Authorization", tt.authHeader)
+				}
+
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRouter_CartAuth(t *testing.T) {
+	router := newTestRouter(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		authHeader string
+		wantStatus int
+	}{
+		// Cart routes accept guests, but a bad token is still rejected.
+		{name: "invalid token on cart", method: http.MethodGet, path: "/api/v1/cart/", authHeader: "Bearer garbage", wantStatus: http.StatusUnauthorized},
+		{name: "guest checkout", method: http.MethodPost, path: "/api/v1/cart/checkout", wantStatus: http.StatusUnauthorized},
+		// A malformed body is rejected by the handler, proving guests get through.
+		{name: "guest add item", method: http.MethodPost, path: "/api/v1/cart/items", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{"))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_JWKS(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	// The HMAC secret is never published.
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"keys":[]}` {
+		t.Fatalf("body = %s, want empty key set", body)
+	}
+}
+
+func TestRouter_AdminUsersRequireAdmin(t *testing.T) {
+	router := newTestRouter(t)
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/api/v1/admin/users/"},
+		{http.MethodGet, "/api/v1/admin/users/1"},
+		{http.MethodPut, "/api/v1/admin/users/1/role"},
+		{http.MethodPost, "/api/v1/admin/users/1/disable"},
+		{http.MethodPost, "/api/v1/admin/users/1/enable"},
+	}
+
+	for _, r := range routes {
+		for _, tt := range []struct {
+			authHeader string
+			wantStatus int
+		}{
+			{authHeader: "", wantStatus: http.StatusUnauthorized},
+			{authHeader: bearer(t, "user"), wantStatus: http.StatusForbidden},
+		} {
+			req := httptest.NewRequest(r.method, r.path, nil)
+			if tt.authHeader != "" {
+				req.Header.Set("Authorization", tt.authHeader)
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("%s %s: status = %d, want %d", r.method, r.path, rec.Code, tt.wantStatus)
+			}
+		}
+	}
+}
+
+func TestRouter_RateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := NewRouter(Deps{
+		JWT:            auth.NewManager(auth.NewHMACKeySet(testJWTSecret), time.Minute, time.Hour, nil),
+		RateLimitStore: ratelimit.NewMemoryStore(),
+		RateLimits: map[string]ratelimit.Policy{
+			"auth":    {Requests: 1, Period: time.Hour, Burst: 2},
+			"default": {Requests: 1, Period: time.Hour},
+		},
+	})
+
+	do := func(method, path, authHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader("{"))
+		req.Header.Set("Content-Type", "application/json")
+		if authHeader != "" {
+			req.Header.Set("Authorization", authHeader)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i, want := range []string{"1", "0"} {
+		rec := do(http.MethodPost, "/api/v1/auth/login", "")
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("request %d: status = %d, want %d", i+1, rec.Code, http.StatusBadRequest)
+		}
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != want {
+			t.Fatalf("request %d: X-RateLimit-Remaining = %q, want %q", i+1, got, want)
+		}
+	}
+
+	rec := do(http.MethodPost, "/api/v1/auth/login", "")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("Retry-After") != "3600" || rec.Header().Get("X-RateLimit-Limit") != "2" {
+		t.Fatalf("unexpected headers: %v", rec.Header())
+	}
+
+	// Other groups have their own buckets, and signed-in users are keyed by
+	// user ID rather than by address.
+	if rec := do(http.MethodPost, "/api/v1/cart/items", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("guest cart: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := do(http.MethodPost, "/api/v1/cart/items", ""); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("guest cart again: status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec := do(http.MethodPost, "/api/v1/cart/items", bearer(t, "user")); rec.Code != http.StatusBadRequest {
+		t.Fatalf("user cart: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRouter_RateLimitIgnoresUntrustedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(trusted []string) *gin.Engine {
+		return NewRouter(Deps{
+			JWT:            auth.NewManager(auth.NewHMACKeySet(testJWTSecret), time.Minute, time.Hour, nil),
+			RateLimitStore: ratelimit.NewMemoryStore(),
+			RateLimits: map[string]ratelimit.Policy{
+				"auth": {Requests: 1, Period: time.Hour, Burst: 1},
+			},
+			TrustedProxies: trusted,
+		})
+	}
+
+	// httptest requests come from 192.0.2.1.
+	login := func(router *gin.Engine, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader("{"))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Without trusted proxies a forged header does not buy a fresh bucket.
+	router := newRouter(nil)
+	if code := login(router, "198.51.100.1"); code != http.StatusBadRequest {
+		t.Fatalf("first request: status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := login(router, "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("forged address: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Behind a trusted proxy the forwarded address is the client's.
+	router = newRouter([]string{"192.0.2.0/24"})
+	if code := login(router, "198.51.100.1"); code != http.StatusBadRequest {
+		t.Fatalf("first client: status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := login(router, "198.51.100.2"); code != http.StatusBadRequest {
+		t.Fatalf("second client: status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := login(router, "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("first client again: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+// unknownUsers is a users.Repository where every login is for an unknown
+// account; other methods are not expected to be called.
+type unknownUsers struct {
+	users.Repository
+}
+
+func (unknownUsers) GetByEmail(ctx context.Context, email string) (*users.UserWithPassword, error) {
+	return nil, domain.ErrNotFound
+}
+
+type noTx struct{}
+
+func (noTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func TestRouter_LoginLockoutIgnoresUntrustedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwt := auth.NewManager(auth.NewHMACKeySet(testJWTSecret), time.Minute, time.Hour, nil)
+	router := NewRouter(Deps{
+		JWT: jwt,
+		UserService: users.NewService(unknownUsers{}, jwt, noTx{}, users.Options{
+			LoginTracker: users.NewMemoryLoginTracker(),
+			Lockout: users.LockoutPolicy{
+				MaxAttempts:     100,
+				IPMaxAttempts:   3,
+				Window:          time.Hour,
+				LockoutDuration: time.Hour,
+			},
+		}),
+	})
+
+	login := func(n int, remoteAddr, forwardedFor string) int {
+		body := fmt.Sprintf(`{"email":"user%d@example.com","password":"wrong"}`, n)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Rotating the header does not spread failures over fresh addresses.
+	for i := 1; i <= 3; i++ {
+		if code := login(i, "203.0.113.7:4000", fmt.Sprintf("198.51.100.%d", i)); code != http.StatusBadRequest {
+			t.Fatalf("attempt %d: status = %d, want %d", i, code, http.StatusBadRequest)
+		}
+	}
+	if code := login(4, "203.0.113.7:4000", "198.51.100.4"); code != http.StatusTooManyRequests {
+		t.Fatalf("attempt past the limit: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Naming a victim in the header did not lock the victim out.
+	if code := login(5, "198.51.100.1:4000", ""); code != http.StatusBadRequest {
+		t.Fatalf("victim address: status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestRouter_PaymentRoutesRequireAuth(t *testing.T) {
+	router := newTestRouter(t)
+
+	for _, r := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/api/v1/orders/1/pay"},
+		{http.MethodGet, "/api/v1/orders/1/payments"},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(r.method, r.path, nil))
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s %s: status = %d, want %d", r.method, r.path, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestRouter_AdminCannotMarkOrderPaid(t *testing.T) {
+	router := newTestRouter(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/orders/1/pay", nil)
+	req.Header.Set("Authorization", bearer(t, "admin"))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,150 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLockLost is returned by Complete when the key was taken over by another
+// request after its lock timed out.
+var ErrLockLost = errors.New("idempotency key lock was lost")
+
+// Record is a stored Idempotency-Key. Until Completed is set the original
+// request is still in flight.
+type Record struct {
+	RequestHash string
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Store keeps idempotency keys scoped to a user.
+type Store interface {
+	// Acquire claims key for a new request and returns the token that
+	// Complete and Release take. When the key is already taken it returns
+	// the existing record instead. Expired keys, and in-flight keys locked
+	// before staleBefore, are taken over under a new token.
+	Acquire(ctx context.Context, userID int64, key, requestHash string, now, expiresAt, staleBefore time.Time) (*Record, string, error)
+	// Complete stores the response for replays. It returns ErrLockLost when
+	// the key no longer holds token.
+	Complete(ctx context.Context, userID int64, key, token string, statusCode int, contentType string, body []byte) error
+	// Release forgets an in-flight key so the request can be retried. It
+	// does nothing when the key no longer holds token.
+	Release(ctx context.Context, userID int64, key, token string) error
+}
+
+type postgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) Store {
+	return &postgresStore{db: db}
+}
+
+func (s *postgresStore) Acquire(ctx context.Context, userID int64, key, requestHash string, now, expiresAt, staleBefore time.Time) (*Record, string, error) {
+	const claim = `
+        INSERT INTO idempotency_keys (user_id, key, token, request_hash, locked_at, expires_at)
+        VALUES ($1, $2, $7, $3, $4, $5)
+        ON CONFLICT (user_id, key) DO UPDATE
+        SET token = EXCLUDED.token,
+            request_hash = EXCLUDED.request_hash,
+            locked_at = EXCLUDED.locked_at,
+            expires_at = EXCLUDED.expires_at,
+            status_code = NULL,
+            content_type = NULL,
+            response_body = NULL,
+            completed_at = NULL
+        WHERE idempotency_keys.expires_at <= $4
+           OR (idempotency_keys.completed_at IS NULL AND idempotency_keys.locked_at < $6)
+        RETURNING user_id
+    `
+	const existing = `
+        SELECT request_hash, completed_at IS NOT NULL, COALESCE(status_code, 0),
+               COALESCE(content_type, ''), response_body
+        FROM idempotency_keys
+        WHERE user_id = $1 AND key = $2
+    `
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The existing row can be released between the two statements; the
+	// second pass then claims it.
+	for attempt := 0; attempt < 2; attempt++ {
+		var id int64
+		err := s.db.QueryRowContext(ctx, claim, userID, key, requestHash, now, expiresAt, staleBefore, token).Scan(&id)
+		if err == nil {
+			if _, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now); err != nil {
+				return nil, "", fmt.Errorf("prune idempotency keys: %w", err)
+			}
+			return nil, token, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, "", fmt.Errorf("claim idempotency key: %w", err)
+		}
+
+		var rec Record
+		err = s.db.QueryRowContext(ctx, existing, userID, key).
+			Scan(&rec.RequestHash, &rec.Completed, &rec.StatusCode, &rec.ContentType, &rec.Body)
+		if err == nil {
+			return &rec, "", nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, "", fmt.Errorf("get idempotency key: %w", err)
+		}
+	}
+
+	return nil, "", fmt.Errorf("claim idempotency key: key changed concurrently")
+}
+
+func (s *postgresStore) Complete(ctx context.Context, userID int64, key, token string, statusCode int, contentType string, body []byte) error {
+	const query = `
+        UPDATE idempotency_keys
+        SET status_code = $4, content_type = $5, response_body = $6, completed_at = NOW()
+        WHERE user_id = $1 AND key = $2 AND token = $3
+    `
+
+	res, err := s.db.ExecContext(ctx, query, userID, key, token, statusCode, contentType, body)
+	if err != nil {
+		return fmt.Errorf("complete idempotency key: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("complete idempotency key: %w", err)
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+
+	return nil
+}
+
+func (s *postgresStore) Release(ctx context.Context, userID int64, key, token string) error {
+	const query = `
+        DELETE FROM idempotency_keys
+        WHERE user_id = $1 AND key = $2 AND token = $3 AND completed_at IS NULL
+    `
+
+	if _, err := s.db.ExecContext(ctx, query, userID, key, token); err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate idempotency token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,301 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB stands in for Postgres behind database/sql. It recognises the
+// store's statements and applies them to an in-memory table, so the tests
+// exercise the arguments the store passes and the rows it scans.
+type fakeDB struct {
+	mu   sync.Mutex
+	rows map[string]*fakeRow
+}
+
+type fakeRow struct {
+	token       string
+	requestHash string
+	lockedAt    time.Time
+	expiresAt   time.Time
+	completed   bool
+	statusCode  int64
+	contentType string
+	body        []byte
+}
+
+func newTestStore(t *testing.T) (Store, *fakeDB) {
+	t.Helper()
+
+	fake := &fakeDB{rows: make(map[string]*fakeRow)}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+
+	return NewPostgresStore(db), fake
+}
+
+func rowID(userID, key driver.Value) string {
+	return fmt.Sprintf("%v:%v", userID, key)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("begin is not supported") }
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, named []driver.NamedValue) (driver.Rows, error) {
+	args := values(named)
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query = strings.TrimSpace(query)
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO idempotency_keys"):
+		// $1 user_id, $2 key, $3 request_hash, $4 now, $5 expires_at,
+		// $6 stale_before, $7 token
+		id := rowID(args[0], args[1])
+		now, staleBefore := args[3].(time.Time), args[5].(time.Time)
+		if row, ok := f.rows[id]; ok {
+			expired := !row.expiresAt.After(now)
+			stale := !row.completed && row.lockedAt.Before(staleBefore)
+			if !expired && !stale {
+				return &fakeRows{columns: []string{"user_id"}}, nil
+			}
+		}
+		f.rows[id] = &fakeRow{
+			token:       args[6].(string),
+			requestHash: args[2].(string),
+			lockedAt:    now,
+			expiresAt:   args[4].(time.Time),
+		}
+		return &fakeRows{columns: []string{"user_id"}, values: [][]driver.Value{{args[0]}}}, nil
+
+	case strings.HasPrefix(query, "SELECT request_hash"):
+		row, ok := f.rows[rowID(args[0], args[1])]
+		if !ok {
+			return &fakeRows{columns: make([]string, 5)}, nil
+		}
+		return &fakeRows{columns: make([]string, 5), values: [][]driver.Value{{
+			row.requestHash, row.completed, row.statusCode, row.contentType, row.body,
+		}}}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected query: %s", query)
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, named []driver.NamedValue) (driver.Result, error) {
+	args := values(named)
+	f := c.db
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query = strings.TrimSpace(query)
+	switch {
+	case strings.HasPrefix(query, "DELETE FROM idempotency_keys WHERE expires_at"):
+		now := args[0].(time.Time)
+		var n int64
+		for id, row := range f.rows {
+			if !row.expiresAt.After(now) {
+				delete(f.rows, id)
+				n++
+			}
+		}
+		return driver.RowsAffected(n), nil
+
+	case strings.HasPrefix(query, "UPDATE idempotency_keys"):
+		if !strings.Contains(query, "token = $3") {
+			return nil, fmt.Errorf("complete does not check the token: %s", query)
+		}
+		row, ok := f.rows[rowID(args[0], args[1])]
+		if !ok || row.token != args[2] {
+			return driver.RowsAffected(0), nil
+		}
+		row.completed = true
+		row.statusCode = args[3].(int64)
+		row.contentType = args[4].(string)
+		row.body = args[5].([]byte)
+		return driver.RowsAffected(1), nil
+
+	case strings.HasPrefix(query, "DELETE FROM idempotency_keys"):
+		if !strings.Contains(query, "token = $3") {
+			return nil, fmt.Errorf("release does not check the token: %s", query)
+		}
+		id := rowID(args[0], args[1])
+		row, ok := f.rows[id]
+		if !ok || row.token != args[2] || row.completed {
+			return driver.RowsAffected(0), nil
+		}
+		delete(f.rows, id)
+		return driver.RowsAffected(1), nil
+	}
+
+	return nil, fmt.Errorf("unexpected statement: %s", query)
+}
+
+func values(named []driver.NamedValue) []driver.Value {
+	out := make([]driver.Value, len(named))
+	for i, v := range named {
+		out[i] = v.Value
+	}
+	return out
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestPostgresStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ttl, lockTimeout := 24*time.Hour, time.Minute
+
+	acquire := func(t *testing.T, store Store, key, hash string, at time.Time) (*Record, string) {
+		t.Helper()
+		rec, token, err := store.Acquire(ctx, 1, key, hash, at, at.Add(ttl), at.Add(-lockTimeout))
+		if err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+		return rec, token
+	}
+
+	t.Run("claims a new key and reports it in flight", func(t *testing.T) {
+		store, _ := newTestStore(t)
+
+		rec, token := acquire(t, store, "k", "hash", now)
+		if rec != nil || token == "" {
+			t.Fatalf("Acquire = %+v, %q, want a token", rec, token)
+		}
+
+		rec, second := acquire(t, store, "k", "hash", now.Add(time.Second))
+		if rec == nil || second != "" {
+			t.Fatalf("Acquire = %+v, %q, want the existing record", rec, second)
+		}
+		if rec.Completed || rec.RequestHash != "hash" {
+			t.Fatalf("record = %+v, want in flight with hash", rec)
+		}
+	})
+
+	t.Run("replays a completed key", func(t *testing.T) {
+		store, _ := newTestStore(t)
+
+		_, token := acquire(t, store, "k", "hash", now)
+		if err := store.Complete(ctx, 1, "k", token, 201, "application/json", []byte(`{"id":1}`)); err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+
+		// Completed keys are not taken over when the lock would have timed out.
+		rec, _ := acquire(t, store, "k", "hash", now.Add(time.Hour))
+		if rec == nil || !rec.Completed {
+			t.Fatalf("record = %+v, want completed", rec)
+		}
+		if rec.StatusCode != 201 || rec.ContentType != "application/json" || string(rec.Body) != `{"id":1}` {
+			t.Fatalf("record = %+v, want the stored response", rec)
+		}
+	})
+
+	t.Run("release lets the key be claimed again", func(t *testing.T) {
+		store, _ := newTestStore(t)
+
+		_, token := acquire(t, store, "k", "hash", now)
+		if err := store.Release(ctx, 1, "k", token); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+
+		if rec, next := acquire(t, store, "k", "other", now); rec != nil || next == "" {
+			t.Fatalf("Acquire = %+v, %q, want a token", rec, next)
+		}
+	})
+
+	t.Run("stale lock is taken over and the old holder is fenced off", func(t *testing.T) {
+		store, fake := newTestStore(t)
+
+		_, first := acquire(t, store, "k", "hash", now)
+		rec, second := acquire(t, store, "k", "hash", now.Add(lockTimeout+time.Second))
+		if rec != nil || second == "" || second == first {
+			t.Fatalf("Acquire = %+v, %q, want a new token", rec, second)
+		}
+
+		if err := store.Release(ctx, 1, "k", first); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+		if _, ok := fake.rows[rowID(int64(1), "k")]; !ok {
+			t.Fatalf("stale holder released the new holder's key")
+		}
+
+		err := store.Complete(ctx, 1, "k", first, 201, "application/json", []byte("stale"))
+		if !errors.Is(err, ErrLockLost) {
+			t.Fatalf("Complete with stale token error = %v, want ErrLockLost", err)
+		}
+
+		if err := store.Complete(ctx, 1, "k", second, 201, "application/json", []byte("fresh")); err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+		rec, _ = acquire(t, store, "k", "hash", now.Add(lockTimeout+2*time.Second))
+		if rec == nil || string(rec.Body) != "fresh" {
+			t.Fatalf("record = %+v, want the new holder's response", rec)
+		}
+	})
+
+	t.Run("expired keys are taken over and pruned", func(t *testing.T) {
+		store, fake := newTestStore(t)
+
+		_, token := acquire(t, store, "old", "hash", now)
+		if err := store.Complete(ctx, 1, "old", token, 201, "text/plain", []byte("done")); err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+
+		later := now.Add(ttl)
+		if rec, next := acquire(t, store, "old", "other", later); rec != nil || next == "" {
+			t.Fatalf("Acquire = %+v, %q, want a token", rec, next)
+		}
+
+		acquire(t, store, "other", "hash", now)
+		acquire(t, store, "new", "hash", later.Add(ttl))
+		if _, ok := fake.rows[rowID(int64(1), "other")]; ok {
+			t.Fatalf("expired key was not pruned")
+		}
+	})
+
+	t.Run("keys are scoped to the user", func(t *testing.T) {
+		store, _ := newTestStore(t)
+
+		acquire(t, store, "k", "hash", now)
+		rec, token, err := store.Acquire(ctx, 2, "k", "other", now, now.Add(ttl), now.Add(-lockTimeout))
+		if err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+		if rec != nil || token == "" {
+			t.Fatalf("Acquire = %+v, %q, want a token", rec, token)
+		}
+	})
+}
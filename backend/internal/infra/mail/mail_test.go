@@ -0,0 +1,56 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+
+	m, err := NewFileMailer(dir, "shop@example.com")
+	if err != nil {
+		t.Fatalf("new file mailer: %v", err)
+	}
+
+	msg := Message{To: "user@example.com", Subject: "Reset your password", Body: "line 1\nline 2"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected one file per message, got %d", len(files))
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("read mail: %v", err)
+	}
+	for _, want := range []string{"From: shop@example.com\r\n", "To: user@example.com\r\n", "\r\n\r\nline 1\r\nline 2"} {
+		if !strings.Contains(string(raw), want) {
+			t.Fatalf("expected %q in message:\n%s", want, raw)
+		}
+	}
+}
+
+func TestMessage_RejectsHeaderInjection(t *testing.T) {
+	m, err := NewFileMailer(t.TempDir(), "shop@example.com")
+	if err != nil {
+		t.Fatalf("new file mailer: %v", err)
+	}
+
+	msg := Message{To: "user@example.com\r\nBcc: victim@example.com", Subject: "hi"}
+	if err := m.Send(context.Background(), msg); err == nil {
+		t.Fatalf("expected error for a recipient with a line break")
+	}
+}
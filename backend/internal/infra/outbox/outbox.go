@@ -0,0 +1,208 @@
+package outbox
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	infraDB "go-shop-app-backend/internal/infra/db"
+)
+
+// Message is a domain event waiting to be written to the outbox.
+type Message struct {
+	Type          string
+	AggregateType string
+	AggregateID   int64
+	Payload       json.RawMessage
+}
+
+// NewMessage encodes payload as the event body.
+func NewMessage(eventType, aggregateType string, aggregateID int64, payload any) (Message, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Message{}, fmt.Errorf("encode %s event: %w", eventType, err)
+	}
+
+	return Message{
+		Type:          eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       body,
+	}, nil
+}
+
+// Event is a stored message as handed to sinks. Attempts counts previous
+// failed deliveries. LeaseToken identifies the claim that handed it out.
+type Event struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int             `json:"-"`
+	LeaseToken    string          `json:"-"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// ErrLeaseLost is returned when recording the outcome of an event whose
+// lease ran out and which another relay has claimed since.
+var ErrLeaseLost = errors.New("outbox lease lost")
+
+// Writer records events. Called inside infraDB.Transactor.WithinTx the
+// event commits or rolls back together with the state change.
+type Writer interface {
+	Add(ctx context.Context, msg Message) error
+}
+
+// Store is the outbox table as seen by the relay.
+type Store interface {
+	Writer
+	// Claim leases up to limit events that are due at now. Leased events
+	// are not handed out again until lease has passed, so an event whose
+	// relay dies mid-delivery is retried.
+	Claim(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]*Event, error)
+	// The Mark methods record the outcome of a claimed event. They return
+	// ErrLeaseLost when the event has been claimed again under a token
+	// other than leaseToken.
+	MarkDelivered(ctx context.Context, id int64, leaseToken string, now time.Time) error
+	// MarkFailed counts a failed attempt and schedules the next one.
+	MarkFailed(ctx context.Context, id int64, leaseToken string, nextAttemptAt time.Time, lastError string) error
+	// MarkDead counts a failed attempt and gives up on the event.
+	MarkDead(ctx context.Context, id int64, leaseToken string, lastError string) error
+}
+
+type postgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) Store {
+	return &postgresStore{db: db}
+}
+
+func (s *postgresStore) conn(ctx context.Context) infraDB.DBTX {
+	return infraDB.Conn(ctx, s.db)
+}
+
+func (s *postgresStore) Add(ctx context.Context, msg Message) error {
+	const query = `
+        INSERT INTO outbox (event_type, aggregate_type, aggregate_id, payload)
+        VALUES ($1, $2, $3, $4)
+    `
+
+	if _, err := s.conn(ctx).ExecContext(ctx, query, msg.Type, msg.AggregateType, msg.AggregateID, []byte(msg.Payload)); err != nil {
+		return fmt.Errorf("insert outbox event: %w", err)
+	}
+
+	return nil
+}
+
+func (s *postgresStore) Claim(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]*Event, error) {
+	const query = `
+        UPDATE outbox
+        SET next_attempt_at = $3, lease_token = $4
+        WHERE id IN (
+            SELECT id FROM outbox
+            WHERE status = 'pending' AND next_attempt_at <= $1
+            ORDER BY next_attempt_at, id
+            LIMIT $2
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, event_type, aggregate_type, aggregate_id, payload, attempts, created_at
+    `
+
+	token, err := newLeaseToken()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, now, limit, now.Add(lease), token)
+	if err != nil {
+		return nil, fmt.Errorf("claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		var (
+			e       Event
+			payload []byte
+		)
+		if err := rows.Scan(&e.ID, &e.Type, &e.AggregateType, &e.AggregateID, &payload, &e.Attempts, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan outbox event: %w", err)
+		}
+		e.Payload = payload
+		e.LeaseToken = token
+		events = append(events, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate outbox events: %w", err)
+	}
+
+	// RETURNING does not keep the subquery's order.
+	slices.SortFunc(events, func(a, b *Event) int { return cmp.Compare(a.ID, b.ID) })
+
+	return events, nil
+}
+
+func (s *postgresStore) MarkDelivered(ctx context.Context, id int64, leaseToken string, now time.Time) error {
+	const query = `
+        UPDATE outbox
+        SET status = 'delivered', delivered_at = $3, last_error = NULL
+        WHERE id = $1 AND lease_token = $2 AND status = 'pending'
+    `
+
+	return s.exec(ctx, "mark outbox event delivered", query, id, leaseToken, now)
+}
+
+func (s *postgresStore) MarkFailed(ctx context.Context, id int64, leaseToken string, nextAttemptAt time.Time, lastError string) error {
+	const query = `
+        UPDATE outbox
+        SET attempts = attempts + 1, next_attempt_at = $3, last_error = $4
+        WHERE id = $1 AND lease_token = $2 AND status = 'pending'
+    `
+
+	return s.exec(ctx, "mark outbox event failed", query, id, leaseToken, nextAttemptAt, lastError)
+}
+
+func (s *postgresStore) MarkDead(ctx context.Context, id int64, leaseToken string, lastError string) error {
+	const query = `
+        UPDATE outbox
+        SET status = 'dead', attempts = attempts + 1, last_error = $3
+        WHERE id = $1 AND lease_token = $2 AND status = 'pending'
+    `
+
+	return s.exec(ctx, "mark outbox event dead", query, id, leaseToken, lastError)
+}
+
+func (s *postgresStore) exec(ctx context.Context, what, query string, args ...any) error {
+	res, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s rows affected: %w", what, err)
+	}
+	if affected == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+func newLeaseToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate outbox lease token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
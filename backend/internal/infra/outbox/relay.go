@@ -0,0 +1,216 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-shop-app-backend/pkg/logger"
+)
+
+type RelayOptions struct {
+	// Interval is the pause between polls once the outbox is drained.
+	Interval  time.Duration
+	BatchSize int
+	// Lease is how long a claimed batch is hidden from other relays; it
+	// must comfortably exceed delivering a whole batch. Events still
+	// undelivered when it runs out are left for the next claim.
+	Lease time.Duration
+	// MaxAttempts failed deliveries move an event to the dead state.
+	MaxAttempts int
+	// The n-th retry waits BackoffBase * 2^(n-1), capped at BackoffMax.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+// RelayResult counts what one RunOnce did.
+type RelayResult struct {
+	Delivered int
+	Retried   int
+	Dead      int
+}
+
+// Relay moves events from the outbox to a sink with at-least-once
+// semantics. Events are claimed with SKIP LOCKED, so several instances can
+// run a relay against the same table.
+type Relay struct {
+	store Store
+	sink  Sink
+	opts  RelayOptions
+	now   func() time.Time
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRelay(store Store, sink Sink, opts RelayOptions) *Relay {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = time.Minute
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	if opts.BackoffBase <= 0 {
+		opts.BackoffBase = time.Second
+	}
+	if opts.BackoffMax < opts.BackoffBase {
+		opts.BackoffMax = opts.BackoffBase
+	}
+
+	return &Relay{
+		store: store,
+		sink:  sink,
+		opts:  opts,
+		now:   time.Now,
+	}
+}
+
+// Start polls the outbox in the background until Stop is called. Calling
+// Start on a running relay does nothing.
+func (r *Relay) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go r.loop(ctx, r.done)
+}
+
+// Stop cancels in-flight deliveries and waits for the relay to exit or for
+// ctx to end. Interrupted events are retried once their lease expires.
+func (r *Relay) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stop outbox relay: %w", ctx.Err())
+	}
+}
+
+func (r *Relay) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		res, err := r.RunOnce(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logger.Error("outbox relay failed", "error", err)
+		case res.Retried > 0 || res.Dead > 0:
+			logger.Warn("outbox deliveries failed",
+				"delivered", res.Delivered, "retried", res.Retried, "dead", res.Dead)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce delivers due events until none are left.
+func (r *Relay) RunOnce(ctx context.Context) (RelayResult, error) {
+	var res RelayResult
+
+	for ctx.Err() == nil {
+		// The lease is measured from the same instant the store stamps it
+		// with, so it never looks longer here than it is in the table.
+		now := r.now()
+		events, err := r.store.Claim(ctx, r.opts.BatchSize, now, r.opts.Lease)
+		if err != nil {
+			return res, err
+		}
+
+		leasedUntil := now.Add(r.opts.Lease)
+		for _, e := range events {
+			// Another relay may have claimed the rest of the batch by now.
+			if !r.now().Before(leasedUntil) {
+				break
+			}
+			if err := r.deliver(ctx, e, &res); err != nil {
+				return res, err
+			}
+		}
+
+		if len(events) < r.opts.BatchSize {
+			break
+		}
+	}
+
+	return res, nil
+}
+
+// deliver hands e to the sink and records the outcome. If the lease ran out
+// and another relay has claimed e since, the outcome is dropped and the
+// other relay's stands.
+func (r *Relay) deliver(ctx context.Context, e *Event, res *RelayResult) error {
+	err := r.attempt(ctx, e, res)
+	if errors.Is(err, ErrLeaseLost) {
+		logger.Warn("outbox lease lost before the delivery was recorded", "event_id", e.ID)
+		return nil
+	}
+	return err
+}
+
+func (r *Relay) attempt(ctx context.Context, e *Event, res *RelayResult) error {
+	deliverErr := r.sink.Deliver(ctx, e)
+	if deliverErr == nil {
+		res.Delivered++
+		return r.store.MarkDelivered(ctx, e.ID, e.LeaseToken, r.now())
+	}
+
+	// Shutting down: leave the event leased so it is retried later rather
+	// than charging it an attempt.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	attempts := e.Attempts + 1
+	if attempts >= r.opts.MaxAttempts {
+		res.Dead++
+		return r.store.MarkDead(ctx, e.ID, e.LeaseToken, deliverErr.Error())
+	}
+
+	res.Retried++
+	return r.store.MarkFailed(ctx, e.ID, e.LeaseToken, r.now().Add(r.backoff(attempts)), deliverErr.Error())
+}
+
+// backoff returns the delay before the next try after attempts failures.
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.opts.BackoffBase
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= r.opts.BackoffMax {
+			return r.opts.BackoffMax
+		}
+	}
+	return d
+}
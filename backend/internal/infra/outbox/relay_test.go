@@ -0,0 +1,435 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type storedEvent struct {
+	Event
+	status      string
+	nextAttempt time.Time
+	lastError   string
+}
+
+// memoryStore mimics the outbox table, including leases.
+type memoryStore struct {
+	mu     sync.Mutex
+	events []*storedEvent
+	claims int
+}
+
+func (s *memoryStore) Add(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, &storedEvent{
+		Event: Event{
+			ID:            int64(len(s.events) + 1),
+			Type:          msg.Type,
+			AggregateType: msg.AggregateType,
+			AggregateID:   msg.AggregateID,
+			Payload:       msg.Payload,
+		},
+		status: "pending",
+	})
+	return nil
+}
+
+func (s *memoryStore) Claim(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]*Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.claims++
+	token := strconv.Itoa(s.claims)
+
+	var claimed []*Event
+	for _, e := range s.events {
+		if len(claimed) == limit {
+			break
+		}
+		if e.status != "pending" || e.nextAttempt.After(now) {
+			continue
+		}
+		e.nextAttempt = now.Add(lease)
+		e.LeaseToken = token
+		cp := e.Event
+		claimed = append(claimed, &cp)
+	}
+	return claimed, nil
+}
+
+// leased returns the event if it is still pending under leaseToken.
+func (s *memoryStore) leased(id int64, leaseToken string) (*storedEvent, error) {
+	e := s.events[id-1]
+	if e.status != "pending" || e.LeaseToken != leaseToken {
+		return nil, ErrLeaseLost
+	}
+	return e, nil
+}
+
+func (s *memoryStore) MarkDelivered(ctx context.Context, id int64, leaseToken string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.leased(id, leaseToken)
+	if err != nil {
+		return err
+	}
+	e.status = "delivered"
+	return nil
+}
+
+func (s *memoryStore) MarkFailed(ctx context.Context, id int64, leaseToken string, nextAttemptAt time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.leased(id, leaseToken)
+	if err != nil {
+		return err
+	}
+	e.Attempts++
+	e.nextAttempt = nextAttemptAt
+	e.lastError = lastError
+	return nil
+}
+
+func (s *memoryStore) MarkDead(ctx context.Context, id int64, leaseToken string, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.leased(id, leaseToken)
+	if err != nil {
+		return err
+	}
+	e.Attempts++
+	e.status = "dead"
+	e.lastError = lastError
+	return nil
+}
+
+func addEvents(t *testing.T, store Store, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		msg, err := NewMessage("order.created", "order", int64(i+1), map[string]int{"n": i})
+		if err != nil {
+			t.Fatalf("new message: %v", err)
+		}
+		if err := store.Add(context.Background(), msg); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+}
+
+func TestRelay_DeliversInBatches(t *testing.T) {
+	store := &memoryStore{}
+	addEvents(t, store, 5)
+	sink := NewMemorySink()
+
+	relay := NewRelay(store, sink, RelayOptions{BatchSize: 2})
+
+	res, err := relay.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Delivered != 5 {
+		t.Fatalf("delivered %d, want 5", res.Delivered)
+	}
+
+	events := sink.Events()
+	for i, e := range events {
+		if e.ID != int64(i+1) || e.Type != "order.created" || string(e.Payload) == "" {
+			t.Fatalf("unexpected event %d: %+v", i, e)
+		}
+	}
+
+	res, _ = relay.RunOnce(context.Background())
+	if res.Delivered != 0 || len(sink.Events()) != 5 {
+		t.Fatalf("delivered events again: %+v", res)
+	}
+}
+
+// slowSink records events and moves the clock forward on every delivery.
+// The first delivery to start at or after rival is preceded by a run of
+// other, as a second instance polling the same table would do.
+type slowSink struct {
+	*MemorySink
+	now   *time.Time
+	step  time.Duration
+	rival time.Time
+	other *Relay
+}
+
+func (s *slowSink) Deliver(ctx context.Context, event *Event) error {
+	if s.other != nil && !s.now.Before(s.rival) {
+		other := s.other
+		s.other = nil
+		if _, err := other.RunOnce(ctx); err != nil {
+			return err
+		}
+	}
+
+	*s.now = s.now.Add(s.step)
+	return s.MemorySink.Deliver(ctx, event)
+}
+
+func TestRelay_StopsBatchWhenLeaseRunsOut(t *testing.T) {
+	store := &memoryStore{}
+	addEvents(t, store, 5)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	opts := RelayOptions{BatchSize: 3, Lease: 10 * time.Second}
+
+	// Two deliveries use up the lease of the first batch; another relay
+	// polling after that claims whatever is left of it.
+	sink := &slowSink{MemorySink: NewMemorySink(), now: &now, step: 6 * time.Second, rival: now.Add(opts.Lease)}
+	relay := NewRelay(store, sink, opts)
+	relay.now = clock
+	sink.other = NewRelay(store, sink, opts)
+	sink.other.now = clock
+
+	if _, err := relay.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := sink.Events()
+	if len(events) != 5 {
+		t.Fatalf("delivered %d events, want 5", len(events))
+	}
+	for i, e := range events {
+		if e.ID != int64(i+1) {
+			t.Fatalf("delivery %d was event %d; each event should go out once", i, e.ID)
+		}
+	}
+}
+
+// leaseCheckSink fails the test for any delivery that starts once the
+// event's lease in the store has run out.
+type leaseCheckSink struct {
+	*MemorySink
+	t     *testing.T
+	store *memoryStore
+	now   *time.Time
+}
+
+func (s *leaseCheckSink) Deliver(ctx context.Context, event *Event) error {
+	if leasedUntil := s.store.events[event.ID-1].nextAttempt; !s.now.Before(leasedUntil) {
+		s.t.Errorf("event %d delivered at %v, after its lease ran out at %v", event.ID, *s.now, leasedUntil)
+	}
+	return s.MemorySink.Deliver(ctx, event)
+}
+
+func TestRelay_LeaseMatchesTheStoredOne(t *testing.T) {
+	store := &memoryStore{}
+	addEvents(t, store, 3)
+
+	// Every reading of the clock moves it on, so a lease measured from a
+	// later reading than the claim's would outlast the stored one.
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	relay := NewRelay(store, &leaseCheckSink{MemorySink: NewMemorySink(), t: t, store: store, now: &now},
+		RelayOptions{BatchSize: 3, Lease: 10 * time.Second})
+	relay.now = func() time.Time {
+		now = now.Add(3 * time.Second)
+		return now
+	}
+
+	if _, err := relay.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// rivalSink runs rival, as a second instance would, during the first
+// delivery and then fails it, as a relay that stalled past its lease.
+type rivalSink struct {
+	rival func()
+}
+
+func (s *rivalSink) Deliver(ctx context.Context, event *Event) error {
+	if s.rival != nil {
+		rival := s.rival
+		s.rival = nil
+		rival()
+	}
+	return errors.New("sink timed out")
+}
+
+func TestRelay_StaleLeaseDoesNotOverwrite(t *testing.T) {
+	store := &memoryStore{}
+	addEvents(t, store, 1)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	opts := RelayOptions{Lease: 10 * time.Second}
+
+	other := NewRelay(store, NewMemorySink(), opts)
+	other.now = clock
+
+	sink := &rivalSink{rival: func() {
+		now = now.Add(opts.Lease)
+		if res, err := other.RunOnce(context.Background()); err != nil || res.Delivered != 1 {
+			t.Fatalf("rival relay: %+v, %v", res, err)
+		}
+	}}
+	relay := NewRelay(store, sink, opts)
+	relay.now = clock
+
+	if _, err := relay.RunOnce(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if e := store.events[0]; e.status != "delivered" || e.Attempts != 0 || e.lastError != "" {
+		t.Fatalf("stale relay overwrote the event: %+v", e)
+	}
+}
+
+func TestRelay_RetriesWithBackoffThenDeadLetters(t *testing.T) {
+	store := &memoryStore{}
+	addEvents(t, store, 1)
+	sink := NewMemorySink()
+	sink.SetError(errors.New("sink down"))
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	relay := NewRelay(store, sink, RelayOptions{
+		MaxAttempts: 3,
+		BackoffBase: time.Second,
+		BackoffMax:  time.Minute,
+	})
+	relay.now = func() time.Time { return now }
+
+	res, _ := relay.RunOnce(context.Background())
+	if res.Retried != 1 || !store.events[0].nextAttempt.Equal(now.Add(time.Second)) {
+		t.Fatalf("first failure: %+v, next attempt %v", res, store.events[0].nextAttempt)
+	}
+
+	// Not due yet.
+	res, _ = relay.RunOnce(context.Background())
+	if res != (RelayResult{}) {
+		t.Fatalf("retried before backoff elapsed: %+v", res)
+	}
+
+	now = now.Add(time.Second)
+	res, _ = relay.RunOnce(context.Background())
+	if res.Retried != 1 || !store.events[0].nextAttempt.Equal(now.Add(2*time.Second)) {
+		t.Fatalf("second failure: %+v, next attempt %v", res, store.events[0].nextAttempt)
+	}
+
+	now = now.Add(2 * time.Second)
+	res, _ = relay.RunOnce(context.Background())
+	if res.Dead != 1 || store.events[0].status != "dead" || store.events[0].Attempts != 3 {
+		t.Fatalf("expected dead letter, got %+v, event %+v", res, store.events[0])
+	}
+	if store.events[0].lastError != "sink down" {
+		t.Fatalf("last error = %q", store.events[0].lastError)
+	}
+
+	sink.SetError(nil)
+	now = now.Add(time.Hour)
+	if res, _ = relay.RunOnce(context.Background()); res.Delivered != 0 {
+		t.Fatalf("dead event was redelivered: %+v", res)
+	}
+}
+
+func TestRelay_Backoff(t *testing.T) {
+	relay := NewRelay(&memoryStore{}, NewMemorySink(), RelayOptions{
+		BackoffBase: time.Second,
+		BackoffMax:  10 * time.Second,
+	})
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{60, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempts); got != tt.want {
+			t.Fatalf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRelay_StartStop(t *testing.T) {
+	store := &memoryStore{}
+	addEvents(t, store, 3)
+	sink := NewMemorySink()
+
+	relay := NewRelay(store, sink, RelayOptions{Interval: 10 * time.Millisecond})
+	relay.Start()
+
+	deadline := time.Now().Add(time.Second)
+	for len(sink.Events()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := relay.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if got := len(sink.Events()); got != 3 {
+		t.Fatalf("delivered %d events, want 3", got)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		statuses = []int{http.StatusInternalServerError, http.StatusNoContent}
+		headers  []http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		headers = append(headers, r.Header.Clone())
+		w.WriteHeader(statuses[0])
+		statuses = statuses[1:]
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(srv.URL, time.Second)
+	event := &Event{ID: 42, Type: "order.paid", AggregateType: "order", AggregateID: 7, Payload: []byte(`{}`)}
+
+	if err := sink.Deliver(context.Background(), event); err == nil {
+		t.Fatal("expected error for 500 response")
+	}
+	if err := sink.Deliver(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := headers[1].Get(EventIDHeader); got != "42" {
+		t.Fatalf("%s = %q", EventIDHeader, got)
+	}
+	if got := headers[1].Get(EventTypeHeader); got != "order.paid" {
+		t.Fatalf("%s = %q", EventTypeHeader, got)
+	}
+}
+
+func TestMultiSink(t *testing.T) {
+	first, second := NewMemorySink(), NewMemorySink()
+	sink := NewMultiSink(first, second)
+	event := &Event{ID: 1, Type: "order.paid"}
+
+	second.SetError(errors.New("second down"))
+	if err := sink.Deliver(context.Background(), event); err == nil {
+		t.Fatal("expected the second sink's error")
+	}
+
+	second.SetError(nil)
+	if err := sink.Deliver(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first.Events()) != 2 || len(second.Events()) != 1 {
+		t.Fatalf("first got %d events, second %d", len(first.Events()), len(second.Events()))
+	}
+}
@@ -0,0 +1,143 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-shop-app-backend/pkg/logger"
+)
+
+// Sink delivers events somewhere outside the database. Deliver may be
+// called more than once for the same event, so consumers must deduplicate
+// by Event.ID.
+type Sink interface {
+	Deliver(ctx context.Context, event *Event) error
+}
+
+type logSink struct{}
+
+// NewLogSink returns a sink that writes events to the application log.
+func NewLogSink() Sink {
+	return logSink{}
+}
+
+func (logSink) Deliver(ctx context.Context, event *Event) error {
+	logger.Info("domain event",
+		"event_id", event.ID,
+		"type", event.Type,
+		"aggregate_type", event.AggregateType,
+		"aggregate_id", event.AggregateID,
+		"payload", event.Payload,
+	)
+	return nil
+}
+
+type multiSink []Sink
+
+// NewMultiSink returns a sink that hands each event to every sink in turn.
+// A failure stops the fan-out and the event is retried as a whole, so
+// earlier sinks may see it again.
+func NewMultiSink(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (m multiSink) Deliver(ctx context.Context, event *Event) error {
+	for _, sink := range m {
+		if err := sink.Deliver(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	EventIDHeader   = "Outbox-Event-Id"
+	EventTypeHeader = "Outbox-Event-Type"
+)
+
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink returns a sink that POSTs each event as JSON to url. Any
+// response other than 2xx counts as a failed delivery.
+func NewHTTPSink(url string, timeout time.Duration) Sink {
+	return &httpSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *httpSink) Deliver(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(EventTypeHeader, event.Type)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post event: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("post event: unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// MemorySink keeps delivered events in memory, for tests.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []Event
+	err    error
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Deliver(ctx context.Context, event *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, *event)
+	return nil
+}
+
+// Events returns the events delivered so far.
+func (s *MemorySink) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Event(nil), s.events...)
+}
+
+// SetError makes every delivery fail with err until it is reset with nil.
+func (s *MemorySink) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
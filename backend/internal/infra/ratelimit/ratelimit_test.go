@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	policy := Policy{Requests: 2, Period: time.Second, Burst: 3}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("burst then reject", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		for i := 0; i < 3; i++ {
+			res, err := store.Take(context.Background(), "k", policy, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !res.Allowed {
+				t.Fatalf("request %d: expected allowed", i+1)
+			}
+			if res.Remaining != 2-i {
+				t.Fatalf("request %d: expected remaining %d, got %d", i+1, 2-i, res.Remaining)
+			}
+		}
+
+		res, _ := store.Take(context.Background(), "k", policy, now)
+		if res.Allowed {
+			t.Fatalf("expected request over burst to be rejected")
+		}
+		if res.RetryAfter != 500*time.Millisecond {
+			t.Fatalf("expected retry after 500ms, got %s", res.RetryAfter)
+		}
+		if res.Reset != 1500*time.Millisecond {
+			t.Fatalf("expected reset 1.5s, got %s", res.Reset)
+		}
+	})
+
+	t.Run("refills over time", func(t *testing.T) {
+		store := NewMemoryStore()
+		for i := 0; i < 3; i++ {
+			_, _ = store.Take(context.Background(), "k", policy, now)
+		}
+
+		res, _ := store.Take(context.Background(), "k", policy, now.Add(500*time.Millisecond))
+		if !res.Allowed {
+			t.Fatalf("expected a refilled token")
+		}
+		res, _ = store.Take(context.Background(), "k", policy, now.Add(500*time.Millisecond))
+		if res.Allowed {
+			t.Fatalf("expected bucket to be empty again")
+		}
+	})
+
+	t.Run("keys are independent", func(t *testing.T) {
+		store := NewMemoryStore()
+		for i := 0; i < 3; i++ {
+			_, _ = store.Take(context.Background(), "a", policy, now)
+		}
+
+		res, _ := store.Take(context.Background(), "b", policy, now)
+		if !res.Allowed {
+			t.Fatalf("expected other key to be allowed")
+		}
+	})
+}
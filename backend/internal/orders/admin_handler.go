@@ -0,0 +1,196 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/pagination"
+)
+
+// RegisterAdminRoutes registers admin order routes. There is no route to mark
+// an order paid: that only happens when a payment is captured, so every paid
+// order has a payment to refund against.
+func (h *Handler) RegisterAdminRoutes(r *gin.RouterGroup) {
+	g := r.Group("/orders")
+
+	g.GET("/", h.adminList)
+	g.GET("/:id", h.adminGetByID)
+	g.POST("/:id/ship", h.adminTransition(OrderStatusShipped))
+	g.POST("/:id/deliver", h.adminTransition(OrderStatusDelivered))
+}
+
+func (h *Handler) adminList(c *gin.Context) {
+	page, err := pagination.Parse(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_pagination",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	filter, err := parseListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_filter",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ordersList, err := h.service.List(c.Request.Context(), filter, page)
+	if err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_list_orders",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, ordersList)
+}
+
+func (h *Handler) adminGetByID(c *gin.Context) {
+	id, err := parseIDParam(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_id",
+			"message": "id must be a positive integer",
+		})
+		return
+	}
+
+	details, err := h.service.GetDetails(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "order_not_found",
+				"message": "order not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_order",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, details)
+}
+
+func (h *Handler) adminTransition(status OrderStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := parseIDParam(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_id",
+				"message": "id must be a positive integer",
+			})
+			return
+		}
+
+		actor, _ := actorFromContext(c)
+
+		order, err := h.service.ChangeStatus(c.Request.Context(), id, status, actor.UserID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error":   "order_not_found",
+					"message": "order not found",
+				})
+				return
+			}
+
+			if domain.IsConflictError(err) {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":   "invalid_status_transition",
+					"message": err.Error(),
+				})
+				return
+			}
+
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "failed_to_update_order_status",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+func parseListFilter(c *gin.Context) (ListFilter, error) {
+	var filter ListFilter
+
+	filter.Status = OrderStatus(c.Query("status"))
+
+	if raw := c.Query("user_id"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v <= 0 {
+			return ListFilter{}, errors.New("user_id must be a positive integer")
+		}
+		filter.UserID = v
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"created_from", &filter.CreatedFrom},
+		{"created_to", &filter.CreatedTo},
+	} {
+		raw := c.Query(p.name)
+		if raw == "" {
+			continue
+		}
+		t, err := parseTimeParam(raw)
+		if err != nil {
+			return ListFilter{}, fmt.Errorf("%s must be an RFC 3339 timestamp or YYYY-MM-DD date", p.name)
+		}
+		*p.dst = &t
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **int64
+	}{
+		{"min_total", &filter.MinTotal},
+		{"max_total", &filter.MaxTotal},
+	} {
+		raw := c.Query(p.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return ListFilter{}, fmt.Errorf("%s must be an integer", p.name)
+		}
+		*p.dst = &v
+	}
+
+	return filter, nil
+}
+
+func parseTimeParam(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
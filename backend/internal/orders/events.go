@@ -0,0 +1,69 @@
+package orders
+
+import (
+	"context"
+	"fmt"
+
+	"go-shop-app-backend/internal/infra/outbox"
+	"go-shop-app-backend/internal/products"
+)
+
+const (
+	EventOrderCreated   = "order.created"
+	EventOrderPaid      = "order.paid"
+	EventOrderCancelled = "order.cancelled"
+)
+
+// OrderEvent is the payload of order events. ChangedBy is the acting user,
+// omitted for system changes such as expiry.
+type OrderEvent struct {
+	OrderID    int64       `json:"order_id"`
+	UserID     int64       `json:"user_id"`
+	Status     OrderStatus `json:"status"`
+	TotalPrice int64       `json:"total_price"`
+	Items      []OrderItem `json:"items,omitempty"`
+	ChangedBy  int64       `json:"changed_by,omitempty"`
+}
+
+func (s *service) emitOrderEvent(ctx context.Context, eventType string, o *Order, changedBy int64) error {
+	return s.emit(ctx, eventType, "order", o.ID, OrderEvent{
+		OrderID:    o.ID,
+		UserID:     o.UserID,
+		Status:     o.Status,
+		TotalPrice: o.TotalPrice,
+		Items:      o.Items,
+		ChangedBy:  changedBy,
+	})
+}
+
+// checkLowStock emits products.EventStockLow when taking quantity units
+// drops the product to the threshold or below.
+func (s *service) checkLowStock(ctx context.Context, p *products.Product, quantity int64) error {
+	threshold := s.opts.LowStockThreshold
+	if threshold <= 0 || p.Stock <= threshold || p.Stock-quantity > threshold {
+		return nil
+	}
+
+	return s.emit(ctx, products.EventStockLow, "product", p.ID, products.StockLowEvent{
+		ProductID: p.ID,
+		Name:      p.Name,
+		Stock:     p.Stock - quantity,
+		Threshold: threshold,
+	})
+}
+
+func (s *service) emit(ctx context.Context, eventType, aggregateType string, id int64, payload any) error {
+	if s.opts.Events == nil {
+		return nil
+	}
+
+	msg, err := outbox.NewMessage(eventType, aggregateType, id, payload)
+	if err != nil {
+		return err
+	}
+	if err := s.opts.Events.Add(ctx, msg); err != nil {
+		return fmt.Errorf("record %s event: %w", eventType, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package orders
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-shop-app-backend/pkg/logger"
+)
+
+type ExpiryOptions struct {
+	// TTL is how long an order may stay pending.
+	TTL time.Duration
+	// Interval is the pause between sweeps.
+	Interval time.Duration
+	// BatchSize caps the orders cancelled per transaction.
+	BatchSize int
+}
+
+// ExpiryScheduler periodically cancels pending orders older than the TTL,
+// releasing their reserved stock; each cancellation records an
+// EventOrderCancelled without ChangedBy. Rows are claimed with SKIP LOCKED,
+// so any number of instances can run it side by side.
+type ExpiryScheduler struct {
+	service Service
+	opts    ExpiryOptions
+	now     func() time.Time
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewExpiryScheduler(service Service, opts ExpiryOptions) *ExpiryScheduler {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	return &ExpiryScheduler{
+		service: service,
+		opts:    opts,
+		now:     time.Now,
+	}
+}
+
+// Start runs sweeps in the background until Stop is called. Calling Start
+// on a running scheduler does nothing.
+func (s *ExpiryScheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go s.loop(ctx, s.done)
+}
+
+// Stop cancels the running sweep and waits for it to finish or for ctx to
+// end.
+func (s *ExpiryScheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done = nil, nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stop order expiry: %w", ctx.Err())
+	}
+}
+
+func (s *ExpiryScheduler) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.RunOnce(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logger.Error("order expiry sweep failed", "error", err)
+		case n > 0:
+			logger.Info("expired pending orders", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce cancels every pending order past the TTL, one batch per
+// transaction, and returns how many orders were expired.
+func (s *ExpiryScheduler) RunOnce(ctx context.Context) (int, error) {
+	cutoff := s.now().Add(-s.opts.TTL)
+	total := 0
+
+	for ctx.Err() == nil {
+		expired, err := s.service.ExpirePending(ctx, cutoff, s.opts.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		total += len(expired)
+
+		if len(expired) < s.opts.BatchSize {
+			break
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,161 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// expiringRepo serves pending orders to ListExpiredPendingForUpdate in
+// batches, the way SKIP LOCKED hands out rows, and records the writes.
+func expiringRepo(pending []*Order, cutoffs *[]time.Time, history *[]int64) *mockOrderRepo {
+	return &mockOrderRepo{
+		listExpiredFn: func(ctx context.Context, before time.Time, limit int) ([]*Order, error) {
+			*cutoffs = append(*cutoffs, before)
+			n := min(limit, len(pending))
+			batch := pending[:n]
+			pending = pending[n:]
+			return batch, nil
+		},
+		updateStatusFn: func(ctx context.Context, id int64, status OrderStatus) error {
+			return nil
+		},
+		addStatusHistoryFn: func(ctx context.Context, orderID int64, from, to OrderStatus, changedBy int64) error {
+			if from != OrderStatusPending || to != OrderStatusCancelled || changedBy != 0 {
+				return errUnexpectedHistory
+			}
+			*history = append(*history, orderID)
+			return nil
+		},
+	}
+}
+
+var errUnexpectedHistory = errors.New("unexpected status change")
+
+func stalePending(ids ...int64) []*Order {
+	orders := make([]*Order, 0, len(ids))
+	for _, id := range ids {
+		orders = append(orders, &Order{
+			ID:         id,
+			UserID:     10,
+			Status:     OrderStatusPending,
+			TotalPrice: 100,
+			Items:      []OrderItem{{ProductID: id, Quantity: 2}},
+		})
+	}
+	return orders
+}
+
+func TestService_ExpirePending(t *testing.T) {
+	var (
+		cutoffs []time.Time
+		history []int64
+	)
+	store := newMockProductStore()
+	tx := &fakeTx{}
+	svc := NewService(expiringRepo(stalePending(1, 2), &cutoffs, &history), store, tx, nil, Options{})
+
+	before := time.Now().Add(-time.Hour)
+	expired, err := svc.ExpirePending(context.Background(), before, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(expired) != 2 || expired[0].Status != OrderStatusCancelled || expired[1].Status != OrderStatusCancelled {
+		t.Fatalf("unexpected expired orders: %+v", expired)
+	}
+	if store.adjusted[1] != 2 || store.adjusted[2] != 2 {
+		t.Fatalf("stock not released: %v", store.adjusted)
+	}
+	if len(history) != 2 || tx.calls != 1 || !cutoffs[0].Equal(before) {
+		t.Fatalf("unexpected writes: history %v, tx calls %d, cutoffs %v", history, tx.calls, cutoffs)
+	}
+
+	if _, err := svc.ExpirePending(context.Background(), before, 0); err == nil {
+		t.Fatal("expected error for non-positive limit")
+	}
+}
+
+func TestExpiryScheduler_RunOnce(t *testing.T) {
+	var (
+		cutoffs []time.Time
+		history []int64
+	)
+	store := newMockProductStore()
+	events := &recordingEvents{}
+	svc := NewService(expiringRepo(stalePending(1, 2, 3), &cutoffs, &history), store, &fakeTx{}, nil, Options{Events: events})
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	scheduler := NewExpiryScheduler(svc, ExpiryOptions{
+		TTL:       30 * time.Minute,
+		Interval:  time.Minute,
+		BatchSize: 2,
+	})
+	scheduler.now = func() time.Time { return now }
+
+	n, err := scheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expired %d orders, want 3", n)
+	}
+
+	// Two full batches are not enough to know the backlog is drained.
+	if len(cutoffs) != 2 || !cutoffs[0].Equal(now.Add(-30*time.Minute)) {
+		t.Fatalf("unexpected sweeps: %v", cutoffs)
+	}
+	if len(events.messages) != 3 {
+		t.Fatalf("recorded %d events, want 3", len(events.messages))
+	}
+	for i, m := range events.messages {
+		var payload OrderEvent
+		if err := json.Unmarshal(m.Payload, &payload); err != nil {
+			t.Fatalf("decode event %d: %v", i, err)
+		}
+		if m.Type != EventOrderCancelled || payload.OrderID != int64(i+1) || payload.Status != OrderStatusCancelled || payload.ChangedBy != 0 {
+			t.Fatalf("unexpected event %d: %s %+v", i, m.Type, payload)
+		}
+	}
+}
+
+func TestExpiryScheduler_StartStop(t *testing.T) {
+	var (
+		cutoffs []time.Time
+		history []int64
+	)
+	swept := make(chan struct{}, 1)
+	repo := expiringRepo(nil, &cutoffs, &history)
+	list := repo.listExpiredFn
+	repo.listExpiredFn = func(ctx context.Context, before time.Time, limit int) ([]*Order, error) {
+		select {
+		case swept <- struct{}{}:
+		default:
+		}
+		return list(ctx, before, limit)
+	}
+
+	scheduler := NewExpiryScheduler(NewService(repo, newMockProductStore(), &fakeTx{}, nil, Options{}), ExpiryOptions{
+		TTL:      time.Minute,
+		Interval: time.Hour,
+	})
+	scheduler.Start()
+	scheduler.Start()
+
+	select {
+	case <-swept:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler did not sweep on start")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := scheduler.Stop(ctx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := scheduler.Stop(ctx); err != nil {
+		t.Fatalf("second stop: %v", err)
+	}
+}
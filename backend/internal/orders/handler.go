@@ -8,27 +8,35 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/middleware"
+	"go-shop-app-backend/internal/infra/http/pagination"
 )
 
 type Handler struct {
-	service Service
+	service     Service
+	idempotency gin.HandlerFunc
 }
 
-func NewHandler(service Service) *Handler {
-	return &Handler{service: service}
+// NewHandler builds the handler. idempotency, typically
+// middleware.Idempotency, guards order creation; nil disables it.
+func NewHandler(service Service, idempotency gin.HandlerFunc) *Handler {
+	if idempotency == nil {
+		idempotency = func(c *gin.Context) { c.Next() }
+	}
+	return &Handler{service: service, idempotency: idempotency}
 }
 
 func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 	g := r.Group("/orders")
 
-	g.POST("/", h.createOrder)
+	g.POST("/", h.idempotency, h.createOrder)
 	g.GET("/:id", h.getByID)
 	g.GET("/me", h.listMy)
 	g.POST("/:id/cancel", h.cancel)
 }
 
 func (h *Handler) createOrder(c *gin.Context) {
-	userIDVal, ok := c.Get("userID")
+	actor, ok := actorFromContext(c)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error":   "unauthorized",
@@ -37,15 +45,6 @@ func (h *Handler) createOrder(c *gin.Context) {
 		return
 	}
 
-	userID, ok := userIDVal.(int64)
-	if !ok || userID <= 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "unauthorized",
-			"message": "invalid user id in context",
-		})
-		return
-	}
-
 	var input CreateOrderInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -55,7 +54,7 @@ func (h *Handler) createOrder(c *gin.Context) {
 		return
 	}
 
-	order, items, err := h.service.CreateOrder(c.Request.Context(), userID, input)
+	order, items, err := h.service.CreateOrder(c.Request.Context(), actor.UserID, input)
 	if err != nil {
 		if domain.IsValidationError(err) {
 			c.JSON(http.StatusBadRequest, gin.H{
@@ -65,6 +64,23 @@ func (h *Handler) createOrder(c *gin.Context) {
 			return
 		}
 
+		if stockErr, ok := domain.AsOutOfStockError(err); ok {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":       "out_of_stock",
+				"message":     "not enough stock for some products",
+				"product_ids": stockErr.ProductIDs,
+			})
+			return
+		}
+
+		if errors.Is(err, domain.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "email_not_verified",
+				"message": "verify your email address before placing orders",
+			})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed_to_create_order",
 			"message": err.Error(),
@@ -87,7 +103,16 @@ func (h *Handler) getByID(c *gin.Context) {
 		return
 	}
 
-	order, items, err := h.service.GetByID(c.Request.Context(), id)
+	actor, ok := actorFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "user is not authenticated",
+		})
+		return
+	}
+
+	order, items, err := h.service.GetByID(c.Request.Context(), id, actor)
 	if err != nil {
 		if errors.Is(err, domain.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -118,7 +143,7 @@ func (h *Handler) getByID(c *gin.Context) {
 }
 
 func (h *Handler) listMy(c *gin.Context) {
-	userIDVal, ok := c.Get("userID")
+	actor, ok := actorFromContext(c)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"error":   "unauthorized",
@@ -127,16 +152,7 @@ func (h *Handler) listMy(c *gin.Context) {
 		return
 	}
 
-	userID, ok := userIDVal.(int64)
-	if !ok || userID <= 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "unauthorized",
-			"message": "invalid user id in context",
-		})
-		return
-	}
-
-	page, limit, err := parsePagination(c)
+	page, err := pagination.Parse(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "invalid_pagination",
@@ -145,7 +161,7 @@ func (h *Handler) listMy(c *gin.Context) {
 		return
 	}
 
-	ordersList, err := h.service.ListByUser(c.Request.Context(), userID, page, limit)
+	ordersList, err := h.service.ListByUser(c.Request.Context(), actor.UserID, page)
 	if err != nil {
 		if domain.IsValidationError(err) {
 			c.JSON(http.StatusBadRequest, gin.H{
@@ -165,7 +181,6 @@ func (h *Handler) listMy(c *gin.Context) {
 	c.JSON(http.StatusOK, ordersList)
 }
 
-
 func (h *Handler) cancel(c *gin.Context) {
 	id, err := parseIDParam(c.Param("id"))
 	if err != nil {
@@ -176,7 +191,16 @@ func (h *Handler) cancel(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.Cancel(c.Request.Context(), id); err != nil {
+	actor, ok := actorFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "user is not authenticated",
+		})
+		return
+	}
+
+	if err := h.service.Cancel(c.Request.Context(), id, actor); err != nil {
 		if errors.Is(err, domain.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{
 				"error":   "order_not_found",
@@ -185,6 +209,14 @@ func (h *Handler) cancel(c *gin.Context) {
 			return
 		}
 
+		if domain.IsConflictError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "invalid_status_transition",
+				"message": err.Error(),
+			})
+			return
+		}
+
 		if domain.IsValidationError(err) {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "validation_error",
@@ -203,6 +235,17 @@ func (h *Handler) cancel(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
+func actorFromContext(c *gin.Context) (Actor, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok || userID <= 0 {
+		return Actor{}, false
+	}
+
+	role, _ := middleware.GetUserRole(c)
+
+	return Actor{UserID: userID, Role: role}, true
+}
+
 func parseIDParam(raw string) (int64, error) {
 	id, err := strconv.ParseInt(raw, 10, 64)
 	if err != nil || id <= 0 {
@@ -210,32 +253,3 @@ func parseIDParam(raw string) (int64, error) {
 	}
 	return id, nil
 }
-
-func parsePagination(c *gin.Context) (int, int, error) {
-	pageStr := c.Query("page")
-	limitStr := c.Query("limit")
-
-	page := 1
-	limit := 20
-
-	if pageStr != "" {
-		v, err := strconv.Atoi(pageStr)
-		if err != nil || v <= 0 {
-			return 0, 0, errors.New("page must be a positive integer")
-		}
-		page = v
-	}
-
-	if limitStr != "" {
-		v, err := strconv.Atoi(limitStr)
-		if err != nil || v <= 0 {
-			return 0, 0, errors.New("limit must be a positive integer")
-		}
-		if v > 100 {
-			return 0, 0, errors.New("limit must be less than or equal to 100")
-		}
-		limit = v
-	}
-
-	return page, limit, nil
-}
@@ -1,40 +1,132 @@
 package orders
 
-import "time"
+import (
+	"time"
+
+	"go-shop-app-backend/internal/domain"
+)
 
 type OrderStatus string
 
 const (
 	OrderStatusPending   OrderStatus = "pending"
 	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusShipped   OrderStatus = "shipped"
+	OrderStatusDelivered OrderStatus = "delivered"
 	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRefunded  OrderStatus = "refunded"
+
+	OrderStatusPartiallyRefunded OrderStatus = "partially_refunded"
 )
 
+// orderTransitions lists the statuses each status may move to. Statuses
+// without an entry are terminal.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusShipped, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusDelivered: {OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusPartiallyRefunded: {
+		OrderStatusShipped, OrderStatusDelivered, OrderStatusPartiallyRefunded, OrderStatusRefunded,
+	},
+}
+
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusShipped,
+		OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded,
+		OrderStatusPartiallyRefunded:
+		return true
+	}
+	return false
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Refunded reports whether the status follows a full or partial refund.
+func (s OrderStatus) Refunded() bool {
+	return s == OrderStatusRefunded || s == OrderStatusPartiallyRefunded
+}
+
 type OrderItem struct {
-	ID         int64 `json:"id"`
-	OrderID    int64 `json:"order_id"`
-	ProductID  int64 `json:"product_id"`
-	Quantity   int64 `json:"quantity"`
-	UnitPrice  int64 `json:"unit_price"`
-	TotalPrice int64 `json:"total_price"`
+	ID               int64 `json:"id"`
+	OrderID          int64 `json:"order_id"`
+	ProductID        int64 `json:"product_id"`
+	Quantity         int64 `json:"quantity"`
+	RefundedQuantity int64 `json:"refunded_quantity"`
+	UnitPrice        int64 `json:"unit_price"`
+	TotalPrice       int64 `json:"total_price"`
 }
 
 type Order struct {
-	ID         int64       `json:"id"`
-	UserID     int64       `json:"user_id"`
-	Status     OrderStatus `json:"status"`
-	TotalPrice int64       `json:"total_price"`
-	Items      []OrderItem `json:"items,omitempty"`
-	CreatedAt  time.Time   `json:"created_at"`
-	UpdatedAt  time.Time   `json:"updated_at"`
+	ID             int64       `json:"id"`
+	UserID         int64       `json:"user_id"`
+	Status         OrderStatus `json:"status"`
+	TotalPrice     int64       `json:"total_price"`
+	RefundedAmount int64       `json:"refunded_amount"`
+	Items          []OrderItem `json:"items,omitempty"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// RefundLine refunds Quantity units of one order item. Amount is filled in
+// by the service from the item's unit price.
+type RefundLine struct {
+	OrderItemID int64 `json:"order_item_id"`
+	Quantity    int64 `json:"quantity"`
+	Amount      int64 `json:"amount"`
 }
 
 type CreateOrderItemInput struct {
 	ProductID int64 `json:"product_id"`
 	Quantity  int64 `json:"quantity"`
-	UnitPrice int64 `json:"unit_price"`
 }
 
 type CreateOrderInput struct {
 	Items []CreateOrderItemInput `json:"items"`
 }
+
+// ListFilter narrows the admin order listing. Zero values mean "any".
+type ListFilter struct {
+	Status      OrderStatus
+	UserID      int64
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	MinTotal    *int64
+	MaxTotal    *int64
+}
+
+type UserSummary struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type OrderDetails struct {
+	Order
+	User *UserSummary `json:"user"`
+}
+
+// Actor identifies the caller of an order operation.
+type Actor struct {
+	UserID int64
+	Role   string
+}
+
+func (a Actor) IsAdmin() bool {
+	return a.Role == string(domain.UserRoleAdmin)
+}
+
+// CanAccess reports whether the actor may see or act on the order. Other
+// users' orders are reported as not found rather than forbidden so their
+// existence is not leaked.
+func (a Actor) CanAccess(o *Order) bool {
+	return a.IsAdmin() || (a.UserID > 0 && o.UserID == a.UserID)
+}
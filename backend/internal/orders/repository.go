@@ -1,11 +1,32 @@
 package orders
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"go-shop-app-backend/internal/infra/http/pagination"
+	"go-shop-app-backend/internal/products"
+)
 
 type Repository interface {
 	CreateOrder(ctx context.Context, userID int64, totalPrice int64) (*Order, error)
-	AddOrderItems(ctx context.Context, orderID int64, items []CreateOrderItemInput) ([]OrderItem, error)
+	AddOrderItems(ctx context.Context, orderID int64, items []OrderItem) ([]OrderItem, error)
 	GetByID(ctx context.Context, id int64) (*Order, []OrderItem, error)
-	ListByUser(ctx context.Context, userID int64, limit, offset int) ([]*Order, error)
+	GetByIDForUpdate(ctx context.Context, id int64) (*Order, []OrderItem, error)
+	List(ctx context.Context, filter ListFilter, page pagination.Params) ([]*Order, error)
+	Count(ctx context.Context, filter ListFilter) (int64, error)
+	GetUserSummary(ctx context.Context, userID int64) (*UserSummary, error)
 	UpdateStatus(ctx context.Context, id int64, status OrderStatus) error
+	AddStatusHistory(ctx context.Context, orderID int64, from, to OrderStatus, changedBy int64) error
+	AddRefundedQuantity(ctx context.Context, itemID int64, quantity int64) error
+	AddRefundedAmount(ctx context.Context, orderID int64, amount int64) error
+	ListExpiredPendingForUpdate(ctx context.Context, before time.Time, limit int) ([]*Order, error)
+	HasPaymentInFlight(ctx context.Context, orderID int64) (bool, error)
+}
+
+// ProductStore is the part of products.Repository that orders need to price
+// items and reserve stock.
+type ProductStore interface {
+	GetByIDsForUpdate(ctx context.Context, ids []int64) ([]*products.Product, error)
+	AdjustStock(ctx context.Context, id int64, delta int64) error
 }
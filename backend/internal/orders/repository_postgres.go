@@ -5,8 +5,14 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 
 	"go-shop-app-backend/internal/domain"
+	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/infra/http/pagination"
 )
 
 type postgresRepository struct {
@@ -17,15 +23,19 @@ func NewPostgresRepository(db *sql.DB) Repository {
 	return &postgresRepository{db: db}
 }
 
+func (r *postgresRepository) conn(ctx context.Context) infraDB.DBTX {
+	return infraDB.Conn(ctx, r.db)
+}
+
 func (r *postgresRepository) CreateOrder(ctx context.Context, userID int64, totalPrice int64) (*Order, error) {
 	const query = `
         INSERT INTO orders (user_id, status, total_price)
         VALUES ($1, $2, $3)
-        RETURNING id, user_id, status, total_price, created_at, updated_at
+        RETURNING id, user_id, status, total_price, refunded_amount, created_at, updated_at
     `
 
 	var o Order
-	err := r.db.QueryRowContext(
+	err := r.conn(ctx).QueryRowContext(
 		ctx,
 		query,
 		userID,
@@ -36,6 +46,7 @@ func (r *postgresRepository) CreateOrder(ctx context.Context, userID int64, tota
 		&o.UserID,
 		&o.Status,
 		&o.TotalPrice,
+		&o.RefundedAmount,
 		&o.CreatedAt,
 		&o.UpdatedAt,
 	)
@@ -46,38 +57,32 @@ func (r *postgresRepository) CreateOrder(ctx context.Context, userID int64, tota
 	return &o, nil
 }
 
-func (r *postgresRepository) AddOrderItems(ctx context.Context, orderID int64, items []CreateOrderItemInput) ([]OrderItem, error) {
+func (r *postgresRepository) AddOrderItems(ctx context.Context, orderID int64, items []OrderItem) ([]OrderItem, error) {
 	const query = `
         INSERT INTO order_items (order_id, product_id, quantity, unit_price, total_price)
         VALUES ($1, $2, $3, $4, $5)
-        RETURNING id, order_id, product_id, quantity, unit_price, total_price
+        RETURNING id, order_id, product_id, quantity, refunded_quantity, unit_price, total_price
     `
 
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, fmt.Errorf("begin tx: %w", err)
-	}
-	defer tx.Rollback()
-
-	var result []OrderItem
+	result := make([]OrderItem, 0, len(items))
 
 	for _, it := range items {
 		var row OrderItem
-		total := it.UnitPrice * it.Quantity
 
-		err := tx.QueryRowContext(
+		err := r.conn(ctx).QueryRowContext(
 			ctx,
 			query,
 			orderID,
 			it.ProductID,
 			it.Quantity,
 			it.UnitPrice,
-			total,
+			it.UnitPrice*it.Quantity,
 		).Scan(
 			&row.ID,
 			&row.OrderID,
 			&row.ProductID,
 			&row.Quantity,
+			&row.RefundedQuantity,
 			&row.UnitPrice,
 			&row.TotalPrice,
 		)
@@ -88,32 +93,35 @@ func (r *postgresRepository) AddOrderItems(ctx context.Context, orderID int64, i
 		result = append(result, row)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("commit order items tx: %w", err)
-	}
-
 	return result, nil
 }
 
 func (r *postgresRepository) GetByID(ctx context.Context, id int64) (*Order, []OrderItem, error) {
-	const orderQuery = `
-        SELECT id, user_id, status, total_price, created_at, updated_at
+	return r.getByID(ctx, id, false)
+}
+
+// GetByIDForUpdate locks the order row until the surrounding transaction ends.
+func (r *postgresRepository) GetByIDForUpdate(ctx context.Context, id int64) (*Order, []OrderItem, error) {
+	return r.getByID(ctx, id, true)
+}
+
+func (r *postgresRepository) getByID(ctx context.Context, id int64, forUpdate bool) (*Order, []OrderItem, error) {
+	orderQuery := `
+        SELECT id, user_id, status, total_price, refunded_amount, created_at, updated_at
         FROM orders
         WHERE id = $1
     `
-
-	const itemsQuery = `
-        SELECT id, order_id, product_id, quantity, unit_price, total_price
-        FROM order_items
-        WHERE order_id = $1
-    `
+	if forUpdate {
+		orderQuery += " FOR UPDATE"
+	}
 
 	var o Order
-	err := r.db.QueryRowContext(ctx, orderQuery, id).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, orderQuery, id).Scan(
 		&o.ID,
 		&o.UserID,
 		&o.Status,
 		&o.TotalPrice,
+		&o.RefundedAmount,
 		&o.CreatedAt,
 		&o.UpdatedAt,
 	)
@@ -124,9 +132,25 @@ func (r *postgresRepository) GetByID(ctx context.Context, id int64) (*Order, []O
 		return nil, nil, fmt.Errorf("get order by id: %w", err)
 	}
 
-	rows, err := r.db.QueryContext(ctx, itemsQuery, id)
+	items, err := r.listItems(ctx, id)
 	if err != nil {
-		return nil, nil, fmt.Errorf("query order items: %w", err)
+		return nil, nil, err
+	}
+
+	return &o, items, nil
+}
+
+func (r *postgresRepository) listItems(ctx context.Context, orderID int64) ([]OrderItem, error) {
+	const query = `
+        SELECT id, order_id, product_id, quantity, refunded_quantity, unit_price, total_price
+        FROM order_items
+        WHERE order_id = $1
+        ORDER BY id
+    `
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("query order items: %w", err)
 	}
 	defer rows.Close()
 
@@ -138,33 +162,44 @@ func (r *postgresRepository) GetByID(ctx context.Context, id int64) (*Order, []O
 			&it.OrderID,
 			&it.ProductID,
 			&it.Quantity,
+			&it.RefundedQuantity,
 			&it.UnitPrice,
 			&it.TotalPrice,
 		); err != nil {
-			return nil, nil, fmt.Errorf("scan order item: %w", err)
+			return nil, fmt.Errorf("scan order item: %w", err)
 		}
 		items = append(items, it)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, nil, fmt.Errorf("rows error: %w", err)
+		return nil, fmt.Errorf("rows error: %w", err)
 	}
 
-	return &o, items, nil
+	return items, nil
 }
 
-func (r *postgresRepository) ListByUser(ctx context.Context, userID int64, limit, offset int) ([]*Order, error) {
+// ListExpiredPendingForUpdate locks up to limit pending orders created
+// before the cutoff, oldest first, and loads their items. Rows locked by
+// another transaction are skipped so several instances can expire orders
+// concurrently. Orders with a payment in flight are left alone.
+func (r *postgresRepository) ListExpiredPendingForUpdate(ctx context.Context, before time.Time, limit int) ([]*Order, error) {
 	const query = `
-        SELECT id, user_id, status, total_price, created_at, updated_at
-        FROM orders
-        WHERE user_id = $1
-        ORDER BY created_at DESC
-        LIMIT $2 OFFSET $3
+        SELECT o.id, o.user_id, o.status, o.total_price, o.refunded_amount, o.created_at, o.updated_at
+        FROM orders o
+        WHERE o.status = $1
+          AND o.created_at < $2
+          AND NOT EXISTS (
+              SELECT 1 FROM payments p
+              WHERE p.order_id = o.id AND p.status IN ('pending', 'processing')
+          )
+        ORDER BY o.created_at, o.id
+        LIMIT $3
+        FOR UPDATE OF o SKIP LOCKED
     `
 
-	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, OrderStatusPending, before, limit)
 	if err != nil {
-		return nil, fmt.Errorf("query orders by user: %w", err)
+		return nil, fmt.Errorf("query expired orders: %w", err)
 	}
 	defer rows.Close()
 
@@ -176,6 +211,100 @@ func (r *postgresRepository) ListByUser(ctx context.Context, userID int64, limit
 			&o.UserID,
 			&o.Status,
 			&o.TotalPrice,
+			&o.RefundedAmount,
+			&o.CreatedAt,
+			&o.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan expired order: %w", err)
+		}
+		orders = append(orders, &o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	rows.Close()
+
+	for _, o := range orders {
+		if o.Items, err = r.listItems(ctx, o.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return orders, nil
+}
+
+func listConditions(filter ListFilter) ([]string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+
+	addCondition := func(expr string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.Status != "" {
+		addCondition("status = $%d", filter.Status)
+	}
+	if filter.UserID > 0 {
+		addCondition("user_id = $%d", filter.UserID)
+	}
+	if filter.CreatedFrom != nil {
+		addCondition("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		addCondition("created_at < $%d", *filter.CreatedTo)
+	}
+	if filter.MinTotal != nil {
+		addCondition("total_price >= $%d", *filter.MinTotal)
+	}
+	if filter.MaxTotal != nil {
+		addCondition("total_price <= $%d", *filter.MaxTotal)
+	}
+
+	return conditions, args
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+func (r *postgresRepository) List(ctx context.Context, filter ListFilter, page pagination.Params) ([]*Order, error) {
+	conditions, args := listConditions(filter)
+
+	if page.Cursor != nil {
+		args = append(args, page.Cursor.CreatedAt, page.Cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `
+        SELECT id, user_id, status, total_price, refunded_amount, created_at, updated_at
+        FROM orders
+    ` + whereClause(conditions)
+
+	args = append(args, page.Limit, page.Offset())
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []*Order
+	for rows.Next() {
+		var o Order
+		if err := rows.Scan(
+			&o.ID,
+			&o.UserID,
+			&o.Status,
+			&o.TotalPrice,
+			&o.RefundedAmount,
 			&o.CreatedAt,
 			&o.UpdatedAt,
 		); err != nil {
@@ -191,6 +320,36 @@ func (r *postgresRepository) ListByUser(ctx context.Context, userID int64, limit
 	return orders, nil
 }
 
+func (r *postgresRepository) Count(ctx context.Context, filter ListFilter) (int64, error) {
+	conditions, args := listConditions(filter)
+
+	var total int64
+	if err := r.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM orders"+whereClause(conditions), args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("count orders: %w", err)
+	}
+
+	return total, nil
+}
+
+func (r *postgresRepository) GetUserSummary(ctx context.Context, userID int64) (*UserSummary, error) {
+	const query = `
+        SELECT id, email, name
+        FROM users
+        WHERE id = $1
+    `
+
+	var u UserSummary
+	err := r.conn(ctx).QueryRowContext(ctx, query, userID).Scan(&u.ID, &u.Email, &u.Name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get order user: %w", err)
+	}
+
+	return &u, nil
+}
+
 func (r *postgresRepository) UpdateStatus(ctx context.Context, id int64, status OrderStatus) error {
 	const query = `
         UPDATE orders
@@ -198,7 +357,7 @@ func (r *postgresRepository) UpdateStatus(ctx context.Context, id int64, status
         WHERE id = $2
     `
 
-	res, err := r.db.ExecContext(ctx, query, status, id)
+	res, err := r.conn(ctx).ExecContext(ctx, query, status, id)
 	if err != nil {
 		return fmt.Errorf("update order status: %w", err)
 	}
@@ -214,3 +373,88 @@ func (r *postgresRepository) UpdateStatus(ctx context.Context, id int64, status
 
 	return nil
 }
+
+func (r *postgresRepository) AddStatusHistory(ctx context.Context, orderID int64, from, to OrderStatus, changedBy int64) error {
+	const query = `
+        INSERT INTO order_status_history (order_id, from_status, to_status, changed_by)
+        VALUES ($1, $2, $3, $4)
+    `
+
+	_, err := r.conn(ctx).ExecContext(
+		ctx,
+		query,
+		orderID,
+		sql.NullString{String: string(from), Valid: from != ""},
+		to,
+		sql.NullInt64{Int64: changedBy, Valid: changedBy > 0},
+	)
+	if err != nil {
+		return fmt.Errorf("insert order status history: %w", err)
+	}
+
+	return nil
+}
+
+// AddRefundedQuantity marks more units of an item as refunded. The database
+// refuses to refund more units than were ordered.
+func (r *postgresRepository) AddRefundedQuantity(ctx context.Context, itemID int64, quantity int64) error {
+	const query = `
+        UPDATE order_items
+        SET refunded_quantity = refunded_quantity + $1
+        WHERE id = $2
+    `
+
+	return r.addRefunded(ctx, query, quantity, itemID, "order item")
+}
+
+// AddRefundedAmount adds to the order's refunded total. The database refuses
+// to refund more than the order total.
+func (r *postgresRepository) AddRefundedAmount(ctx context.Context, orderID int64, amount int64) error {
+	const query = `
+        UPDATE orders
+        SET refunded_amount = refunded_amount + $1, updated_at = now()
+        WHERE id = $2
+    `
+
+	return r.addRefunded(ctx, query, amount, orderID, "order")
+}
+
+func (r *postgresRepository) addRefunded(ctx context.Context, query string, delta, id int64, what string) error {
+	res, err := r.conn(ctx).ExecContext(ctx, query, delta, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23514" {
+			return domain.NewConflictError(fmt.Sprintf("refund exceeds %s total", what))
+		}
+		return fmt.Errorf("update %s refund: %w", what, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update %s refund rows affected: %w", what, err)
+	}
+
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// HasPaymentInFlight reports whether the order has a payment whose outcome is
+// not known yet.
+func (r *postgresRepository) HasPaymentInFlight(ctx context.Context, orderID int64) (bool, error) {
+	const query = `
+        SELECT EXISTS (
+            SELECT 1 FROM payments
+            WHERE order_id = $1 AND status IN ('pending', 'processing')
+        )
+    `
+
+	var exists bool
+	if err := r.conn(ctx).QueryRowContext(ctx, query, orderID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("check payments in flight: %w", err)
+	}
+
+	return exists, nil
+}
@@ -2,29 +2,65 @@ package orders
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"go-shop-app-backend/internal/domain"
-	"go-shop-app-backend/pkg/logger"
-	"go-shop-app-backend/pkg/workerpool"
+	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/infra/http/pagination"
+	"go-shop-app-backend/internal/infra/outbox"
+	"go-shop-app-backend/internal/products"
 )
 
 type Service interface {
 	CreateOrder(ctx context.Context, userID int64, input CreateOrderInput) (*Order, []OrderItem, error)
-	GetByID(ctx context.Context, id int64) (*Order, []OrderItem, error)
-	ListByUser(ctx context.Context, userID int64, page, pageSize int) ([]*Order, error)
-	Cancel(ctx context.Context, id int64) error
+	GetByID(ctx context.Context, id int64, actor Actor) (*Order, []OrderItem, error)
+	// GetForUpdate is GetByID that also locks the order until the caller's
+	// transaction ends. It must be called within one.
+	GetForUpdate(ctx context.Context, id int64, actor Actor) (*Order, error)
+	ListByUser(ctx context.Context, userID int64, page pagination.Params) (*pagination.Page[*Order], error)
+	List(ctx context.Context, filter ListFilter, page pagination.Params) (*pagination.Page[*Order], error)
+	GetDetails(ctx context.Context, id int64) (*OrderDetails, error)
+	ChangeStatus(ctx context.Context, id int64, status OrderStatus, changedBy int64) (*Order, error)
+	Cancel(ctx context.Context, id int64, actor Actor) error
+	ApplyRefund(ctx context.Context, id int64, lines []RefundLine, restock bool, changedBy int64) (*Order, []RefundLine, error)
+	RestockRefund(ctx context.Context, id int64, lines []RefundLine) error
+	RevertRefund(ctx context.Context, id int64, lines []RefundLine, status OrderStatus, changedBy int64) error
+	ExpirePending(ctx context.Context, before time.Time, limit int) ([]*Order, error)
+}
+
+// EmailVerifier gates order placement on a verified email address.
+type EmailVerifier interface {
+	EnsureEmailVerified(ctx context.Context, userID int64) error
+}
+
+type Options struct {
+	// Events records domain events in the transaction that causes them;
+	// nil drops them.
+	Events outbox.Writer
+	// LowStockThreshold emits products.EventStockLow when an order leaves a
+	// product with this many units or fewer. Zero disables the event.
+	LowStockThreshold int64
 }
 
 type service struct {
-	repo Repository
-	pool *workerpool.Pool
+	repo     Repository
+	products ProductStore
+	tx       infraDB.Transactor
+	verifier EmailVerifier
+	opts     Options
 }
 
-func NewService(repo Repository, pool *workerpool.Pool) Service {
+// NewService builds the order service. verifier may be nil, in which case
+// unverified users can place orders.
+func NewService(repo Repository, products ProductStore, tx infraDB.Transactor, verifier EmailVerifier, opts Options) Service {
 	return &service{
-		repo: repo,
-		pool: pool,
+		repo:     repo,
+		products: products,
+		tx:       tx,
+		verifier: verifier,
+		opts:     opts,
 	}
 }
 
@@ -36,7 +72,8 @@ func (s *service) CreateOrder(ctx context.Context, userID int64, input CreateOrd
 		return nil, nil, domain.NewValidationError("at least one item is required")
 	}
 
-	var total int64
+	quantities := make(map[int64]int64, len(input.Items))
+	merged := make([]CreateOrderItemInput, 0, len(input.Items))
 	for _, it := range input.Items {
 		if it.ProductID <= 0 {
 			return nil, nil, domain.NewValidationError("product_id must be positive")
@@ -44,38 +81,105 @@ func (s *service) CreateOrder(ctx context.Context, userID int64, input CreateOrd
 		if it.Quantity <= 0 {
 			return nil, nil, domain.NewValidationError("quantity must be positive")
 		}
-		if it.UnitPrice <= 0 {
-			return nil, nil, domain.NewValidationError("unit_price must be positive")
+		if _, seen := quantities[it.ProductID]; !seen {
+			merged = append(merged, CreateOrderItemInput{ProductID: it.ProductID})
 		}
-		total += it.UnitPrice * it.Quantity
+		quantities[it.ProductID] += it.Quantity
+	}
+	for i := range merged {
+		merged[i].Quantity = quantities[merged[i].ProductID]
 	}
 
-	order, err := s.repo.CreateOrder(ctx, userID, total)
-	if err != nil {
-		return nil, nil, fmt.Errorf("create order: %w", err)
+	if s.verifier != nil {
+		if err := s.verifier.EnsureEmailVerified(ctx, userID); err != nil {
+			if errors.Is(err, domain.ErrEmailNotVerified) {
+				return nil, nil, domain.ErrEmailNotVerified
+			}
+			return nil, nil, fmt.Errorf("check email verification: %w", err)
+		}
 	}
 
-	items, err := s.repo.AddOrderItems(ctx, order.ID, input.Items)
-	if err != nil {
-		return nil, nil, fmt.Errorf("add order items: %w", err)
+	ids := make([]int64, 0, len(merged))
+	for _, it := range merged {
+		ids = append(ids, it.ProductID)
 	}
 
-	order.Items = items
+	var (
+		order *Order
+		items []OrderItem
+	)
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		locked, err := s.products.GetByIDsForUpdate(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("lock products: %w", err)
+		}
+
+		byID := make(map[int64]*products.Product, len(locked))
+		for _, p := range locked {
+			byID[p.ID] = p
+		}
+
+		var (
+			total      int64
+			outOfStock []int64
+			lines      = make([]OrderItem, 0, len(merged))
+		)
+		for _, it := range merged {
+			p, ok := byID[it.ProductID]
+			if !ok {
+				return domain.NewValidationError(fmt.Sprintf("product %d not found", it.ProductID))
+			}
+			if p.Stock < it.Quantity {
+				outOfStock = append(outOfStock, it.ProductID)
+				continue
+			}
+			total += p.Price * it.Quantity
+			lines = append(lines, OrderItem{
+				ProductID: it.ProductID,
+				Quantity:  it.Quantity,
+				UnitPrice: p.Price,
+			})
+		}
+
+		if len(outOfStock) > 0 {
+			return domain.NewOutOfStockError(outOfStock)
+		}
+
+		order, err = s.repo.CreateOrder(ctx, userID, total)
+		if err != nil {
+			return fmt.Errorf("create order: %w", err)
+		}
+
+		items, err = s.repo.AddOrderItems(ctx, order.ID, lines)
+		if err != nil {
+			return fmt.Errorf("add order items: %w", err)
+		}
+
+		if err := s.repo.AddStatusHistory(ctx, order.ID, "", OrderStatusPending, userID); err != nil {
+			return fmt.Errorf("record order status: %w", err)
+		}
 
-	if s.pool != nil {
-		_ = s.pool.Submit(func(taskCtx context.Context) {
-			logger.Info("order created asynchronously",
-				"order_id", order.ID,
-				"user_id", order.UserID,
-				"total_price", order.TotalPrice,
-			)
-		})
+		for _, it := range lines {
+			if err := s.products.AdjustStock(ctx, it.ProductID, -it.Quantity); err != nil {
+				return fmt.Errorf("reserve stock: %w", err)
+			}
+			if err := s.checkLowStock(ctx, byID[it.ProductID], it.Quantity); err != nil {
+				return err
+			}
+		}
+
+		order.Items = items
+		return s.emitOrderEvent(ctx, EventOrderCreated, order, userID)
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
 	return order, items, nil
 }
 
-func (s *service) GetByID(ctx context.Context, id int64) (*Order, []OrderItem, error) {
+func (s *service) GetByID(ctx context.Context, id int64, actor Actor) (*Order, []OrderItem, error) {
 	if id <= 0 {
 		return nil, nil, domain.NewValidationError("invalid id")
 	}
@@ -85,39 +189,440 @@ func (s *service) GetByID(ctx context.Context, id int64) (*Order, []OrderItem, e
 		return nil, nil, err
 	}
 
+	if !actor.CanAccess(order) {
+		return nil, nil, domain.ErrNotFound
+	}
+
 	order.Items = items
 
 	return order, items, nil
 }
 
-func (s *service) ListByUser(ctx context.Context, userID int64, page, pageSize int) ([]*Order, error) {
+func (s *service) GetForUpdate(ctx context.Context, id int64, actor Actor) (*Order, error) {
+	if id <= 0 {
+		return nil, domain.NewValidationError("invalid id")
+	}
+
+	order, items, err := s.repo.GetByIDForUpdate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !actor.CanAccess(order) {
+		return nil, domain.ErrNotFound
+	}
+
+	order.Items = items
+
+	return order, nil
+}
+
+func (s *service) ListByUser(ctx context.Context, userID int64, page pagination.Params) (*pagination.Page[*Order], error) {
 	if userID <= 0 {
 		return nil, domain.NewValidationError("invalid user_id")
 	}
 
-	if page <= 0 {
-		page = 1
+	return s.list(ctx, ListFilter{UserID: userID}, page)
+}
+
+func (s *service) List(ctx context.Context, filter ListFilter, page pagination.Params) (*pagination.Page[*Order], error) {
+	if filter.Status != "" && !filter.Status.Valid() {
+		return nil, domain.NewValidationError("unknown status")
+	}
+	if filter.UserID < 0 {
+		return nil, domain.NewValidationError("invalid user_id")
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return nil, domain.NewValidationError("created_from must be before created_to")
+	}
+	if filter.MinTotal != nil && *filter.MinTotal < 0 {
+		return nil, domain.NewValidationError("min_total cannot be negative")
+	}
+	if filter.MinTotal != nil && filter.MaxTotal != nil && *filter.MinTotal > *filter.MaxTotal {
+		return nil, domain.NewValidationError("min_total must be less than or equal to max_total")
+	}
+
+	return s.list(ctx, filter, page)
+}
+
+func (s *service) list(ctx context.Context, filter ListFilter, page pagination.Params) (*pagination.Page[*Order], error) {
+	page = page.WithDefaults()
+	if err := page.Validate(); err != nil {
+		return nil, domain.NewValidationError(err.Error())
+	}
+
+	orders, err := s.repo.List(ctx, filter, page)
+	if err != nil {
+		return nil, fmt.Errorf("list orders: %w", err)
 	}
-	if pageSize <= 0 {
-		pageSize = 20
+
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("count orders: %w", err)
 	}
-	if pageSize > 100 {
-		return nil, domain.NewValidationError("pageSize must be less than or equal to 100")
+
+	return pagination.NewPage(orders, total, page, orderCursor), nil
+}
+
+func orderCursor(o *Order) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: o.CreatedAt, ID: o.ID}
+}
+
+// GetDetails returns the order with a summary of its user. The summary is
+// left empty when the user cannot be found, so an existing order is never
+// reported as missing.
+func (s *service) GetDetails(ctx context.Context, id int64) (*OrderDetails, error) {
+	if id <= 0 {
+		return nil, domain.NewValidationError("invalid id")
+	}
+
+	order, items, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	order.Items = items
+
+	user, err := s.repo.GetUserSummary(ctx, order.UserID)
+	if err != nil && !errors.Is(err, domain.ErrNotFound) {
+		return nil, fmt.Errorf("get order user: %w", err)
 	}
 
-	offset := (page - 1) * pageSize
+	return &OrderDetails{Order: *order, User: user}, nil
+}
 
-	return s.repo.ListByUser(ctx, userID, pageSize, offset)
+// ChangeStatus moves the order along the transition table and records the
+// change. changedBy is the acting user, or 0 for system-initiated changes.
+func (s *service) ChangeStatus(ctx context.Context, id int64, status OrderStatus, changedBy int64) (*Order, error) {
+	if status.Refunded() {
+		return nil, domain.NewValidationError("refund statuses are set by issuing a refund")
+	}
+	return s.changeStatus(ctx, id, status, changedBy, nil)
 }
 
-func (s *service) Cancel(ctx context.Context, id int64) error {
+// changeStatus applies a transition; when authorize is set it is checked
+// against the locked order before anything is written.
+func (s *service) changeStatus(ctx context.Context, id int64, status OrderStatus, changedBy int64, authorize func(*Order) bool) (*Order, error) {
 	if id <= 0 {
-		return domain.NewValidationError("invalid id")
+		return nil, domain.NewValidationError("invalid id")
+	}
+
+	var order *Order
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		current, items, err := s.repo.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if authorize != nil && !authorize(current) {
+			return domain.ErrNotFound
+		}
+
+		if !current.Status.CanTransitionTo(status) {
+			return domain.NewConflictError(fmt.Sprintf("order cannot move from %s to %s", current.Status, status))
+		}
+
+		// The capture could still succeed and would then charge for a
+		// cancelled order; expiry leaves such orders alone for the same reason.
+		if status == OrderStatusCancelled {
+			inFlight, err := s.repo.HasPaymentInFlight(ctx, id)
+			if err != nil {
+				return fmt.Errorf("check payments: %w", err)
+			}
+			if inFlight {
+				return domain.NewConflictError("order has a payment in progress")
+			}
+		}
+
+		current.Items = items
+		if err := s.transition(ctx, current, status, changedBy); err != nil {
+			return err
+		}
+		order = current
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// transition writes an already validated status change for a locked order,
+// releasing reserved stock on cancellation.
+func (s *service) transition(ctx context.Context, order *Order, status OrderStatus, changedBy int64) error {
+	if err := s.repo.UpdateStatus(ctx, order.ID, status); err != nil {
+		return fmt.Errorf("update order status: %w", err)
+	}
+
+	if err := s.repo.AddStatusHistory(ctx, order.ID, order.Status, status, changedBy); err != nil {
+		return fmt.Errorf("record order status: %w", err)
 	}
 
-	if err := s.repo.UpdateStatus(ctx, id, OrderStatusCancelled); err != nil {
+	if status == OrderStatusCancelled {
+		for _, it := range order.Items {
+			if err := s.products.AdjustStock(ctx, it.ProductID, it.Quantity); err != nil {
+				return fmt.Errorf("restore stock: %w", err)
+			}
+		}
+	}
+
+	order.Status = status
+
+	switch status {
+	case OrderStatusPaid:
+		return s.emitOrderEvent(ctx, EventOrderPaid, order, changedBy)
+	case OrderStatusCancelled:
+		return s.emitOrderEvent(ctx, EventOrderCancelled, order, changedBy)
+	}
+
+	return nil
+}
+
+// ExpirePending cancels up to limit pending orders created before the
+// cutoff and releases their stock. Orders locked elsewhere, e.g. by another
+// instance, are skipped.
+func (s *service) ExpirePending(ctx context.Context, before time.Time, limit int) ([]*Order, error) {
+	if limit <= 0 {
+		return nil, domain.NewValidationError("limit must be positive")
+	}
+
+	var expired []*Order
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		stale, err := s.repo.ListExpiredPendingForUpdate(ctx, before, limit)
+		if err != nil {
+			return fmt.Errorf("list expired orders: %w", err)
+		}
+
+		for _, o := range stale {
+			if err := s.transition(ctx, o, OrderStatusCancelled, 0); err != nil {
+				return fmt.Errorf("expire order %d: %w", o.ID, err)
+			}
+		}
+		expired = stale
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+func (s *service) Cancel(ctx context.Context, id int64, actor Actor) error {
+	if _, err := s.changeStatus(ctx, id, OrderStatusCancelled, actor.UserID, actor.CanAccess); err != nil {
+		if domain.IsValidationError(err) {
+			return err
+		}
 		return fmt.Errorf("cancel order: %w", err)
 	}
 
 	return nil
 }
+
+// ApplyRefund marks order items as refunded and moves the order to refunded
+// or partially_refunded. Empty lines refund everything not yet refunded. The
+// returned lines carry the refunded amount per item. It joins the caller's
+// transaction when there is one.
+func (s *service) ApplyRefund(ctx context.Context, id int64, lines []RefundLine, restock bool, changedBy int64) (*Order, []RefundLine, error) {
+	if id <= 0 {
+		return nil, nil, domain.NewValidationError("invalid id")
+	}
+
+	var (
+		order    *Order
+		refunded []RefundLine
+	)
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		current, items, err := s.repo.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if !current.Status.CanTransitionTo(OrderStatusPartiallyRefunded) {
+			return domain.NewConflictError(fmt.Sprintf("order in status %s cannot be refunded", current.Status))
+		}
+
+		refunded, err = refundLines(items, lines)
+		if err != nil {
+			return err
+		}
+
+		var total int64
+		for _, l := range refunded {
+			total += l.Amount
+		}
+		if current.RefundedAmount+total > current.TotalPrice {
+			return domain.NewConflictError("refund exceeds order total")
+		}
+
+		byID := make(map[int64]*OrderItem, len(items))
+		for i := range items {
+			byID[items[i].ID] = &items[i]
+		}
+
+		for _, l := range refunded {
+			if err := s.repo.AddRefundedQuantity(ctx, l.OrderItemID, l.Quantity); err != nil {
+				return fmt.Errorf("refund order item: %w", err)
+			}
+			item := byID[l.OrderItemID]
+			item.RefundedQuantity += l.Quantity
+
+			if restock {
+				if err := s.products.AdjustStock(ctx, item.ProductID, l.Quantity); err != nil {
+					return fmt.Errorf("restock: %w", err)
+				}
+			}
+		}
+
+		if err := s.repo.AddRefundedAmount(ctx, id, total); err != nil {
+			return fmt.Errorf("refund order: %w", err)
+		}
+
+		status := OrderStatusPartiallyRefunded
+		if current.RefundedAmount+total == current.TotalPrice {
+			status = OrderStatusRefunded
+		}
+
+		current.Items = items
+		if err := s.transition(ctx, current, status, changedBy); err != nil {
+			return err
+		}
+		current.RefundedAmount += total
+		order = current
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return order, refunded, nil
+}
+
+// RestockRefund returns the units of refund lines recorded by ApplyRefund
+// to stock. It joins the caller's transaction when there is one.
+func (s *service) RestockRefund(ctx context.Context, id int64, lines []RefundLine) error {
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		_, items, err := s.repo.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		products := make(map[int64]int64, len(items))
+		for _, it := range items {
+			products[it.ID] = it.ProductID
+		}
+
+		for _, l := range lines {
+			productID, ok := products[l.OrderItemID]
+			if !ok {
+				return fmt.Errorf("restock: order item %d not found", l.OrderItemID)
+			}
+			if err := s.products.AdjustStock(ctx, productID, l.Quantity); err != nil {
+				return fmt.Errorf("restock: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// RevertRefund undoes ApplyRefund for a refund that did not go through and
+// moves the order back to status, the one it had before the refund, unless
+// it has left the refunded statuses since. Only the status and its history
+// are restored: the order already got there once, so no event is emitted
+// and no stock moves. It joins the caller's transaction when there is one.
+func (s *service) RevertRefund(ctx context.Context, id int64, lines []RefundLine, status OrderStatus, changedBy int64) error {
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		current, _, err := s.repo.GetByIDForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		var total int64
+		for _, l := range lines {
+			if err := s.repo.AddRefundedQuantity(ctx, l.OrderItemID, -l.Quantity); err != nil {
+				return fmt.Errorf("revert order item refund: %w", err)
+			}
+			total += l.Amount
+		}
+
+		if err := s.repo.AddRefundedAmount(ctx, id, -total); err != nil {
+			return fmt.Errorf("revert order refund: %w", err)
+		}
+
+		if !current.Status.Refunded() || current.Status == status {
+			return nil
+		}
+
+		if err := s.repo.UpdateStatus(ctx, id, status); err != nil {
+			return fmt.Errorf("update order status: %w", err)
+		}
+		if err := s.repo.AddStatusHistory(ctx, id, current.Status, status, changedBy); err != nil {
+			return fmt.Errorf("record order status: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// refundLines validates the requested lines against the order items and
+// prices them. Repeated items are merged.
+func refundLines(items []OrderItem, requested []RefundLine) ([]RefundLine, error) {
+	if len(requested) == 0 {
+		var lines []RefundLine
+		for _, it := range items {
+			if remaining := it.Quantity - it.RefundedQuantity; remaining > 0 {
+				lines = append(lines, RefundLine{
+					OrderItemID: it.ID,
+					Quantity:    remaining,
+					Amount:      remaining * it.UnitPrice,
+				})
+			}
+		}
+		if len(lines) == 0 {
+			return nil, domain.NewConflictError("order is already fully refunded")
+		}
+		return lines, nil
+	}
+
+	byID := make(map[int64]OrderItem, len(items))
+	for _, it := range items {
+		byID[it.ID] = it
+	}
+
+	quantities := make(map[int64]int64, len(requested))
+	lines := make([]RefundLine, 0, len(requested))
+	for _, l := range requested {
+		if l.OrderItemID <= 0 {
+			return nil, domain.NewValidationError("order_item_id must be positive")
+		}
+		if l.Quantity <= 0 {
+			return nil, domain.NewValidationError("quantity must be positive")
+		}
+		if _, ok := byID[l.OrderItemID]; !ok {
+			return nil, domain.NewValidationError(fmt.Sprintf("order item %d not found", l.OrderItemID))
+		}
+		if _, seen := quantities[l.OrderItemID]; !seen {
+			lines = append(lines, RefundLine{OrderItemID: l.OrderItemID})
+		}
+		quantities[l.OrderItemID] += l.Quantity
+	}
+
+	for i := range lines {
+		it := byID[lines[i].OrderItemID]
+		qty := quantities[it.ID]
+		if qty > it.Quantity-it.RefundedQuantity {
+			return nil, domain.NewValidationError(fmt.Sprintf("quantity for order item %d exceeds refundable quantity", it.ID))
+		}
+		lines[i].Quantity = qty
+		lines[i].Amount = qty * it.UnitPrice
+	}
+
+	return lines, nil
+}
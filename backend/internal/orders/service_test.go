@@ -4,23 +4,35 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/pagination"
+	"go-shop-app-backend/internal/infra/outbox"
+	"go-shop-app-backend/internal/products"
 )
 
 type mockOrderRepo struct {
-	createOrderFn   func(ctx context.Context, userID int64, totalPrice int64) (*Order, error)
-	addOrderItemsFn func(ctx context.Context, orderID int64, items []CreateOrderItemInput) ([]OrderItem, error)
-	getByIDFn       func(ctx context.Context, id int64) (*Order, []OrderItem, error)
-	listByUserFn    func(ctx context.Context, userID int64, limit, offset int) ([]*Order, error)
-	updateStatusFn  func(ctx context.Context, id int64, status OrderStatus) error
+	createOrderFn      func(ctx context.Context, userID int64, totalPrice int64) (*Order, error)
+	addOrderItemsFn    func(ctx context.Context, orderID int64, items []OrderItem) ([]OrderItem, error)
+	getByIDFn          func(ctx context.Context, id int64) (*Order, []OrderItem, error)
+	getByIDForUpdateFn func(ctx context.Context, id int64) (*Order, []OrderItem, error)
+	listFn             func(ctx context.Context, filter ListFilter, page pagination.Params) ([]*Order, error)
+	countFn            func(ctx context.Context, filter ListFilter) (int64, error)
+	getUserSummaryFn   func(ctx context.Context, userID int64) (*UserSummary, error)
+	updateStatusFn     func(ctx context.Context, id int64, status OrderStatus) error
+	addStatusHistoryFn func(ctx context.Context, orderID int64, from, to OrderStatus, changedBy int64) error
+	addRefundedQtyFn   func(ctx context.Context, itemID int64, quantity int64) error
+	addRefundedAmtFn   func(ctx context.Context, orderID int64, amount int64) error
+	listExpiredFn      func(ctx context.Context, before time.Time, limit int) ([]*Order, error)
+	paymentInFlightFn  func(ctx context.Context, orderID int64) (bool, error)
 }
 
 func (m *mockOrderRepo) CreateOrder(ctx context.Context, userID int64, totalPrice int64) (*Order, error) {
 	return m.createOrderFn(ctx, userID, totalPrice)
 }
 
-func (m *mockOrderRepo) AddOrderItems(ctx context.Context, orderID int64, items []CreateOrderItemInput) ([]OrderItem, error) {
+func (m *mockOrderRepo) AddOrderItems(ctx context.Context, orderID int64, items []OrderItem) ([]OrderItem, error) {
 	return m.addOrderItemsFn(ctx, orderID, items)
 }
 
@@ -28,17 +40,112 @@ func (m *mockOrderRepo) GetByID(ctx context.Context, id int64) (*Order, []OrderI
 	return m.getByIDFn(ctx, id)
 }
 
-func (m *mockOrderRepo) ListByUser(ctx context.Context, userID int64, limit, offset int) ([]*Order, error) {
-	return m.listByUserFn(ctx, userID, limit, offset)
+func (m *mockOrderRepo) GetByIDForUpdate(ctx context.Context, id int64) (*Order, []OrderItem, error) {
+	return m.getByIDForUpdateFn(ctx, id)
+}
+
+func (m *mockOrderRepo) List(ctx context.Context, filter ListFilter, page pagination.Params) ([]*Order, error) {
+	return m.listFn(ctx, filter, page)
+}
+
+func (m *mockOrderRepo) Count(ctx context.Context, filter ListFilter) (int64, error) {
+	return m.countFn(ctx, filter)
+}
+
+func (m *mockOrderRepo) GetUserSummary(ctx context.Context, userID int64) (*UserSummary, error) {
+	return m.getUserSummaryFn(ctx, userID)
 }
 
 func (m *mockOrderRepo) UpdateStatus(ctx context.Context, id int64, status OrderStatus) error {
 	return m.updateStatusFn(ctx, id, status)
 }
 
+func (m *mockOrderRepo) AddStatusHistory(ctx context.Context, orderID int64, from, to OrderStatus, changedBy int64) error {
+	return m.addStatusHistoryFn(ctx, orderID, from, to, changedBy)
+}
+
+func (m *mockOrderRepo) AddRefundedQuantity(ctx context.Context, itemID int64, quantity int64) error {
+	return m.addRefundedQtyFn(ctx, itemID, quantity)
+}
+
+func (m *mockOrderRepo) AddRefundedAmount(ctx context.Context, orderID int64, amount int64) error {
+	return m.addRefundedAmtFn(ctx, orderID, amount)
+}
+
+func (m *mockOrderRepo) ListExpiredPendingForUpdate(ctx context.Context, before time.Time, limit int) ([]*Order, error) {
+	return m.listExpiredFn(ctx, before, limit)
+}
+
+func (m *mockOrderRepo) HasPaymentInFlight(ctx context.Context, orderID int64) (bool, error) {
+	return m.paymentInFlightFn(ctx, orderID)
+}
+
+type mockProductStore struct {
+	products map[int64]*products.Product
+	adjusted map[int64]int64
+}
+
+func newMockProductStore(list ...*products.Product) *mockProductStore {
+	m := &mockProductStore{
+		products: make(map[int64]*products.Product, len(list)),
+		adjusted: make(map[int64]int64),
+	}
+	for _, p := range list {
+		m.products[p.ID] = p
+	}
+	return m
+}
+
+func (m *mockProductStore) GetByIDsForUpdate(ctx context.Context, ids []int64) ([]*products.Product, error) {
+	var result []*products.Product
+	for _, id := range ids {
+		if p, ok := m.products[id]; ok {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockProductStore) AdjustStock(ctx context.Context, id int64, delta int64) error {
+	m.adjusted[id] += delta
+	return nil
+}
+
+// recordingEvents collects outbox messages in memory.
+type recordingEvents struct {
+	messages []outbox.Message
+}
+
+func (r *recordingEvents) Add(ctx context.Context, msg outbox.Message) error {
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func (r *recordingEvents) types() []string {
+	types := make([]string, 0, len(r.messages))
+	for _, m := range r.messages {
+		types = append(types, m.Type)
+	}
+	return types
+}
+
+// fakeTx runs fn inline and remembers whether it failed, standing in for
+// infraDB.TxManager.
+type fakeTx struct {
+	calls      int
+	rolledBack bool
+}
+
+func (f *fakeTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.calls++
+	err := fn(ctx)
+	f.rolledBack = err != nil
+	return err
+}
+
 func TestService_CreateOrder_Validation(t *testing.T) {
 	repo := &mockOrderRepo{}
-	svc := NewService(repo, nil) 
+	svc := NewService(repo, newMockProductStore(), &fakeTx{}, nil, Options{})
 
 	tests := []struct {
 		name    string
@@ -50,7 +157,7 @@ func TestService_CreateOrder_Validation(t *testing.T) {
 			name:   "invalid user id",
 			userID: 0,
 			input: CreateOrderInput{
-				Items: []CreateOrderItemInput{{ProductID: 1, Quantity: 1, UnitPrice: 100}},
+				Items: []CreateOrderItemInput{{ProductID: 1, Quantity: 1}},
 			},
 			wantErr: true,
 		},
@@ -64,7 +171,7 @@ func TestService_CreateOrder_Validation(t *testing.T) {
 			name:   "invalid product id",
 			userID: 1,
 			input: CreateOrderInput{
-				Items: []CreateOrderItemInput{{ProductID: 0, Quantity: 1, UnitPrice: 100}},
+				Items: []CreateOrderItemInput{{ProductID: 0, Quantity: 1}},
 			},
 			wantErr: true,
 		},
@@ -72,15 +179,7 @@ func TestService_CreateOrder_Validation(t *testing.T) {
 			name:   "invalid quantity",
 			userID: 1,
 			input: CreateOrderInput{
-				Items: []CreateOrderItemInput{{ProductID: 1, Quantity: 0, UnitPrice: 100}},
-			},
-			wantErr: true,
-		},
-		{
-			name:   "invalid unit price",
-			userID: 1,
-			input: CreateOrderInput{
-				Items: []CreateOrderItemInput{{ProductID: 1, Quantity: 1, UnitPrice: 0}},
+				Items: []CreateOrderItemInput{{ProductID: 1, Quantity: 0}},
 			},
 			wantErr: true,
 		},
@@ -114,40 +213,40 @@ func TestService_CreateOrder_Success(t *testing.T) {
 				TotalPrice: totalPrice,
 			}, nil
 		},
-		addOrderItemsFn: func(ctx context.Context, orderID int64, items []CreateOrderItemInput) ([]OrderItem, error) {
+		addOrderItemsFn: func(ctx context.Context, orderID int64, items []OrderItem) ([]OrderItem, error) {
 			if orderID != 1 {
 				return nil, errors.New("unexpected order id")
 			}
 			result := make([]OrderItem, len(items))
 			for i, it := range items {
-				result[i] = OrderItem{
-					ID:         int64(i + 1),
-					OrderID:    orderID,
-					ProductID:  it.ProductID,
-					Quantity:   it.Quantity,
-					UnitPrice:  it.UnitPrice,
-					TotalPrice: it.UnitPrice * it.Quantity,
-				}
+				result[i] = it
+				result[i].ID = int64(i + 1)
+				result[i].OrderID = orderID
+				result[i].TotalPrice = it.UnitPrice * it.Quantity
 			}
 			return result, nil
 		},
-		getByIDFn: func(ctx context.Context, id int64) (*Order, []OrderItem, error) {
-			return nil, nil, errors.New("not used")
-		},
-		listByUserFn: func(ctx context.Context, userID int64, limit, offset int) ([]*Order, error) {
-			return nil, errors.New("not used")
-		},
-		updateStatusFn: func(ctx context.Context, id int64, status OrderStatus) error {
-			return errors.New("not used")
+		addStatusHistoryFn: func(ctx context.Context, orderID int64, from, to OrderStatus, changedBy int64) error {
+			if from != "" || to != OrderStatusPending || changedBy != 10 {
+				return errors.New("unexpected initial status history")
+			}
+			return nil
 		},
 	}
+	store := newMockProductStore(
+		&products.Product{ID: 1, Price: 100, Stock: 10},
+		&products.Product{ID: 2, Price: 50, Stock: 10},
+	)
+	tx := &fakeTx{}
+	events := &recordingEvents{}
 
-	svc := NewService(repo, nil)
+	svc := NewService(repo, store, tx, nil, Options{Events: events, LowStockThreshold: 8})
 
 	input := CreateOrderInput{
 		Items: []CreateOrderItemInput{
-			{ProductID: 1, Quantity: 2, UnitPrice: 100},
-			{ProductID: 2, Quantity: 1, UnitPrice: 50},
+			{ProductID: 1, Quantity: 1},
+			{ProductID: 2, Quantity: 1},
+			{ProductID: 1, Quantity: 1},
 		},
 	}
 
@@ -163,20 +262,141 @@ func TestService_CreateOrder_Success(t *testing.T) {
 	if order.TotalPrice != expectedTotal {
 		t.Fatalf("order.TotalPrice = %d, want %d", order.TotalPrice, expectedTotal)
 	}
-	if len(items) != len(input.Items) {
-		t.Fatalf("expected %d items, got %d", len(input.Items), len(items))
+	if len(items) != 2 {
+		t.Fatalf("expected duplicate products to be merged into 2 items, got %d", len(items))
+	}
+	if items[0].UnitPrice != 100 {
+		t.Fatalf("expected server-side unit price 100, got %d", items[0].UnitPrice)
+	}
+	if store.adjusted[1] != -2 || store.adjusted[2] != -1 {
+		t.Fatalf("unexpected stock adjustments: %v", store.adjusted)
+	}
+	if tx.calls != 1 {
+		t.Fatalf("expected a single transaction, got %d", tx.calls)
+	}
+
+	// Product 1 drops from 10 to 8 and crosses the threshold; product 2
+	// stays above it.
+	if got := events.types(); len(got) != 2 || got[0] != products.EventStockLow || got[1] != EventOrderCreated {
+		t.Fatalf("unexpected events: %v", got)
+	}
+	if events.messages[0].AggregateID != 1 || events.messages[1].AggregateID != 1 {
+		t.Fatalf("unexpected event aggregates: %+v", events.messages)
+	}
+}
+
+type verifierFunc func(ctx context.Context, userID int64) error
+
+func (f verifierFunc) EnsureEmailVerified(ctx context.Context, userID int64) error {
+	return f(ctx, userID)
+}
+
+func TestService_CreateOrder_RequiresVerifiedEmail(t *testing.T) {
+	repo := &mockOrderRepo{
+		createOrderFn: func(ctx context.Context, userID int64, totalPrice int64) (*Order, error) {
+			return nil, errors.New("order must not be created")
+		},
+	}
+	tx := &fakeTx{}
+	verifier := verifierFunc(func(ctx context.Context, userID int64) error {
+		if userID != 10 {
+			t.Fatalf("unexpected user id %d", userID)
+		}
+		return domain.ErrEmailNotVerified
+	})
+
+	svc := NewService(repo, newMockProductStore(&products.Product{ID: 1, Price: 100, Stock: 10}), tx, verifier, Options{})
+
+	_, _, err := svc.CreateOrder(context.Background(), 10, CreateOrderInput{
+		Items: []CreateOrderItemInput{{ProductID: 1, Quantity: 1}},
+	})
+	if !errors.Is(err, domain.ErrEmailNotVerified) {
+		t.Fatalf("expected ErrEmailNotVerified, got %v", err)
+	}
+	if tx.calls != 0 {
+		t.Fatalf("expected no transaction for an unverified user")
+	}
+}
+
+func TestService_CreateOrder_OutOfStock(t *testing.T) {
+	repo := &mockOrderRepo{
+		createOrderFn: func(ctx context.Context, userID int64, totalPrice int64) (*Order, error) {
+			return nil, errors.New("order must not be created")
+		},
+	}
+	store := newMockProductStore(
+		&products.Product{ID: 1, Price: 100, Stock: 10},
+		&products.Product{ID: 2, Price: 50, Stock: 1},
+	)
+	tx := &fakeTx{}
+	svc := NewService(repo, store, tx, nil, Options{})
+
+	_, _, err := svc.CreateOrder(context.Background(), 10, CreateOrderInput{
+		Items: []CreateOrderItemInput{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 5}},
+	})
+
+	stockErr, ok := domain.AsOutOfStockError(err)
+	if !ok {
+		t.Fatalf("expected out of stock error, got %v", err)
+	}
+	if len(stockErr.ProductIDs) != 1 || stockErr.ProductIDs[0] != 2 {
+		t.Fatalf("unexpected product ids: %v", stockErr.ProductIDs)
+	}
+	if !tx.rolledBack {
+		t.Fatalf("expected transaction to be rolled back")
+	}
+	if len(store.adjusted) != 0 {
+		t.Fatalf("expected no stock adjustments, got %v", store.adjusted)
+	}
+}
+
+func TestService_CreateOrder_RollsBackOnItemFailure(t *testing.T) {
+	repo := &mockOrderRepo{
+		createOrderFn: func(ctx context.Context, userID int64, totalPrice int64) (*Order, error) {
+			return &Order{ID: 1, UserID: userID, TotalPrice: totalPrice}, nil
+		},
+		addOrderItemsFn: func(ctx context.Context, orderID int64, items []OrderItem) ([]OrderItem, error) {
+			return nil, errors.New("insert failed")
+		},
+	}
+	store := newMockProductStore(&products.Product{ID: 1, Price: 100, Stock: 10})
+	tx := &fakeTx{}
+	svc := NewService(repo, store, tx, nil, Options{})
+
+	_, _, err := svc.CreateOrder(context.Background(), 10, CreateOrderInput{
+		Items: []CreateOrderItemInput{{ProductID: 1, Quantity: 1}},
+	})
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if !tx.rolledBack {
+		t.Fatalf("expected transaction to be rolled back")
+	}
+}
+
+func TestService_CreateOrder_UnknownProduct(t *testing.T) {
+	svc := NewService(&mockOrderRepo{}, newMockProductStore(), &fakeTx{}, nil, Options{})
+
+	_, _, err := svc.CreateOrder(context.Background(), 10, CreateOrderInput{
+		Items: []CreateOrderItemInput{{ProductID: 42, Quantity: 1}},
+	})
+	if !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error, got %v", err)
 	}
 }
 
 func TestService_ListByUser_Validation(t *testing.T) {
 	repo := &mockOrderRepo{
-		listByUserFn: func(ctx context.Context, userID int64, limit, offset int) ([]*Order, error) {
+		listFn: func(ctx context.Context, filter ListFilter, page pagination.Params) ([]*Order, error) {
 			return []*Order{}, nil
 		},
+		countFn: func(ctx context.Context, filter ListFilter) (int64, error) {
+			return 0, nil
+		},
 		createOrderFn: func(ctx context.Context, userID int64, totalPrice int64) (*Order, error) {
 			return nil, errors.New("not used")
 		},
-		addOrderItemsFn: func(ctx context.Context, orderID int64, items []CreateOrderItemInput) ([]OrderItem, error) {
+		addOrderItemsFn: func(ctx context.Context, orderID int64, items []OrderItem) ([]OrderItem, error) {
 			return nil, errors.New("not used")
 		},
 		getByIDFn: func(ctx context.Context, id int64) (*Order, []OrderItem, error) {
@@ -186,14 +406,14 @@ func TestService_ListByUser_Validation(t *testing.T) {
 			return errors.New("not used")
 		},
 	}
-	svc := NewService(repo, nil)
+	svc := NewService(repo, newMockProductStore(), &fakeTx{}, nil, Options{})
 
-	_, err := svc.ListByUser(context.Background(), 0, 1, 10)
+	_, err := svc.ListByUser(context.Background(), 0, pagination.Params{Page: 1, Limit: 10})
 	if err == nil || !domain.IsValidationError(err) {
 		t.Fatalf("expected validation error for invalid user id, got %v", err)
 	}
 
-	_, err = svc.ListByUser(context.Background(), 1, 1, 101)
+	_, err = svc.ListByUser(context.Background(), 1, pagination.Params{Page: 1, Limit: 101})
 	if err == nil || !domain.IsValidationError(err) {
 		t.Fatalf("expected validation error for too big pageSize, got %v", err)
 	}
@@ -207,19 +427,548 @@ func TestService_Cancel_Validation(t *testing.T) {
 		createOrderFn: func(ctx context.Context, userID int64, totalPrice int64) (*Order, error) {
 			return nil, errors.New("not used")
 		},
-		addOrderItemsFn: func(ctx context.Context, orderID int64, items []CreateOrderItemInput) ([]OrderItem, error) {
+		addOrderItemsFn: func(ctx context.Context, orderID int64, items []OrderItem) ([]OrderItem, error) {
 			return nil, errors.New("not used")
 		},
 		getByIDFn: func(ctx context.Context, id int64) (*Order, []OrderItem, error) {
 			return nil, nil, errors.New("not used")
 		},
-		listByUserFn: func(ctx context.Context, userID int64, limit, offset int) ([]*Order, error) {
+		listFn: func(ctx context.Context, filter ListFilter, page pagination.Params) ([]*Order, error) {
 			return nil, errors.New("not used")
 		},
 	}
-	svc := NewService(repo, nil)
+	svc := NewService(repo, newMockProductStore(), &fakeTx{}, nil, Options{})
 
-	if err := svc.Cancel(context.Background(), 0); err == nil || !domain.IsValidationError(err) {
+	if err := svc.Cancel(context.Background(), 0, Actor{UserID: 1, Role: "user"}); err == nil || !domain.IsValidationError(err) {
 		t.Fatalf("expected validation error for invalid id, got %v", err)
 	}
 }
+
+func TestOrderStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from OrderStatus
+		to   OrderStatus
+		want bool
+	}{
+		{OrderStatusPending, OrderStatusPaid, true},
+		{OrderStatusPending, OrderStatusCancelled, true},
+		{OrderStatusPending, OrderStatusShipped, false},
+		{OrderStatusPaid, OrderStatusShipped, true},
+		{OrderStatusPaid, OrderStatusCancelled, false},
+		{OrderStatusPaid, OrderStatusRefunded, true},
+		{OrderStatusShipped, OrderStatusDelivered, true},
+		{OrderStatusDelivered, OrderStatusRefunded, true},
+		{OrderStatusCancelled, OrderStatusCancelled, false},
+		{OrderStatusCancelled, OrderStatusPaid, false},
+		{OrderStatusRefunded, OrderStatusPaid, false},
+		{OrderStatusPaid, OrderStatusPartiallyRefunded, true},
+		{OrderStatusPartiallyRefunded, OrderStatusPartiallyRefunded, true},
+		{OrderStatusPartiallyRefunded, OrderStatusShipped, true},
+		{OrderStatusPartiallyRefunded, OrderStatusRefunded, true},
+		{OrderStatusPending, OrderStatusPartiallyRefunded, false},
+		{OrderStatusRefunded, OrderStatusPartiallyRefunded, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+				t.Fatalf("CanTransitionTo = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_Cancel(t *testing.T) {
+	newRepo := func(status OrderStatus, history *[]OrderStatus) *mockOrderRepo {
+		return &mockOrderRepo{
+			getByIDForUpdateFn: func(ctx context.Context, id int64) (*Order, []OrderItem, error) {
+				if id != 1 {
+					return nil, nil, domain.ErrNotFound
+				}
+				return &Order{ID: 1, UserID: 10, Status: status}, []OrderItem{
+					{ProductID: 1, Quantity: 2},
+					{ProductID: 2, Quantity: 3},
+				}, nil
+			},
+			paymentInFlightFn: func(ctx context.Context, orderID int64) (bool, error) {
+				return false, nil
+			},
+			updateStatusFn: func(ctx context.Context, id int64, status OrderStatus) error {
+				return nil
+			},
+			addStatusHistoryFn: func(ctx context.Context, orderID int64, from, to OrderStatus, changedBy int64) error {
+				*history = append(*history, from, to)
+				return nil
+			},
+		}
+	}
+
+	t.Run("pending order restores stock", func(t *testing.T) {
+		var history []OrderStatus
+		store := newMockProductStore()
+		svc := NewService(newRepo(OrderStatusPending, &history), store, &fakeTx{}, nil, Options{})
+
+		if err := svc.Cancel(context.Background(), 1, Actor{UserID: 10, Role: "user"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if store.adjusted[1] != 2 || store.adjusted[2] != 3 {
+			t.Fatalf("unexpected stock adjustments: %v", store.adjusted)
+		}
+		if len(history) != 2 || history[0] != OrderStatusPending || history[1] != OrderStatusCancelled {
+			t.Fatalf("unexpected status history: %v", history)
+		}
+	})
+
+	t.Run("paid order is a conflict", func(t *testing.T) {
+		var history []OrderStatus
+		store := newMockProductStore()
+		svc := NewService(newRepo(OrderStatusPaid, &history), store, &fakeTx{}, nil, Options{})
+
+		err := svc.Cancel(context.Background(), 1, Actor{UserID: 10, Role: "user"})
+		if !domain.IsConflictError(err) {
+			t.Fatalf("expected conflict error, got %v", err)
+		}
+		if len(store.adjusted) != 0 || len(history) != 0 {
+			t.Fatalf("expected no side effects, got stock %v history %v", store.adjusted, history)
+		}
+	})
+
+	t.Run("payment in flight is a conflict", func(t *testing.T) {
+		var history []OrderStatus
+		store := newMockProductStore()
+		repo := newRepo(OrderStatusPending, &history)
+		repo.paymentInFlightFn = func(ctx context.Context, orderID int64) (bool, error) {
+			return true, nil
+		}
+		svc := NewService(repo, store, &fakeTx{}, nil, Options{})
+
+		err := svc.Cancel(context.Background(), 1, Actor{UserID: 10, Role: "user"})
+		if !domain.IsConflictError(err) {
+			t.Fatalf("expected conflict error, got %v", err)
+		}
+		if len(store.adjusted) != 0 || len(history) != 0 {
+			t.Fatalf("expected no side effects, got stock %v history %v", store.adjusted, history)
+		}
+	})
+
+	t.Run("cancelled order is a conflict", func(t *testing.T) {
+		var history []OrderStatus
+		svc := NewService(newRepo(OrderStatusCancelled, &history), newMockProductStore(), &fakeTx{}, nil, Options{})
+
+		if err := svc.Cancel(context.Background(), 1, Actor{UserID: 10, Role: "user"}); !domain.IsConflictError(err) {
+			t.Fatalf("expected conflict error, got %v", err)
+		}
+	})
+
+	t.Run("missing order", func(t *testing.T) {
+		var history []OrderStatus
+		svc := NewService(newRepo(OrderStatusPending, &history), newMockProductStore(), &fakeTx{}, nil, Options{})
+
+		if err := svc.Cancel(context.Background(), 2, Actor{UserID: 10, Role: "user"}); !errors.Is(err, domain.ErrNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	})
+}
+
+func TestService_ApplyRefund(t *testing.T) {
+	type refundState struct {
+		quantities map[int64]int64
+		amount     int64
+		status     OrderStatus
+		history    []OrderStatus
+	}
+
+	newRepo := func(order Order, items []OrderItem, st *refundState) *mockOrderRepo {
+		st.quantities = make(map[int64]int64)
+		return &mockOrderRepo{
+			getByIDForUpdateFn: func(ctx context.Context, id int64) (*Order, []OrderItem, error) {
+				if id != order.ID {
+					return nil, nil, domain.ErrNotFound
+				}
+				o := order
+				return &o, append([]OrderItem(nil), items...), nil
+			},
+			addRefundedQtyFn: func(ctx context.Context, itemID int64, quantity int64) error {
+				st.quantities[itemID] += quantity
+				return nil
+			},
+			addRefundedAmtFn: func(ctx context.Context, orderID int64, amount int64) error {
+				st.amount += amount
+				return nil
+			},
+			updateStatusFn: func(ctx context.Context, id int64, status OrderStatus) error {
+				st.status = status
+				return nil
+			},
+			addStatusHistoryFn: func(ctx context.Context, orderID int64, from, to OrderStatus, changedBy int64) error {
+				st.history = append(st.history, from, to)
+				return nil
+			},
+		}
+	}
+
+	order := Order{ID: 1, UserID: 10, Status: OrderStatusDelivered, TotalPrice: 1300}
+	items := []OrderItem{
+		{ID: 11, ProductID: 1, Quantity: 2, UnitPrice: 500, TotalPrice: 1000},
+		{ID: 12, ProductID: 2, Quantity: 3, UnitPrice: 100, TotalPrice: 300},
+	}
+
+	t.Run("partial refund with restock", func(t *testing.T) {
+		var st refundState
+		store := newMockProductStore()
+		svc := NewService(newRepo(order, items, &st), store, &fakeTx{}, nil, Options{})
+
+		got, lines, err := svc.ApplyRefund(context.Background(), 1, []RefundLine{
+			{OrderItemID: 12, Quantity: 1},
+			{OrderItemID: 12, Quantity: 1},
+		}, true, 99)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(lines) != 1 || lines[0].Quantity != 2 || lines[0].Amount != 200 {
+			t.Fatalf("unexpected refund lines: %+v", lines)
+		}
+		if st.quantities[12] != 2 || st.amount != 200 || store.adjusted[2] != 2 {
+			t.Fatalf("unexpected writes: quantities %v amount %d stock %v", st.quantities, st.amount, store.adjusted)
+		}
+		if got.Status != OrderStatusPartiallyRefunded || st.status != OrderStatusPartiallyRefunded || got.RefundedAmount != 200 {
+			t.Fatalf("unexpected order: %+v", got)
+		}
+		if len(st.history) != 2 || st.history[0] != OrderStatusDelivered {
+			t.Fatalf("unexpected status history: %v", st.history)
+		}
+	})
+
+	t.Run("empty lines refund the remainder", func(t *testing.T) {
+		partial := order
+		partial.Status = OrderStatusPartiallyRefunded
+		partial.RefundedAmount = 500
+		refunded := append([]OrderItem(nil), items...)
+		refunded[0].RefundedQuantity = 1
+
+		var st refundState
+		store := newMockProductStore()
+		svc := NewService(newRepo(partial, refunded, &st), store, &fakeTx{}, nil, Options{})
+
+		got, lines, err := svc.ApplyRefund(context.Background(), 1, nil, false, 99)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(lines) != 2 || st.quantities[11] != 1 || st.quantities[12] != 3 || st.amount != 800 {
+			t.Fatalf("unexpected refund: lines %+v quantities %v amount %d", lines, st.quantities, st.amount)
+		}
+		if got.Status != OrderStatusRefunded || got.RefundedAmount != 1300 {
+			t.Fatalf("unexpected order: %+v", got)
+		}
+		if len(store.adjusted) != 0 {
+			t.Fatalf("expected no restock, got %v", store.adjusted)
+		}
+	})
+
+	t.Run("restock after the refund went through", func(t *testing.T) {
+		var st refundState
+		store := newMockProductStore()
+		svc := NewService(newRepo(order, items, &st), store, &fakeTx{}, nil, Options{})
+
+		if err := svc.RestockRefund(context.Background(), 1, []RefundLine{{OrderItemID: 12, Quantity: 2, Amount: 200}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if store.adjusted[2] != 2 || len(store.adjusted) != 1 {
+			t.Fatalf("unexpected restock: %v", store.adjusted)
+		}
+	})
+
+	t.Run("revert a refund that did not go through", func(t *testing.T) {
+		partial := order
+		partial.Status = OrderStatusPartiallyRefunded
+		partial.RefundedAmount = 200
+
+		var st refundState
+		store := newMockProductStore()
+		svc := NewService(newRepo(partial, items, &st), store, &fakeTx{}, nil, Options{})
+
+		err := svc.RevertRefund(context.Background(), 1, []RefundLine{{OrderItemID: 12, Quantity: 2, Amount: 200}}, OrderStatusDelivered, 99)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if st.quantities[12] != -2 || st.amount != -200 || len(store.adjusted) != 0 {
+			t.Fatalf("unexpected writes: quantities %v amount %d stock %v", st.quantities, st.amount, store.adjusted)
+		}
+		if st.status != OrderStatusDelivered || len(st.history) != 2 || st.history[0] != OrderStatusPartiallyRefunded {
+			t.Fatalf("unexpected status: %s, history %v", st.status, st.history)
+		}
+	})
+
+	t.Run("reverting to paid emits no event", func(t *testing.T) {
+		paid := order
+		paid.Status = OrderStatusRefunded
+		paid.RefundedAmount = 1300
+
+		var st refundState
+		store := newMockProductStore()
+		events := &recordingEvents{}
+		svc := NewService(newRepo(paid, items, &st), store, &fakeTx{}, nil, Options{Events: events})
+
+		lines := []RefundLine{{OrderItemID: 11, Quantity: 2, Amount: 1000}, {OrderItemID: 12, Quantity: 3, Amount: 300}}
+		if err := svc.RevertRefund(context.Background(), 1, lines, OrderStatusPaid, 99); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if st.status != OrderStatusPaid || len(st.history) != 2 || st.history[0] != OrderStatusRefunded {
+			t.Fatalf("unexpected status: %s, history %v", st.status, st.history)
+		}
+		if len(events.messages) != 0 {
+			t.Fatalf("expected no outbox events, got %v", events.types())
+		}
+		if len(store.adjusted) != 0 {
+			t.Fatalf("expected no stock changes, got %v", store.adjusted)
+		}
+	})
+
+	t.Run("rejected refunds", func(t *testing.T) {
+		fully := order
+		fully.Status = OrderStatusRefunded
+		fully.RefundedAmount = 1300
+
+		tests := []struct {
+			name      string
+			order     Order
+			lines     []RefundLine
+			wantCheck func(error) bool
+		}{
+			{"pending order", Order{ID: 1, Status: OrderStatusPending, TotalPrice: 1300}, nil, domain.IsConflictError},
+			{"fully refunded order", fully, nil, domain.IsConflictError},
+			{"unknown item", order, []RefundLine{{OrderItemID: 99, Quantity: 1}}, domain.IsValidationError},
+			{"zero quantity", order, []RefundLine{{OrderItemID: 11, Quantity: 0}}, domain.IsValidationError},
+			{"more than ordered", order, []RefundLine{{OrderItemID: 11, Quantity: 2}, {OrderItemID: 11, Quantity: 1}}, domain.IsValidationError},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var st refundState
+				store := newMockProductStore()
+				svc := NewService(newRepo(tt.order, items, &st), store, &fakeTx{}, nil, Options{})
+
+				_, _, err := svc.ApplyRefund(context.Background(), 1, tt.lines, true, 99)
+				if !tt.wantCheck(err) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if st.amount != 0 || len(st.quantities) != 0 || len(store.adjusted) != 0 {
+					t.Fatalf("expected no writes, got quantities %v amount %d stock %v", st.quantities, st.amount, store.adjusted)
+				}
+			})
+		}
+	})
+}
+
+func TestService_ChangeStatus_RejectsRefundStatuses(t *testing.T) {
+	svc := NewService(&mockOrderRepo{}, newMockProductStore(), &fakeTx{}, nil, Options{})
+
+	for _, status := range []OrderStatus{OrderStatusRefunded, OrderStatusPartiallyRefunded} {
+		if _, err := svc.ChangeStatus(context.Background(), 1, status, 99); !domain.IsValidationError(err) {
+			t.Fatalf("%s: expected validation error, got %v", status, err)
+		}
+	}
+}
+
+func TestService_Ownership(t *testing.T) {
+	const ownerID = 10
+
+	tests := []struct {
+		name    string
+		actor   Actor
+		wantErr error
+	}{
+		{name: "owner", actor: Actor{UserID: ownerID, Role: "user"}},
+		{name: "other user", actor: Actor{UserID: 11, Role: "user"}, wantErr: domain.ErrNotFound},
+		{name: "admin", actor: Actor{UserID: 1, Role: "admin"}},
+	}
+
+	newRepo := func(cancelled *bool) *mockOrderRepo {
+		order := func() *Order {
+			return &Order{ID: 1, UserID: ownerID, Status: OrderStatusPending}
+		}
+		return &mockOrderRepo{
+			getByIDFn: func(ctx context.Context, id int64) (*Order, []OrderItem, error) {
+				return order(), nil, nil
+			},
+			getByIDForUpdateFn: func(ctx context.Context, id int64) (*Order, []OrderItem, error) {
+				return order(), nil, nil
+			},
+			paymentInFlightFn: func(ctx context.Context, orderID int64) (bool, error) {
+				return false, nil
+			},
+			updateStatusFn: func(ctx context.Context, id int64, status OrderStatus) error {
+				*cancelled = true
+				return nil
+			},
+			addStatusHistoryFn: func(ctx context.Context, orderID int64, from, to OrderStatus, changedBy int64) error {
+				return nil
+			},
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run("get "+tt.name, func(t *testing.T) {
+			var cancelled bool
+			svc := NewService(newRepo(&cancelled), newMockProductStore(), &fakeTx{}, nil, Options{})
+
+			order, _, err := svc.GetByID(context.Background(), 1, tt.actor)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && order.ID != 1 {
+				t.Fatalf("unexpected order: %+v", order)
+			}
+		})
+
+		t.Run("cancel "+tt.name, func(t *testing.T) {
+			var cancelled bool
+			svc := NewService(newRepo(&cancelled), newMockProductStore(), &fakeTx{}, nil, Options{})
+
+			err := svc.Cancel(context.Background(), 1, tt.actor)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if cancelled != (tt.wantErr == nil) {
+				t.Fatalf("cancelled = %v, want %v", cancelled, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestService_List_Validation(t *testing.T) {
+	var captured ListFilter
+	repo := &mockOrderRepo{
+		listFn: func(ctx context.Context, filter ListFilter, page pagination.Params) ([]*Order, error) {
+			captured = filter
+			return []*Order{}, nil
+		},
+		countFn: func(ctx context.Context, filter ListFilter) (int64, error) {
+			return 0, nil
+		},
+	}
+	svc := NewService(repo, newMockProductStore(), &fakeTx{}, nil, Options{})
+
+	from := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	minTotal, maxTotal, negative := int64(500), int64(100), int64(-1)
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+	}{
+		{name: "unknown status", filter: ListFilter{Status: "lost"}},
+		{name: "inverted created range", filter: ListFilter{CreatedFrom: &from, CreatedTo: &to}},
+		{name: "inverted total range", filter: ListFilter{MinTotal: &minTotal, MaxTotal: &maxTotal}},
+		{name: "negative min total", filter: ListFilter{MinTotal: &negative}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.List(context.Background(), tt.filter, pagination.Params{Page: 1, Limit: 20}); !domain.IsValidationError(err) {
+				t.Fatalf("expected validation error, got %v", err)
+			}
+		})
+	}
+
+	filter := ListFilter{Status: OrderStatusPaid, UserID: 7, CreatedFrom: &to, CreatedTo: &from}
+	if _, err := svc.List(context.Background(), filter, pagination.Params{Page: 2, Limit: 10}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if captured.Status != OrderStatusPaid || captured.UserID != 7 {
+		t.Fatalf("filter not passed to repository: %+v", captured)
+	}
+}
+
+func TestService_GetDetails(t *testing.T) {
+	repo := &mockOrderRepo{
+		getByIDFn: func(ctx context.Context, id int64) (*Order, []OrderItem, error) {
+			return &Order{ID: id, UserID: 10}, []OrderItem{{ID: 1, OrderID: id}}, nil
+		},
+		getUserSummaryFn: func(ctx context.Context, userID int64) (*UserSummary, error) {
+			return &UserSummary{ID: userID, Email: "user@example.com"}, nil
+		},
+	}
+	svc := NewService(repo, newMockProductStore(), &fakeTx{}, nil, Options{})
+
+	details, err := svc.GetDetails(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if details.ID != 3 || len(details.Items) != 1 {
+		t.Fatalf("unexpected order: %+v", details.Order)
+	}
+	if details.User == nil || details.User.ID != 10 {
+		t.Fatalf("unexpected user summary: %+v", details.User)
+	}
+
+	t.Run("missing user", func(t *testing.T) {
+		repo.getUserSummaryFn = func(ctx context.Context, userID int64) (*UserSummary, error) {
+			return nil, domain.ErrNotFound
+		}
+
+		details, err := svc.GetDetails(context.Background(), 3)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if details.ID != 3 || details.User != nil {
+			t.Fatalf("expected the order without a user summary, got %+v", details)
+		}
+	})
+
+	t.Run("user lookup fails", func(t *testing.T) {
+		repo.getUserSummaryFn = func(ctx context.Context, userID int64) (*UserSummary, error) {
+			return nil, errors.New("connection lost")
+		}
+
+		_, err := svc.GetDetails(context.Background(), 3)
+		if err == nil || errors.Is(err, domain.ErrNotFound) {
+			t.Fatalf("expected a user lookup error, got %v", err)
+		}
+	})
+}
+
+func TestService_ListByUser_Page(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var capturedPage pagination.Params
+	repo := &mockOrderRepo{
+		listFn: func(ctx context.Context, filter ListFilter, page pagination.Params) ([]*Order, error) {
+			if filter.UserID != 10 {
+				return nil, errors.New("expected user filter")
+			}
+			capturedPage = page
+			return []*Order{
+				{ID: 9, UserID: 10, CreatedAt: created.Add(time.Minute)},
+				{ID: 8, UserID: 10, CreatedAt: created},
+			}, nil
+		},
+		countFn: func(ctx context.Context, filter ListFilter) (int64, error) {
+			return 7, nil
+		},
+	}
+	svc := NewService(repo, newMockProductStore(), &fakeTx{}, nil, Options{})
+
+	page, err := svc.ListByUser(context.Background(), 10, pagination.Params{Page: 2, Limit: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if capturedPage.Offset() != 2 {
+		t.Fatalf("expected offset 2, got %d", capturedPage.Offset())
+	}
+	if page.Total != 7 || page.Page != 2 || page.Limit != 2 || len(page.Items) != 2 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+
+	cursor, err := pagination.DecodeCursor(page.NextCursor)
+	if err != nil {
+		t.Fatalf("decode next cursor: %v", err)
+	}
+	if cursor.ID != 8 || !cursor.CreatedAt.Equal(created) {
+		t.Fatalf("unexpected next cursor: %+v", cursor)
+	}
+
+	if _, err := svc.ListByUser(context.Background(), 10, pagination.Params{Page: 2, Limit: 2, Cursor: cursor}); !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for page combined with cursor, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package payments
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/domain"
+)
+
+// RegisterAdminRoutes registers refund management. r must already be
+// restricted to admins.
+func (h *Handler) RegisterAdminRoutes(r *gin.RouterGroup) {
+	g := r.Group("/orders/:id")
+
+	g.POST("/refunds", h.idempotency, h.adminRefund)
+	g.GET("/refunds", h.adminListRefunds)
+}
+
+func (h *Handler) adminRefund(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_id",
+			"message": "id must be a positive integer",
+		})
+		return
+	}
+
+	actor, _ := actorFromContext(c)
+
+	// The body is optional; without it the whole order is refunded.
+	var input RefundInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	refund, err := h.service.Refund(c.Request.Context(), id, input, actor.UserID)
+	if err != nil {
+		if domain.IsConflictError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "refund_conflict",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		writeError(c, err, "failed_to_refund_order")
+		return
+	}
+
+	c.JSON(http.StatusCreated, refund)
+}
+
+func (h *Handler) adminListRefunds(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_id",
+			"message": "id must be a positive integer",
+		})
+		return
+	}
+
+	list, err := h.service.ListRefunds(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err, "failed_to_list_refunds")
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,172 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Payment methods understood by FakeProvider.
+const (
+	FakeMethodOK       = "pm_card_ok"
+	FakeMethodDeclined = "pm_card_declined"
+	// FakeMethodAsync leaves the capture processing until Webhook is used
+	// to settle it.
+	FakeMethodAsync = "pm_card_async"
+)
+
+// FakeProvider is a deterministic in-memory gateway for development and
+// tests. Intent and refund IDs are sequential.
+type FakeProvider struct {
+	mu            sync.Mutex
+	webhookSecret []byte
+	seq           int
+	intents       map[string]*fakeIntent
+	byKey         map[string]string
+	refunds       map[string]*ProviderRefund
+}
+
+type fakeIntent struct {
+	Intent
+	method   string
+	refunded int64
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		webhookSecret: []byte(webhookSecret),
+		intents:       make(map[string]*fakeIntent),
+		byKey:         make(map[string]string),
+		refunds:       make(map[string]*ProviderRefund),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id, ok := p.byKey[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		intent := p.intents[id].Intent
+		return &intent, nil
+	}
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	p.seq++
+	in := &fakeIntent{
+		Intent: Intent{ID: fmt.Sprintf("fake_pi_%d", p.seq), Status: IntentRequiresCapture, Amount: req.Amount},
+		method: req.PaymentMethod,
+	}
+	switch req.PaymentMethod {
+	case "", FakeMethodOK, FakeMethodAsync:
+	case FakeMethodDeclined:
+		in.Status = IntentFailed
+		in.FailureReason = "card_declined"
+	default:
+		in.Status = IntentFailed
+		in.FailureReason = "unknown_payment_method"
+	}
+
+	p.intents[in.ID] = in
+	if req.IdempotencyKey != "" {
+		p.byKey[req.IdempotencyKey] = in.ID
+	}
+
+	intent := in.Intent
+	return &intent, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, intentID string, amount int64) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	in, ok := p.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("unknown intent %s", intentID)
+	}
+	if in.Status == IntentRequiresCapture {
+		if amount != in.Amount {
+			return nil, fmt.Errorf("capture amount %d does not match intent amount %d", amount, in.Amount)
+		}
+		in.Status = IntentSucceeded
+		if in.method == FakeMethodAsync {
+			in.Status = IntentProcessing
+		}
+	}
+
+	intent := in.Intent
+	return &intent, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, req RefundRequest) (*ProviderRefund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if refund, ok := p.refunds[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		cp := *refund
+		return &cp, nil
+	}
+
+	in, ok := p.intents[req.IntentID]
+	if !ok {
+		return nil, fmt.Errorf("unknown intent %s", req.IntentID)
+	}
+	if in.Status != IntentSucceeded {
+		return nil, fmt.Errorf("intent %s is %s, not succeeded", req.IntentID, in.Status)
+	}
+	if req.Amount <= 0 || in.refunded+req.Amount > in.Amount {
+		return nil, fmt.Errorf("refund of %d exceeds the refundable amount %d", req.Amount, in.Amount-in.refunded)
+	}
+
+	in.refunded += req.Amount
+	p.seq++
+	refund := &ProviderRefund{ID: fmt.Sprintf("fake_re_%d", p.seq), Amount: req.Amount}
+	if req.IdempotencyKey != "" {
+		p.refunds[req.IdempotencyKey] = refund
+	}
+
+	cp := *refund
+	return &cp, nil
+}
+
+// Webhook settles a processing intent and returns the signed webhook the
+// real gateway would send, as payload and Payment-Signature header.
+func (p *FakeProvider) Webhook(intentID string, succeed bool) ([]byte, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	in, ok := p.intents[intentID]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown intent %s", intentID)
+	}
+
+	p.seq++
+	event := WebhookEvent{
+		ID:       fmt.Sprintf("fake_evt_%d", p.seq),
+		IntentID: in.ID,
+		Amount:   in.Amount,
+	}
+	if succeed {
+		in.Status = IntentSucceeded
+		event.Type = EventPaymentSucceeded
+	} else {
+		in.Status = IntentFailed
+		in.FailureReason = "card_declined"
+		event.Type = EventPaymentFailed
+		event.FailureReason = in.FailureReason
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshal webhook event: %w", err)
+	}
+
+	return payload, SignWebhook(p.webhookSecret, payload, time.Now()), nil
+}
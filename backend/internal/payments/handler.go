@@ -0,0 +1,201 @@
+package payments
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/middleware"
+	"go-shop-app-backend/internal/orders"
+)
+
+const maxWebhookBody = 1 << 20
+
+type Handler struct {
+	service     Service
+	idempotency gin.HandlerFunc
+}
+
+// NewHandler builds the handler. idempotency, typically
+// middleware.Idempotency, guards the pay route; nil disables it.
+func NewHandler(service Service, idempotency gin.HandlerFunc) *Handler {
+	if idempotency == nil {
+		idempotency = func(c *gin.Context) { c.Next() }
+	}
+	return &Handler{service: service, idempotency: idempotency}
+}
+
+// RegisterRoutes registers the payment routes. r must already use
+// middleware.AuthMiddleware.
+func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
+	g := r.Group("/orders/:id")
+
+	g.POST("/pay", h.idempotency, h.pay)
+	g.GET("/payments", h.listByOrder)
+}
+
+// RegisterWebhookRoutes registers the provider webhook, which authenticates
+// by signature instead of a user token.
+func (h *Handler) RegisterWebhookRoutes(r *gin.RouterGroup) {
+	r.POST("/payments/webhook", h.webhook)
+}
+
+func (h *Handler) pay(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_id",
+			"message": "id must be a positive integer",
+		})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "user is not authenticated",
+		})
+		return
+	}
+
+	// The body is optional; without it the provider's default method is used.
+	var input PayInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	payment, err := h.service.Pay(c.Request.Context(), id, actor, input)
+	if err != nil {
+		if declinedErr, ok := AsDeclinedError(err); ok {
+			c.JSON(http.StatusPaymentRequired, gin.H{
+				"error":   "payment_declined",
+				"message": declinedErr.Error(),
+				"reason":  declinedErr.Reason,
+			})
+			return
+		}
+
+		writeError(c, err, "failed_to_pay_order")
+		return
+	}
+
+	status := http.StatusOK
+	if payment.Status == PaymentStatusProcessing {
+		status = http.StatusAccepted
+	}
+
+	c.JSON(status, payment)
+}
+
+func (h *Handler) listByOrder(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_id",
+			"message": "id must be a positive integer",
+		})
+		return
+	}
+
+	actor, ok := actorFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "user is not authenticated",
+		})
+		return
+	}
+
+	list, err := h.service.ListByOrder(c.Request.Context(), id, actor)
+	if err != nil {
+		writeError(c, err, "failed_to_list_payments")
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) webhook(c *gin.Context) {
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	err = h.service.HandleWebhook(c.Request.Context(), payload, c.GetHeader(SignatureHeader))
+	if err != nil {
+		if errors.Is(err, ErrInvalidSignature) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "invalid_signature",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "payment_not_found",
+				"message": "no payment for this intent",
+			})
+			return
+		}
+
+		writeError(c, err, "failed_to_process_webhook")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func writeError(c *gin.Context, err error, fallbackCode string) {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "order_not_found",
+			"message": "order not found",
+		})
+	case domain.IsValidationError(err):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "validation_error",
+			"message": err.Error(),
+		})
+	case domain.IsConflictError(err):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "payment_conflict",
+			"message": err.Error(),
+		})
+	case errors.Is(err, ErrProvider):
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "payment_provider_error",
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   fallbackCode,
+			"message": err.Error(),
+		})
+	}
+}
+
+func actorFromContext(c *gin.Context) (orders.Actor, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok || userID <= 0 {
+		return orders.Actor{}, false
+	}
+
+	role, _ := middleware.GetUserRole(c)
+
+	return orders.Actor{UserID: userID, Role: role}, true
+}
@@ -0,0 +1,114 @@
+package payments
+
+import (
+	"errors"
+	"time"
+
+	"go-shop-app-backend/internal/orders"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending    PaymentStatus = "pending"
+	PaymentStatusProcessing PaymentStatus = "processing"
+	PaymentStatusSucceeded  PaymentStatus = "succeeded"
+	PaymentStatusFailed     PaymentStatus = "failed"
+)
+
+// Final reports whether the status can no longer change.
+func (s PaymentStatus) Final() bool {
+	return s == PaymentStatusSucceeded || s == PaymentStatusFailed
+}
+
+// Payment is one attempt to pay an order. Amount is copied from the order's
+// total_price when the attempt starts.
+type Payment struct {
+	ID             int64         `json:"id"`
+	OrderID        int64         `json:"order_id"`
+	Provider       string        `json:"provider"`
+	IntentID       string        `json:"intent_id,omitempty"`
+	Status         PaymentStatus `json:"status"`
+	Amount         int64         `json:"amount"`
+	RefundedAmount int64         `json:"refunded_amount"`
+	Currency       string        `json:"currency"`
+	FailureReason  string        `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+type PayInput struct {
+	// PaymentMethod is the provider's token for the card or wallet.
+	PaymentMethod string `json:"payment_method"`
+}
+
+type RefundStatus string
+
+const (
+	// RefundStatusPending means the refund is recorded but the provider
+	// has not confirmed it yet.
+	RefundStatusPending   RefundStatus = "pending"
+	RefundStatusSucceeded RefundStatus = "succeeded"
+	RefundStatusFailed    RefundStatus = "failed"
+)
+
+// Refund is one entry in an order's refund ledger. PaymentID is always set
+// for new refunds; the column stays nullable for entries recorded before
+// refunds required a captured payment.
+type Refund struct {
+	ID               int64               `json:"id"`
+	OrderID          int64               `json:"order_id"`
+	PaymentID        *int64              `json:"payment_id"`
+	Status           RefundStatus        `json:"status"`
+	Amount           int64               `json:"amount"`
+	Restock          bool                `json:"restock"`
+	Reason           string              `json:"reason,omitempty"`
+	ProviderRefundID string              `json:"provider_refund_id,omitempty"`
+	CreatedBy        int64               `json:"created_by,omitempty"`
+	Items            []orders.RefundLine `json:"items"`
+	CreatedAt        time.Time           `json:"created_at"`
+}
+
+type RefundItemInput struct {
+	OrderItemID int64 `json:"order_item_id"`
+	Quantity    int64 `json:"quantity"`
+}
+
+// RefundInput describes a refund. Without items everything not yet refunded
+// is refunded.
+type RefundInput struct {
+	Items   []RefundItemInput `json:"items"`
+	Restock bool              `json:"restock"`
+	Reason  string            `json:"reason"`
+}
+
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+)
+
+// WebhookEvent is the body of a provider webhook.
+type WebhookEvent struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"`
+	IntentID      string `json:"intent_id"`
+	Amount        int64  `json:"amount"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// DeclinedError is returned by Pay when the provider refuses the payment.
+type DeclinedError struct {
+	Reason string
+}
+
+func (e *DeclinedError) Error() string {
+	return "payment declined: " + e.Reason
+}
+
+func AsDeclinedError(err error) (*DeclinedError, bool) {
+	var declinedErr *DeclinedError
+	if errors.As(err, &declinedErr) {
+		return declinedErr, true
+	}
+	return nil, false
+}
@@ -0,0 +1,59 @@
+package payments
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrProvider wraps failures talking to the payment provider.
+var ErrProvider = errors.New("payment provider error")
+
+type IntentStatus string
+
+const (
+	IntentRequiresCapture IntentStatus = "requires_capture"
+	// IntentProcessing means the outcome arrives later by webhook.
+	IntentProcessing IntentStatus = "processing"
+	IntentSucceeded  IntentStatus = "succeeded"
+	IntentFailed     IntentStatus = "failed"
+)
+
+type IntentRequest struct {
+	// Reference identifies the payment on our side, e.g. in the provider's
+	// dashboard.
+	Reference     string
+	Amount        int64
+	Currency      string
+	PaymentMethod string
+	// IdempotencyKey makes retried requests return the same intent.
+	IdempotencyKey string
+}
+
+type Intent struct {
+	ID            string
+	Status        IntentStatus
+	Amount        int64
+	FailureReason string
+}
+
+type RefundRequest struct {
+	IntentID string
+	Amount   int64
+	// IdempotencyKey makes a retried refund return the first one instead
+	// of giving the money back twice.
+	IdempotencyKey string
+}
+
+type ProviderRefund struct {
+	ID     string
+	Amount int64
+}
+
+// PaymentProvider is a card payment gateway. Amounts are in the currency's
+// minor units.
+type PaymentProvider interface {
+	Name() string
+	CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error)
+	Capture(ctx context.Context, intentID string, amount int64) (*Intent, error)
+	Refund(ctx context.Context, req RefundRequest) (*ProviderRefund, error)
+}
@@ -0,0 +1,28 @@
+package payments
+
+import "context"
+
+type Repository interface {
+	// Create inserts a pending payment. It returns a domain.ConflictError
+	// when the order already has a payment in progress or succeeded.
+	Create(ctx context.Context, p *Payment) (*Payment, error)
+	SetIntent(ctx context.Context, id int64, intentID string) error
+	// UpdateStatus moves a pending or processing payment to status. It
+	// reports false, and changes nothing, when the payment has been settled
+	// already, e.g. by a webhook.
+	UpdateStatus(ctx context.Context, id int64, status PaymentStatus, failureReason string) (bool, error)
+	GetByID(ctx context.Context, id int64) (*Payment, error)
+	GetByIntentForUpdate(ctx context.Context, provider, intentID string) (*Payment, error)
+	ListByOrder(ctx context.Context, orderID int64) ([]*Payment, error)
+	// GetSucceededByOrderForUpdate returns domain.ErrNotFound when the order
+	// has no succeeded payment.
+	GetSucceededByOrderForUpdate(ctx context.Context, orderID int64) (*Payment, error)
+	// AddRefundedAmount returns a domain.ConflictError when the payment
+	// would be refunded beyond its amount.
+	AddRefundedAmount(ctx context.Context, id int64, amount int64) error
+	// CreateRefund returns a domain.ConflictError when the order already
+	// has a pending refund.
+	CreateRefund(ctx context.Context, refund *Refund) (*Refund, error)
+	SetRefundStatus(ctx context.Context, id int64, status RefundStatus, providerRefundID string) error
+	ListRefunds(ctx context.Context, orderID int64) ([]*Refund, error)
+}
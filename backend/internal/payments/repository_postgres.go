@@ -0,0 +1,336 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"go-shop-app-backend/internal/domain"
+	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/orders"
+)
+
+const paymentColumns = `id, order_id, provider, COALESCE(intent_id, ''), status, amount, refunded_amount, currency,
+               COALESCE(failure_reason, ''), created_at, updated_at`
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+func (r *postgresRepository) conn(ctx context.Context) infraDB.DBTX {
+	return infraDB.Conn(ctx, r.db)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPayment(row rowScanner) (*Payment, error) {
+	var p Payment
+	err := row.Scan(&p.ID, &p.OrderID, &p.Provider, &p.IntentID, &p.Status, &p.Amount, &p.RefundedAmount, &p.Currency,
+		&p.FailureReason, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *postgresRepository) Create(ctx context.Context, p *Payment) (*Payment, error) {
+	query := `
+        INSERT INTO payments (order_id, provider, status, amount, currency)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING ` + paymentColumns
+
+	created, err := scanPayment(r.conn(ctx).QueryRowContext(ctx, query, p.OrderID, p.Provider, p.Status, p.Amount, p.Currency))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, domain.NewConflictError("order already has a payment in progress or completed")
+		}
+		return nil, fmt.Errorf("insert payment: %w", err)
+	}
+
+	return created, nil
+}
+
+func (r *postgresRepository) SetIntent(ctx context.Context, id int64, intentID string) error {
+	const query = `UPDATE payments SET intent_id = $2 WHERE id = $1`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, id, intentID)
+	if err != nil {
+		return fmt.Errorf("set payment intent: %w", err)
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepository) UpdateStatus(ctx context.Context, id int64, status PaymentStatus, failureReason string) (bool, error) {
+	const query = `
+        UPDATE payments
+        SET status = $2, failure_reason = NULLIF($3, '')
+        WHERE id = $1 AND status IN ('pending', 'processing')
+    `
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, id, status, failureReason)
+	if err != nil {
+		return false, fmt.Errorf("update payment status: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+func (r *postgresRepository) GetByID(ctx context.Context, id int64) (*Payment, error) {
+	query := `
+        SELECT ` + paymentColumns + `
+        FROM payments
+        WHERE id = $1
+    `
+
+	p, err := scanPayment(r.conn(ctx).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get payment by id: %w", err)
+	}
+
+	return p, nil
+}
+
+func (r *postgresRepository) GetByIntentForUpdate(ctx context.Context, provider, intentID string) (*Payment, error) {
+	query := `
+        SELECT ` + paymentColumns + `
+        FROM payments
+        WHERE provider = $1 AND intent_id = $2
+        FOR UPDATE
+    `
+
+	p, err := scanPayment(r.conn(ctx).QueryRowContext(ctx, query, provider, intentID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get payment by intent: %w", err)
+	}
+
+	return p, nil
+}
+
+func (r *postgresRepository) ListByOrder(ctx context.Context, orderID int64) ([]*Payment, error) {
+	query := `
+        SELECT ` + paymentColumns + `
+        FROM payments
+        WHERE order_id = $1
+        ORDER BY created_at, id
+    `
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("list payments: %w", err)
+	}
+	defer rows.Close()
+
+	list := []*Payment{}
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan payment: %w", err)
+		}
+		list = append(list, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate payments: %w", err)
+	}
+
+	return list, nil
+}
+
+func (r *postgresRepository) GetSucceededByOrderForUpdate(ctx context.Context, orderID int64) (*Payment, error) {
+	query := `
+        SELECT ` + paymentColumns + `
+        FROM payments
+        WHERE order_id = $1 AND status = $2
+        FOR UPDATE
+    `
+
+	p, err := scanPayment(r.conn(ctx).QueryRowContext(ctx, query, orderID, PaymentStatusSucceeded))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get succeeded payment: %w", err)
+	}
+
+	return p, nil
+}
+
+func (r *postgresRepository) AddRefundedAmount(ctx context.Context, id int64, amount int64) error {
+	const query = `UPDATE payments SET refunded_amount = refunded_amount + $2 WHERE id = $1`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, id, amount)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23514" {
+			return domain.NewConflictError("refund exceeds captured amount")
+		}
+		return fmt.Errorf("update payment refund: %w", err)
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepository) CreateRefund(ctx context.Context, refund *Refund) (*Refund, error) {
+	const query = `
+        INSERT INTO refunds (order_id, payment_id, status, amount, restock, reason, created_by)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+        RETURNING id, created_at
+    `
+
+	created := *refund
+	err := r.conn(ctx).QueryRowContext(
+		ctx,
+		query,
+		refund.OrderID,
+		refund.PaymentID,
+		refund.Status,
+		refund.Amount,
+		refund.Restock,
+		refund.Reason,
+		sql.NullInt64{Int64: refund.CreatedBy, Valid: refund.CreatedBy > 0},
+	).Scan(&created.ID, &created.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, domain.NewConflictError("order already has a refund in progress")
+		}
+		return nil, fmt.Errorf("insert refund: %w", err)
+	}
+
+	const itemQuery = `
+        INSERT INTO refund_items (refund_id, order_item_id, quantity, amount)
+        VALUES ($1, $2, $3, $4)
+    `
+
+	for _, it := range refund.Items {
+		if _, err := r.conn(ctx).ExecContext(ctx, itemQuery, created.ID, it.OrderItemID, it.Quantity, it.Amount); err != nil {
+			return nil, fmt.Errorf("insert refund item: %w", err)
+		}
+	}
+
+	return &created, nil
+}
+
+func (r *postgresRepository) SetRefundStatus(ctx context.Context, id int64, status RefundStatus, providerRefundID string) error {
+	const query = `
+        UPDATE refunds
+        SET status = $2, provider_refund_id = COALESCE(NULLIF($3, ''), provider_refund_id)
+        WHERE id = $1
+    `
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, id, status, providerRefundID)
+	if err != nil {
+		return fmt.Errorf("set refund status: %w", err)
+	}
+
+	return expectAffected(res)
+}
+
+func (r *postgresRepository) ListRefunds(ctx context.Context, orderID int64) ([]*Refund, error) {
+	const query = `
+        SELECT id, order_id, payment_id, status, amount, restock, COALESCE(reason, ''),
+               COALESCE(provider_refund_id, ''), COALESCE(created_by, 0), created_at
+        FROM refunds
+        WHERE order_id = $1
+        ORDER BY created_at, id
+    `
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("list refunds: %w", err)
+	}
+	defer rows.Close()
+
+	list := []*Refund{}
+	byID := make(map[int64]*Refund)
+	for rows.Next() {
+		var (
+			rf        Refund
+			paymentID sql.NullInt64
+		)
+		if err := rows.Scan(&rf.ID, &rf.OrderID, &paymentID, &rf.Status, &rf.Amount, &rf.Restock, &rf.Reason,
+			&rf.ProviderRefundID, &rf.CreatedBy, &rf.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan refund: %w", err)
+		}
+		if paymentID.Valid {
+			rf.PaymentID = &paymentID.Int64
+		}
+		rf.Items = []orders.RefundLine{}
+		list = append(list, &rf)
+		byID[rf.ID] = &rf
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate refunds: %w", err)
+	}
+
+	if len(list) == 0 {
+		return list, nil
+	}
+
+	const itemsQuery = `
+        SELECT ri.refund_id, ri.order_item_id, ri.quantity, ri.amount
+        FROM refund_items ri
+        JOIN refunds rf ON rf.id = ri.refund_id
+        WHERE rf.order_id = $1
+        ORDER BY ri.refund_id, ri.order_item_id
+    `
+
+	itemRows, err := r.conn(ctx).QueryContext(ctx, itemsQuery, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("list refund items: %w", err)
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var (
+			refundID int64
+			line     orders.RefundLine
+		)
+		if err := itemRows.Scan(&refundID, &line.OrderItemID, &line.Quantity, &line.Amount); err != nil {
+			return nil, fmt.Errorf("scan refund item: %w", err)
+		}
+		if rf, ok := byID[refundID]; ok {
+			rf.Items = append(rf.Items, line)
+		}
+	}
+
+	if err := itemRows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate refund items: %w", err)
+	}
+
+	return list, nil
+}
+
+func expectAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,480 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-shop-app-backend/internal/domain"
+	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/orders"
+	"go-shop-app-backend/pkg/logger"
+)
+
+const (
+	defaultCurrency = "usd"
+
+	maxRefundReasonLength = 500
+)
+
+type Service interface {
+	Pay(ctx context.Context, orderID int64, actor orders.Actor, input PayInput) (*Payment, error)
+	ListByOrder(ctx context.Context, orderID int64, actor orders.Actor) ([]*Payment, error)
+	HandleWebhook(ctx context.Context, payload []byte, signature string) error
+	Refund(ctx context.Context, orderID int64, input RefundInput, adminID int64) (*Refund, error)
+	ListRefunds(ctx context.Context, orderID int64) ([]*Refund, error)
+}
+
+// OrderService is the part of orders.Service that payments need.
+type OrderService interface {
+	GetByID(ctx context.Context, id int64, actor orders.Actor) (*orders.Order, []orders.OrderItem, error)
+	GetForUpdate(ctx context.Context, id int64, actor orders.Actor) (*orders.Order, error)
+	ChangeStatus(ctx context.Context, id int64, status orders.OrderStatus, changedBy int64) (*orders.Order, error)
+	ApplyRefund(ctx context.Context, id int64, lines []orders.RefundLine, restock bool, changedBy int64) (*orders.Order, []orders.RefundLine, error)
+	RestockRefund(ctx context.Context, id int64, lines []orders.RefundLine) error
+	RevertRefund(ctx context.Context, id int64, lines []orders.RefundLine, status orders.OrderStatus, changedBy int64) error
+}
+
+type Options struct {
+	Currency string
+	// WebhookSecret is shared with the provider to sign webhooks.
+	WebhookSecret string
+}
+
+type service struct {
+	repo     Repository
+	orders   OrderService
+	provider PaymentProvider
+	tx       infraDB.Transactor
+	opts     Options
+}
+
+func NewService(repo Repository, orders OrderService, provider PaymentProvider, tx infraDB.Transactor, opts Options) Service {
+	if opts.Currency == "" {
+		opts.Currency = defaultCurrency
+	}
+
+	return &service{
+		repo:     repo,
+		orders:   orders,
+		provider: provider,
+		tx:       tx,
+		opts:     opts,
+	}
+}
+
+// Pay charges the order's total. The order is marked paid once the capture
+// succeeds, either right away or later by webhook, in which case the
+// payment is returned while still processing.
+func (s *service) Pay(ctx context.Context, orderID int64, actor orders.Actor, input PayInput) (*Payment, error) {
+	if orderID <= 0 {
+		return nil, domain.NewValidationError("invalid order id")
+	}
+
+	// The payment row is created under the order lock, so once it commits
+	// the order can neither be cancelled nor expire until the outcome of the
+	// capture is known.
+	var payment *Payment
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		order, err := s.orders.GetForUpdate(ctx, orderID, actor)
+		if err != nil {
+			return err
+		}
+		if order.Status != orders.OrderStatusPending {
+			return domain.NewConflictError(fmt.Sprintf("order is %s, not awaiting payment", order.Status))
+		}
+		if order.TotalPrice <= 0 {
+			return domain.NewConflictError("order has nothing to pay")
+		}
+
+		payment, err = s.repo.Create(ctx, &Payment{
+			OrderID:  order.ID,
+			Provider: s.provider.Name(),
+			Status:   PaymentStatusPending,
+			Amount:   order.TotalPrice,
+			Currency: s.opts.Currency,
+		})
+		if err != nil {
+			if domain.IsConflictError(err) {
+				return err
+			}
+			return fmt.Errorf("create payment: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	intent, err := s.provider.CreateIntent(ctx, IntentRequest{
+		Reference:      fmt.Sprintf("order-%d", payment.OrderID),
+		Amount:         payment.Amount,
+		Currency:       payment.Currency,
+		PaymentMethod:  input.PaymentMethod,
+		IdempotencyKey: fmt.Sprintf("payment-%d", payment.ID),
+	})
+	if err != nil {
+		return s.providerFailed(ctx, payment, err)
+	}
+
+	if err := s.repo.SetIntent(ctx, payment.ID, intent.ID); err != nil {
+		return s.abandon(ctx, payment, fmt.Errorf("save payment intent: %w", err))
+	}
+	payment.IntentID = intent.ID
+
+	if intent.Status == IntentFailed {
+		return s.declined(ctx, payment, intent.FailureReason)
+	}
+
+	intent, err = s.provider.Capture(ctx, intent.ID, payment.Amount)
+	if err != nil {
+		return s.providerFailed(ctx, payment, err)
+	}
+
+	switch intent.Status {
+	case IntentSucceeded:
+		settled, err := s.settle(ctx, intent.ID, true, intent.Amount, "")
+		if err != nil {
+			// The money has been taken, so the payment stays pending and
+			// keeps the order from being cancelled until it is reconciled.
+			logger.Error("payment captured but could not be recorded",
+				"payment_id", payment.ID, "order_id", payment.OrderID, "intent_id", intent.ID, "error", err)
+			return nil, err
+		}
+		return settled, nil
+	case IntentFailed:
+		return s.declined(ctx, payment, intent.FailureReason)
+	}
+
+	updated, err := s.repo.UpdateStatus(ctx, payment.ID, PaymentStatusProcessing, "")
+	if err != nil {
+		return s.abandon(ctx, payment, fmt.Errorf("update payment status: %w", err))
+	}
+	if !updated {
+		// A webhook settled the payment before the capture call returned.
+		return s.repo.GetByID(ctx, payment.ID)
+	}
+	payment.Status = PaymentStatusProcessing
+
+	return payment, nil
+}
+
+// providerFailed marks the attempt failed so the order can be paid again.
+func (s *service) providerFailed(ctx context.Context, payment *Payment, cause error) (*Payment, error) {
+	return s.fail(ctx, payment, "provider_error", fmt.Errorf("%w: %v", ErrProvider, cause))
+}
+
+// abandon marks the attempt failed after a local error so a payment left
+// half-recorded does not keep the order from being paid, cancelled or
+// expired.
+func (s *service) abandon(ctx context.Context, payment *Payment, cause error) (*Payment, error) {
+	return s.fail(ctx, payment, "internal_error", cause)
+}
+
+// declined marks the attempt failed with the provider's reason.
+func (s *service) declined(ctx context.Context, payment *Payment, reason string) (*Payment, error) {
+	if reason == "" {
+		reason = "declined"
+	}
+	return s.fail(ctx, payment, reason, &DeclinedError{Reason: reason})
+}
+
+// fail marks the attempt failed with reason and returns cause. It does not
+// stop when the client goes away, so the payment never stays pending. A
+// webhook may have settled the payment first, e.g. when the capture call
+// timed out after the card was charged; the payment is then left as it is
+// and returned if it succeeded.
+func (s *service) fail(ctx context.Context, payment *Payment, reason string, cause error) (*Payment, error) {
+	ctx = context.WithoutCancel(ctx)
+
+	updated, err := s.repo.UpdateStatus(ctx, payment.ID, PaymentStatusFailed, reason)
+	if err != nil {
+		return nil, fmt.Errorf("mark payment failed after %v: %w", cause, err)
+	}
+	if updated {
+		return nil, cause
+	}
+
+	settled, err := s.repo.GetByID(ctx, payment.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get payment: %w", err)
+	}
+	if settled.Status == PaymentStatusSucceeded {
+		return settled, nil
+	}
+
+	return nil, cause
+}
+
+// settle records the outcome of a capture and marks the order paid. Repeated
+// outcomes for a settled payment, e.g. redelivered webhooks, are ignored.
+func (s *service) settle(ctx context.Context, intentID string, succeeded bool, amount int64, reason string) (*Payment, error) {
+	var payment *Payment
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		p, err := s.repo.GetByIntentForUpdate(ctx, s.provider.Name(), intentID)
+		if err != nil {
+			return err
+		}
+		payment = p
+
+		if p.Status.Final() {
+			if succeeded && p.Status == PaymentStatusFailed {
+				logger.Error("payment captured after it was marked failed",
+					"payment_id", p.ID, "order_id", p.OrderID, "intent_id", intentID, "amount", amount)
+			}
+			return nil
+		}
+
+		status := PaymentStatusFailed
+		switch {
+		case !succeeded:
+			if reason == "" {
+				reason = "payment_failed"
+			}
+		case amount != p.Amount:
+			reason = fmt.Sprintf("amount_mismatch: captured %d, expected %d", amount, p.Amount)
+			// The money has been taken but the order stays unpaid, so
+			// someone has to refund or reconcile it by hand.
+			logger.Error("payment captured with the wrong amount",
+				"payment_id", p.ID, "order_id", p.OrderID, "intent_id", intentID, "captured", amount, "expected", p.Amount)
+		default:
+			status, reason = PaymentStatusSucceeded, ""
+		}
+
+		if _, err := s.repo.UpdateStatus(ctx, p.ID, status, reason); err != nil {
+			return fmt.Errorf("update payment status: %w", err)
+		}
+		p.Status, p.FailureReason = status, reason
+
+		if status != PaymentStatusSucceeded {
+			return nil
+		}
+
+		if _, err := s.orders.ChangeStatus(ctx, p.OrderID, orders.OrderStatusPaid, 0); err != nil {
+			if domain.IsConflictError(err) {
+				// Pay keeps the order pending while a payment is in
+				// flight, so this needs manual attention: the money has
+				// been taken and needs a refund.
+				logger.Warn("payment succeeded for an order that cannot be paid",
+					"payment_id", p.ID, "order_id", p.OrderID, "error", err)
+				return nil
+			}
+			return fmt.Errorf("mark order paid: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+func (s *service) ListByOrder(ctx context.Context, orderID int64, actor orders.Actor) ([]*Payment, error) {
+	if orderID <= 0 {
+		return nil, domain.NewValidationError("invalid order id")
+	}
+
+	if _, _, err := s.orders.GetByID(ctx, orderID, actor); err != nil {
+		return nil, err
+	}
+
+	list, err := s.repo.ListByOrder(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("list payments: %w", err)
+	}
+
+	return list, nil
+}
+
+// HandleWebhook verifies and applies a provider event. Unknown event types
+// are acknowledged and ignored.
+func (s *service) HandleWebhook(ctx context.Context, payload []byte, signature string) error {
+	if err := VerifyWebhook([]byte(s.opts.WebhookSecret), payload, signature, time.Now()); err != nil {
+		return err
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return domain.NewValidationError("invalid webhook payload")
+	}
+	if event.IntentID == "" {
+		return domain.NewValidationError("intent_id is required")
+	}
+
+	var err error
+	switch event.Type {
+	case EventPaymentSucceeded:
+		_, err = s.settle(ctx, event.IntentID, true, event.Amount, "")
+	case EventPaymentFailed:
+		_, err = s.settle(ctx, event.IntentID, false, 0, event.FailureReason)
+	default:
+		return nil
+	}
+
+	return err
+}
+
+// Refund gives money back for the whole order or some of its items and
+// records it in the ledger. The order must have a captured payment.
+//
+// The refund is committed as pending before the provider is called, with
+// the refunded items and amounts already reserved, so a crash or a failed
+// commit after the provider accepted it cannot lose the record. The
+// provider call carries a key derived from the refund ID, and the pending
+// row blocks further refunds of the order until it is resolved.
+func (s *service) Refund(ctx context.Context, orderID int64, input RefundInput, adminID int64) (*Refund, error) {
+	if orderID <= 0 {
+		return nil, domain.NewValidationError("invalid order id")
+	}
+	if len(input.Reason) > maxRefundReasonLength {
+		return nil, domain.NewValidationError(fmt.Sprintf("reason must be at most %d characters", maxRefundReasonLength))
+	}
+
+	lines := make([]orders.RefundLine, 0, len(input.Items))
+	for _, it := range input.Items {
+		lines = append(lines, orders.RefundLine{OrderItemID: it.OrderItemID, Quantity: it.Quantity})
+	}
+
+	var (
+		refund   *Refund
+		payment  *Payment
+		previous orders.OrderStatus
+	)
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := s.orders.GetForUpdate(ctx, orderID, orders.Actor{UserID: adminID, Role: string(domain.UserRoleAdmin)})
+		if err != nil {
+			return err
+		}
+		previous = current.Status
+
+		// Stock is only returned once the provider confirms the refund.
+		order, refunded, err := s.orders.ApplyRefund(ctx, orderID, lines, false, adminID)
+		if err != nil {
+			return err
+		}
+
+		var amount int64
+		for _, l := range refunded {
+			amount += l.Amount
+		}
+
+		// Only money captured through the provider can be given back; the
+		// refund is capped at what is left of that capture.
+		payment, err = s.repo.GetSucceededByOrderForUpdate(ctx, order.ID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return domain.NewConflictError("order has no captured payment to refund")
+			}
+			return fmt.Errorf("get payment: %w", err)
+		}
+		if amount > payment.Amount-payment.RefundedAmount {
+			return domain.NewConflictError(fmt.Sprintf("refund of %d exceeds the %d left of the captured payment",
+				amount, payment.Amount-payment.RefundedAmount))
+		}
+		if err := s.repo.AddRefundedAmount(ctx, payment.ID, amount); err != nil {
+			if domain.IsConflictError(err) {
+				return err
+			}
+			return fmt.Errorf("update payment refund: %w", err)
+		}
+
+		refund, err = s.repo.CreateRefund(ctx, &Refund{
+			OrderID:   order.ID,
+			PaymentID: &payment.ID,
+			Status:    RefundStatusPending,
+			Amount:    amount,
+			Restock:   input.Restock,
+			Reason:    input.Reason,
+			CreatedBy: adminID,
+			Items:     refunded,
+		})
+		if err != nil {
+			if domain.IsConflictError(err) {
+				return err
+			}
+			return fmt.Errorf("create refund: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	providerRefund, err := s.provider.Refund(ctx, RefundRequest{
+		IntentID:       payment.IntentID,
+		Amount:         refund.Amount,
+		IdempotencyKey: fmt.Sprintf("refund-%d", refund.ID),
+	})
+	if err != nil {
+		return nil, s.refundFailed(ctx, refund, payment.ID, previous, err)
+	}
+
+	err = s.tx.WithinTx(context.WithoutCancel(ctx), func(ctx context.Context) error {
+		if err := s.repo.SetRefundStatus(ctx, refund.ID, RefundStatusSucceeded, providerRefund.ID); err != nil {
+			return fmt.Errorf("update refund status: %w", err)
+		}
+		if refund.Restock {
+			if err := s.orders.RestockRefund(ctx, refund.OrderID, refund.Items); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// The money has been returned; the refund stays pending until
+		// someone reconciles it with the provider.
+		logger.Error("refund succeeded at the provider but could not be recorded",
+			"refund_id", refund.ID, "order_id", refund.OrderID, "provider_refund_id", providerRefund.ID, "error", err)
+		return nil, err
+	}
+	refund.Status = RefundStatusSucceeded
+	refund.ProviderRefundID = providerRefund.ID
+
+	return refund, nil
+}
+
+// refundFailed marks a refund the provider refused as failed and releases
+// what it reserved on the order and the payment.
+func (s *service) refundFailed(ctx context.Context, refund *Refund, paymentID int64, previous orders.OrderStatus, cause error) error {
+	err := s.tx.WithinTx(context.WithoutCancel(ctx), func(ctx context.Context) error {
+		if err := s.orders.RevertRefund(ctx, refund.OrderID, refund.Items, previous, refund.CreatedBy); err != nil {
+			return err
+		}
+		if err := s.repo.AddRefundedAmount(ctx, paymentID, -refund.Amount); err != nil {
+			return fmt.Errorf("revert payment refund: %w", err)
+		}
+		if err := s.repo.SetRefundStatus(ctx, refund.ID, RefundStatusFailed, ""); err != nil {
+			return fmt.Errorf("update refund status: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("refund failed at the provider but could not be released",
+			"refund_id", refund.ID, "order_id", refund.OrderID, "error", err)
+		return fmt.Errorf("release refund after %v: %w", cause, err)
+	}
+
+	return fmt.Errorf("%w: %v", ErrProvider, cause)
+}
+
+func (s *service) ListRefunds(ctx context.Context, orderID int64) ([]*Refund, error) {
+	if orderID <= 0 {
+		return nil, domain.NewValidationError("invalid order id")
+	}
+
+	list, err := s.repo.ListRefunds(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("list refunds: %w", err)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,720 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/orders"
+)
+
+const testWebhookSecret = "test-webhook-secret"
+
+type mockPaymentRepo struct {
+	createFn               func(ctx context.Context, p *Payment) (*Payment, error)
+	setIntentFn            func(ctx context.Context, id int64, intentID string) error
+	updateStatusFn         func(ctx context.Context, id int64, status PaymentStatus, failureReason string) (bool, error)
+	getByIDFn              func(ctx context.Context, id int64) (*Payment, error)
+	getByIntentForUpdateFn func(ctx context.Context, provider, intentID string) (*Payment, error)
+	listByOrderFn          func(ctx context.Context, orderID int64) ([]*Payment, error)
+	getSucceededFn         func(ctx context.Context, orderID int64) (*Payment, error)
+	addRefundedAmountFn    func(ctx context.Context, id int64, amount int64) error
+	createRefundFn         func(ctx context.Context, refund *Refund) (*Refund, error)
+	setRefundStatusFn      func(ctx context.Context, id int64, status RefundStatus, providerRefundID string) error
+	listRefundsFn          func(ctx context.Context, orderID int64) ([]*Refund, error)
+}
+
+func (m *mockPaymentRepo) Create(ctx context.Context, p *Payment) (*Payment, error) {
+	return m.createFn(ctx, p)
+}
+
+func (m *mockPaymentRepo) SetIntent(ctx context.Context, id int64, intentID string) error {
+	return m.setIntentFn(ctx, id, intentID)
+}
+
+func (m *mockPaymentRepo) UpdateStatus(ctx context.Context, id int64, status PaymentStatus, failureReason string) (bool, error) {
+	return m.updateStatusFn(ctx, id, status, failureReason)
+}
+
+func (m *mockPaymentRepo) GetByID(ctx context.Context, id int64) (*Payment, error) {
+	return m.getByIDFn(ctx, id)
+}
+
+func (m *mockPaymentRepo) GetByIntentForUpdate(ctx context.Context, provider, intentID string) (*Payment, error) {
+	return m.getByIntentForUpdateFn(ctx, provider, intentID)
+}
+
+func (m *mockPaymentRepo) ListByOrder(ctx context.Context, orderID int64) ([]*Payment, error) {
+	return m.listByOrderFn(ctx, orderID)
+}
+
+func (m *mockPaymentRepo) GetSucceededByOrderForUpdate(ctx context.Context, orderID int64) (*Payment, error) {
+	return m.getSucceededFn(ctx, orderID)
+}
+
+func (m *mockPaymentRepo) AddRefundedAmount(ctx context.Context, id int64, amount int64) error {
+	return m.addRefundedAmountFn(ctx, id, amount)
+}
+
+func (m *mockPaymentRepo) CreateRefund(ctx context.Context, refund *Refund) (*Refund, error) {
+	return m.createRefundFn(ctx, refund)
+}
+
+func (m *mockPaymentRepo) SetRefundStatus(ctx context.Context, id int64, status RefundStatus, providerRefundID string) error {
+	return m.setRefundStatusFn(ctx, id, status, providerRefundID)
+}
+
+func (m *mockPaymentRepo) ListRefunds(ctx context.Context, orderID int64) ([]*Refund, error) {
+	return m.listRefundsFn(ctx, orderID)
+}
+
+// paymentStore backs mockPaymentRepo with slices of payments and refunds.
+type paymentStore struct {
+	payments []*Payment
+	refunds  []*Refund
+}
+
+func (s *paymentStore) install(repo *mockPaymentRepo) {
+	repo.createFn = func(ctx context.Context, p *Payment) (*Payment, error) {
+		for _, existing := range s.payments {
+			if existing.OrderID == p.OrderID && existing.Status != PaymentStatusFailed {
+				return nil, domain.NewConflictError("order already has a payment in progress or completed")
+			}
+		}
+		cp := *p
+		cp.ID = int64(len(s.payments) + 1)
+		s.payments = append(s.payments, &cp)
+		created := cp
+		return &created, nil
+	}
+	repo.setIntentFn = func(ctx context.Context, id int64, intentID string) error {
+		s.payments[id-1].IntentID = intentID
+		return nil
+	}
+	repo.updateStatusFn = func(ctx context.Context, id int64, status PaymentStatus, failureReason string) (bool, error) {
+		if s.payments[id-1].Status.Final() {
+			return false, nil
+		}
+		s.payments[id-1].Status = status
+		s.payments[id-1].FailureReason = failureReason
+		return true, nil
+	}
+	repo.getByIDFn = func(ctx context.Context, id int64) (*Payment, error) {
+		if id < 1 || int(id) > len(s.payments) {
+			return nil, domain.ErrNotFound
+		}
+		cp := *s.payments[id-1]
+		return &cp, nil
+	}
+	repo.getByIntentForUpdateFn = func(ctx context.Context, provider, intentID string) (*Payment, error) {
+		for _, p := range s.payments {
+			if p.Provider == provider && p.IntentID == intentID {
+				cp := *p
+				return &cp, nil
+			}
+		}
+		return nil, domain.ErrNotFound
+	}
+	repo.getSucceededFn = func(ctx context.Context, orderID int64) (*Payment, error) {
+		for _, p := range s.payments {
+			if p.OrderID == orderID && p.Status == PaymentStatusSucceeded {
+				cp := *p
+				return &cp, nil
+			}
+		}
+		return nil, domain.ErrNotFound
+	}
+	repo.addRefundedAmountFn = func(ctx context.Context, id int64, amount int64) error {
+		p := s.payments[id-1]
+		if p.RefundedAmount+amount > p.Amount {
+			return domain.NewConflictError("refund exceeds captured amount")
+		}
+		p.RefundedAmount += amount
+		return nil
+	}
+	repo.createRefundFn = func(ctx context.Context, refund *Refund) (*Refund, error) {
+		for _, existing := range s.refunds {
+			if existing.OrderID == refund.OrderID && existing.Status == RefundStatusPending {
+				return nil, domain.NewConflictError("order already has a refund in progress")
+			}
+		}
+		cp := *refund
+		cp.ID = int64(len(s.refunds) + 1)
+		s.refunds = append(s.refunds, &cp)
+		created := cp
+		return &created, nil
+	}
+	repo.setRefundStatusFn = func(ctx context.Context, id int64, status RefundStatus, providerRefundID string) error {
+		s.refunds[id-1].Status = status
+		if providerRefundID != "" {
+			s.refunds[id-1].ProviderRefundID = providerRefundID
+		}
+		return nil
+	}
+}
+
+type mockOrderService struct {
+	getByIDFn      func(ctx context.Context, id int64, actor orders.Actor) (*orders.Order, []orders.OrderItem, error)
+	getForUpdateFn func(ctx context.Context, id int64, actor orders.Actor) (*orders.Order, error)
+	changeStatusFn func(ctx context.Context, id int64, status orders.OrderStatus, changedBy int64) (*orders.Order, error)
+	applyRefundFn  func(ctx context.Context, id int64, lines []orders.RefundLine, restock bool, changedBy int64) (*orders.Order, []orders.RefundLine, error)
+	restockFn      func(ctx context.Context, id int64, lines []orders.RefundLine) error
+	revertRefundFn func(ctx context.Context, id int64, lines []orders.RefundLine, status orders.OrderStatus, changedBy int64) error
+}
+
+func (m *mockOrderService) GetByID(ctx context.Context, id int64, actor orders.Actor) (*orders.Order, []orders.OrderItem, error) {
+	return m.getByIDFn(ctx, id, actor)
+}
+
+func (m *mockOrderService) GetForUpdate(ctx context.Context, id int64, actor orders.Actor) (*orders.Order, error) {
+	return m.getForUpdateFn(ctx, id, actor)
+}
+
+func (m *mockOrderService) ChangeStatus(ctx context.Context, id int64, status orders.OrderStatus, changedBy int64) (*orders.Order, error) {
+	return m.changeStatusFn(ctx, id, status, changedBy)
+}
+
+func (m *mockOrderService) ApplyRefund(ctx context.Context, id int64, lines []orders.RefundLine, restock bool, changedBy int64) (*orders.Order, []orders.RefundLine, error) {
+	return m.applyRefundFn(ctx, id, lines, restock, changedBy)
+}
+
+func (m *mockOrderService) RestockRefund(ctx context.Context, id int64, lines []orders.RefundLine) error {
+	return m.restockFn(ctx, id, lines)
+}
+
+func (m *mockOrderService) RevertRefund(ctx context.Context, id int64, lines []orders.RefundLine, status orders.OrderStatus, changedBy int64) error {
+	return m.revertRefundFn(ctx, id, lines, status, changedBy)
+}
+
+// fakeTx runs fn inline and tracks how many transactions are open.
+type fakeTx struct {
+	open int
+}
+
+func (f *fakeTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.open++
+	defer func() { f.open-- }()
+	return fn(ctx)
+}
+
+type paymentFixture struct {
+	svc      Service
+	repo     *mockPaymentRepo
+	orderSvc *mockOrderService
+	provider *FakeProvider
+	store    *paymentStore
+	tx       *fakeTx
+	order    *orders.Order
+	paidFor  []int64
+	// restocked holds the quantities returned to stock per order item.
+	restocked map[int64]int64
+	// lockedInTx holds what was done under the order lock, in order.
+	lockedInTx []string
+}
+
+func newPaymentFixture() *paymentFixture {
+	f := &paymentFixture{
+		provider:  NewFakeProvider(testWebhookSecret),
+		store:     &paymentStore{},
+		tx:        &fakeTx{},
+		restocked: make(map[int64]int64),
+		order:     &orders.Order{ID: 7, UserID: 1, Status: orders.OrderStatusPending, TotalPrice: 2500},
+	}
+
+	repo := &mockPaymentRepo{}
+	f.store.install(repo)
+
+	locked := false
+	create := repo.createFn
+	repo.createFn = func(ctx context.Context, p *Payment) (*Payment, error) {
+		if locked && f.tx.open > 0 {
+			f.lockedInTx = append(f.lockedInTx, "create payment")
+		}
+		return create(ctx, p)
+	}
+
+	orderSvc := &mockOrderService{
+		getByIDFn: func(ctx context.Context, id int64, actor orders.Actor) (*orders.Order, []orders.OrderItem, error) {
+			if id != f.order.ID || !actor.CanAccess(f.order) {
+				return nil, nil, domain.ErrNotFound
+			}
+			cp := *f.order
+			return &cp, nil, nil
+		},
+		getForUpdateFn: func(ctx context.Context, id int64, actor orders.Actor) (*orders.Order, error) {
+			if id != f.order.ID || !actor.CanAccess(f.order) {
+				return nil, domain.ErrNotFound
+			}
+			if f.tx.open > 0 {
+				locked = true
+				f.lockedInTx = append(f.lockedInTx, "lock order")
+			}
+			cp := *f.order
+			return &cp, nil
+		},
+		changeStatusFn: func(ctx context.Context, id int64, status orders.OrderStatus, changedBy int64) (*orders.Order, error) {
+			if !f.order.Status.CanTransitionTo(status) {
+				return nil, domain.NewConflictError("invalid transition")
+			}
+			f.order.Status = status
+			f.paidFor = append(f.paidFor, id)
+			return f.order, nil
+		},
+		// Every unit costs 100; without lines the remaining total is refunded.
+		applyRefundFn: func(ctx context.Context, id int64, lines []orders.RefundLine, restock bool, changedBy int64) (*orders.Order, []orders.RefundLine, error) {
+			if id != f.order.ID {
+				return nil, nil, domain.ErrNotFound
+			}
+			if !f.order.Status.CanTransitionTo(orders.OrderStatusPartiallyRefunded) {
+				return nil, nil, domain.NewConflictError("invalid transition")
+			}
+			if len(lines) == 0 {
+				lines = []orders.RefundLine{{OrderItemID: 1, Quantity: (f.order.TotalPrice - f.order.RefundedAmount) / 100}}
+			}
+			var amount int64
+			for i := range lines {
+				lines[i].Amount = lines[i].Quantity * 100
+				amount += lines[i].Amount
+			}
+			f.order.RefundedAmount += amount
+			f.order.Status = orders.OrderStatusPartiallyRefunded
+			if f.order.RefundedAmount == f.order.TotalPrice {
+				f.order.Status = orders.OrderStatusRefunded
+			}
+			if restock {
+				for _, l := range lines {
+					f.restocked[l.OrderItemID] += l.Quantity
+				}
+			}
+			cp := *f.order
+			return &cp, lines, nil
+		},
+		restockFn: func(ctx context.Context, id int64, lines []orders.RefundLine) error {
+			for _, l := range lines {
+				f.restocked[l.OrderItemID] += l.Quantity
+			}
+			return nil
+		},
+		revertRefundFn: func(ctx context.Context, id int64, lines []orders.RefundLine, status orders.OrderStatus, changedBy int64) error {
+			for _, l := range lines {
+				f.order.RefundedAmount -= l.Amount
+			}
+			f.order.Status = status
+			return nil
+		},
+	}
+
+	f.repo = repo
+	f.orderSvc = orderSvc
+	f.svc = NewService(repo, orderSvc, f.provider, f.tx, Options{WebhookSecret: testWebhookSecret})
+	return f
+}
+
+// captureHookProvider runs hook after each capture and returns its result,
+// e.g. to deliver a webhook before the capture call returns.
+type captureHookProvider struct {
+	*FakeProvider
+	hook func(intent *Intent) (*Intent, error)
+}
+
+func (p *captureHookProvider) Capture(ctx context.Context, intentID string, amount int64) (*Intent, error) {
+	intent, err := p.FakeProvider.Capture(ctx, intentID, amount)
+	if err != nil {
+		return nil, err
+	}
+	return p.hook(intent)
+}
+
+var owner = orders.Actor{UserID: 1, Role: "user"}
+
+func TestService_Pay(t *testing.T) {
+	t.Run("captures and marks order paid", func(t *testing.T) {
+		f := newPaymentFixture()
+
+		payment, err := f.svc.Pay(context.Background(), 7, owner, PayInput{PaymentMethod: FakeMethodOK})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if payment.Status != PaymentStatusSucceeded || payment.Amount != 2500 || payment.IntentID == "" {
+			t.Fatalf("unexpected payment: %+v", payment)
+		}
+		if f.order.Status != orders.OrderStatusPaid {
+			t.Fatalf("order status = %s, want paid", f.order.Status)
+		}
+
+		_, err = f.svc.Pay(context.Background(), 7, owner, PayInput{})
+		if !domain.IsConflictError(err) {
+			t.Fatalf("expected conflict paying twice, got %v", err)
+		}
+	})
+
+	t.Run("payment created under the order lock", func(t *testing.T) {
+		f := newPaymentFixture()
+
+		if _, err := f.svc.Pay(context.Background(), 7, owner, PayInput{PaymentMethod: FakeMethodOK}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(f.lockedInTx) != 2 || f.lockedInTx[0] != "lock order" || f.lockedInTx[1] != "create payment" {
+			t.Fatalf("expected the order locked and the payment created in one transaction, got %v", f.lockedInTx)
+		}
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		f := newPaymentFixture()
+
+		_, err := f.svc.Pay(context.Background(), 7, owner, PayInput{PaymentMethod: FakeMethodDeclined})
+		declinedErr, ok := AsDeclinedError(err)
+		if !ok {
+			t.Fatalf("expected declined error, got %v", err)
+		}
+		if declinedErr.Reason != "card_declined" {
+			t.Fatalf("unexpected reason: %s", declinedErr.Reason)
+		}
+		if f.store.payments[0].Status != PaymentStatusFailed || f.order.Status != orders.OrderStatusPending {
+			t.Fatalf("unexpected state: payment %s, order %s", f.store.payments[0].Status, f.order.Status)
+		}
+
+		// A failed attempt does not block another one.
+		if _, err := f.svc.Pay(context.Background(), 7, owner, PayInput{}); err != nil {
+			t.Fatalf("unexpected error on retry: %v", err)
+		}
+	})
+
+	t.Run("declined after the client went away", func(t *testing.T) {
+		f := newPaymentFixture()
+		update := f.repo.updateStatusFn
+		f.repo.updateStatusFn = func(ctx context.Context, id int64, status PaymentStatus, failureReason string) (bool, error) {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+			return update(ctx, id, status, failureReason)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := f.svc.Pay(ctx, 7, owner, PayInput{PaymentMethod: FakeMethodDeclined}); err == nil {
+			t.Fatal("expected an error")
+		}
+		if f.store.payments[0].Status != PaymentStatusFailed {
+			t.Fatalf("payment status = %s, want failed", f.store.payments[0].Status)
+		}
+	})
+
+	t.Run("local failures do not leave the payment pending", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			method string
+			fail   func(repo *mockPaymentRepo)
+		}{
+			{"saving the intent", FakeMethodOK, func(repo *mockPaymentRepo) {
+				repo.setIntentFn = func(ctx context.Context, id int64, intentID string) error {
+					return errors.New("connection lost")
+				}
+			}},
+			{"marking it processing", FakeMethodAsync, func(repo *mockPaymentRepo) {
+				update := repo.updateStatusFn
+				repo.updateStatusFn = func(ctx context.Context, id int64, status PaymentStatus, failureReason string) (bool, error) {
+					if status == PaymentStatusProcessing {
+						return false, errors.New("connection lost")
+					}
+					return update(ctx, id, status, failureReason)
+				}
+			}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				f := newPaymentFixture()
+				tt.fail(f.repo)
+
+				if _, err := f.svc.Pay(context.Background(), 7, owner, PayInput{PaymentMethod: tt.method}); err == nil {
+					t.Fatal("expected an error")
+				}
+				if f.store.payments[0].Status != PaymentStatusFailed {
+					t.Fatalf("payment status = %s, want failed", f.store.payments[0].Status)
+				}
+			})
+		}
+	})
+
+	t.Run("webhook settles the payment before capture returns", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			capture func(intent *Intent) (*Intent, error)
+		}{
+			{"still processing", func(intent *Intent) (*Intent, error) {
+				return intent, nil
+			}},
+			{"capture timed out", func(intent *Intent) (*Intent, error) {
+				return nil, context.DeadlineExceeded
+			}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				f := newPaymentFixture()
+				provider := &captureHookProvider{FakeProvider: f.provider}
+				provider.hook = func(intent *Intent) (*Intent, error) {
+					payload, signature, err := f.provider.Webhook(intent.ID, true)
+					if err != nil {
+						t.Fatalf("build webhook: %v", err)
+					}
+					if err := f.svc.HandleWebhook(context.Background(), payload, signature); err != nil {
+						t.Fatalf("webhook: %v", err)
+					}
+					return tt.capture(intent)
+				}
+				f.svc = NewService(f.repo, f.orderSvc, provider, f.tx, Options{WebhookSecret: testWebhookSecret})
+
+				payment, err := f.svc.Pay(context.Background(), 7, owner, PayInput{PaymentMethod: FakeMethodAsync})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if payment.Status != PaymentStatusSucceeded {
+					t.Fatalf("returned payment status = %s, want succeeded", payment.Status)
+				}
+				if f.store.payments[0].Status != PaymentStatusSucceeded || f.order.Status != orders.OrderStatusPaid {
+					t.Fatalf("unexpected state: payment %s, order %s", f.store.payments[0].Status, f.order.Status)
+				}
+			})
+		}
+	})
+
+	t.Run("other user's order", func(t *testing.T) {
+		f := newPaymentFixture()
+
+		_, err := f.svc.Pay(context.Background(), 7, orders.Actor{UserID: 2, Role: "user"}, PayInput{})
+		if !errors.Is(err, domain.ErrNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	})
+
+	t.Run("order not pending", func(t *testing.T) {
+		f := newPaymentFixture()
+		f.order.Status = orders.OrderStatusCancelled
+
+		_, err := f.svc.Pay(context.Background(), 7, owner, PayInput{})
+		if !domain.IsConflictError(err) {
+			t.Fatalf("expected conflict, got %v", err)
+		}
+	})
+}
+
+func TestService_HandleWebhook(t *testing.T) {
+	t.Run("settles async payment once", func(t *testing.T) {
+		f := newPaymentFixture()
+
+		payment, err := f.svc.Pay(context.Background(), 7, owner, PayInput{PaymentMethod: FakeMethodAsync})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if payment.Status != PaymentStatusProcessing || f.order.Status != orders.OrderStatusPending {
+			t.Fatalf("unexpected state: payment %s, order %s", payment.Status, f.order.Status)
+		}
+
+		payload, signature, err := f.provider.Webhook(payment.IntentID, true)
+		if err != nil {
+			t.Fatalf("build webhook: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := f.svc.HandleWebhook(context.Background(), payload, signature); err != nil {
+				t.Fatalf("delivery %d: unexpected error: %v", i+1, err)
+			}
+		}
+
+		if f.store.payments[0].Status != PaymentStatusSucceeded || f.order.Status != orders.OrderStatusPaid {
+			t.Fatalf("unexpected state: payment %s, order %s", f.store.payments[0].Status, f.order.Status)
+		}
+		if len(f.paidFor) != 1 {
+			t.Fatalf("order marked paid %d times, want 1", len(f.paidFor))
+		}
+	})
+
+	t.Run("failed payment", func(t *testing.T) {
+		f := newPaymentFixture()
+		payment, _ := f.svc.Pay(context.Background(), 7, owner, PayInput{PaymentMethod: FakeMethodAsync})
+
+		payload, signature, _ := f.provider.Webhook(payment.IntentID, false)
+		if err := f.svc.HandleWebhook(context.Background(), payload, signature); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if f.store.payments[0].Status != PaymentStatusFailed || f.order.Status != orders.OrderStatusPending {
+			t.Fatalf("unexpected state: payment %s, order %s", f.store.payments[0].Status, f.order.Status)
+		}
+	})
+
+	t.Run("amount mismatch", func(t *testing.T) {
+		f := newPaymentFixture()
+		payment, _ := f.svc.Pay(context.Background(), 7, owner, PayInput{PaymentMethod: FakeMethodAsync})
+
+		payload, _ := json.Marshal(WebhookEvent{ID: "evt_1", Type: EventPaymentSucceeded, IntentID: payment.IntentID, Amount: 100})
+		signature := SignWebhook([]byte(testWebhookSecret), payload, time.Now())
+		if err := f.svc.HandleWebhook(context.Background(), payload, signature); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if f.store.payments[0].Status != PaymentStatusFailed || f.order.Status != orders.OrderStatusPending {
+			t.Fatalf("unexpected state: payment %s, order %s", f.store.payments[0].Status, f.order.Status)
+		}
+	})
+
+	t.Run("invalid signatures", func(t *testing.T) {
+		f := newPaymentFixture()
+		payload := []byte(`{"type":"payment.succeeded","intent_id":"fake_pi_1","amount":2500}`)
+
+		signatures := map[string]string{
+			"missing":      "",
+			"wrong secret": SignWebhook([]byte("other"), payload, time.Now()),
+			"stale":        SignWebhook([]byte(testWebhookSecret), payload, time.Now().Add(-time.Hour)),
+			"malformed":    "t=abc,v1=zz",
+		}
+		for name, signature := range signatures {
+			if err := f.svc.HandleWebhook(context.Background(), payload, signature); !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("%s: expected invalid signature, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("unknown intent", func(t *testing.T) {
+		f := newPaymentFixture()
+		payload := []byte(`{"type":"payment.succeeded","intent_id":"fake_pi_404","amount":2500}`)
+
+		err := f.svc.HandleWebhook(context.Background(), payload, SignWebhook([]byte(testWebhookSecret), payload, time.Now()))
+		if !errors.Is(err, domain.ErrNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	})
+}
+
+func TestService_Refund(t *testing.T) {
+	const adminID = 99
+
+	paidFixture := func(t *testing.T) *paymentFixture {
+		t.Helper()
+		f := newPaymentFixture()
+		if _, err := f.svc.Pay(context.Background(), 7, owner, PayInput{PaymentMethod: FakeMethodOK}); err != nil {
+			t.Fatalf("pay: %v", err)
+		}
+		return f
+	}
+
+	t.Run("partial then full", func(t *testing.T) {
+		f := paidFixture(t)
+
+		refund, err := f.svc.Refund(context.Background(), 7, RefundInput{
+			Items:   []RefundItemInput{{OrderItemID: 1, Quantity: 5}},
+			Restock: true,
+			Reason:  "damaged",
+		}, adminID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if refund.Amount != 500 || refund.ProviderRefundID == "" || refund.PaymentID == nil || refund.CreatedBy != adminID ||
+			refund.Status != RefundStatusSucceeded {
+			t.Fatalf("unexpected refund: %+v", refund)
+		}
+		if f.store.refunds[0].Status != RefundStatusSucceeded || f.restocked[1] != 5 {
+			t.Fatalf("unexpected state: refund %s, restocked %v", f.store.refunds[0].Status, f.restocked)
+		}
+		if f.order.Status != orders.OrderStatusPartiallyRefunded || f.store.payments[0].RefundedAmount != 500 {
+			t.Fatalf("unexpected state: order %s, payment refunded %d", f.order.Status, f.store.payments[0].RefundedAmount)
+		}
+
+		refund, err = f.svc.Refund(context.Background(), 7, RefundInput{}, adminID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if refund.Amount != 2000 || f.order.Status != orders.OrderStatusRefunded || f.store.payments[0].RefundedAmount != 2500 {
+			t.Fatalf("unexpected state: refund %d, order %s, payment refunded %d",
+				refund.Amount, f.order.Status, f.store.payments[0].RefundedAmount)
+		}
+		if len(f.store.refunds) != 2 {
+			t.Fatalf("ledger has %d refunds, want 2", len(f.store.refunds))
+		}
+	})
+
+	t.Run("more than captured", func(t *testing.T) {
+		f := paidFixture(t)
+		f.store.payments[0].Amount = 2000
+
+		_, err := f.svc.Refund(context.Background(), 7, RefundInput{}, adminID)
+		if !domain.IsConflictError(err) {
+			t.Fatalf("expected conflict, got %v", err)
+		}
+		if len(f.store.refunds) != 0 || f.store.payments[0].RefundedAmount != 0 {
+			t.Fatalf("expected nothing recorded, got %d refunds", len(f.store.refunds))
+		}
+	})
+
+	t.Run("more than left of the payment", func(t *testing.T) {
+		f := paidFixture(t)
+		f.store.payments[0].RefundedAmount = 2000
+
+		_, err := f.svc.Refund(context.Background(), 7, RefundInput{
+			Items: []RefundItemInput{{OrderItemID: 1, Quantity: 6}},
+		}, adminID)
+		if !domain.IsConflictError(err) {
+			t.Fatalf("expected conflict, got %v", err)
+		}
+		if len(f.store.refunds) != 0 || f.store.payments[0].RefundedAmount != 2000 {
+			t.Fatalf("expected nothing recorded, got %d refunds", len(f.store.refunds))
+		}
+	})
+
+	t.Run("no captured payment", func(t *testing.T) {
+		f := newPaymentFixture()
+		// E.g. marked paid by hand, without going through the provider.
+		f.order.Status = orders.OrderStatusDelivered
+
+		_, err := f.svc.Refund(context.Background(), 7, RefundInput{}, adminID)
+		if !domain.IsConflictError(err) {
+			t.Fatalf("expected conflict, got %v", err)
+		}
+		if len(f.store.refunds) != 0 {
+			t.Fatalf("expected nothing recorded, got %d refunds", len(f.store.refunds))
+		}
+	})
+
+	t.Run("provider failure", func(t *testing.T) {
+		f := paidFixture(t)
+		f.store.payments[0].IntentID = "fake_pi_404"
+
+		_, err := f.svc.Refund(context.Background(), 7, RefundInput{Restock: true}, adminID)
+		if !errors.Is(err, ErrProvider) {
+			t.Fatalf("expected provider error, got %v", err)
+		}
+		if len(f.store.refunds) != 1 || f.store.refunds[0].Status != RefundStatusFailed {
+			t.Fatalf("expected the refund recorded as failed, got %+v", f.store.refunds)
+		}
+		if f.order.Status != orders.OrderStatusPaid || f.order.RefundedAmount != 0 || f.store.payments[0].RefundedAmount != 0 {
+			t.Fatalf("expected the refund released: order %s refunded %d, payment refunded %d",
+				f.order.Status, f.order.RefundedAmount, f.store.payments[0].RefundedAmount)
+		}
+		if len(f.restocked) != 0 {
+			t.Fatalf("expected no restock, got %v", f.restocked)
+		}
+	})
+
+	t.Run("pending refund blocks another", func(t *testing.T) {
+		f := paidFixture(t)
+		f.store.refunds = append(f.store.refunds, &Refund{ID: 1, OrderID: 7, Status: RefundStatusPending, Amount: 100})
+
+		_, err := f.svc.Refund(context.Background(), 7, RefundInput{
+			Items: []RefundItemInput{{OrderItemID: 1, Quantity: 1}},
+		}, adminID)
+		if !domain.IsConflictError(err) {
+			t.Fatalf("expected conflict, got %v", err)
+		}
+	})
+
+	t.Run("unpaid order", func(t *testing.T) {
+		f := newPaymentFixture()
+
+		if _, err := f.svc.Refund(context.Background(), 7, RefundInput{}, adminID); !domain.IsConflictError(err) {
+			t.Fatalf("expected conflict, got %v", err)
+		}
+	})
+}
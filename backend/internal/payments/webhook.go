@@ -0,0 +1,65 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "Payment-Signature"
+
+	// signatureTolerance bounds how old a signed webhook may be, limiting
+	// replays of captured requests.
+	signatureTolerance = 5 * time.Minute
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// SignWebhook returns the Payment-Signature header for payload, in the form
+// "t=<unix>,v1=<hex hmac-sha256 of "<unix>.<payload>">".
+func SignWebhook(secret, payload []byte, at time.Time) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(webhookMAC(secret, ts, payload))
+}
+
+// VerifyWebhook checks a Payment-Signature header against payload.
+func VerifyWebhook(secret, payload []byte, header string, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, webhookMAC(secret, ts, payload)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func webhookMAC(secret []byte, ts string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,12 @@
+package products
+
+// EventStockLow is emitted when a sale leaves a product at or below the
+// configured low-stock threshold.
+const EventStockLow = "product.stock_low"
+
+type StockLowEvent struct {
+	ProductID int64  `json:"product_id"`
+	Name      string `json:"name"`
+	Stock     int64  `json:"stock"`
+	Threshold int64  `json:"threshold"`
+}
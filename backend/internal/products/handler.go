@@ -2,12 +2,14 @@ package products
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 
 	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/pagination"
 )
 
 type Handler struct {
@@ -18,12 +20,20 @@ func NewHandler(service Service) *Handler {
 	return &Handler{service: service}
 }
 
+// RegisterRoutes registers the public, read-only catalog routes.
 func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 	g := r.Group("/products")
 
-	g.POST("/", h.create)
 	g.GET("/", h.getAll)
 	g.GET("/:id", h.getByID)
+}
+
+// RegisterAdminRoutes registers the catalog write routes. r must already be
+// restricted to admins.
+func (h *Handler) RegisterAdminRoutes(r *gin.RouterGroup) {
+	g := r.Group("/products")
+
+	g.POST("/", h.create)
 	g.PUT("/:id", h.update)
 	g.DELETE("/:id", h.delete)
 }
@@ -58,9 +68,8 @@ func (h *Handler) create(c *gin.Context) {
 	c.JSON(http.StatusCreated, product)
 }
 
-
 func (h *Handler) getAll(c *gin.Context) {
-	page, limit, err := parsePagination(c)
+	page, err := pagination.Parse(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "invalid_pagination",
@@ -69,8 +78,25 @@ func (h *Handler) getAll(c *gin.Context) {
 		return
 	}
 
-	products, err := h.service.GetAll(c.Request.Context(), page, limit)
+	filter, err := ParseFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_filter",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	products, err := h.service.GetAll(c.Request.Context(), filter, page)
 	if err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed_to_get_products",
 			"message": err.Error(),
@@ -196,31 +222,38 @@ func parseIDParam(raw string) (int64, error) {
 	return id, nil
 }
 
-func parsePagination(c *gin.Context) (int, int, error) {
-	pageStr := c.Query("page")
-	limitStr := c.Query("limit")
-
-	page := 1
-	limit := 20
+// ParseFilter reads the catalog filter from the query string.
+func ParseFilter(c *gin.Context) (Filter, error) {
+	filter := Filter{
+		Query: c.Query("q"),
+		Sort:  SortOrder(c.Query("sort")),
+	}
 
-	if pageStr != "" {
-		v, err := strconv.Atoi(pageStr)
-		if err != nil || v <= 0 {
-			return 0, 0, errors.New("page must be a positive integer")
+	for _, p := range []struct {
+		name string
+		dst  **int64
+	}{
+		{"min_price", &filter.MinPrice},
+		{"max_price", &filter.MaxPrice},
+	} {
+		raw := c.Query(p.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return Filter{}, fmt.Errorf("%s must be an integer", p.name)
 		}
-		page = v
+		*p.dst = &v
 	}
 
-	if limitStr != "" {
-		v, err := strconv.Atoi(limitStr)
-		if err != nil || v <= 0 {
-			return 0, 0, errors.New("limit must be a positive integer")
-		}
-		if v > 100 {
-			return 0, 0, errors.New("limit must be less than or equal to 100")
+	if raw := c.Query("in_stock"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return Filter{}, errors.New("in_stock must be a boolean")
 		}
-		limit = v
+		filter.InStock = v
 	}
 
-	return page, limit, nil
+	return filter, nil
 }
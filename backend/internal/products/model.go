@@ -8,15 +8,17 @@ type Product struct {
 	Description string    `json:"description,omitempty"`
 	Price       int64     `json:"price"`
 	Stock       int64     `json:"stock"`
+	CategoryIDs []int64   `json:"category_ids"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 type CreateProductInput struct {
-	Name        string `json:"name"`
-	Description string `json:"description,omitempty"`
-	Price       int64  `json:"price"`
-	Stock       int64  `json:"stock"`
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	Price       int64   `json:"price"`
+	Stock       int64   `json:"stock"`
+	CategoryIDs []int64 `json:"category_ids,omitempty"`
 }
 
 type UpdateProductInput struct {
@@ -24,4 +26,38 @@ type UpdateProductInput struct {
 	Description *string `json:"description,omitempty"`
 	Price       *int64  `json:"price,omitempty"`
 	Stock       *int64  `json:"stock,omitempty"`
+	// CategoryIDs replaces the product's categories when present; an empty
+	// list clears them.
+	CategoryIDs *[]int64 `json:"category_ids,omitempty"`
+}
+
+type SortOrder string
+
+const (
+	SortDefault   SortOrder = ""
+	SortPriceAsc  SortOrder = "price_asc"
+	SortPriceDesc SortOrder = "price_desc"
+	SortNewest    SortOrder = "newest"
+	SortName      SortOrder = "name"
+)
+
+func (s SortOrder) Valid() bool {
+	switch s {
+	case SortDefault, SortPriceAsc, SortPriceDesc, SortNewest, SortName:
+		return true
+	}
+	return false
+}
+
+// Filter narrows the catalog listing. Zero values mean "any". With the
+// default sort, results are ranked by relevance when Query is set and by id
+// otherwise.
+type Filter struct {
+	Query    string
+	MinPrice *int64
+	MaxPrice *int64
+	InStock  bool
+	Sort     SortOrder
+	// CategoryID also matches products in descendant categories.
+	CategoryID int64
 }
@@ -1,11 +1,19 @@
 package products
 
-import "context"
+import (
+	"context"
+
+	"go-shop-app-backend/internal/infra/http/pagination"
+)
 
 type Repository interface {
 	Create(ctx context.Context, input CreateProductInput) (*Product, error)
-	GetAll(ctx context.Context, limit, offset int) ([]*Product, error)
+	GetAll(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error)
+	Count(ctx context.Context, filter Filter) (int64, error)
 	GetByID(ctx context.Context, id int64) (*Product, error)
 	Update(ctx context.Context, id int64, input UpdateProductInput) (*Product, error)
 	Delete(ctx context.Context, id int64) error
+	GetByIDsForUpdate(ctx context.Context, ids []int64) ([]*Product, error)
+	AdjustStock(ctx context.Context, id int64, delta int64) error
+	SetCategories(ctx context.Context, productID int64, categoryIDs []int64) error
 }
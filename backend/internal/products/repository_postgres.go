@@ -5,8 +5,13 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
 
 	"go-shop-app-backend/internal/domain"
+	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/infra/http/pagination"
 )
 
 type postgresRepository struct {
@@ -17,6 +22,10 @@ func NewPostgresRepository(db *sql.DB) Repository {
 	return &postgresRepository{db: db}
 }
 
+func (r *postgresRepository) conn(ctx context.Context) infraDB.DBTX {
+	return infraDB.Conn(ctx, r.db)
+}
+
 func (r *postgresRepository) Create(ctx context.Context, input CreateProductInput) (*Product, error) {
 	const query = `
         INSERT INTO products (name, description, price, stock)
@@ -25,7 +34,7 @@ func (r *postgresRepository) Create(ctx context.Context, input CreateProductInpu
     `
 
 	var p Product
-	err := r.db.QueryRowContext(
+	err := r.conn(ctx).QueryRowContext(
 		ctx,
 		query,
 		input.Name,
@@ -45,18 +54,97 @@ func (r *postgresRepository) Create(ctx context.Context, input CreateProductInpu
 		return nil, fmt.Errorf("insert product: %w", err)
 	}
 
+	p.CategoryIDs = []int64{}
+
 	return &p, nil
 }
 
-func (r *postgresRepository) GetAll(ctx context.Context, limit, offset int) ([]*Product, error) {
-	const query = `
+// filterQuery accumulates WHERE conditions and their positional arguments.
+type filterQuery struct {
+	conditions []string
+	args       []any
+	queryArg   int
+}
+
+func (q *filterQuery) addArg(arg any) int {
+	q.args = append(q.args, arg)
+	return len(q.args)
+}
+
+func (q *filterQuery) where() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+func newFilterQuery(filter Filter) *filterQuery {
+	q := &filterQuery{}
+
+	if filter.Query != "" {
+		q.queryArg = q.addArg(filter.Query)
+		q.conditions = append(q.conditions, fmt.Sprintf("search_vector @@ websearch_to_tsquery('simple', $%d)", q.queryArg))
+	}
+	if filter.MinPrice != nil {
+		q.conditions = append(q.conditions, fmt.Sprintf("price >= $%d", q.addArg(*filter.MinPrice)))
+	}
+	if filter.MaxPrice != nil {
+		q.conditions = append(q.conditions, fmt.Sprintf("price <= $%d", q.addArg(*filter.MaxPrice)))
+	}
+	if filter.InStock {
+		q.conditions = append(q.conditions, "stock > 0")
+	}
+	if filter.CategoryID > 0 {
+		q.conditions = append(q.conditions, fmt.Sprintf(`id IN (
+            SELECT pc.product_id
+            FROM product_categories pc
+            WHERE pc.category_id IN (
+                WITH RECURSIVE tree AS (
+                    SELECT id FROM categories WHERE id = $%d
+                    UNION
+                    SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+                )
+                SELECT id FROM tree
+            )
+        )`, q.addArg(filter.CategoryID)))
+	}
+
+	return q
+}
+
+func (r *postgresRepository) GetAll(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error) {
+	q := newFilterQuery(filter)
+
+	if page.Cursor != nil {
+		q.conditions = append(q.conditions, fmt.Sprintf(
+			"(created_at, id) < ($%d, $%d)", q.addArg(page.Cursor.CreatedAt), q.addArg(page.Cursor.ID),
+		))
+	}
+
+	query := `
         SELECT id, name, description, price, stock, created_at, updated_at
         FROM products
-        ORDER BY id
-        LIMIT $1 OFFSET $2
-    `
+    ` + q.where()
+
+	switch {
+	case page.Cursor != nil || filter.Sort == SortNewest:
+		query += " ORDER BY created_at DESC, id DESC"
+	case filter.Sort == SortPriceAsc:
+		query += " ORDER BY price ASC, id"
+	case filter.Sort == SortPriceDesc:
+		query += " ORDER BY price DESC, id"
+	case filter.Sort == SortName:
+		query += " ORDER BY name ASC, id"
+	case q.queryArg > 0:
+		query += fmt.Sprintf(" ORDER BY ts_rank(search_vector, websearch_to_tsquery('simple', $%d)) DESC, id", q.queryArg)
+	default:
+		query += " ORDER BY id"
+	}
 
-	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", q.addArg(page.Limit), q.addArg(page.Offset()))
+	args := q.args
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query products: %w", err)
 	}
@@ -83,9 +171,24 @@ func (r *postgresRepository) GetAll(ctx context.Context, limit, offset int) ([]*
 		return nil, fmt.Errorf("rows error: %w", err)
 	}
 
+	if err := r.attachCategories(ctx, products); err != nil {
+		return nil, err
+	}
+
 	return products, nil
 }
 
+func (r *postgresRepository) Count(ctx context.Context, filter Filter) (int64, error) {
+	q := newFilterQuery(filter)
+
+	var total int64
+	if err := r.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM products"+q.where(), q.args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("count products: %w", err)
+	}
+
+	return total, nil
+}
+
 func (r *postgresRepository) GetByID(ctx context.Context, id int64) (*Product, error) {
 	const query = `
         SELECT id, name, description, price, stock, created_at, updated_at
@@ -94,7 +197,7 @@ func (r *postgresRepository) GetByID(ctx context.Context, id int64) (*Product, e
     `
 
 	var p Product
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := r.conn(ctx).QueryRowContext(ctx, query, id).Scan(
 		&p.ID,
 		&p.Name,
 		&p.Description,
@@ -110,74 +213,136 @@ func (r *postgresRepository) GetByID(ctx context.Context, id int64) (*Product, e
 		return nil, fmt.Errorf("get product by id: %w", err)
 	}
 
-	return &p, nil
-}
-
-func (r *postgresRepository) Update(ctx context.Context, id int64, input UpdateProductInput) (*Product, error) {
-	current, err := r.GetByID(ctx, id)
-	if err != nil {
+	if err := r.attachCategories(ctx, []*Product{&p}); err != nil {
 		return nil, err
 	}
 
-	if input.Name != nil {
-		current.Name = *input.Name
-	}
-	if input.Description != nil {
-		current.Description = *input.Description
-	}
-	if input.Price != nil {
-		current.Price = *input.Price
-	}
-	if input.Stock != nil {
-		current.Stock = *input.Stock
-	}
+	return &p, nil
+}
 
+// Update only writes the columns present in input, so stock reserved or
+// released by orders since the product was last read is never overwritten.
+func (r *postgresRepository) Update(ctx context.Context, id int64, input UpdateProductInput) (*Product, error) {
 	const query = `
         UPDATE products
-        SET name = $1,
-            description = $2,
-            price = $3,
-            stock = $4,
+        SET name = COALESCE($1::text, name),
+            description = COALESCE($2::text, description),
+            price = COALESCE($3::bigint, price),
+            stock = COALESCE($4::bigint, stock),
             updated_at = now()
         WHERE id = $5
+        RETURNING id, name, description, price, stock, created_at, updated_at
     `
 
-	res, err := r.db.ExecContext(
+	var p Product
+	err := r.conn(ctx).QueryRowContext(
 		ctx,
 		query,
-		current.Name,
-		current.Description,
-		current.Price,
-		current.Stock,
+		input.Name,
+		input.Description,
+		input.Price,
+		input.Stock,
 		id,
+	).Scan(
+		&p.ID,
+		&p.Name,
+		&p.Description,
+		&p.Price,
+		&p.Stock,
+		&p.CreatedAt,
+		&p.UpdatedAt,
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
 		return nil, fmt.Errorf("update product: %w", err)
 	}
 
+	if err := r.attachCategories(ctx, []*Product{&p}); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func (r *postgresRepository) Delete(ctx context.Context, id int64) error {
+	const query = `DELETE FROM products WHERE id = $1`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("delete product: %w", err)
+	}
+
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		return nil, fmt.Errorf("update product rows affected: %w", err)
+		return fmt.Errorf("delete product rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		return nil, domain.ErrNotFound
+		return domain.ErrNotFound
 	}
 
-	return current, nil
+	return nil
 }
 
-func (r *postgresRepository) Delete(ctx context.Context, id int64) error {
-	const query = `DELETE FROM products WHERE id = $1`
+// GetByIDsForUpdate locks the rows in id order so that concurrent orders
+// touching the same products cannot deadlock. It only holds the locks when
+// ctx carries a transaction.
+func (r *postgresRepository) GetByIDsForUpdate(ctx context.Context, ids []int64) ([]*Product, error) {
+	const query = `
+        SELECT id, name, description, price, stock, created_at, updated_at
+        FROM products
+        WHERE id = ANY($1)
+        ORDER BY id
+        FOR UPDATE
+    `
 
-	res, err := r.db.ExecContext(ctx, query, id)
+	rows, err := r.conn(ctx).QueryContext(ctx, query, pq.Array(ids))
 	if err != nil {
-		return fmt.Errorf("delete product: %w", err)
+		return nil, fmt.Errorf("lock products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []*Product
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(
+			&p.ID,
+			&p.Name,
+			&p.Description,
+			&p.Price,
+			&p.Stock,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan product: %w", err)
+		}
+		products = append(products, &p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return products, nil
+}
+
+func (r *postgresRepository) AdjustStock(ctx context.Context, id int64, delta int64) error {
+	const query = `
+        UPDATE products
+        SET stock = stock + $1
+        WHERE id = $2
+    `
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, delta, id)
+	if err != nil {
+		return fmt.Errorf("adjust product stock: %w", err)
 	}
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("delete product rows affected: %w", err)
+		return fmt.Errorf("adjust product stock rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
@@ -186,3 +351,70 @@ func (r *postgresRepository) Delete(ctx context.Context, id int64) error {
 
 	return nil
 }
+
+// SetCategories replaces the product's category links.
+func (r *postgresRepository) SetCategories(ctx context.Context, productID int64, categoryIDs []int64) error {
+	if _, err := r.conn(ctx).ExecContext(ctx, `DELETE FROM product_categories WHERE product_id = $1`, productID); err != nil {
+		return fmt.Errorf("clear product categories: %w", err)
+	}
+
+	if len(categoryIDs) == 0 {
+		return nil
+	}
+
+	const query = `
+        INSERT INTO product_categories (product_id, category_id)
+        SELECT $1, unnest($2::bigint[])
+    `
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, productID, pq.Array(categoryIDs)); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return domain.NewValidationError("unknown category id")
+		}
+		return fmt.Errorf("insert product categories: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) attachCategories(ctx context.Context, products []*Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Product, len(products))
+	ids := make([]int64, 0, len(products))
+	for _, p := range products {
+		p.CategoryIDs = []int64{}
+		byID[p.ID] = p
+		ids = append(ids, p.ID)
+	}
+
+	const query = `
+        SELECT product_id, category_id
+        FROM product_categories
+        WHERE product_id = ANY($1)
+        ORDER BY product_id, category_id
+    `
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("query product categories: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID, categoryID int64
+		if err := rows.Scan(&productID, &categoryID); err != nil {
+			return fmt.Errorf("scan product category: %w", err)
+		}
+		byID[productID].CategoryIDs = append(byID[productID].CategoryIDs, categoryID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
+
+	return nil
+}
@@ -4,13 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
 	"go-shop-app-backend/internal/domain"
+	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/infra/http/pagination"
 )
 
+const maxSearchQueryLength = 200
+
 type Service interface {
 	Create(ctx context.Context, input CreateProductInput) (*Product, error)
-	GetAll(ctx context.Context, page, pageSize int) ([]*Product, error)
+	GetAll(ctx context.Context, filter Filter, page pagination.Params) (*pagination.Page[*Product], error)
 	GetByID(ctx context.Context, id int64) (*Product, error)
 	Update(ctx context.Context, id int64, input UpdateProductInput) (*Product, error)
 	Delete(ctx context.Context, id int64) error
@@ -18,10 +24,11 @@ type Service interface {
 
 type service struct {
 	repo Repository
+	tx   infraDB.Transactor
 }
 
-func NewService(repo Repository) Service {
-	return &service{repo: repo}
+func NewService(repo Repository, tx infraDB.Transactor) Service {
+	return &service{repo: repo, tx: tx}
 }
 
 func (s *service) Create(ctx context.Context, input CreateProductInput) (*Product, error) {
@@ -35,33 +42,106 @@ func (s *service) Create(ctx context.Context, input CreateProductInput) (*Produc
 		return nil, domain.NewValidationError("stock cannot be negative")
 	}
 
-	product, err := s.repo.Create(ctx, input)
+	categoryIDs, err := normalizeCategoryIDs(input.CategoryIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var product *Product
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		created, err := s.repo.Create(ctx, input)
+		if err != nil {
+			return fmt.Errorf("create product: %w", err)
+		}
+
+		if err := s.repo.SetCategories(ctx, created.ID, categoryIDs); err != nil {
+			if domain.IsValidationError(err) {
+				return err
+			}
+			return fmt.Errorf("set product categories: %w", err)
+		}
+
+		created.CategoryIDs = categoryIDs
+		product = created
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("create product: %w", err)
+		return nil, err
 	}
 
 	return product, nil
 }
 
-func (s *service) GetAll(ctx context.Context, page, pageSize int) ([]*Product, error) {
-	if page <= 0 {
-		page = 1
+// normalizeCategoryIDs validates and de-duplicates category ids, keeping the
+// result sorted so it matches what the repository returns on read.
+func normalizeCategoryIDs(ids []int64) ([]int64, error) {
+	result := make([]int64, 0, len(ids))
+	seen := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		if id <= 0 {
+			return nil, domain.NewValidationError("category_ids must contain positive integers")
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
 	}
-	if pageSize <= 0 {
-		pageSize = 20
+
+	slices.Sort(result)
+	return result, nil
+}
+
+func (s *service) GetAll(ctx context.Context, filter Filter, page pagination.Params) (*pagination.Page[*Product], error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	if len(filter.Query) > maxSearchQueryLength {
+		return nil, domain.NewValidationError(fmt.Sprintf("q must be at most %d characters", maxSearchQueryLength))
+	}
+	if filter.MinPrice != nil && *filter.MinPrice < 0 {
+		return nil, domain.NewValidationError("min_price cannot be negative")
+	}
+	if filter.MaxPrice != nil && *filter.MaxPrice < 0 {
+		return nil, domain.NewValidationError("max_price cannot be negative")
 	}
-	if pageSize > 100 {
-		return nil, domain.NewValidationError("pageSize must be less than or equal to 100")
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return nil, domain.NewValidationError("min_price must be less than or equal to max_price")
+	}
+	if filter.CategoryID < 0 {
+		return nil, domain.NewValidationError("category id must be positive")
+	}
+	if !filter.Sort.Valid() {
+		return nil, domain.NewValidationError("sort must be one of price_asc, price_desc, newest, name")
 	}
 
-	offset := (page - 1) * pageSize
+	if page.Cursor != nil && filter.Sort != SortDefault && filter.Sort != SortNewest {
+		return nil, domain.NewValidationError("cursor pagination only supports sort=newest")
+	}
 
-	products, err := s.repo.GetAll(ctx, pageSize, offset)
+	page = page.WithDefaults()
+	if err := page.Validate(); err != nil {
+		return nil, domain.NewValidationError(err.Error())
+	}
+
+	products, err := s.repo.GetAll(ctx, filter, page)
 	if err != nil {
 		return nil, fmt.Errorf("get all products: %w", err)
 	}
 
-	return products, nil
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("count products: %w", err)
+	}
+
+	var cursorOf func(*Product) pagination.Cursor
+	if page.Cursor != nil || filter.Sort == SortNewest {
+		cursorOf = productCursor
+	}
+
+	return pagination.NewPage(products, total, page, cursorOf), nil
+}
+
+func productCursor(p *Product) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: p.CreatedAt, ID: p.ID}
 }
 
 func (s *service) GetByID(ctx context.Context, id int64) (*Product, error) {
@@ -92,12 +172,40 @@ func (s *service) Update(ctx context.Context, id int64, input UpdateProductInput
 		return nil, domain.NewValidationError("stock cannot be negative")
 	}
 
-	product, err := s.repo.Update(ctx, id, input)
-	if err != nil {
-		if errors.Is(err, domain.ErrNotFound) {
-			return nil, domain.ErrNotFound
+	var categoryIDs []int64
+	if input.CategoryIDs != nil {
+		ids, err := normalizeCategoryIDs(*input.CategoryIDs)
+		if err != nil {
+			return nil, err
+		}
+		categoryIDs = ids
+	}
+
+	var product *Product
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		updated, err := s.repo.Update(ctx, id, input)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return domain.ErrNotFound
+			}
+			return fmt.Errorf("update product: %w", err)
 		}
-		return nil, fmt.Errorf("update product: %w", err)
+
+		if input.CategoryIDs != nil {
+			if err := s.repo.SetCategories(ctx, id, categoryIDs); err != nil {
+				if domain.IsValidationError(err) {
+					return err
+				}
+				return fmt.Errorf("set product categories: %w", err)
+			}
+			updated.CategoryIDs = categoryIDs
+		}
+
+		product = updated
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return product, nil
@@ -3,25 +3,36 @@ package products
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/pagination"
 )
 
 type mockProductRepo struct {
-	createFn  func(ctx context.Context, input CreateProductInput) (*Product, error)
-	getAllFn  func(ctx context.Context, limit, offset int) ([]*Product, error)
-	getByIDFn func(ctx context.Context, id int64) (*Product, error)
-	updateFn  func(ctx context.Context, id int64, input UpdateProductInput) (*Product, error)
-	deleteFn  func(ctx context.Context, id int64) error
+	createFn            func(ctx context.Context, input CreateProductInput) (*Product, error)
+	getAllFn            func(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error)
+	countFn             func(ctx context.Context, filter Filter) (int64, error)
+	getByIDFn           func(ctx context.Context, id int64) (*Product, error)
+	updateFn            func(ctx context.Context, id int64, input UpdateProductInput) (*Product, error)
+	deleteFn            func(ctx context.Context, id int64) error
+	getByIDsForUpdateFn func(ctx context.Context, ids []int64) ([]*Product, error)
+	adjustStockFn       func(ctx context.Context, id int64, delta int64) error
+	setCategoriesFn     func(ctx context.Context, productID int64, categoryIDs []int64) error
 }
 
 func (m *mockProductRepo) Create(ctx context.Context, input CreateProductInput) (*Product, error) {
 	return m.createFn(ctx, input)
 }
 
-func (m *mockProductRepo) GetAll(ctx context.Context, limit, offset int) ([]*Product, error) {
-	return m.getAllFn(ctx, limit, offset)
+func (m *mockProductRepo) GetAll(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error) {
+	return m.getAllFn(ctx, filter, page)
+}
+
+func (m *mockProductRepo) Count(ctx context.Context, filter Filter) (int64, error) {
+	return m.countFn(ctx, filter)
 }
 
 func (m *mockProductRepo) GetByID(ctx context.Context, id int64) (*Product, error) {
@@ -36,12 +47,33 @@ func (m *mockProductRepo) Delete(ctx context.Context, id int64) error {
 	return m.deleteFn(ctx, id)
 }
 
+func (m *mockProductRepo) GetByIDsForUpdate(ctx context.Context, ids []int64) ([]*Product, error) {
+	return m.getByIDsForUpdateFn(ctx, ids)
+}
+
+func (m *mockProductRepo) AdjustStock(ctx context.Context, id int64, delta int64) error {
+	return m.adjustStockFn(ctx, id, delta)
+}
+
+func (m *mockProductRepo) SetCategories(ctx context.Context, productID int64, categoryIDs []int64) error {
+	return m.setCategoriesFn(ctx, productID, categoryIDs)
+}
+
+type fakeTx struct {
+	calls int
+}
+
+func (f *fakeTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.calls++
+	return fn(ctx)
+}
+
 func TestService_Create_Validation(t *testing.T) {
 	repo := &mockProductRepo{
 		createFn: func(ctx context.Context, input CreateProductInput) (*Product, error) {
 			return &Product{ID: 1, Name: input.Name, Price: input.Price, Stock: input.Stock}, nil
 		},
-		getAllFn: func(ctx context.Context, limit, offset int) ([]*Product, error) {
+		getAllFn: func(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error) {
 			return nil, nil
 		},
 		getByIDFn: func(ctx context.Context, id int64) (*Product, error) {
@@ -53,9 +85,12 @@ func TestService_Create_Validation(t *testing.T) {
 		deleteFn: func(ctx context.Context, id int64) error {
 			return nil
 		},
+		setCategoriesFn: func(ctx context.Context, productID int64, categoryIDs []int64) error {
+			return nil
+		},
 	}
 
-	svc := NewService(repo)
+	svc := NewService(repo, &fakeTx{})
 
 	tests := []struct {
 		name    string
@@ -118,7 +153,7 @@ func TestService_Create_Validation(t *testing.T) {
 
 func TestService_GetAll_Validation(t *testing.T) {
 	repo := &mockProductRepo{
-		getAllFn: func(ctx context.Context, limit, offset int) ([]*Product, error) {
+		getAllFn: func(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error) {
 			return []*Product{}, nil
 		},
 		createFn: func(ctx context.Context, input CreateProductInput) (*Product, error) {
@@ -135,9 +170,9 @@ func TestService_GetAll_Validation(t *testing.T) {
 		},
 	}
 
-	svc := NewService(repo)
+	svc := NewService(repo, &fakeTx{})
 
-	_, err := svc.GetAll(context.Background(), 1, 101)
+	_, err := svc.GetAll(context.Background(), Filter{}, pagination.Params{Page: 1, Limit: 101})
 	if err == nil || !domain.IsValidationError(err) {
 		t.Fatalf("expected validation error for too big pageSize, got %v", err)
 	}
@@ -156,7 +191,7 @@ func TestService_GetByID(t *testing.T) {
 		createFn: func(ctx context.Context, input CreateProductInput) (*Product, error) {
 			return nil, nil
 		},
-		getAllFn: func(ctx context.Context, limit, offset int) ([]*Product, error) {
+		getAllFn: func(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error) {
 			return nil, nil
 		},
 		updateFn: func(ctx context.Context, id int64, input UpdateProductInput) (*Product, error) {
@@ -167,7 +202,7 @@ func TestService_GetByID(t *testing.T) {
 		},
 	}
 
-	svc := NewService(repo)
+	svc := NewService(repo, &fakeTx{})
 
 	_, err := svc.GetByID(context.Background(), 0)
 	if err == nil || !domain.IsValidationError(err) {
@@ -196,7 +231,7 @@ func TestService_Update_Validation(t *testing.T) {
 		createFn: func(ctx context.Context, input CreateProductInput) (*Product, error) {
 			return nil, nil
 		},
-		getAllFn: func(ctx context.Context, limit, offset int) ([]*Product, error) {
+		getAllFn: func(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error) {
 			return nil, nil
 		},
 		getByIDFn: func(ctx context.Context, id int64) (*Product, error) {
@@ -207,7 +242,7 @@ func TestService_Update_Validation(t *testing.T) {
 		},
 	}
 
-	svc := NewService(repo)
+	svc := NewService(repo, &fakeTx{})
 
 	_, err := svc.Update(context.Background(), 0, UpdateProductInput{})
 	if err == nil || !domain.IsValidationError(err) {
@@ -238,7 +273,7 @@ func TestService_Delete_Validation(t *testing.T) {
 		createFn: func(ctx context.Context, input CreateProductInput) (*Product, error) {
 			return nil, nil
 		},
-		getAllFn: func(ctx context.Context, limit, offset int) ([]*Product, error) {
+		getAllFn: func(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error) {
 			return nil, nil
 		},
 		getByIDFn: func(ctx context.Context, id int64) (*Product, error) {
@@ -249,7 +284,7 @@ func TestService_Delete_Validation(t *testing.T) {
 		},
 	}
 
-	svc := NewService(repo)
+	svc := NewService(repo, &fakeTx{})
 
 	if err := svc.Delete(context.Background(), 0); err == nil || !domain.IsValidationError(err) {
 		t.Fatalf("expected validation error for id <= 0, got %v", err)
@@ -264,4 +299,129 @@ func TestService_Delete_Validation(t *testing.T) {
 	}
 }
 
+func TestService_GetAll_Filter(t *testing.T) {
+	var captured Filter
+	repo := &mockProductRepo{
+		getAllFn: func(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error) {
+			captured = filter
+			return []*Product{}, nil
+		},
+		countFn: func(ctx context.Context, filter Filter) (int64, error) {
+			return 0, nil
+		},
+	}
+
+	svc := NewService(repo, &fakeTx{})
 
+	negative, low, high := int64(-1), int64(100), int64(500)
+
+	invalid := []struct {
+		name   string
+		filter Filter
+	}{
+		{name: "negative min price", filter: Filter{MinPrice: &negative}},
+		{name: "negative max price", filter: Filter{MaxPrice: &negative}},
+		{name: "inverted price range", filter: Filter{MinPrice: &high, MaxPrice: &low}},
+		{name: "unknown sort", filter: Filter{Sort: "popularity"}},
+		{name: "query too long", filter: Filter{Query: strings.Repeat("a", maxSearchQueryLength+1)}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.GetAll(context.Background(), tt.filter, pagination.Params{Page: 1, Limit: 20})
+			if err == nil || !domain.IsValidationError(err) {
+				t.Fatalf("expected validation error, got %v", err)
+			}
+		})
+	}
+
+	_, err := svc.GetAll(context.Background(), Filter{
+		Query:    "  mug  ",
+		MinPrice: &low,
+		MaxPrice: &high,
+		InStock:  true,
+		Sort:     SortPriceDesc,
+	}, pagination.Params{Page: 1, Limit: 20})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if captured.Query != "mug" || !captured.InStock || captured.Sort != SortPriceDesc {
+		t.Fatalf("unexpected filter passed to repository: %+v", captured)
+	}
+
+	cursor := &pagination.Cursor{CreatedAt: time.Now(), ID: 5}
+	_, err = svc.GetAll(context.Background(), Filter{Sort: SortPriceAsc}, pagination.Params{Limit: 20, Cursor: cursor})
+	if err == nil || !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for cursor with price sort, got %v", err)
+	}
+}
+
+func TestService_Categories(t *testing.T) {
+	var setCalls [][]int64
+	repo := &mockProductRepo{
+		createFn: func(ctx context.Context, input CreateProductInput) (*Product, error) {
+			return &Product{ID: 7, Name: input.Name, Price: input.Price, CategoryIDs: []int64{}}, nil
+		},
+		updateFn: func(ctx context.Context, id int64, input UpdateProductInput) (*Product, error) {
+			return &Product{ID: id, CategoryIDs: []int64{1}}, nil
+		},
+		setCategoriesFn: func(ctx context.Context, productID int64, categoryIDs []int64) error {
+			setCalls = append(setCalls, categoryIDs)
+			return nil
+		},
+	}
+
+	tx := &fakeTx{}
+	svc := NewService(repo, tx)
+
+	_, err := svc.Create(context.Background(), CreateProductInput{Name: "P", Price: 100, CategoryIDs: []int64{3, 0}})
+	if err == nil || !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for non-positive category id, got %v", err)
+	}
+
+	p, err := svc.Create(context.Background(), CreateProductInput{Name: "P", Price: 100, CategoryIDs: []int64{3, 1, 3}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(p.CategoryIDs) != 2 || p.CategoryIDs[0] != 1 || p.CategoryIDs[1] != 3 {
+		t.Fatalf("expected category ids [1 3], got %v", p.CategoryIDs)
+	}
+	if tx.calls != 1 {
+		t.Fatalf("expected create to run in a transaction, got %d calls", tx.calls)
+	}
+
+	setCalls = nil
+	if _, err := svc.Update(context.Background(), 7, UpdateProductInput{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(setCalls) != 0 {
+		t.Fatalf("expected categories untouched when omitted, got %v", setCalls)
+	}
+
+	empty := []int64{}
+	p, err = svc.Update(context.Background(), 7, UpdateProductInput{CategoryIDs: &empty})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(setCalls) != 1 || len(setCalls[0]) != 0 || len(p.CategoryIDs) != 0 {
+		t.Fatalf("expected categories cleared, got calls %v and product %v", setCalls, p.CategoryIDs)
+	}
+}
+
+func TestService_GetAll_CategoryFilter(t *testing.T) {
+	repo := &mockProductRepo{
+		getAllFn: func(ctx context.Context, filter Filter, page pagination.Params) ([]*Product, error) {
+			return []*Product{}, nil
+		},
+		countFn: func(ctx context.Context, filter Filter) (int64, error) {
+			return 0, nil
+		},
+	}
+
+	svc := NewService(repo, &fakeTx{})
+
+	_, err := svc.GetAll(context.Background(), Filter{CategoryID: -1}, pagination.Params{Page: 1, Limit: 20})
+	if err == nil || !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for negative category id, got %v", err)
+	}
+}
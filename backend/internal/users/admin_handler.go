@@ -0,0 +1,227 @@
+package users
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/middleware"
+	"go-shop-app-backend/internal/infra/http/pagination"
+)
+
+func (h *Handler) RegisterAdminRoutes(r *gin.RouterGroup) {
+	g := r.Group("/users")
+
+	g.GET("/", h.adminList)
+	g.GET("/:id", h.adminGetByID)
+	g.PUT("/:id/role", h.adminChangeRole)
+	g.POST("/:id/disable", h.adminSetDisabled(true))
+	g.POST("/:id/enable", h.adminSetDisabled(false))
+}
+
+// adminList godoc
+//
+// @Summary List users
+// @Tags admin
+// @Produce json
+// @Param q query string false "Substring of email or name"
+// @Param role query string false "user or admin"
+// @Param disabled query bool false "Only disabled (true) or active (false) accounts"
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size"
+// @Param cursor query string false "Keyset cursor"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/users [get]
+func (h *Handler) adminList(c *gin.Context) {
+	page, err := pagination.Parse(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_pagination",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	filter := ListFilter{
+		Query: c.Query("q"),
+		Role:  c.Query("role"),
+	}
+	if raw := c.Query("disabled"); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_filter",
+				"message": "disabled must be true or false",
+			})
+			return
+		}
+		filter.Disabled = &v
+	}
+
+	usersList, err := h.service.List(c.Request.Context(), filter, page)
+	if err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_list_users",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, usersList)
+}
+
+// adminGetByID godoc
+//
+// @Summary Get a user with order statistics
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} UserDetails
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/users/{id} [get]
+func (h *Handler) adminGetByID(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	details, err := h.service.GetDetails(c.Request.Context(), id)
+	if err != nil {
+		writeAdminError(c, err, "failed_to_get_user")
+		return
+	}
+
+	c.JSON(http.StatusOK, details)
+}
+
+// adminChangeRole godoc
+//
+// @Summary Change a user's role
+// @Description Revokes the user's sessions so the new role takes effect immediately.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param input body ChangeRoleInput true "New role"
+// @Success 200 {object} User
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/users/{id}/role [put]
+func (h *Handler) adminChangeRole(c *gin.Context) {
+	id, ok := parseIDParam(c)
+	if !ok {
+		return
+	}
+
+	var input ChangeRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	actorID, _ := middleware.GetUserID(c)
+
+	user, err := h.service.ChangeRole(c.Request.Context(), actorID, id, input.Role)
+	if err != nil {
+		writeAdminError(c, err, "failed_to_change_role")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// adminSetDisabled godoc
+//
+// @Summary Disable or re-enable a user account
+// @Description Disabled users cannot log in and their tokens are rejected.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} User
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/users/{id}/disable [post]
+// @Router /api/v1/admin/users/{id}/enable [post]
+func (h *Handler) adminSetDisabled(disabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseIDParam(c)
+		if !ok {
+			return
+		}
+
+		actorID, _ := middleware.GetUserID(c)
+
+		user, err := h.service.SetDisabled(c.Request.Context(), actorID, id, disabled)
+		if err != nil {
+			writeAdminError(c, err, "failed_to_update_user")
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+func parseIDParam(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_id",
+			"message": "id must be a positive integer",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeAdminError(c *gin.Context, err error, code string) {
+	if domain.IsValidationError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "validation_error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if domain.IsConflictError(err) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "conflict",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, domain.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "user_not_found",
+			"message": "user not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   code,
+		"message": err.Error(),
+	})
+}
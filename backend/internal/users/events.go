@@ -0,0 +1,36 @@
+package users
+
+import (
+	"context"
+	"fmt"
+
+	"go-shop-app-backend/internal/infra/outbox"
+)
+
+const EventUserRegistered = "user.registered"
+
+type UserRegisteredEvent struct {
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+}
+
+func (s *service) emitRegistered(ctx context.Context, u *UserWithPassword) error {
+	if s.opts.Events == nil {
+		return nil
+	}
+
+	msg, err := outbox.NewMessage(EventUserRegistered, "user", u.ID, UserRegisteredEvent{
+		UserID: u.ID,
+		Email:  u.Email,
+		Name:   u.Name,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.opts.Events.Add(ctx, msg); err != nil {
+		return fmt.Errorf("record %s event: %w", EventUserRegistered, err)
+	}
+
+	return nil
+}
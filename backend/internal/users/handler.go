@@ -1,19 +1,34 @@
 package users
 
 import (
+	"context"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 
 	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/middleware"
+	"go-shop-app-backend/pkg/logger"
 )
 
+// cartTokenHeader matches carts.TokenHeader.
+const cartTokenHeader = "X-Cart-Token"
+
+// CartMerger moves a guest cart into the user's cart once they sign in.
+type CartMerger interface {
+	MergeGuestCart(ctx context.Context, token string, userID int64) error
+}
+
 type Handler struct {
 	service Service
+	carts   CartMerger
 }
 
-func NewHandler(service Service) *Handler {
-	return &Handler{service: service}
+func NewHandler(service Service, carts CartMerger) *Handler {
+	return &Handler{service: service, carts: carts}
 }
 
 func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
@@ -21,6 +36,27 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 	{
 		authGroup.POST("/register", h.register)
 		authGroup.POST("/login", h.login)
+		authGroup.POST("/refresh", h.refresh)
+		authGroup.POST("/password/forgot", h.forgotPassword)
+		authGroup.POST("/password/reset", h.resetPassword)
+		authGroup.GET("/verify", h.verifyEmail)
+	}
+}
+
+// RegisterAuthenticatedRoutes registers routes that need a valid access
+// token. r must already use middleware.AuthMiddleware.
+func (h *Handler) RegisterAuthenticatedRoutes(r *gin.RouterGroup) {
+	authGroup := r.Group("/auth")
+	{
+		authGroup.POST("/logout", h.logout)
+		authGroup.POST("/verify/resend", h.resendVerification)
+	}
+
+	me := r.Group("/users/me")
+	{
+		me.GET("", h.getMe)
+		me.PATCH("", h.updateMe)
+		me.POST("/password", h.changePassword)
 	}
 }
 
@@ -31,6 +67,7 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 // @Accept json
 // @Produce json
 // @Param input body RegisterInput true "Register input"
+// @Param X-Cart-Token header string false "Guest cart to merge into the new account"
 // @Success 201 {object} AuthResponse
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
@@ -62,6 +99,8 @@ func (h *Handler) register(c *gin.Context) {
 		return
 	}
 
+	h.mergeGuestCart(c, resp.User.ID)
+
 	c.JSON(http.StatusCreated, resp)
 }
 
@@ -72,8 +111,11 @@ func (h *Handler) register(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param input body LoginInput true "Login input"
+// @Param X-Cart-Token header string false "Guest cart to merge into the user's cart"
 // @Success 200 {object} AuthResponse
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 429 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /api/v1/auth/login [post]
 func (h *Handler) login(c *gin.Context) {
@@ -86,8 +128,20 @@ func (h *Handler) login(c *gin.Context) {
 		return
 	}
 
+	input.IP = c.ClientIP()
+
 	resp, err := h.service.Login(c.Request.Context(), input)
 	if err != nil {
+		if lockedErr, ok := AsLockedError(err); ok {
+			seconds := int(math.Ceil(lockedErr.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":   "login_locked",
+				"message": err.Error(),
+			})
+			return
+		}
+
 		if domain.IsValidationError(err) {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "invalid_credentials",
@@ -96,6 +150,14 @@ func (h *Handler) login(c *gin.Context) {
 			return
 		}
 
+		if errors.Is(err, ErrAccountDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "account_disabled",
+				"message": err.Error(),
+			})
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed_to_login",
 			"message": err.Error(),
@@ -103,5 +165,480 @@ func (h *Handler) login(c *gin.Context) {
 		return
 	}
 
+	h.mergeGuestCart(c, resp.User.ID)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// refresh godoc
+//
+// @Summary Rotate a refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body RefreshInput true "Refresh input"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/auth/refresh [post]
+func (h *Handler) refresh(c *gin.Context) {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	resp, err := h.service.Refresh(c.Request.Context(), input.RefreshToken)
+	if err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "refresh_token_reused",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "invalid_refresh_token",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_refresh",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// forgotPassword godoc
+//
+// @Summary Request a password reset email
+// @Description Always returns 202 so the response does not reveal whether the email is registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body ForgotPasswordInput true "Account email"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/auth/password/forgot [post]
+func (h *Handler) forgotPassword(c *gin.Context) {
+	var input ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.ForgotPassword(c.Request.Context(), input.Email); err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_request_password_reset",
+			"message": "failed to request password reset",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "if the account exists, a password reset link has been sent",
+	})
+}
+
+// resetPassword godoc
+//
+// @Summary Set a new password with a reset token
+// @Tags auth
+// @Accept json
+// @Param input body ResetPasswordInput true "Reset token and new password"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/auth/password/reset [post]
+func (h *Handler) resetPassword(c *gin.Context) {
+	var input ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.ResetPassword(c.Request.Context(), input); err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_reset_token",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_reset_password",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// verifyEmail godoc
+//
+// @Summary Confirm an email address from a verification link
+// @Tags auth
+// @Produce json
+// @Param token query string true "Token from the verification link"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/auth/verify [get]
+func (h *Handler) verifyEmail(c *gin.Context) {
+	if err := h.service.VerifyEmail(c.Request.Context(), c.Query("token")); err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_verification_token",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_verify_email",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "email verified",
+	})
+}
+
+// resendVerification godoc
+//
+// @Summary Send a new email verification link
+// @Tags auth
+// @Produce json
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/auth/verify/resend [post]
+func (h *Handler) resendVerification(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.ResendVerification(c.Request.Context(), userID); err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "user_not_found",
+				"message": "user not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_send_verification",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "verification link sent",
+	})
+}
+
+// logout godoc
+//
+// @Summary Revoke the current access token and optionally the refresh token
+// @Tags auth
+// @Accept json
+// @Param input body LogoutInput false "Logout input"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/auth/logout [post]
+func (h *Handler) logout(c *gin.Context) {
+	claims, ok := middleware.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "user is not authenticated",
+		})
+		return
+	}
+
+	var input LogoutInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_request_body",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := h.service.Logout(c.Request.Context(), claims, input); err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_logout",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// getMe godoc
+//
+// @Summary Get the current user's profile
+// @Tags users
+// @Produce json
+// @Success 200 {object} User
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/users/me [get]
+func (h *Handler) getMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.service.GetByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "user_not_found",
+				"message": "user not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_user",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// updateMe godoc
+//
+// @Summary Update the current user's name or email
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param input body UpdateProfileInput true "Profile fields to change"
+// @Success 200 {object} User
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/users/me [patch]
+func (h *Handler) updateMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input UpdateProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	user, err := h.service.UpdateProfile(c.Request.Context(), userID, input)
+	if err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if domain.IsConflictError(err) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "email_taken",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "user_not_found",
+				"message": "user not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_update_user",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// changePassword godoc
+//
+// @Summary Change the current user's password
+// @Description Revokes every existing session and returns a new token pair.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param input body ChangePasswordInput true "Current and new password"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/users/me/password [post]
+func (h *Handler) changePassword(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var input ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	resp, err := h.service.ChangePassword(c.Request.Context(), userID, input)
+	if err != nil {
+		if domain.IsValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "validation_error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, ErrWrongPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_current_password",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, domain.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "user_not_found",
+				"message": "user not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_change_password",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, resp)
 }
+
+func currentUserID(c *gin.Context) (int64, bool) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "user is not authenticated",
+		})
+		return 0, false
+	}
+	return userID, true
+}
+
+// mergeGuestCart is best effort: the user is already authenticated, so a
+// failed merge is logged rather than failing the request.
+func (h *Handler) mergeGuestCart(c *gin.Context, userID int64) {
+	token := c.GetHeader(cartTokenHeader)
+	if token == "" || h.carts == nil {
+		return
+	}
+
+	if err := h.carts.MergeGuestCart(c.Request.Context(), token, userID); err != nil {
+		logger.Warn("failed to merge guest cart", "user_id", userID, "error", err)
+	}
+}
@@ -0,0 +1,227 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-shop-app-backend/internal/domain"
+)
+
+// LockedError is returned by Login while an account or client address is
+// backing off or locked out after failed attempts.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+func AsLockedError(err error) (*LockedError, bool) {
+	var lockedErr *LockedError
+	if errors.As(err, &lockedErr) {
+		return lockedErr, true
+	}
+	return nil, false
+}
+
+// LockoutPolicy configures login throttling. After each failure the next
+// attempt is delayed by BackoffBase doubled per failure (capped at
+// BackoffMax); reaching the attempt limit within Window locks the key for
+// LockoutDuration.
+type LockoutPolicy struct {
+	MaxAttempts     int
+	IPMaxAttempts   int
+	Window          time.Duration
+	LockoutDuration time.Duration
+	BackoffBase     time.Duration
+	BackoffMax      time.Duration
+}
+
+// LoginAttempts is the failure state of one account or client address.
+type LoginAttempts struct {
+	Failures     int
+	FirstFailure time.Time
+	LastFailure  time.Time
+	LockedUntil  *time.Time
+}
+
+// LoginTracker stores failed login attempts per key.
+type LoginTracker interface {
+	Get(ctx context.Context, key string) (LoginAttempts, error)
+	// RecordFailure counts a failure at now, starting a new count when the
+	// previous one is older than window or its lockout has ended.
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (LoginAttempts, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+func (p LockoutPolicy) retryAfter(a LoginAttempts, now time.Time) time.Duration {
+	if a.LockedUntil != nil {
+		if now.Before(*a.LockedUntil) {
+			return a.LockedUntil.Sub(now)
+		}
+		return 0
+	}
+	if a.Failures == 0 || now.Sub(a.FirstFailure) > p.Window {
+		return 0
+	}
+
+	delay := p.BackoffBase
+	for i := 1; i < a.Failures && delay < p.BackoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.BackoffMax)
+
+	if next := a.LastFailure.Add(delay); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+func accountKey(email string) string {
+	return "account:" + email
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+const sweepInterval = time.Minute
+
+type memoryLoginTracker struct {
+	mu        sync.Mutex
+	attempts  map[string]LoginAttempts
+	lastSweep time.Time
+}
+
+// NewMemoryLoginTracker keeps attempts in process memory; use the Postgres
+// tracker when running more than one instance.
+func NewMemoryLoginTracker() LoginTracker {
+	return &memoryLoginTracker{attempts: make(map[string]LoginAttempts)}
+}
+
+func (t *memoryLoginTracker) Get(ctx context.Context, key string) (LoginAttempts, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.attempts[key], nil
+}
+
+func (t *memoryLoginTracker) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (LoginAttempts, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now, window)
+
+	a, ok := t.attempts[key]
+	if !ok || now.Sub(a.FirstFailure) > window || (a.LockedUntil != nil && !now.Before(*a.LockedUntil)) {
+		a = LoginAttempts{FirstFailure: now}
+	}
+	a.Failures++
+	a.LastFailure = now
+	t.attempts[key] = a
+
+	return a, nil
+}
+
+// sweep drops entries outside the window that are not locked, so the map
+// does not grow without bound. It runs at most once per sweepInterval
+// rather than on every failure.
+func (t *memoryLoginTracker) sweep(now time.Time, window time.Duration) {
+	if now.Sub(t.lastSweep) < sweepInterval {
+		return
+	}
+	t.lastSweep = now
+
+	for k, v := range t.attempts {
+		if now.Sub(v.LastFailure) > window && (v.LockedUntil == nil || !now.Before(*v.LockedUntil)) {
+			delete(t.attempts, k)
+		}
+	}
+}
+
+func (t *memoryLoginTracker) Lock(ctx context.Context, key string, until time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a := t.attempts[key]
+	a.LockedUntil = &until
+	t.attempts[key] = a
+	return nil
+}
+
+func (t *memoryLoginTracker) Reset(ctx context.Context, key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, key)
+	return nil
+}
+
+type loginKey struct {
+	key         string
+	maxAttempts int
+}
+
+func (s *service) loginKeys(email, ip string) []loginKey {
+	if s.opts.LoginTracker == nil {
+		return nil
+	}
+
+	keys := []loginKey{{key: accountKey(email), maxAttempts: s.opts.Lockout.MaxAttempts}}
+	if ip != "" {
+		keys = append(keys, loginKey{key: ipKey(ip), maxAttempts: s.opts.Lockout.IPMaxAttempts})
+	}
+	return keys
+}
+
+func (s *service) checkLoginLockout(ctx context.Context, keys []loginKey) error {
+	now := time.Now()
+
+	var wait time.Duration
+	for _, k := range keys {
+		a, err := s.opts.LoginTracker.Get(ctx, k.key)
+		if err != nil {
+			return err
+		}
+		wait = max(wait, s.opts.Lockout.retryAfter(a, now))
+	}
+
+	if wait > 0 {
+		return &LockedError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// loginFailed records the failure against every key and returns the error
+// Login should report.
+func (s *service) loginFailed(ctx context.Context, keys []loginKey) error {
+	now := time.Now()
+
+	for _, k := range keys {
+		a, err := s.opts.LoginTracker.RecordFailure(ctx, k.key, now, s.opts.Lockout.Window)
+		if err != nil {
+			return err
+		}
+		if k.maxAttempts > 0 && a.Failures >= k.maxAttempts {
+			if err := s.opts.LoginTracker.Lock(ctx, k.key, now.Add(s.opts.Lockout.LockoutDuration)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return domain.NewValidationError("invalid email or password")
+}
+
+// resetLoginFailures clears the account's failures. The address count is
+// kept so one valid login cannot reset guessing against other accounts.
+func (s *service) resetLoginFailures(ctx context.Context, email string) error {
+	if s.opts.LoginTracker == nil {
+		return nil
+	}
+	return s.opts.LoginTracker.Reset(ctx, accountKey(email))
+}
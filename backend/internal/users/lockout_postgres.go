@@ -0,0 +1,102 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	infraDB "go-shop-app-backend/internal/infra/db"
+)
+
+type postgresLoginTracker struct {
+	db *sql.DB
+}
+
+func NewPostgresLoginTracker(db *sql.DB) LoginTracker {
+	return &postgresLoginTracker{db: db}
+}
+
+func (t *postgresLoginTracker) conn(ctx context.Context) infraDB.DBTX {
+	return infraDB.Conn(ctx, t.db)
+}
+
+func (t *postgresLoginTracker) Get(ctx context.Context, key string) (LoginAttempts, error) {
+	const query = `
+        SELECT failures, first_failure_at, last_failure_at, locked_until
+        FROM login_attempts
+        WHERE key = $1
+    `
+
+	a, err := scanLoginAttempts(t.conn(ctx).QueryRowContext(ctx, query, key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return LoginAttempts{}, nil
+		}
+		return LoginAttempts{}, fmt.Errorf("get login attempts: %w", err)
+	}
+
+	return a, nil
+}
+
+func (t *postgresLoginTracker) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (LoginAttempts, error) {
+	// A new count starts once the window has passed or the lockout ended.
+	const restart = `(login_attempts.first_failure_at < $3 OR COALESCE(login_attempts.locked_until <= $2, FALSE))`
+	query := fmt.Sprintf(`
+        INSERT INTO login_attempts (key, failures, first_failure_at, last_failure_at)
+        VALUES ($1, 1, $2, $2)
+        ON CONFLICT (key) DO UPDATE
+        SET failures = CASE WHEN %[1]s THEN 1 ELSE login_attempts.failures + 1 END,
+            first_failure_at = CASE WHEN %[1]s THEN $2 ELSE login_attempts.first_failure_at END,
+            last_failure_at = $2,
+            locked_until = CASE WHEN %[1]s THEN NULL ELSE login_attempts.locked_until END
+        RETURNING failures, first_failure_at, last_failure_at, locked_until
+    `, restart)
+
+	a, err := scanLoginAttempts(t.conn(ctx).QueryRowContext(ctx, query, key, now, now.Add(-window)))
+	if err != nil {
+		return LoginAttempts{}, fmt.Errorf("record login failure: %w", err)
+	}
+
+	if _, err := t.conn(ctx).ExecContext(ctx, `
+        DELETE FROM login_attempts
+        WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until <= $2)
+    `, now.Add(-window), now); err != nil {
+		return LoginAttempts{}, fmt.Errorf("prune login attempts: %w", err)
+	}
+
+	return a, nil
+}
+
+func (t *postgresLoginTracker) Lock(ctx context.Context, key string, until time.Time) error {
+	const query = `UPDATE login_attempts SET locked_until = $2 WHERE key = $1`
+
+	if _, err := t.conn(ctx).ExecContext(ctx, query, key, until); err != nil {
+		return fmt.Errorf("lock login key: %w", err)
+	}
+
+	return nil
+}
+
+func (t *postgresLoginTracker) Reset(ctx context.Context, key string) error {
+	if _, err := t.conn(ctx).ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, key); err != nil {
+		return fmt.Errorf("reset login attempts: %w", err)
+	}
+
+	return nil
+}
+
+func scanLoginAttempts(row rowScanner) (LoginAttempts, error) {
+	var (
+		a           LoginAttempts
+		lockedUntil sql.NullTime
+	)
+	if err := row.Scan(&a.Failures, &a.FirstFailure, &a.LastFailure, &lockedUntil); err != nil {
+		return LoginAttempts{}, err
+	}
+	if lockedUntil.Valid {
+		a.LockedUntil = &lockedUntil.Time
+	}
+	return a, nil
+}
@@ -3,17 +3,20 @@ package users
 import "time"
 
 type User struct {
-	ID        int64     `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              int64      `json:"id"`
+	Email           string     `json:"email"`
+	Name            string     `json:"name"`
+	Role            string     `json:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	DisabledAt      *time.Time `json:"disabled_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type UserWithPassword struct {
 	User
 	PasswordHash string
+	TokenVersion int64
 }
 
 type RegisterInput struct {
@@ -25,9 +28,93 @@ type RegisterInput struct {
 type LoginInput struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	// IP is the client address, set by the handler for login throttling.
+	// It only comes from X-Forwarded-For when the router trusts the proxy.
+	IP string `json:"-"`
+}
+
+// UpdateProfileInput changes only the fields that are set.
+type UpdateProfileInput struct {
+	Name  *string `json:"name"`
+	Email *string `json:"email" binding:"omitempty,email"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// ListFilter narrows the admin user listing. Zero values mean "any".
+type ListFilter struct {
+	// Query matches a substring of the email or name.
+	Query    string
+	Role     string
+	Disabled *bool
+}
+
+type UserStats struct {
+	OrderCount int64 `json:"order_count"`
+	// LifetimeSpend sums paid, shipped, delivered and partially refunded
+	// orders, less what was refunded on them.
+	LifetimeSpend int64 `json:"lifetime_spend"`
+}
+
+// UserDetails is the admin view of a single user.
+type UserDetails struct {
+	User
+	UserStats
+}
+
+type ChangeRoleInput struct {
+	Role string `json:"role" binding:"required"`
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the access token lifetime in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+	User      User  `json:"user"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutInput optionally names the refresh token to revoke alongside the
+// access token. All signs the user out of every session.
+type LogoutInput struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+	All          bool   `json:"all,omitempty"`
+}
+
+// RefreshToken is a stored refresh token. Tokens issued by rotating one
+// another share a FamilyID, so reuse of a rotated token revokes them all.
+type RefreshToken struct {
+	ID           int64
+	UserID       int64
+	FamilyID     string
+	TokenHash    string
+	TokenVersion int64
+	ExpiresAt    time.Time
+	UsedAt       *time.Time
+	RevokedAt    *time.Time
+}
+
+// PasswordReset is a stored password reset token.
+type PasswordReset struct {
+	ID        int64
+	UserID    int64
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
 }
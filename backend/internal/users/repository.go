@@ -1,9 +1,33 @@
 package users
 
-import "context"
+import (
+	"context"
+
+	"go-shop-app-backend/internal/infra/http/pagination"
+)
 
 type Repository interface {
 	Create(ctx context.Context, email, name, passwordHash, role string) (*UserWithPassword, error)
 	GetByEmail(ctx context.Context, email string) (*UserWithPassword, error)
 	GetByID(ctx context.Context, id int64) (*UserWithPassword, error)
+	Update(ctx context.Context, id int64, email, name string) (*UserWithPassword, error)
+	UpdatePassword(ctx context.Context, id int64, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, id int64) error
+
+	List(ctx context.Context, filter ListFilter, page pagination.Params) ([]*User, error)
+	Count(ctx context.Context, filter ListFilter) (int64, error)
+	GetStats(ctx context.Context, id int64) (*UserStats, error)
+	SetRole(ctx context.Context, id int64, role string) error
+	SetDisabled(ctx context.Context, id int64, disabled bool) error
+	BumpTokenVersion(ctx context.Context, userID int64) error
+
+	CreateRefreshToken(ctx context.Context, token RefreshToken) error
+	GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id int64) error
+	RevokeRefreshFamily(ctx context.Context, familyID string) error
+
+	CreatePasswordReset(ctx context.Context, reset PasswordReset) error
+	GetPasswordResetForUpdate(ctx context.Context, tokenHash string) (*PasswordReset, error)
+	// MarkPasswordResetsUsed consumes every outstanding reset token of the user.
+	MarkPasswordResetsUsed(ctx context.Context, userID int64) error
 }
@@ -5,8 +5,13 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
 
 	"go-shop-app-backend/internal/domain"
+	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/infra/http/pagination"
 )
 
 type postgresRepository struct {
@@ -17,54 +22,40 @@ func NewPostgresRepository(db *sql.DB) Repository {
 	return &postgresRepository{db: db}
 }
 
+func (r *postgresRepository) conn(ctx context.Context) infraDB.DBTX {
+	return infraDB.Conn(ctx, r.db)
+}
+
 func (r *postgresRepository) Create(ctx context.Context, email, name, passwordHash, role string) (*UserWithPassword, error) {
 	const query = `
         INSERT INTO users (email, name, password_hash, role)
         VALUES ($1, $2, $3, $4)
-        RETURNING id, email, name, password_hash, role, created_at, updated_at
+        RETURNING id, email, name, password_hash, role, token_version, email_verified_at, disabled_at, created_at, updated_at
     `
 
-	var u UserWithPassword
-	err := r.db.QueryRowContext(
+	u, err := scanUser(r.conn(ctx).QueryRowContext(
 		ctx,
 		query,
 		email,
 		name,
 		passwordHash,
 		role,
-	).Scan(
-		&u.ID,
-		&u.Email,
-		&u.Name,
-		&u.PasswordHash,
-		&u.Role,
-		&u.CreatedAt,
-		&u.UpdatedAt,
-	)
+	))
 	if err != nil {
 		return nil, fmt.Errorf("insert user: %w", err)
 	}
 
-	return &u, nil
+	return u, nil
 }
 
 func (r *postgresRepository) GetByEmail(ctx context.Context, email string) (*UserWithPassword, error) {
 	const query = `
-        SELECT id, email, name, password_hash, role, created_at, updated_at
+        SELECT id, email, name, password_hash, role, token_version, email_verified_at, disabled_at, created_at, updated_at
         FROM users
         WHERE email = $1
     `
 
-	var u UserWithPassword
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
-		&u.ID,
-		&u.Email,
-		&u.Name,
-		&u.PasswordHash,
-		&u.Role,
-		&u.CreatedAt,
-		&u.UpdatedAt,
-	)
+	u, err := scanUser(r.conn(ctx).QueryRowContext(ctx, query, email))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, domain.ErrNotFound
@@ -72,31 +63,426 @@ func (r *postgresRepository) GetByEmail(ctx context.Context, email string) (*Use
 		return nil, fmt.Errorf("get user by email: %w", err)
 	}
 
-	return &u, nil
+	return u, nil
 }
 
 func (r *postgresRepository) GetByID(ctx context.Context, id int64) (*UserWithPassword, error) {
 	const query = `
-        SELECT id, email, name, password_hash, role, created_at, updated_at
+        SELECT id, email, name, password_hash, role, token_version, email_verified_at, disabled_at, created_at, updated_at
         FROM users
         WHERE id = $1
     `
 
-	var u UserWithPassword
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	u, err := scanUser(r.conn(ctx).QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get user by id: %w", err)
+	}
+
+	return u, nil
+}
+
+func (r *postgresRepository) Update(ctx context.Context, id int64, email, name string) (*UserWithPassword, error) {
+	const query = `
+        UPDATE users
+        SET email = $1,
+            name = $2,
+            email_verified_at = CASE WHEN email = $1 THEN email_verified_at END,
+            updated_at = NOW()
+        WHERE id = $3
+        RETURNING id, email, name, password_hash, role, token_version, email_verified_at, disabled_at, created_at, updated_at
+    `
+
+	u, err := scanUser(r.conn(ctx).QueryRowContext(ctx, query, email, name, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, domain.NewConflictError("email is already in use")
+		}
+		return nil, fmt.Errorf("update user: %w", err)
+	}
+
+	return u, nil
+}
+
+func listConditions(filter ListFilter) ([]string, []any) {
+	var (
+		conditions []string
+		args       []any
+	)
+
+	addCondition := func(expr string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if filter.Query != "" {
+		addCondition(`(email ILIKE $%[1]d ESCAPE '\' OR name ILIKE $%[1]d ESCAPE '\')`, "%"+likeEscaper.Replace(filter.Query)+"%")
+	}
+	if filter.Role != "" {
+		addCondition("role = $%d", filter.Role)
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			conditions = append(conditions, "disabled_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "disabled_at IS NULL")
+		}
+	}
+
+	return conditions, args
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+func (r *postgresRepository) List(ctx context.Context, filter ListFilter, page pagination.Params) ([]*User, error) {
+	conditions, args := listConditions(filter)
+
+	if page.Cursor != nil {
+		args = append(args, page.Cursor.CreatedAt, page.Cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `
+        SELECT id, email, name, password_hash, role, token_version, email_verified_at, disabled_at, created_at, updated_at
+        FROM users
+    ` + whereClause(conditions)
+
+	args = append(args, page.Limit, page.Offset())
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		users = append(users, &u.User)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+
+	return users, nil
+}
+
+func (r *postgresRepository) Count(ctx context.Context, filter ListFilter) (int64, error) {
+	conditions, args := listConditions(filter)
+
+	var total int64
+	if err := r.conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM users"+whereClause(conditions), args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("count users: %w", err)
+	}
+
+	return total, nil
+}
+
+// GetStats counts all of the user's orders; lifetime spend only includes
+// orders that were paid for, net of partial refunds.
+func (r *postgresRepository) GetStats(ctx context.Context, id int64) (*UserStats, error) {
+	const query = `
+        SELECT COUNT(*),
+               COALESCE(SUM(total_price - refunded_amount)
+                   FILTER (WHERE status IN ('paid', 'shipped', 'delivered', 'partially_refunded')), 0)
+        FROM orders
+        WHERE user_id = $1
+    `
+
+	var stats UserStats
+	if err := r.conn(ctx).QueryRowContext(ctx, query, id).Scan(&stats.OrderCount, &stats.LifetimeSpend); err != nil {
+		return nil, fmt.Errorf("get user stats: %w", err)
+	}
+
+	return &stats, nil
+}
+
+func (r *postgresRepository) SetRole(ctx context.Context, id int64, role string) error {
+	const query = `UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, role, id)
+	if err != nil {
+		return fmt.Errorf("set user role: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("set user role rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) SetDisabled(ctx context.Context, id int64, disabled bool) error {
+	const query = `
+        UPDATE users
+        SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, NOW()) END,
+            updated_at = NOW()
+        WHERE id = $2
+    `
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, disabled, id)
+	if err != nil {
+		return fmt.Errorf("set user disabled: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("set user disabled rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) MarkEmailVerified(ctx context.Context, id int64) error {
+	const query = `
+        UPDATE users
+        SET email_verified_at = NOW()
+        WHERE id = $1 AND email_verified_at IS NULL
+    `
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("mark email verified: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	const query = `UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, passwordHash, id)
+	if err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update password rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) BumpTokenVersion(ctx context.Context, userID int64) error {
+	const query = `UPDATE users SET token_version = token_version + 1 WHERE id = $1`
+
+	res, err := r.conn(ctx).ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("bump token version: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("bump token version rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	const query = `
+        INSERT INTO refresh_tokens (user_id, family_id, token_hash, token_version, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+    `
+
+	_, err := r.conn(ctx).ExecContext(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.TokenVersion, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("insert refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	const query = `
+        SELECT id, user_id, family_id, token_hash, token_version, expires_at, used_at, revoked_at
+        FROM refresh_tokens
+        WHERE token_hash = $1
+        FOR UPDATE
+    `
+
+	var (
+		t         RefreshToken
+		usedAt    sql.NullTime
+		revokedAt sql.NullTime
+	)
+	err := r.conn(ctx).QueryRowContext(ctx, query, tokenHash).Scan(
+		&t.ID,
+		&t.UserID,
+		&t.FamilyID,
+		&t.TokenHash,
+		&t.TokenVersion,
+		&t.ExpiresAt,
+		&usedAt,
+		&revokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get refresh token: %w", err)
+	}
+
+	if usedAt.Valid {
+		t.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+
+	return &t, nil
+}
+
+func (r *postgresRepository) MarkRefreshTokenUsed(ctx context.Context, id int64) error {
+	const query = `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("mark refresh token used: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	const query = `
+        UPDATE refresh_tokens
+        SET revoked_at = NOW()
+        WHERE family_id = $1 AND revoked_at IS NULL
+    `
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, familyID); err != nil {
+		return fmt.Errorf("revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) CreatePasswordReset(ctx context.Context, reset PasswordReset) error {
+	const query = `
+        INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+        VALUES ($1, $2, $3)
+    `
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, reset.UserID, reset.TokenHash, reset.ExpiresAt); err != nil {
+		return fmt.Errorf("insert password reset token: %w", err)
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) GetPasswordResetForUpdate(ctx context.Context, tokenHash string) (*PasswordReset, error) {
+	const query = `
+        SELECT id, user_id, token_hash, expires_at, used_at
+        FROM password_reset_tokens
+        WHERE token_hash = $1
+        FOR UPDATE
+    `
+
+	var (
+		p      PasswordReset
+		usedAt sql.NullTime
+	)
+	err := r.conn(ctx).QueryRowContext(ctx, query, tokenHash).Scan(
+		&p.ID,
+		&p.UserID,
+		&p.TokenHash,
+		&p.ExpiresAt,
+		&usedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get password reset token: %w", err)
+	}
+
+	if usedAt.Valid {
+		p.UsedAt = &usedAt.Time
+	}
+
+	return &p, nil
+}
+
+func (r *postgresRepository) MarkPasswordResetsUsed(ctx context.Context, userID int64) error {
+	const query = `
+        UPDATE password_reset_tokens
+        SET used_at = NOW()
+        WHERE user_id = $1 AND used_at IS NULL
+    `
+
+	if _, err := r.conn(ctx).ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("mark password reset tokens used: %w", err)
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (*UserWithPassword, error) {
+	var (
+		u          UserWithPassword
+		verifiedAt sql.NullTime
+		disabledAt sql.NullTime
+	)
+	err := row.Scan(
 		&u.ID,
 		&u.Email,
 		&u.Name,
 		&u.PasswordHash,
 		&u.Role,
+		&u.TokenVersion,
+		&verifiedAt,
+		&disabledAt,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, domain.ErrNotFound
-		}
-		return nil, fmt.Errorf("get user by id: %w", err)
+		return nil, err
+	}
+
+	if verifiedAt.Valid {
+		u.EmailVerifiedAt = &verifiedAt.Time
+	}
+	if disabledAt.Valid {
+		u.DisabledAt = &disabledAt.Time
 	}
 
 	return &u, nil
@@ -2,29 +2,114 @@ package users
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"go-shop-app-backend/internal/domain"
 	"go-shop-app-backend/internal/infra/auth"
+	infraDB "go-shop-app-backend/internal/infra/db"
+	"go-shop-app-backend/internal/infra/http/pagination"
+	"go-shop-app-backend/internal/infra/mail"
+	"go-shop-app-backend/internal/infra/outbox"
+	"go-shop-app-backend/pkg/logger"
 	"go-shop-app-backend/pkg/utils"
+	"go-shop-app-backend/pkg/workerpool"
+)
+
+const (
+	defaultPasswordResetTTL     = time.Hour
+	defaultEmailVerificationTTL = 72 * time.Hour
+
+	verifyEmailPurpose = "verify_email"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused means an already rotated token was presented;
+	// its whole family has been revoked.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	ErrWrongPassword      = errors.New("current password is incorrect")
+	ErrInvalidResetToken  = errors.New("invalid or expired reset token")
+	ErrAccountDisabled    = errors.New("account is disabled")
+	// ErrInvalidVerificationToken covers malformed, expired and stale links,
+	// e.g. ones sent to an email the user has since changed.
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
 )
 
 type Service interface {
 	Register(ctx context.Context, input RegisterInput) (*AuthResponse, error)
 	Login(ctx context.Context, input LoginInput) (*AuthResponse, error)
+	Refresh(ctx context.Context, refreshToken string) (*AuthResponse, error)
+	Logout(ctx context.Context, claims *auth.Claims, input LogoutInput) error
+	RevokeAllSessions(ctx context.Context, userID int64) error
 	GetByID(ctx context.Context, id int64) (*User, error)
+	UpdateProfile(ctx context.Context, id int64, input UpdateProfileInput) (*User, error)
+	ChangePassword(ctx context.Context, id int64, input ChangePasswordInput) (*AuthResponse, error)
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, input ResetPasswordInput) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, userID int64) error
+	EnsureEmailVerified(ctx context.Context, userID int64) error
+
+	List(ctx context.Context, filter ListFilter, page pagination.Params) (*pagination.Page[*User], error)
+	GetDetails(ctx context.Context, id int64) (*UserDetails, error)
+	ChangeRole(ctx context.Context, actorID, id int64, role string) (*User, error)
+	SetDisabled(ctx context.Context, actorID, id int64, disabled bool) (*User, error)
+}
+
+// Options configures the email-based account flows. Mail is sent through
+// Pool when it is set, otherwise inline.
+type Options struct {
+	Mailer mail.Mailer
+	Pool   *workerpool.Pool
+
+	PasswordResetTTL time.Duration
+	// PasswordResetURL is the frontend page that receives ?token=.
+	PasswordResetURL string
+
+	// Signer signs email verification links; without it no verification
+	// mail is sent.
+	Signer               *auth.LinkSigner
+	EmailVerificationTTL time.Duration
+	// EmailVerificationURL is the page that receives ?token=, normally
+	// GET /api/v1/auth/verify itself.
+	EmailVerificationURL string
+
+	// LoginTracker enables brute-force protection on Login; nil disables it.
+	LoginTracker LoginTracker
+	Lockout      LockoutPolicy
+
+	// Events records domain events in the transaction that causes them;
+	// nil drops them.
+	Events outbox.Writer
 }
 
 type service struct {
 	repo       Repository
 	jwtManager *auth.Manager
+	tx         infraDB.Transactor
+	opts       Options
 }
 
-func NewService(repo Repository, jwtManager *auth.Manager) Service {
+func NewService(repo Repository, jwtManager *auth.Manager, tx infraDB.Transactor, opts Options) Service {
+	if opts.PasswordResetTTL <= 0 {
+		opts.PasswordResetTTL = defaultPasswordResetTTL
+	}
+	if opts.EmailVerificationTTL <= 0 {
+		opts.EmailVerificationTTL = defaultEmailVerificationTTL
+	}
+
 	return &service{
 		repo:       repo,
 		jwtManager: jwtManager,
+		tx:         tx,
+		opts:       opts,
 	}
 }
 
@@ -51,27 +136,26 @@ func (s *service) Register(ctx context.Context, input RegisterInput) (*AuthRespo
 		return nil, fmt.Errorf("hash password: %w", err)
 	}
 
-	u, err := s.repo.Create(ctx, email, name, hash, string(domain.UserRoleUser))
+	var u *UserWithPassword
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		created, err := s.repo.Create(ctx, email, name, hash, string(domain.UserRoleUser))
+		if err != nil {
+			return fmt.Errorf("create user: %w", err)
+		}
+		u = created
+
+		return s.emitRegistered(ctx, u)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("create user: %w", err)
+		return nil, err
 	}
 
-	token, err := s.jwtManager.GenerateToken(u.ID, u.Role)
+	resp, err := s.issueTokens(ctx, u, "")
 	if err != nil {
-		return nil, fmt.Errorf("generate token: %w", err)
+		return nil, err
 	}
 
-	resp := &AuthResponse{
-		Token: token,
-		User: User{
-			ID:        u.ID,
-			Email:     u.Email,
-			Name:      u.Name,
-			Role:      u.Role,
-			CreatedAt: u.CreatedAt,
-			UpdatedAt: u.UpdatedAt,
-		},
-	}
+	s.sendVerification(u)
 
 	return resp, nil
 }
@@ -86,54 +170,747 @@ func (s *service) Login(ctx context.Context, input LoginInput) (*AuthResponse, e
 		return nil, domain.NewValidationError("password is required")
 	}
 
+	keys := s.loginKeys(email, input.IP)
+	if err := s.checkLoginLockout(ctx, keys); err != nil {
+		return nil, err
+	}
+
 	u, err := s.repo.GetByEmail(ctx, email)
 	if err != nil {
 		if err == domain.ErrNotFound {
-			return nil, domain.NewValidationError("invalid email or password")
+			return nil, s.loginFailed(ctx, keys)
 		}
 		return nil, fmt.Errorf("get user by email: %w", err)
 	}
 
 	if err := utils.CheckPassword(u.PasswordHash, input.Password); err != nil {
-		return nil, domain.NewValidationError("invalid email or password")
+		return nil, s.loginFailed(ctx, keys)
+	}
+
+	if err := s.resetLoginFailures(ctx, email); err != nil {
+		return nil, err
+	}
+
+	// Checked after the password so the response does not reveal that a
+	// disabled account exists.
+	if u.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+
+	return s.issueTokens(ctx, u, "")
+}
+
+func (s *service) GetByID(ctx context.Context, id int64) (*User, error) {
+	if id <= 0 {
+		return nil, domain.NewValidationError("invalid id")
 	}
 
-	token, err := s.jwtManager.GenerateToken(u.ID, u.Role)
+	u, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("generate token: %w", err)
+		return nil, err
 	}
 
-	resp := &AuthResponse{
-		Token: token,
-		User: User{
-			ID:        u.ID,
-			Email:     u.Email,
-			Name:      u.Name,
-			Role:      u.Role,
-			CreatedAt: u.CreatedAt,
-			UpdatedAt: u.UpdatedAt,
-		},
+	user := u.User
+	return &user, nil
+}
+
+func (s *service) UpdateProfile(ctx context.Context, id int64, input UpdateProfileInput) (*User, error) {
+	if id <= 0 {
+		return nil, domain.NewValidationError("invalid id")
+	}
+
+	var name, email string
+	if input.Name != nil {
+		name = strings.TrimSpace(*input.Name)
+		if name == "" {
+			return nil, domain.NewValidationError("name cannot be empty")
+		}
+	}
+	if input.Email != nil {
+		email = strings.TrimSpace(strings.ToLower(*input.Email))
+		if email == "" {
+			return nil, domain.NewValidationError("email cannot be empty")
+		}
+	}
+
+	var (
+		user         User
+		emailChanged bool
+		updatedUser  *UserWithPassword
+	)
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		current, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return domain.ErrNotFound
+			}
+			return fmt.Errorf("get user by id: %w", err)
+		}
+
+		if input.Name == nil {
+			name = current.Name
+		}
+		if input.Email == nil {
+			email = current.Email
+		}
+
+		if email != current.Email {
+			existing, err := s.repo.GetByEmail(ctx, email)
+			if err == nil && existing.ID != id {
+				return domain.NewConflictError("email is already in use")
+			}
+			if err != nil && !errors.Is(err, domain.ErrNotFound) {
+				return fmt.Errorf("get user by email: %w", err)
+			}
+		}
+
+		updated, err := s.repo.Update(ctx, id, email, name)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) || domain.IsConflictError(err) {
+				return err
+			}
+			return fmt.Errorf("update user: %w", err)
+		}
+
+		user = updated.User
+		updatedUser = updated
+		emailChanged = updated.Email != current.Email
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if emailChanged {
+		s.sendVerification(updatedUser)
+	}
+
+	return &user, nil
+}
+
+// ChangePassword replaces the password and signs the user out everywhere.
+// The caller gets a fresh token pair so only its own session survives.
+func (s *service) ChangePassword(ctx context.Context, id int64, input ChangePasswordInput) (*AuthResponse, error) {
+	if id <= 0 {
+		return nil, domain.NewValidationError("invalid id")
+	}
+	if input.CurrentPassword == "" {
+		return nil, domain.NewValidationError("current_password is required")
+	}
+	if len(input.NewPassword) < 6 {
+		return nil, domain.NewValidationError("new_password must be at least 6 characters")
+	}
+
+	hash, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		return nil, fmt.Errorf("hash password: %w", err)
+	}
+
+	var resp *AuthResponse
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		u, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return domain.ErrNotFound
+			}
+			return fmt.Errorf("get user by id: %w", err)
+		}
+
+		if err := utils.CheckPassword(u.PasswordHash, input.CurrentPassword); err != nil {
+			return ErrWrongPassword
+		}
+
+		if err := s.repo.UpdatePassword(ctx, id, hash); err != nil {
+			return fmt.Errorf("update password: %w", err)
+		}
+
+		if err := s.repo.BumpTokenVersion(ctx, id); err != nil {
+			return fmt.Errorf("bump token version: %w", err)
+		}
+
+		u, err = s.repo.GetByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("get user by id: %w", err)
+		}
+
+		resp, err = s.issueTokens(ctx, u, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return resp, nil
 }
 
-func (s *service) GetByID(ctx context.Context, id int64) (*User, error) {
+// Refresh rotates a refresh token: the presented token is marked used and a
+// new access/refresh pair from the same family is issued.
+func (s *service) Refresh(ctx context.Context, refreshToken string) (*AuthResponse, error) {
+	if refreshToken == "" {
+		return nil, domain.NewValidationError("refresh_token is required")
+	}
+
+	var (
+		resp   *AuthResponse
+		reused bool
+	)
+
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		stored, err := s.repo.GetRefreshTokenForUpdate(ctx, auth.HashToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return fmt.Errorf("get refresh token: %w", err)
+		}
+
+		if stored.RevokedAt != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		// A rotated token showing up again means it leaked; revoke the family
+		// and commit that before reporting the failure.
+		if stored.UsedAt != nil {
+			if err := s.repo.RevokeRefreshFamily(ctx, stored.FamilyID); err != nil {
+				return fmt.Errorf("revoke refresh token family: %w", err)
+			}
+			reused = true
+			return nil
+		}
+
+		if !time.Now().Before(stored.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		u, err := s.repo.GetByID(ctx, stored.UserID)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return fmt.Errorf("get user by id: %w", err)
+		}
+
+		if u.TokenVersion != stored.TokenVersion || u.DisabledAt != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		if err := s.repo.MarkRefreshTokenUsed(ctx, stored.ID); err != nil {
+			return fmt.Errorf("mark refresh token used: %w", err)
+		}
+
+		resp, err = s.issueTokens(ctx, u, stored.FamilyID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+
+	return resp, nil
+}
+
+// Logout revokes the current access token and, when given, the refresh
+// token's family. With input.All every session of the user is revoked.
+func (s *service) Logout(ctx context.Context, claims *auth.Claims, input LogoutInput) error {
+	if claims == nil || claims.UserID <= 0 {
+		return domain.NewValidationError("user_id is required")
+	}
+
+	if err := s.jwtManager.Revoke(ctx, claims); err != nil {
+		return fmt.Errorf("revoke access token: %w", err)
+	}
+
+	if input.RefreshToken != "" {
+		err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+			stored, err := s.repo.GetRefreshTokenForUpdate(ctx, auth.HashToken(input.RefreshToken))
+			if err != nil {
+				if errors.Is(err, domain.ErrNotFound) {
+					return nil
+				}
+				return fmt.Errorf("get refresh token: %w", err)
+			}
+
+			if stored.UserID != claims.UserID {
+				return nil
+			}
+
+			return s.repo.RevokeRefreshFamily(ctx, stored.FamilyID)
+		})
+		if err != nil {
+			return fmt.Errorf("revoke refresh token: %w", err)
+		}
+	}
+
+	if input.All {
+		return s.RevokeAllSessions(ctx, claims.UserID)
+	}
+
+	return nil
+}
+
+// RevokeAllSessions bumps the user's token version, which invalidates every
+// access and refresh token issued so far.
+func (s *service) RevokeAllSessions(ctx context.Context, userID int64) error {
+	if userID <= 0 {
+		return domain.NewValidationError("invalid id")
+	}
+
+	if err := s.repo.BumpTokenVersion(ctx, userID); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.ErrNotFound
+		}
+		return fmt.Errorf("bump token version: %w", err)
+	}
+
+	return nil
+}
+
+// ForgotPassword emails a reset link if the account exists. The lookup and
+// the mail happen in the background for every well-formed email, so neither
+// the result nor the response time tells callers which accounts exist.
+func (s *service) ForgotPassword(ctx context.Context, email string) error {
+	email = strings.TrimSpace(strings.ToLower(email))
+	if email == "" {
+		return domain.NewValidationError("email is required")
+	}
+
+	task := func(ctx context.Context) {
+		if err := s.sendPasswordReset(ctx, email); err != nil {
+			logger.Error("failed to send password reset", "error", err)
+		}
+	}
+
+	if s.opts.Pool == nil {
+		task(context.WithoutCancel(ctx))
+		return nil
+	}
+
+	if err := s.opts.Pool.Submit(task); err != nil {
+		logger.Error("failed to queue password reset", "error", err)
+	}
+
+	return nil
+}
+
+// sendPasswordReset stores a reset token and mails the link, unless the
+// account is unknown or disabled. It runs on the pool, so the mail is sent
+// inline rather than queued again.
+func (s *service) sendPasswordReset(ctx context.Context, email string) error {
+	u, err := s.repo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("get user by email: %w", err)
+	}
+
+	if u.DisabledAt != nil {
+		return nil
+	}
+
+	raw, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.CreatePasswordReset(ctx, PasswordReset{
+		UserID:    u.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.opts.PasswordResetTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("store password reset token: %w", err)
+	}
+
+	s.deliverMail(ctx, mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s\n\nIf you did not ask for this, ignore this email.\n",
+			u.Name, s.opts.PasswordResetTTL, linkWithToken(s.opts.PasswordResetURL, raw),
+		),
+	})
+
+	return nil
+}
+
+// ResetPassword consumes a reset token, sets the new password and signs the
+// user out of every session.
+func (s *service) ResetPassword(ctx context.Context, input ResetPasswordInput) error {
+	if input.Token == "" {
+		return domain.NewValidationError("token is required")
+	}
+	if len(input.NewPassword) < 6 {
+		return domain.NewValidationError("new_password must be at least 6 characters")
+	}
+
+	hash, err := utils.HashPassword(input.NewPassword)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		reset, err := s.repo.GetPasswordResetForUpdate(ctx, auth.HashToken(input.Token))
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return ErrInvalidResetToken
+			}
+			return fmt.Errorf("get password reset token: %w", err)
+		}
+
+		if reset.UsedAt != nil || !time.Now().Before(reset.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+
+		if err := s.repo.UpdatePassword(ctx, reset.UserID, hash); err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return ErrInvalidResetToken
+			}
+			return fmt.Errorf("update password: %w", err)
+		}
+
+		if err := s.repo.MarkPasswordResetsUsed(ctx, reset.UserID); err != nil {
+			return fmt.Errorf("mark password reset tokens used: %w", err)
+		}
+
+		if err := s.repo.BumpTokenVersion(ctx, reset.UserID); err != nil {
+			return fmt.Errorf("bump token version: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// VerifyEmail marks the email in a verification link as verified. Links
+// stay valid until they expire, so following one twice is not an error.
+func (s *service) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return domain.NewValidationError("token is required")
+	}
+	if s.opts.Signer == nil {
+		return ErrInvalidVerificationToken
+	}
+
+	subject, err := s.opts.Signer.Verify(verifyEmailPurpose, token)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	rawID, email, ok := strings.Cut(subject, ":")
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if !ok || err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	u, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		return fmt.Errorf("get user by id: %w", err)
+	}
+
+	if u.Email != email {
+		return ErrInvalidVerificationToken
+	}
+	if u.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	if err := s.repo.MarkEmailVerified(ctx, id); err != nil {
+		return fmt.Errorf("mark email verified: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) ResendVerification(ctx context.Context, userID int64) error {
+	if userID <= 0 {
+		return domain.NewValidationError("invalid id")
+	}
+
+	u, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.ErrNotFound
+		}
+		return fmt.Errorf("get user by id: %w", err)
+	}
+
+	if u.EmailVerifiedAt != nil {
+		return domain.NewValidationError("email is already verified")
+	}
+
+	s.sendVerification(u)
+	return nil
+}
+
+// EnsureEmailVerified returns domain.ErrEmailNotVerified for users who have
+// not confirmed their email yet.
+func (s *service) EnsureEmailVerified(ctx context.Context, userID int64) error {
+	u, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return domain.ErrNotFound
+		}
+		return fmt.Errorf("get user by id: %w", err)
+	}
+
+	if u.EmailVerifiedAt == nil {
+		return domain.ErrEmailNotVerified
+	}
+
+	return nil
+}
+
+func (s *service) List(ctx context.Context, filter ListFilter, page pagination.Params) (*pagination.Page[*User], error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	if len(filter.Query) > 200 {
+		return nil, domain.NewValidationError("q must be at most 200 characters")
+	}
+	if filter.Role != "" && !validRole(filter.Role) {
+		return nil, domain.NewValidationError("role must be one of user, admin")
+	}
+
+	page = page.WithDefaults()
+	if err := page.Validate(); err != nil {
+		return nil, domain.NewValidationError(err.Error())
+	}
+
+	users, err := s.repo.List(ctx, filter, page)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("count users: %w", err)
+	}
+
+	return pagination.NewPage(users, total, page, userCursor), nil
+}
+
+func userCursor(u *User) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: u.CreatedAt, ID: u.ID}
+}
+
+func (s *service) GetDetails(ctx context.Context, id int64) (*UserDetails, error) {
 	if id <= 0 {
 		return nil, domain.NewValidationError("invalid id")
 	}
 
 	u, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get user by id: %w", err)
+	}
+
+	stats, err := s.repo.GetStats(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get user stats: %w", err)
+	}
+
+	return &UserDetails{User: u.User, UserStats: *stats}, nil
+}
+
+// ChangeRole updates the user's role and revokes their sessions, since the
+// role is carried in issued access tokens.
+func (s *service) ChangeRole(ctx context.Context, actorID, id int64, role string) (*User, error) {
+	if id <= 0 {
+		return nil, domain.NewValidationError("invalid id")
+	}
+	if !validRole(role) {
+		return nil, domain.NewValidationError("role must be one of user, admin")
+	}
+	if actorID == id {
+		return nil, domain.NewConflictError("admins cannot change their own role")
+	}
+
+	return s.updateAndRevoke(ctx, id, func(ctx context.Context, u *UserWithPassword) (bool, error) {
+		if u.Role == role {
+			return false, nil
+		}
+		return true, s.repo.SetRole(ctx, id, role)
+	})
+}
+
+// SetDisabled disables or re-enables an account. Disabling also revokes
+// every session of the user.
+func (s *service) SetDisabled(ctx context.Context, actorID, id int64, disabled bool) (*User, error) {
+	if id <= 0 {
+		return nil, domain.NewValidationError("invalid id")
+	}
+	if actorID == id && disabled {
+		return nil, domain.NewConflictError("admins cannot disable their own account")
+	}
+
+	return s.updateAndRevoke(ctx, id, func(ctx context.Context, u *UserWithPassword) (bool, error) {
+		if (u.DisabledAt != nil) == disabled {
+			return false, nil
+		}
+		return disabled, s.repo.SetDisabled(ctx, id, disabled)
+	})
+}
+
+// updateAndRevoke applies update inside a transaction and bumps the token
+// version when update reports that the user's sessions must end.
+func (s *service) updateAndRevoke(ctx context.Context, id int64, update func(ctx context.Context, u *UserWithPassword) (bool, error)) (*User, error) {
+	var user User
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		u, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return domain.ErrNotFound
+			}
+			return fmt.Errorf("get user by id: %w", err)
+		}
+
+		revoke, err := update(ctx, u)
+		if err != nil {
+			if errors.Is(err, domain.ErrNotFound) {
+				return domain.ErrNotFound
+			}
+			return fmt.Errorf("update user: %w", err)
+		}
+
+		if revoke {
+			if err := s.repo.BumpTokenVersion(ctx, id); err != nil {
+				return fmt.Errorf("bump token version: %w", err)
+			}
+		}
+
+		u, err = s.repo.GetByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("get user by id: %w", err)
+		}
+
+		user = u.User
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func validRole(role string) bool {
+	return role == string(domain.UserRoleUser) || role == string(domain.UserRoleAdmin)
+}
+
+func (s *service) sendVerification(u *UserWithPassword) {
+	if s.opts.Signer == nil {
+		return
+	}
+
+	token := s.opts.Signer.Sign(
+		verifyEmailPurpose,
+		strconv.FormatInt(u.ID, 10)+":"+u.Email,
+		time.Now().Add(s.opts.EmailVerificationTTL),
+	)
+
+	s.sendMail(mail.Message{
+		To:      u.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			u.Name, s.opts.EmailVerificationTTL, linkWithToken(s.opts.EmailVerificationURL, token),
+		),
+	})
+}
+
+// sendMail delivers in the background; failures are only logged because
+// the request that triggered the mail has already succeeded.
+func (s *service) sendMail(msg mail.Message) {
+	if s.opts.Mailer == nil {
+		return
+	}
+
+	send := func(ctx context.Context) {
+		s.deliverMail(ctx, msg)
+	}
+
+	if s.opts.Pool == nil {
+		send(context.Background())
+		return
+	}
+
+	if err := s.opts.Pool.Submit(send); err != nil {
+		logger.Error("failed to queue mail", "to", msg.To, "subject", msg.Subject, "error", err)
+	}
+}
+
+// deliverMail sends msg now, logging any failure.
+func (s *service) deliverMail(ctx context.Context, msg mail.Message) {
+	if s.opts.Mailer == nil {
+		return
+	}
+
+	if err := s.opts.Mailer.Send(ctx, msg); err != nil {
+		logger.Error("failed to send mail", "to", msg.To, "subject", msg.Subject, "error", err)
+	}
+}
+
+func linkWithToken(base, token string) string {
+	u, err := url.Parse(base)
+	if err != nil || base == "" {
+		return token
+	}
+
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// issueTokens creates an access token and a refresh token. An empty familyID
+// starts a new family, i.e. a new session.
+func (s *service) issueTokens(ctx context.Context, u *UserWithPassword, familyID string) (*AuthResponse, error) {
+	token, err := s.jwtManager.GenerateToken(u.ID, u.Role, u.TokenVersion)
+	if err != nil {
+		return nil, fmt.Errorf("generate token: %w", err)
+	}
+
+	refresh, err := s.jwtManager.NewRefreshToken()
 	if err != nil {
 		return nil, err
 	}
 
-	return &User{
-		ID:        u.ID,
-		Email:     u.Email,
-		Name:      u.Name,
-		Role:      u.Role,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+	if familyID == "" {
+		familyID, err = newFamilyID()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.repo.CreateRefreshToken(ctx, RefreshToken{
+		UserID:       u.ID,
+		FamilyID:     familyID,
+		TokenHash:    refresh.Hash,
+		TokenVersion: u.TokenVersion,
+		ExpiresAt:    refresh.ExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("store refresh token: %w", err)
+	}
+
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refresh.Raw,
+		ExpiresIn:    int64(s.jwtManager.AccessTTL() / time.Second),
+		User:         u.User,
 	}, nil
 }
+
+func newFamilyID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token family: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -2,19 +2,47 @@ package users
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"go-shop-app-backend/internal/domain"
 	"go-shop-app-backend/internal/infra/auth"
+	"go-shop-app-backend/internal/infra/http/pagination"
+	"go-shop-app-backend/internal/infra/mail"
+	"go-shop-app-backend/internal/infra/outbox"
 	"go-shop-app-backend/pkg/utils"
+	"go-shop-app-backend/pkg/workerpool"
 )
 
 type mockUserRepo struct {
 	createFn     func(ctx context.Context, email, name, passwordHash, role string) (*UserWithPassword, error)
 	getByEmailFn func(ctx context.Context, email string) (*UserWithPassword, error)
 	getByIDFn    func(ctx context.Context, id int64) (*UserWithPassword, error)
+	updateFn     func(ctx context.Context, id int64, email, name string) (*UserWithPassword, error)
+
+	updatePasswordFn    func(ctx context.Context, id int64, passwordHash string) error
+	markEmailVerifiedFn func(ctx context.Context, id int64) error
+
+	listFn        func(ctx context.Context, filter ListFilter, page pagination.Params) ([]*User, error)
+	countFn       func(ctx context.Context, filter ListFilter) (int64, error)
+	getStatsFn    func(ctx context.Context, id int64) (*UserStats, error)
+	setRoleFn     func(ctx context.Context, id int64, role string) error
+	setDisabledFn func(ctx context.Context, id int64, disabled bool) error
+
+	bumpTokenVersionFn         func(ctx context.Context, userID int64) error
+	createRefreshTokenFn       func(ctx context.Context, token RefreshToken) error
+	getRefreshTokenForUpdateFn func(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	markRefreshTokenUsedFn     func(ctx context.Context, id int64) error
+	revokeRefreshFamilyFn      func(ctx context.Context, familyID string) error
+
+	createPasswordResetFn       func(ctx context.Context, reset PasswordReset) error
+	getPasswordResetForUpdateFn func(ctx context.Context, tokenHash string) (*PasswordReset, error)
+	markPasswordResetsUsedFn    func(ctx context.Context, userID int64) error
 }
 
 func (m *mockUserRepo) Create(ctx context.Context, email, name, passwordHash, role string) (*UserWithPassword, error) {
@@ -29,9 +57,124 @@ func (m *mockUserRepo) GetByID(ctx context.Context, id int64) (*UserWithPassword
 	return m.getByIDFn(ctx, id)
 }
 
+func (m *mockUserRepo) Update(ctx context.Context, id int64, email, name string) (*UserWithPassword, error) {
+	return m.updateFn(ctx, id, email, name)
+}
+
+func (m *mockUserRepo) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	return m.updatePasswordFn(ctx, id, passwordHash)
+}
+
+func (m *mockUserRepo) List(ctx context.Context, filter ListFilter, page pagination.Params) ([]*User, error) {
+	return m.listFn(ctx, filter, page)
+}
+
+func (m *mockUserRepo) Count(ctx context.Context, filter ListFilter) (int64, error) {
+	return m.countFn(ctx, filter)
+}
+
+func (m *mockUserRepo) GetStats(ctx context.Context, id int64) (*UserStats, error) {
+	return m.getStatsFn(ctx, id)
+}
+
+func (m *mockUserRepo) SetRole(ctx context.Context, id int64, role string) error {
+	return m.setRoleFn(ctx, id, role)
+}
+
+func (m *mockUserRepo) SetDisabled(ctx context.Context, id int64, disabled bool) error {
+	return m.setDisabledFn(ctx, id, disabled)
+}
+
+func (m *mockUserRepo) MarkEmailVerified(ctx context.Context, id int64) error {
+	return m.markEmailVerifiedFn(ctx, id)
+}
+
+func (m *mockUserRepo) BumpTokenVersion(ctx context.Context, userID int64) error {
+	return m.bumpTokenVersionFn(ctx, userID)
+}
+
+func (m *mockUserRepo) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	if m.createRefreshTokenFn == nil {
+		return nil
+	}
+	return m.createRefreshTokenFn(ctx, token)
+}
+
+func (m *mockUserRepo) GetRefreshTokenForUpdate(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	return m.getRefreshTokenForUpdateFn(ctx, tokenHash)
+}
+
+func (m *mockUserRepo) MarkRefreshTokenUsed(ctx context.Context, id int64) error {
+	return m.markRefreshTokenUsedFn(ctx, id)
+}
+
+func (m *mockUserRepo) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	return m.revokeRefreshFamilyFn(ctx, familyID)
+}
+
+func (m *mockUserRepo) CreatePasswordReset(ctx context.Context, reset PasswordReset) error {
+	return m.createPasswordResetFn(ctx, reset)
+}
+
+func (m *mockUserRepo) GetPasswordResetForUpdate(ctx context.Context, tokenHash string) (*PasswordReset, error) {
+	return m.getPasswordResetForUpdateFn(ctx, tokenHash)
+}
+
+func (m *mockUserRepo) MarkPasswordResetsUsed(ctx context.Context, userID int64) error {
+	return m.markPasswordResetsUsedFn(ctx, userID)
+}
+
+type fakeTx struct{}
+
+func (fakeTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// refreshTokenStore backs the refresh token methods of mockUserRepo.
+type refreshTokenStore struct {
+	tokens  map[string]*RefreshToken
+	revoked []string
+}
+
+func (s *refreshTokenStore) install(repo *mockUserRepo) {
+	s.tokens = make(map[string]*RefreshToken)
+	repo.createRefreshTokenFn = func(ctx context.Context, token RefreshToken) error {
+		token.ID = int64(len(s.tokens) + 1)
+		s.tokens[token.TokenHash] = &token
+		return nil
+	}
+	repo.getRefreshTokenForUpdateFn = func(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+		t, ok := s.tokens[tokenHash]
+		if !ok {
+			return nil, domain.ErrNotFound
+		}
+		cp := *t
+		return &cp, nil
+	}
+	repo.markRefreshTokenUsedFn = func(ctx context.Context, id int64) error {
+		now := time.Now()
+		for _, t := range s.tokens {
+			if t.ID == id {
+				t.UsedAt = &now
+			}
+		}
+		return nil
+	}
+	repo.revokeRefreshFamilyFn = func(ctx context.Context, familyID string) error {
+		now := time.Now()
+		s.revoked = append(s.revoked, familyID)
+		for _, t := range s.tokens {
+			if t.FamilyID == familyID && t.RevokedAt == nil {
+				t.RevokedAt = &now
+			}
+		}
+		return nil
+	}
+}
+
 func newTestJWTManager() *auth.Manager {
 	// короткий TTL для тестов
-	return auth.NewManager("test-secret", time.Minute)
+	return auth.NewManager(auth.NewHMACKeySet("test-secret"), time.Minute, time.Hour, nil)
 }
 
 func TestService_Register_Validation(t *testing.T) {
@@ -55,7 +198,7 @@ func TestService_Register_Validation(t *testing.T) {
 		},
 	}
 
-	svc := NewService(repo, newTestJWTManager())
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{})
 
 	tests := []struct {
 		name    string
@@ -121,6 +264,53 @@ func TestService_Register_Validation(t *testing.T) {
 	}
 }
 
+type recordingEvents struct {
+	messages []outbox.Message
+}
+
+func (r *recordingEvents) Add(ctx context.Context, msg outbox.Message) error {
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func TestService_Register_RecordsEvent(t *testing.T) {
+	repo := &mockUserRepo{
+		getByEmailFn: func(ctx context.Context, email string) (*UserWithPassword, error) {
+			return nil, domain.ErrNotFound
+		},
+		createFn: func(ctx context.Context, email, name, passwordHash, role string) (*UserWithPassword, error) {
+			return &UserWithPassword{User: User{ID: 3, Email: email, Name: name, Role: role}}, nil
+		},
+	}
+	events := &recordingEvents{}
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{Events: events})
+
+	if _, err := svc.Register(context.Background(), RegisterInput{Email: "a@example.com", Name: "A", Password: "123"}); err == nil {
+		t.Fatal("expected validation error")
+	}
+	if len(events.messages) != 0 {
+		t.Fatalf("failed registration recorded events: %+v", events.messages)
+	}
+
+	if _, err := svc.Register(context.Background(), RegisterInput{Email: "a@example.com", Name: "A", Password: "123456"}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if len(events.messages) != 1 {
+		t.Fatalf("expected one event, got %d", len(events.messages))
+	}
+	msg := events.messages[0]
+	if msg.Type != EventUserRegistered || msg.AggregateType != "user" || msg.AggregateID != 3 {
+		t.Fatalf("unexpected event: %+v", msg)
+	}
+	var payload UserRegisteredEvent
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload != (UserRegisteredEvent{UserID: 3, Email: "a@example.com", Name: "A"}) {
+		t.Fatalf("unexpected payload: %+v", payload)
+	}
+}
+
 func TestService_Login(t *testing.T) {
 	hashed, err := utils.HashPassword("password")
 	if err != nil {
@@ -152,7 +342,7 @@ func TestService_Login(t *testing.T) {
 		},
 	}
 
-	svc := NewService(repo, newTestJWTManager())
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{})
 
 	t.Run("invalid email", func(t *testing.T) {
 		_, err := svc.Login(context.Background(), LoginInput{
@@ -209,3 +399,825 @@ func TestService_Login(t *testing.T) {
 		}
 	})
 }
+
+func TestService_Refresh(t *testing.T) {
+	user := &UserWithPassword{
+		User: User{ID: 1, Email: "user@example.com", Role: string(domain.UserRoleUser)},
+	}
+	hashed, err := utils.HashPassword("password")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	user.PasswordHash = hashed
+
+	newService := func() (Service, *mockUserRepo, *refreshTokenStore) {
+		repo := &mockUserRepo{
+			getByEmailFn: func(ctx context.Context, email string) (*UserWithPassword, error) {
+				cp := *user
+				return &cp, nil
+			},
+			getByIDFn: func(ctx context.Context, id int64) (*UserWithPassword, error) {
+				cp := *user
+				return &cp, nil
+			},
+		}
+		store := &refreshTokenStore{}
+		store.install(repo)
+		return NewService(repo, newTestJWTManager(), fakeTx{}, Options{}), repo, store
+	}
+
+	login := func(t *testing.T, svc Service) *AuthResponse {
+		t.Helper()
+		resp, err := svc.Login(context.Background(), LoginInput{Email: user.Email, Password: "password"})
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		if resp.RefreshToken == "" || resp.ExpiresIn != 60 {
+			t.Fatalf("expected refresh token and expires_in=60, got %+v", resp)
+		}
+		return resp
+	}
+
+	t.Run("rotates within the family", func(t *testing.T) {
+		svc, _, store := newService()
+		first := login(t, svc)
+
+		second, err := svc.Refresh(context.Background(), first.RefreshToken)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if second.RefreshToken == first.RefreshToken || second.Token == "" {
+			t.Fatalf("expected a new token pair, got %+v", second)
+		}
+
+		a := store.tokens[auth.HashToken(first.RefreshToken)]
+		b := store.tokens[auth.HashToken(second.RefreshToken)]
+		if a.UsedAt == nil {
+			t.Fatalf("expected the presented token to be marked used")
+		}
+		if a.FamilyID != b.FamilyID {
+			t.Fatalf("expected rotated token to stay in the family")
+		}
+	})
+
+	t.Run("reuse revokes the family", func(t *testing.T) {
+		svc, _, store := newService()
+		first := login(t, svc)
+
+		second, err := svc.Refresh(context.Background(), first.RefreshToken)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if _, err := svc.Refresh(context.Background(), first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+		}
+		if len(store.revoked) != 1 {
+			t.Fatalf("expected the family to be revoked, got %v", store.revoked)
+		}
+
+		if _, err := svc.Refresh(context.Background(), second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("expected the newest token to be revoked too, got %v", err)
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		svc, _, _ := newService()
+		if _, err := svc.Refresh(context.Background(), "nope"); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("expected ErrInvalidRefreshToken, got %v", err)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		svc, _, store := newService()
+		first := login(t, svc)
+		store.tokens[auth.HashToken(first.RefreshToken)].ExpiresAt = time.Now().Add(-time.Second)
+
+		if _, err := svc.Refresh(context.Background(), first.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("expected ErrInvalidRefreshToken, got %v", err)
+		}
+	})
+
+	t.Run("token version bumped", func(t *testing.T) {
+		svc, repo, _ := newService()
+		first := login(t, svc)
+
+		repo.getByIDFn = func(ctx context.Context, id int64) (*UserWithPassword, error) {
+			cp := *user
+			cp.TokenVersion = 1
+			return &cp, nil
+		}
+
+		if _, err := svc.Refresh(context.Background(), first.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Fatalf("expected ErrInvalidRefreshToken, got %v", err)
+		}
+	})
+}
+
+func TestService_Logout(t *testing.T) {
+	repo := &mockUserRepo{
+		getByIDFn: func(ctx context.Context, id int64) (*UserWithPassword, error) {
+			return &UserWithPassword{User: User{ID: id}}, nil
+		},
+	}
+	store := &refreshTokenStore{}
+	store.install(repo)
+
+	var bumped []int64
+	repo.bumpTokenVersionFn = func(ctx context.Context, userID int64) error {
+		bumped = append(bumped, userID)
+		return nil
+	}
+
+	store.tokens[auth.HashToken("mine")] = &RefreshToken{ID: 1, UserID: 1, FamilyID: "fam-1"}
+	store.tokens[auth.HashToken("theirs")] = &RefreshToken{ID: 2, UserID: 2, FamilyID: "fam-2"}
+
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{})
+	claims := &auth.Claims{UserID: 1}
+
+	if err := svc.Logout(context.Background(), nil, LogoutInput{}); !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error without claims, got %v", err)
+	}
+
+	if err := svc.Logout(context.Background(), claims, LogoutInput{RefreshToken: "theirs"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.revoked) != 0 {
+		t.Fatalf("expected another user's refresh token to be left alone, got %v", store.revoked)
+	}
+
+	if err := svc.Logout(context.Background(), claims, LogoutInput{RefreshToken: "mine"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.revoked) != 1 || store.revoked[0] != "fam-1" {
+		t.Fatalf("expected fam-1 to be revoked, got %v", store.revoked)
+	}
+
+	if err := svc.Logout(context.Background(), claims, LogoutInput{All: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bumped) != 1 || bumped[0] != 1 {
+		t.Fatalf("expected token version bump for user 1, got %v", bumped)
+	}
+}
+
+func TestService_UpdateProfile(t *testing.T) {
+	users := map[string]*UserWithPassword{
+		"user@example.com":  {User: User{ID: 1, Email: "user@example.com", Name: "User"}},
+		"other@example.com": {User: User{ID: 2, Email: "other@example.com", Name: "Other"}},
+	}
+
+	repo := &mockUserRepo{
+		getByIDFn: func(ctx context.Context, id int64) (*UserWithPassword, error) {
+			for _, u := range users {
+				if u.ID == id {
+					cp := *u
+					return &cp, nil
+				}
+			}
+			return nil, domain.ErrNotFound
+		},
+		getByEmailFn: func(ctx context.Context, email string) (*UserWithPassword, error) {
+			if u, ok := users[email]; ok {
+				cp := *u
+				return &cp, nil
+			}
+			return nil, domain.ErrNotFound
+		},
+		updateFn: func(ctx context.Context, id int64, email, name string) (*UserWithPassword, error) {
+			return &UserWithPassword{User: User{ID: id, Email: email, Name: name}}, nil
+		},
+	}
+
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{})
+
+	name := "  New Name "
+	u, err := svc.UpdateProfile(context.Background(), 1, UpdateProfileInput{Name: &name})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.Name != "New Name" || u.Email != "user@example.com" {
+		t.Fatalf("expected only the name to change, got %+v", u)
+	}
+
+	email := "NEW@example.com"
+	u, err = svc.UpdateProfile(context.Background(), 1, UpdateProfileInput{Email: &email})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.Email != "new@example.com" || u.Name != "User" {
+		t.Fatalf("expected only the normalized email to change, got %+v", u)
+	}
+
+	taken := "other@example.com"
+	if _, err := svc.UpdateProfile(context.Background(), 1, UpdateProfileInput{Email: &taken}); !domain.IsConflictError(err) {
+		t.Fatalf("expected conflict for a taken email, got %v", err)
+	}
+
+	empty := " "
+	if _, err := svc.UpdateProfile(context.Background(), 1, UpdateProfileInput{Name: &empty}); !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for an empty name, got %v", err)
+	}
+
+	if _, err := svc.UpdateProfile(context.Background(), 42, UpdateProfileInput{Name: &name}); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestService_ChangePassword(t *testing.T) {
+	hashed, err := utils.HashPassword("password")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	user := &UserWithPassword{
+		User:         User{ID: 1, Email: "user@example.com", Role: string(domain.UserRoleUser)},
+		PasswordHash: hashed,
+	}
+
+	repo := &mockUserRepo{
+		getByIDFn: func(ctx context.Context, id int64) (*UserWithPassword, error) {
+			cp := *user
+			return &cp, nil
+		},
+		updatePasswordFn: func(ctx context.Context, id int64, passwordHash string) error {
+			user.PasswordHash = passwordHash
+			return nil
+		},
+		bumpTokenVersionFn: func(ctx context.Context, userID int64) error {
+			user.TokenVersion++
+			return nil
+		},
+	}
+
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{})
+
+	_, err = svc.ChangePassword(context.Background(), 1, ChangePasswordInput{CurrentPassword: "wrong", NewPassword: "new-password"})
+	if !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+	if user.TokenVersion != 0 {
+		t.Fatalf("expected sessions to be kept after a failed change")
+	}
+
+	if _, err := svc.ChangePassword(context.Background(), 1, ChangePasswordInput{CurrentPassword: "password", NewPassword: "123"}); !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for a short password, got %v", err)
+	}
+
+	resp, err := svc.ChangePassword(context.Background(), 1, ChangePasswordInput{CurrentPassword: "password", NewPassword: "new-password"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := utils.CheckPassword(user.PasswordHash, "new-password"); err != nil {
+		t.Fatalf("expected the new password to be stored")
+	}
+	if user.TokenVersion != 1 {
+		t.Fatalf("expected existing sessions to be revoked, token version = %d", user.TokenVersion)
+	}
+
+	claims, err := newTestJWTManager().ParseToken(resp.Token)
+	if err != nil {
+		t.Fatalf("parse new token: %v", err)
+	}
+	if claims.Version != 1 {
+		t.Fatalf("expected the new token to carry version 1, got %d", claims.Version)
+	}
+}
+
+type recordingMailer struct {
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestService_PasswordReset(t *testing.T) {
+	hashed, err := utils.HashPassword("password")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	user := &UserWithPassword{
+		User:         User{ID: 1, Email: "user@example.com", Name: "User"},
+		PasswordHash: hashed,
+	}
+
+	resets := map[string]*PasswordReset{}
+	repo := &mockUserRepo{
+		getByEmailFn: func(ctx context.Context, email string) (*UserWithPassword, error) {
+			if email != user.Email {
+				return nil, domain.ErrNotFound
+			}
+			cp := *user
+			return &cp, nil
+		},
+		createPasswordResetFn: func(ctx context.Context, reset PasswordReset) error {
+			reset.ID = int64(len(resets) + 1)
+			resets[reset.TokenHash] = &reset
+			return nil
+		},
+		getPasswordResetForUpdateFn: func(ctx context.Context, tokenHash string) (*PasswordReset, error) {
+			r, ok := resets[tokenHash]
+			if !ok {
+				return nil, domain.ErrNotFound
+			}
+			cp := *r
+			return &cp, nil
+		},
+		markPasswordResetsUsedFn: func(ctx context.Context, userID int64) error {
+			now := time.Now()
+			for _, r := range resets {
+				if r.UserID == userID && r.UsedAt == nil {
+					r.UsedAt = &now
+				}
+			}
+			return nil
+		},
+		updatePasswordFn: func(ctx context.Context, id int64, passwordHash string) error {
+			user.PasswordHash = passwordHash
+			return nil
+		},
+		bumpTokenVersionFn: func(ctx context.Context, userID int64) error {
+			user.TokenVersion++
+			return nil
+		},
+	}
+
+	mailer := &recordingMailer{}
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{
+		Mailer:           mailer,
+		PasswordResetURL: "https://shop.example.com/reset?lang=en",
+	})
+
+	if err := svc.ForgotPassword(context.Background(), "nobody@example.com"); err != nil {
+		t.Fatalf("expected unknown email to succeed silently, got %v", err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Fatalf("expected no mail for an unknown email")
+	}
+
+	if err := svc.ForgotPassword(context.Background(), " USER@example.com "); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != user.Email {
+		t.Fatalf("expected one reset mail to the user, got %+v", mailer.sent)
+	}
+
+	_, link, ok := strings.Cut(mailer.sent[0].Body, "https://shop.example.com/reset?")
+	if !ok {
+		t.Fatalf("expected reset link in mail body: %s", mailer.sent[0].Body)
+	}
+	query, err := url.ParseQuery(strings.Fields(link)[0])
+	if err != nil {
+		t.Fatalf("parse reset link: %v", err)
+	}
+	token := query.Get("token")
+	if token == "" || query.Get("lang") != "en" {
+		t.Fatalf("expected token and original query in link, got %v", query)
+	}
+	if _, stored := resets[token]; stored {
+		t.Fatalf("expected only the token hash to be stored")
+	}
+
+	if err := svc.ResetPassword(context.Background(), ResetPasswordInput{Token: "bogus", NewPassword: "new-password"}); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected ErrInvalidResetToken for an unknown token, got %v", err)
+	}
+
+	if err := svc.ResetPassword(context.Background(), ResetPasswordInput{Token: token, NewPassword: "new-password"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := utils.CheckPassword(user.PasswordHash, "new-password"); err != nil {
+		t.Fatalf("expected the new password to be stored")
+	}
+	if user.TokenVersion != 1 {
+		t.Fatalf("expected sessions to be revoked after reset")
+	}
+
+	if err := svc.ResetPassword(context.Background(), ResetPasswordInput{Token: token, NewPassword: "another-password"}); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected a used token to be rejected, got %v", err)
+	}
+
+	expiredRaw, expiredHash, err := auth.NewOpaqueToken()
+	if err != nil {
+		t.Fatalf("new token: %v", err)
+	}
+	resets[expiredHash] = &PasswordReset{ID: 99, UserID: 1, TokenHash: expiredHash, ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := svc.ResetPassword(context.Background(), ResetPasswordInput{Token: expiredRaw, NewPassword: "another-password"}); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("expected an expired token to be rejected, got %v", err)
+	}
+}
+
+func TestService_ForgotPassword_RunsInBackground(t *testing.T) {
+	user := &UserWithPassword{User: User{ID: 1, Email: "user@example.com", Name: "User"}}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	repo := &mockUserRepo{
+		getByEmailFn: func(ctx context.Context, email string) (*UserWithPassword, error) {
+			started <- struct{}{}
+			<-release
+			if email != user.Email {
+				return nil, domain.ErrNotFound
+			}
+			cp := *user
+			return &cp, nil
+		},
+		createPasswordResetFn: func(ctx context.Context, reset PasswordReset) error {
+			return nil
+		},
+	}
+
+	mailer := &recordingMailer{}
+	pool := workerpool.New(2)
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{Mailer: mailer, Pool: pool})
+
+	// Neither call waits for the lookup, so known and unknown emails answer
+	// alike.
+	for _, email := range []string{"nobody@example.com", "user@example.com"} {
+		if err := svc.ForgotPassword(context.Background(), email); err != nil {
+			t.Fatalf("ForgotPassword(%q): %v", email, err)
+		}
+	}
+
+	<-started
+	<-started
+	close(release)
+	pool.Stop()
+
+	if len(mailer.sent) != 1 || mailer.sent[0].To != user.Email {
+		t.Fatalf("expected one reset mail to the user, got %+v", mailer.sent)
+	}
+}
+
+func TestService_EmailVerification(t *testing.T) {
+	var user *UserWithPassword
+	repo := &mockUserRepo{
+		getByEmailFn: func(ctx context.Context, email string) (*UserWithPassword, error) {
+			return nil, domain.ErrNotFound
+		},
+		createFn: func(ctx context.Context, email, name, passwordHash, role string) (*UserWithPassword, error) {
+			user = &UserWithPassword{User: User{ID: 7, Email: email, Name: name, Role: role}, PasswordHash: passwordHash}
+			cp := *user
+			return &cp, nil
+		},
+		getByIDFn: func(ctx context.Context, id int64) (*UserWithPassword, error) {
+			if user == nil || id != user.ID {
+				return nil, domain.ErrNotFound
+			}
+			cp := *user
+			return &cp, nil
+		},
+		markEmailVerifiedFn: func(ctx context.Context, id int64) error {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+			return nil
+		},
+	}
+
+	mailer := &recordingMailer{}
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{
+		Mailer:               mailer,
+		Signer:               auth.NewLinkSigner("verify-secret"),
+		EmailVerificationURL: "http://localhost:8080/api/v1/auth/verify",
+	})
+
+	resp, err := svc.Register(context.Background(), RegisterInput{Email: "new@example.com", Name: "New", Password: "password"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if resp.Token == "" || resp.User.EmailVerifiedAt != nil {
+		t.Fatalf("expected a usable but unverified account, got %+v", resp)
+	}
+	if err := svc.EnsureEmailVerified(context.Background(), 7); !errors.Is(err, domain.ErrEmailNotVerified) {
+		t.Fatalf("expected ErrEmailNotVerified, got %v", err)
+	}
+
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "new@example.com" {
+		t.Fatalf("expected a verification mail, got %+v", mailer.sent)
+	}
+	_, link, ok := strings.Cut(mailer.sent[0].Body, "http://localhost:8080/api/v1/auth/verify?")
+	if !ok {
+		t.Fatalf("expected verification link in mail body: %s", mailer.sent[0].Body)
+	}
+	query, err := url.ParseQuery(strings.Fields(link)[0])
+	if err != nil {
+		t.Fatalf("parse verification link: %v", err)
+	}
+	token := query.Get("token")
+
+	if err := svc.VerifyEmail(context.Background(), token+"x"); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Fatalf("expected a tampered token to be rejected, got %v", err)
+	}
+
+	if err := svc.VerifyEmail(context.Background(), token); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := svc.EnsureEmailVerified(context.Background(), 7); err != nil {
+		t.Fatalf("expected verified user to pass, got %v", err)
+	}
+	if err := svc.VerifyEmail(context.Background(), token); err != nil {
+		t.Fatalf("expected following the link twice to succeed, got %v", err)
+	}
+
+	// A link sent to a previous address must not verify the new one.
+	user.Email = "changed@example.com"
+	user.EmailVerifiedAt = nil
+	if err := svc.VerifyEmail(context.Background(), token); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Fatalf("expected a stale link to be rejected, got %v", err)
+	}
+
+	if err := svc.ResendVerification(context.Background(), 7); err != nil {
+		t.Fatalf("resend: %v", err)
+	}
+	if len(mailer.sent) != 2 || mailer.sent[1].To != "changed@example.com" {
+		t.Fatalf("expected a new link to the current address, got %+v", mailer.sent)
+	}
+}
+
+func TestService_AdminUserManagement(t *testing.T) {
+	hashed, err := utils.HashPassword("password")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	user := &UserWithPassword{
+		User:         User{ID: 2, Email: "user@example.com", Role: string(domain.UserRoleUser)},
+		PasswordHash: hashed,
+	}
+
+	repo := &mockUserRepo{
+		getByEmailFn: func(ctx context.Context, email string) (*UserWithPassword, error) {
+			cp := *user
+			return &cp, nil
+		},
+		getByIDFn: func(ctx context.Context, id int64) (*UserWithPassword, error) {
+			if id != user.ID {
+				return nil, domain.ErrNotFound
+			}
+			cp := *user
+			return &cp, nil
+		},
+		getStatsFn: func(ctx context.Context, id int64) (*UserStats, error) {
+			return &UserStats{OrderCount: 3, LifetimeSpend: 1500}, nil
+		},
+		setRoleFn: func(ctx context.Context, id int64, role string) error {
+			user.Role = role
+			return nil
+		},
+		setDisabledFn: func(ctx context.Context, id int64, disabled bool) error {
+			if disabled {
+				now := time.Now()
+				user.DisabledAt = &now
+			} else {
+				user.DisabledAt = nil
+			}
+			return nil
+		},
+		bumpTokenVersionFn: func(ctx context.Context, userID int64) error {
+			user.TokenVersion++
+			return nil
+		},
+	}
+
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{})
+	ctx := context.Background()
+
+	details, err := svc.GetDetails(ctx, 2)
+	if err != nil {
+		t.Fatalf("get details: %v", err)
+	}
+	if details.ID != 2 || details.OrderCount != 3 || details.LifetimeSpend != 1500 {
+		t.Fatalf("unexpected details: %+v", details)
+	}
+
+	if _, err := svc.ChangeRole(ctx, 1, 2, "superuser"); !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for unknown role, got %v", err)
+	}
+	if _, err := svc.ChangeRole(ctx, 2, 2, "admin"); !domain.IsConflictError(err) {
+		t.Fatalf("expected conflict when changing own role, got %v", err)
+	}
+	if _, err := svc.SetDisabled(ctx, 2, 2, true); !domain.IsConflictError(err) {
+		t.Fatalf("expected conflict when disabling own account, got %v", err)
+	}
+
+	updated, err := svc.ChangeRole(ctx, 1, 2, "admin")
+	if err != nil {
+		t.Fatalf("change role: %v", err)
+	}
+	if updated.Role != "admin" || user.TokenVersion != 1 {
+		t.Fatalf("expected role change to revoke sessions, got role=%s version=%d", updated.Role, user.TokenVersion)
+	}
+
+	if _, err := svc.ChangeRole(ctx, 1, 2, "admin"); err != nil || user.TokenVersion != 1 {
+		t.Fatalf("expected unchanged role to keep sessions, err=%v version=%d", err, user.TokenVersion)
+	}
+
+	disabled, err := svc.SetDisabled(ctx, 1, 2, true)
+	if err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if disabled.DisabledAt == nil || user.TokenVersion != 2 {
+		t.Fatalf("expected disabling to revoke sessions, got %+v version=%d", disabled, user.TokenVersion)
+	}
+
+	if _, err := svc.Login(ctx, LoginInput{Email: user.Email, Password: "password"}); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("expected ErrAccountDisabled on login, got %v", err)
+	}
+	if _, err := svc.Login(ctx, LoginInput{Email: user.Email, Password: "wrong"}); !domain.IsValidationError(err) {
+		t.Fatalf("expected a wrong password to look like any failed login, got %v", err)
+	}
+
+	enabled, err := svc.SetDisabled(ctx, 1, 2, false)
+	if err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	if enabled.DisabledAt != nil || user.TokenVersion != 2 {
+		t.Fatalf("expected enabling to keep the token version, got %+v version=%d", enabled, user.TokenVersion)
+	}
+	if _, err := svc.Login(ctx, LoginInput{Email: user.Email, Password: "password"}); err != nil {
+		t.Fatalf("expected re-enabled user to log in, got %v", err)
+	}
+
+	if _, err := svc.SetDisabled(ctx, 1, 99, true); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestService_List_Validation(t *testing.T) {
+	repo := &mockUserRepo{
+		listFn: func(ctx context.Context, filter ListFilter, page pagination.Params) ([]*User, error) {
+			if filter.Query != "bob" || page.Limit != pagination.DefaultLimit {
+				t.Fatalf("unexpected filter %+v page %+v", filter, page)
+			}
+			return []*User{{ID: 1}}, nil
+		},
+		countFn: func(ctx context.Context, filter ListFilter) (int64, error) {
+			return 1, nil
+		},
+	}
+	svc := NewService(repo, newTestJWTManager(), fakeTx{}, Options{})
+
+	if _, err := svc.List(context.Background(), ListFilter{Role: "owner"}, pagination.Params{}); !domain.IsValidationError(err) {
+		t.Fatalf("expected validation error for unknown role, got %v", err)
+	}
+
+	page, err := svc.List(context.Background(), ListFilter{Query: " bob "}, pagination.Params{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if page.Total != 1 || len(page.Items) != 1 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+}
+
+func TestService_LoginLockout(t *testing.T) {
+	hashed, err := utils.HashPassword("password")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	repo := &mockUserRepo{
+		getByEmailFn: func(ctx context.Context, email string) (*UserWithPassword, error) {
+			if email == "user@example.com" {
+				return &UserWithPassword{
+					User:         User{ID: 1, Email: email, Role: string(domain.UserRoleUser)},
+					PasswordHash: hashed,
+				}, nil
+			}
+			return nil, domain.ErrNotFound
+		},
+	}
+	newSvc := func() Service {
+		return NewService(repo, newTestJWTManager(), fakeTx{}, Options{
+			LoginTracker: NewMemoryLoginTracker(),
+			Lockout: LockoutPolicy{
+				MaxAttempts:     3,
+				IPMaxAttempts:   5,
+				Window:          time.Hour,
+				LockoutDuration: time.Hour,
+			},
+		})
+	}
+	login := func(svc Service, email, password, ip string) error {
+		_, err := svc.Login(context.Background(), LoginInput{Email: email, Password: password, IP: ip})
+		return err
+	}
+
+	t.Run("locks account after max attempts", func(t *testing.T) {
+		svc := newSvc()
+		for i := 0; i < 3; i++ {
+			if err := login(svc, "user@example.com", "wrong", "10.0.0.1"); !domain.IsValidationError(err) {
+				t.Fatalf("attempt %d: expected validation error, got %v", i+1, err)
+			}
+		}
+
+		// The correct password is rejected too, from any address.
+		err := login(svc, "user@example.com", "password", "10.0.0.2")
+		lockedErr, ok := AsLockedError(err)
+		if !ok {
+			t.Fatalf("expected locked error, got %v", err)
+		}
+		if lockedErr.RetryAfter <= 0 || lockedErr.RetryAfter > time.Hour {
+			t.Fatalf("unexpected retry after: %s", lockedErr.RetryAfter)
+		}
+	})
+
+	t.Run("success resets account failures", func(t *testing.T) {
+		svc := newSvc()
+		for i := 0; i < 2; i++ {
+			_ = login(svc, "user@example.com", "wrong", "10.0.0.1")
+		}
+		if err := login(svc, "user@example.com", "password", "10.0.0.1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := login(svc, "user@example.com", "wrong", "10.0.0.1"); !domain.IsValidationError(err) {
+				t.Fatalf("expected validation error after reset, got %v", err)
+			}
+		}
+	})
+
+	t.Run("locks address across accounts", func(t *testing.T) {
+		svc := newSvc()
+		for i := 0; i < 5; i++ {
+			_ = login(svc, fmt.Sprintf("user%d@example.com", i), "wrong", "10.0.0.9")
+		}
+
+		if _, ok := AsLockedError(login(svc, "user@example.com", "password", "10.0.0.9")); !ok {
+			t.Fatalf("expected address to be locked")
+		}
+		if err := login(svc, "user@example.com", "password", "10.0.0.1"); err != nil {
+			t.Fatalf("expected other address to log in, got %v", err)
+		}
+	})
+}
+
+func TestMemoryLoginTracker_Sweep(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewMemoryLoginTracker().(*memoryLoginTracker)
+	window := 10 * time.Second
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	fail := func(key string, at time.Time) {
+		t.Helper()
+		if _, err := tracker.RecordFailure(ctx, key, at, window); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+
+	fail("ip:1", now)
+	if err := tracker.Lock(ctx, "ip:1", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	fail("ip:2", now)
+
+	// Stale entries are kept until a sweep is due.
+	fail("ip:3", now.Add(30*time.Second))
+	if len(tracker.attempts) != 3 {
+		t.Fatalf("swept before the interval: %v", tracker.attempts)
+	}
+
+	fail("ip:4", now.Add(sweepInterval))
+	if _, ok := tracker.attempts["ip:2"]; ok {
+		t.Fatalf("stale entry was not swept: %v", tracker.attempts)
+	}
+	if _, ok := tracker.attempts["ip:1"]; !ok {
+		t.Fatalf("locked entry was swept: %v", tracker.attempts)
+	}
+	if len(tracker.attempts) != 2 {
+		t.Fatalf("unexpected entries after sweep: %v", tracker.attempts)
+	}
+}
+
+func TestLockoutPolicy_RetryAfter(t *testing.T) {
+	policy := LockoutPolicy{
+		Window:      time.Hour,
+		BackoffBase: time.Second,
+		BackoffMax:  10 * time.Second,
+	}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	future := now.Add(time.Minute)
+	past := now.Add(-time.Minute)
+
+	tests := []struct {
+		name     string
+		attempts LoginAttempts
+		want     time.Duration
+	}{
+		{"no failures", LoginAttempts{}, 0},
+		{"first failure", LoginAttempts{Failures: 1, FirstFailure: now, LastFailure: now}, time.Second},
+		{"backoff doubles", LoginAttempts{Failures: 3, FirstFailure: now, LastFailure: now}, 4 * time.Second},
+		{"backoff capped", LoginAttempts{Failures: 10, FirstFailure: now, LastFailure: now}, 10 * time.Second},
+		{"backoff elapsed", LoginAttempts{Failures: 3, FirstFailure: past, LastFailure: past}, 0},
+		{"window passed", LoginAttempts{Failures: 3, FirstFailure: now.Add(-2 * time.Hour), LastFailure: now}, 0},
+		{"locked", LoginAttempts{Failures: 5, FirstFailure: now, LastFailure: now, LockedUntil: &future}, time.Minute},
+		{"lock expired", LoginAttempts{Failures: 5, FirstFailure: past, LastFailure: past, LockedUntil: &now}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.retryAfter(tt.attempts, now); got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
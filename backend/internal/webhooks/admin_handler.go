@@ -0,0 +1,189 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/pagination"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterAdminRoutes registers webhook subscription management. r must
+// already be restricted to admins.
+func (h *Handler) RegisterAdminRoutes(r *gin.RouterGroup) {
+	g := r.Group("/webhooks")
+
+	g.POST("/", h.create)
+	g.GET("/", h.list)
+	g.GET("/:id", h.getByID)
+	g.PUT("/:id", h.update)
+	g.DELETE("/:id", h.delete)
+	g.GET("/:id/deliveries", h.listDeliveries)
+	g.POST("/:id/test", h.sendTest)
+}
+
+func (h *Handler) create(c *gin.Context) {
+	var input CreateSubscriptionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	sub, err := h.service.Create(c.Request.Context(), input)
+	if err != nil {
+		writeError(c, err, "failed_to_create_webhook")
+		return
+	}
+
+	c.JSON(http.StatusCreated, sub)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	list, err := h.service.List(c.Request.Context())
+	if err != nil {
+		writeError(c, err, "failed_to_list_webhooks")
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) getByID(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	sub, err := h.service.GetByID(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err, "failed_to_get_webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+func (h *Handler) update(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var input UpdateSubscriptionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request_body",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	sub, err := h.service.Update(c.Request.Context(), id, input)
+	if err != nil {
+		writeError(c, err, "failed_to_update_webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), id); err != nil {
+		writeError(c, err, "failed_to_delete_webhook")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) listDeliveries(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	page, err := pagination.Parse(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_pagination",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	list, err := h.service.ListDeliveries(c.Request.Context(), id, page)
+	if err != nil {
+		writeError(c, err, "failed_to_list_webhook_deliveries")
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// sendTest responds 200 with the logged delivery whether or not the
+// endpoint accepted it; the delivery status tells which.
+func (h *Handler) sendTest(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.service.SendTest(c.Request.Context(), id)
+	if err != nil {
+		writeError(c, err, "failed_to_send_test_webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+func parseID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_id",
+			"message": "id must be a positive integer",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeError(c *gin.Context, err error, fallbackCode string) {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "webhook_not_found",
+			"message": "webhook subscription not found",
+		})
+	case domain.IsValidationError(err):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "validation_error",
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   fallbackCode,
+			"message": err.Error(),
+		})
+	}
+}
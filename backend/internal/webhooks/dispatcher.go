@@ -0,0 +1,383 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/outbox"
+	"go-shop-app-backend/pkg/logger"
+	"go-shop-app-backend/pkg/workerpool"
+)
+
+type Options struct {
+	// Timeout bounds one HTTP attempt.
+	Timeout time.Duration
+	// Interval is the pause between polls for due deliveries.
+	Interval  time.Duration
+	BatchSize int
+	// MaxAttempts failed attempts mark a delivery failed. The n-th retry
+	// waits BackoffBase * 2^(n-1), capped at BackoffMax.
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// DisableAfter failed attempts in a row disable the subscription.
+	DisableAfter int
+}
+
+// Dispatcher sends webhook deliveries. As an outbox.Sink it queues one
+// delivery per subscribed endpoint; its poll loop then hands due deliveries
+// to the worker pool, claiming no more than there are idle workers.
+// Deliveries are claimed with SKIP LOCKED and a lease, so several instances
+// can run side by side and a delivery interrupted by a crash is retried.
+type Dispatcher struct {
+	repo   Repository
+	pool   *workerpool.Pool
+	client *http.Client
+	opts   Options
+	lease  time.Duration
+	now    func() time.Time
+
+	// inFlight counts attempts handed to the pool and not finished yet.
+	inFlight atomic.Int64
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewDispatcher returns a dispatcher that runs attempts on pool, or inline
+// when pool is nil. The pool should be the dispatcher's own: attempts can
+// take up to Timeout each and would otherwise hold up other work.
+func NewDispatcher(repo Repository, pool *workerpool.Pool, opts Options) *Dispatcher {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 50
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.BackoffBase <= 0 {
+		opts.BackoffBase = 30 * time.Second
+	}
+	if opts.BackoffMax < opts.BackoffBase {
+		opts.BackoffMax = opts.BackoffBase
+	}
+	if opts.DisableAfter <= 0 {
+		opts.DisableAfter = 20
+	}
+
+	return &Dispatcher{
+		repo: repo,
+		pool: pool,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+			// A redirect is treated as a failed attempt rather than
+			// followed, so payloads only go to the registered URL.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		opts: opts,
+		// Claimed deliveries start right away on an idle worker, so the
+		// lease only has to cover one request and recording its outcome.
+		lease: opts.Timeout + time.Minute,
+		now:   time.Now,
+	}
+}
+
+// Deliver queues event for every enabled subscription to its type. It is
+// safe to call again for the same event.
+func (d *Dispatcher) Deliver(ctx context.Context, event *outbox.Event) error {
+	subs, err := d.repo.ListSubscriptionsForEvent(ctx, event.Type)
+	if err != nil {
+		return fmt.Errorf("list webhook subscriptions: %w", err)
+	}
+
+	now := d.now()
+	for _, sub := range subs {
+		eventID := event.ID
+		_, err := d.repo.CreateDelivery(ctx, &Delivery{
+			SubscriptionID: sub.ID,
+			EventID:        &eventID,
+			EventType:      event.Type,
+			Payload:        event.Payload,
+			NextAttemptAt:  &now,
+		})
+		if err != nil && !domain.IsConflictError(err) {
+			return fmt.Errorf("queue webhook delivery: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Start polls for due deliveries in the background until Stop is called.
+// Calling Start on a running dispatcher does nothing.
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
+
+	go d.loop(ctx, d.done)
+}
+
+// Stop ends polling and waits for the loop to exit or for ctx to end.
+// Attempts already handed to the pool finish with the pool.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	cancel, done := d.cancel, d.done
+	d.cancel, d.done = nil, nil
+	d.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("stop webhook dispatcher: %w", ctx.Err())
+	}
+}
+
+func (d *Dispatcher) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("webhook dispatch failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims due deliveries and submits an attempt for each, until none
+// are due or every worker is busy. It returns how many deliveries were
+// claimed.
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	total := 0
+
+	for ctx.Err() == nil {
+		limit := d.capacity()
+		if limit <= 0 {
+			break
+		}
+
+		now := d.now()
+		ids, err := d.repo.ClaimDeliveries(ctx, limit, now, d.lease)
+		if err != nil {
+			return total, err
+		}
+
+		leasedUntil := now.Add(d.lease)
+		for _, id := range ids {
+			if err := d.submit(ctx, id, leasedUntil); err != nil {
+				return total, err
+			}
+			total++
+		}
+
+		if len(ids) < limit {
+			break
+		}
+	}
+
+	return total, nil
+}
+
+// capacity returns how many deliveries can be claimed now: a batch when
+// attempts run inline, otherwise no more than the pool's idle workers, so
+// nothing claimed waits in the pool's queue while its lease runs out.
+func (d *Dispatcher) capacity() int {
+	if d.pool == nil {
+		return d.opts.BatchSize
+	}
+	return min(d.opts.BatchSize, d.pool.Size()-int(d.inFlight.Load()))
+}
+
+func (d *Dispatcher) submit(ctx context.Context, id int64, leasedUntil time.Time) error {
+	if d.pool == nil {
+		return d.attempt(ctx, id, leasedUntil)
+	}
+
+	d.inFlight.Add(1)
+	err := d.pool.Submit(func(ctx context.Context) {
+		defer d.inFlight.Add(-1)
+		if err := d.attempt(ctx, id, leasedUntil); err != nil && ctx.Err() == nil {
+			logger.Error("webhook attempt failed", "delivery_id", id, "error", err)
+		}
+	})
+	if err != nil {
+		d.inFlight.Add(-1)
+		return fmt.Errorf("submit webhook delivery %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// attempt sends a claimed delivery once and records the outcome. Failures
+// are retried with backoff and count towards disabling the subscription;
+// test events are sent once and leave the failure count alone. A delivery
+// whose lease ran out before the attempt started is left alone, since
+// another instance may have claimed it since.
+func (d *Dispatcher) attempt(ctx context.Context, id int64, leasedUntil time.Time) error {
+	if !d.now().Before(leasedUntil) {
+		return nil
+	}
+
+	delivery, err := d.repo.GetDelivery(ctx, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if delivery.Status != DeliveryStatusPending {
+		return nil
+	}
+
+	// The subscription may have been deleted since the delivery was claimed.
+	sub, err := d.repo.GetSubscription(ctx, delivery.SubscriptionID)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	isTest := delivery.EventType == EventTest
+	if !sub.Enabled && !isTest {
+		return d.repo.FailPending(ctx, sub.ID, "subscription is disabled")
+	}
+
+	status, sendErr := d.send(ctx, sub, delivery)
+
+	// Shutting down: leave the delivery leased so it is retried later rather
+	// than charging it an attempt.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	now := d.now()
+	result := AttemptResult{ResponseStatus: status, At: now}
+
+	if sendErr == nil {
+		result.Status = DeliveryStatusSucceeded
+		if err := d.repo.RecordAttempt(ctx, id, result); err != nil {
+			return err
+		}
+		if !isTest && sub.ConsecutiveFailures > 0 {
+			return d.repo.ResetFailures(ctx, sub.ID)
+		}
+		return nil
+	}
+
+	result.Error = sendErr.Error()
+	attempts := delivery.Attempts + 1
+	if isTest || attempts >= d.opts.MaxAttempts {
+		result.Status = DeliveryStatusFailed
+	} else {
+		result.Status = DeliveryStatusPending
+		result.NextAttemptAt = now.Add(d.backoff(attempts))
+	}
+	if err := d.repo.RecordAttempt(ctx, id, result); err != nil {
+		return err
+	}
+	if isTest {
+		return nil
+	}
+
+	disabled, err := d.repo.AddFailure(ctx, sub.ID, d.opts.DisableAfter, now)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		reason := fmt.Sprintf("subscription disabled after %d failed attempts in a row", d.opts.DisableAfter)
+		return d.repo.FailPending(ctx, sub.ID, reason)
+	}
+
+	return nil
+}
+
+// send POSTs the delivery to the subscription and returns the response
+// status, if any. Any response other than 2xx is an error.
+func (d *Dispatcher) send(ctx context.Context, sub *Subscription, delivery *Delivery) (int, error) {
+	body, err := json.Marshal(Body{
+		ID:        delivery.ID,
+		Type:      delivery.EventType,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("encode webhook body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+
+	ts := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, ts, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("post webhook: unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the next try after attempts failures.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.opts.BackoffBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.opts.BackoffMax {
+			return d.opts.BackoffMax
+		}
+	}
+	return delay
+}
@@ -0,0 +1,105 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"time"
+
+	"go-shop-app-backend/internal/orders"
+	"go-shop-app-backend/internal/products"
+	"go-shop-app-backend/internal/users"
+)
+
+// EventTest is sent by the "send test event" action only; subscriptions
+// cannot subscribe to it.
+const EventTest = "webhook.test"
+
+// EventTypes lists the domain events a subscription may receive.
+var EventTypes = []string{
+	orders.EventOrderCreated,
+	orders.EventOrderPaid,
+	orders.EventOrderCancelled,
+	products.EventStockLow,
+	users.EventUserRegistered,
+}
+
+// Subscription is a merchant endpoint. Secret is only returned when it is
+// set, on create and on update.
+type Subscription struct {
+	ID         int64    `json:"id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types"`
+	Enabled    bool     `json:"enabled"`
+	// ConsecutiveFailures counts failed attempts since the last success.
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+type CreateSubscriptionInput struct {
+	URL string `json:"url"`
+	// Secret is generated when empty.
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types"`
+}
+
+type UpdateSubscriptionInput struct {
+	URL        *string  `json:"url,omitempty"`
+	Secret     *string  `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types,omitempty"`
+	// Enabled re-enables an automatically disabled subscription and resets
+	// its failure count.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "pending"
+	DeliveryStatusSucceeded DeliveryStatus = "succeeded"
+	DeliveryStatusFailed    DeliveryStatus = "failed"
+)
+
+// Delivery is one event sent to one subscription, with the outcome of its
+// latest attempt.
+type Delivery struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventID        *int64          `json:"event_id,omitempty"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// AttemptResult is what the repository records after one attempt.
+type AttemptResult struct {
+	Status         DeliveryStatus
+	ResponseStatus int
+	Error          string
+	// NextAttemptAt is set when Status is pending.
+	NextAttemptAt time.Time
+	At            time.Time
+}
+
+// TestEvent is the payload of webhook.test.
+type TestEvent struct {
+	SubscriptionID int64  `json:"subscription_id"`
+	Message        string `json:"message"`
+}
+
+// Body is the JSON document POSTed to subscribers. ID identifies the
+// delivery and stays the same across retries, so receivers can deduplicate
+// on it.
+type Body struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
@@ -0,0 +1,36 @@
+package webhooks
+
+import (
+	"context"
+	"time"
+
+	"go-shop-app-backend/internal/infra/http/pagination"
+)
+
+type Repository interface {
+	CreateSubscription(ctx context.Context, sub *Subscription) (*Subscription, error)
+	GetSubscription(ctx context.Context, id int64) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]*Subscription, error)
+	UpdateSubscription(ctx context.Context, sub *Subscription) (*Subscription, error)
+	DeleteSubscription(ctx context.Context, id int64) error
+	// ListSubscriptionsForEvent returns the enabled subscriptions to eventType.
+	ListSubscriptionsForEvent(ctx context.Context, eventType string) ([]*Subscription, error)
+	ResetFailures(ctx context.Context, id int64) error
+	// AddFailure counts a failed attempt and disables the subscription once
+	// disableAfter attempts in a row have failed. It reports whether this
+	// call disabled it.
+	AddFailure(ctx context.Context, id int64, disableAfter int, now time.Time) (bool, error)
+
+	// CreateDelivery returns a conflict error when the event has already
+	// been queued for the subscription.
+	CreateDelivery(ctx context.Context, d *Delivery) (*Delivery, error)
+	GetDelivery(ctx context.Context, id int64) (*Delivery, error)
+	ListDeliveries(ctx context.Context, subscriptionID int64, page pagination.Params) ([]*Delivery, error)
+	CountDeliveries(ctx context.Context, subscriptionID int64) (int64, error)
+	// ClaimDeliveries leases up to limit pending deliveries that are due at
+	// now and returns their IDs.
+	ClaimDeliveries(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]int64, error)
+	RecordAttempt(ctx context.Context, id int64, result AttemptResult) error
+	// FailPending gives up on every pending delivery of a subscription.
+	FailPending(ctx context.Context, subscriptionID int64, reason string) error
+}
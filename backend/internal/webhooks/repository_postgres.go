@@ -0,0 +1,372 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/pagination"
+)
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(db *sql.DB) Repository {
+	return &postgresRepository{db: db}
+}
+
+const subscriptionColumns = `id, url, secret, event_types, enabled, consecutive_failures, disabled_at, created_at, updated_at`
+
+func (r *postgresRepository) CreateSubscription(ctx context.Context, sub *Subscription) (*Subscription, error) {
+	query := `
+        INSERT INTO webhook_subscriptions (url, secret, event_types)
+        VALUES ($1, $2, $3)
+        RETURNING ` + subscriptionColumns
+
+	s, err := scanSubscription(r.db.QueryRowContext(ctx, query, sub.URL, sub.Secret, pq.Array(sub.EventTypes)))
+	if err != nil {
+		return nil, fmt.Errorf("insert webhook subscription: %w", err)
+	}
+
+	return s, nil
+}
+
+func (r *postgresRepository) GetSubscription(ctx context.Context, id int64) (*Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+
+	s, err := scanSubscription(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get webhook subscription: %w", err)
+	}
+
+	return s, nil
+}
+
+func (r *postgresRepository) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions ORDER BY id`
+
+	return r.querySubscriptions(ctx, query)
+}
+
+func (r *postgresRepository) ListSubscriptionsForEvent(ctx context.Context, eventType string) ([]*Subscription, error) {
+	query := `
+        SELECT ` + subscriptionColumns + `
+        FROM webhook_subscriptions
+        WHERE enabled AND $1 = ANY(event_types)
+        ORDER BY id
+    `
+
+	return r.querySubscriptions(ctx, query, eventType)
+}
+
+func (r *postgresRepository) querySubscriptions(ctx context.Context, query string, args ...any) ([]*Subscription, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	list := []*Subscription{}
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook subscription: %w", err)
+		}
+		list = append(list, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook subscriptions: %w", err)
+	}
+
+	return list, nil
+}
+
+func (r *postgresRepository) UpdateSubscription(ctx context.Context, sub *Subscription) (*Subscription, error) {
+	query := `
+        UPDATE webhook_subscriptions
+        SET url = $1,
+            secret = $2,
+            event_types = $3,
+            enabled = $4,
+            consecutive_failures = $5,
+            disabled_at = $6,
+            updated_at = NOW()
+        WHERE id = $7
+        RETURNING ` + subscriptionColumns
+
+	s, err := scanSubscription(r.db.QueryRowContext(ctx, query,
+		sub.URL, sub.Secret, pq.Array(sub.EventTypes), sub.Enabled, sub.ConsecutiveFailures, sub.DisabledAt, sub.ID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("update webhook subscription: %w", err)
+	}
+
+	return s, nil
+}
+
+func (r *postgresRepository) DeleteSubscription(ctx context.Context, id int64) error {
+	return r.exec(ctx, "delete webhook subscription", `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+}
+
+func (r *postgresRepository) ResetFailures(ctx context.Context, id int64) error {
+	const query = `
+        UPDATE webhook_subscriptions
+        SET consecutive_failures = 0
+        WHERE id = $1
+    `
+
+	return r.exec(ctx, "reset webhook failures", query, id)
+}
+
+func (r *postgresRepository) AddFailure(ctx context.Context, id int64, disableAfter int, now time.Time) (bool, error) {
+	// SET expressions see the row before the update, so only the call that
+	// crosses the threshold stamps disabled_at with its own now.
+	const query = `
+        UPDATE webhook_subscriptions
+        SET consecutive_failures = consecutive_failures + 1,
+            enabled = enabled AND consecutive_failures + 1 < $2,
+            disabled_at = CASE
+                WHEN enabled AND consecutive_failures + 1 >= $2 THEN $3
+                ELSE disabled_at
+            END
+        WHERE id = $1
+        RETURNING NOT enabled AND disabled_at IS NOT DISTINCT FROM $3
+    `
+
+	var disabled bool
+	if err := r.db.QueryRowContext(ctx, query, id, disableAfter, now).Scan(&disabled); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, domain.ErrNotFound
+		}
+		return false, fmt.Errorf("add webhook failure: %w", err)
+	}
+
+	return disabled, nil
+}
+
+const deliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+               response_status, COALESCE(last_error, ''), created_at, delivered_at`
+
+func (r *postgresRepository) CreateDelivery(ctx context.Context, d *Delivery) (*Delivery, error) {
+	query := `
+        INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, next_attempt_at)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING ` + deliveryColumns
+
+	created, err := scanDelivery(r.db.QueryRowContext(ctx, query,
+		d.SubscriptionID, d.EventID, d.EventType, []byte(d.Payload), d.NextAttemptAt))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, domain.NewConflictError("event is already queued for this subscription")
+		}
+		return nil, fmt.Errorf("insert webhook delivery: %w", err)
+	}
+
+	return created, nil
+}
+
+func (r *postgresRepository) GetDelivery(ctx context.Context, id int64) (*Delivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+
+	d, err := scanDelivery(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get webhook delivery: %w", err)
+	}
+
+	return d, nil
+}
+
+func (r *postgresRepository) ListDeliveries(ctx context.Context, subscriptionID int64, page pagination.Params) ([]*Delivery, error) {
+	args := []any{subscriptionID}
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE subscription_id = $1`
+
+	if page.Cursor != nil {
+		args = append(args, page.Cursor.CreatedAt, page.Cursor.ID)
+		query += " AND (created_at, id) < ($2, $3)"
+	}
+
+	args = append(args, page.Limit, page.Offset())
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		list = append(list, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook deliveries: %w", err)
+	}
+
+	return list, nil
+}
+
+func (r *postgresRepository) CountDeliveries(ctx context.Context, subscriptionID int64) (int64, error) {
+	const query = `SELECT COUNT(*) FROM webhook_deliveries WHERE subscription_id = $1`
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, query, subscriptionID).Scan(&total); err != nil {
+		return 0, fmt.Errorf("count webhook deliveries: %w", err)
+	}
+
+	return total, nil
+}
+
+func (r *postgresRepository) ClaimDeliveries(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]int64, error) {
+	const query = `
+        UPDATE webhook_deliveries
+        SET next_attempt_at = $3
+        WHERE id IN (
+            SELECT id FROM webhook_deliveries
+            WHERE status = 'pending' AND next_attempt_at <= $1
+            ORDER BY next_attempt_at, id
+            LIMIT $2
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, now, limit, now.Add(lease))
+	if err != nil {
+		return nil, fmt.Errorf("claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan webhook delivery id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook delivery ids: %w", err)
+	}
+
+	return ids, nil
+}
+
+func (r *postgresRepository) RecordAttempt(ctx context.Context, id int64, result AttemptResult) error {
+	const query = `
+        UPDATE webhook_deliveries
+        SET status = $2,
+            attempts = attempts + 1,
+            response_status = NULLIF($3, 0),
+            last_error = NULLIF($4, ''),
+            next_attempt_at = CASE WHEN $2 = 'pending' THEN $5 ELSE next_attempt_at END,
+            delivered_at = CASE WHEN $2 = 'succeeded' THEN $6 ELSE NULL END
+        WHERE id = $1
+    `
+
+	return r.exec(ctx, "record webhook attempt", query,
+		id, string(result.Status), result.ResponseStatus, result.Error, result.NextAttemptAt, result.At)
+}
+
+func (r *postgresRepository) FailPending(ctx context.Context, subscriptionID int64, reason string) error {
+	const query = `
+        UPDATE webhook_deliveries
+        SET status = 'failed', last_error = $2
+        WHERE subscription_id = $1 AND status = 'pending'
+    `
+
+	if _, err := r.db.ExecContext(ctx, query, subscriptionID, reason); err != nil {
+		return fmt.Errorf("fail pending webhook deliveries: %w", err)
+	}
+
+	return nil
+}
+
+// exec runs a statement that must touch a row, mapping none to ErrNotFound.
+func (r *postgresRepository) exec(ctx context.Context, what, query string, args ...any) error {
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s rows affected: %w", what, err)
+	}
+	if rowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSubscription(row rowScanner) (*Subscription, error) {
+	var (
+		s          Subscription
+		disabledAt sql.NullTime
+	)
+	if err := row.Scan(&s.ID, &s.URL, &s.Secret, pq.Array(&s.EventTypes), &s.Enabled,
+		&s.ConsecutiveFailures, &disabledAt, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if disabledAt.Valid {
+		s.DisabledAt = &disabledAt.Time
+	}
+	return &s, nil
+}
+
+func scanDelivery(row rowScanner) (*Delivery, error) {
+	var (
+		d              Delivery
+		eventID        sql.NullInt64
+		payload        []byte
+		nextAttemptAt  time.Time
+		responseStatus sql.NullInt64
+		deliveredAt    sql.NullTime
+	)
+	if err := row.Scan(&d.ID, &d.SubscriptionID, &eventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&nextAttemptAt, &responseStatus, &d.LastError, &d.CreatedAt, &deliveredAt); err != nil {
+		return nil, err
+	}
+	d.Payload = payload
+	if eventID.Valid {
+		d.EventID = &eventID.Int64
+	}
+	// The next attempt only means something while the delivery is pending.
+	if d.Status == DeliveryStatusPending {
+		d.NextAttemptAt = &nextAttemptAt
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		d.ResponseStatus = &status
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
@@ -0,0 +1,306 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/pagination"
+)
+
+const (
+	maxURLLength    = 2048
+	minSecretLength = 16
+)
+
+type Service interface {
+	Create(ctx context.Context, input CreateSubscriptionInput) (*Subscription, error)
+	GetByID(ctx context.Context, id int64) (*Subscription, error)
+	List(ctx context.Context) ([]*Subscription, error)
+	Update(ctx context.Context, id int64, input UpdateSubscriptionInput) (*Subscription, error)
+	Delete(ctx context.Context, id int64) error
+	ListDeliveries(ctx context.Context, id int64, page pagination.Params) (*pagination.Page[*Delivery], error)
+	// SendTest sends a webhook.test event to the subscription right away,
+	// even when it is disabled, and returns the logged delivery.
+	SendTest(ctx context.Context, id int64) (*Delivery, error)
+}
+
+type service struct {
+	repo       Repository
+	dispatcher *Dispatcher
+}
+
+func NewService(repo Repository, dispatcher *Dispatcher) Service {
+	return &service{repo: repo, dispatcher: dispatcher}
+}
+
+func (s *service) Create(ctx context.Context, input CreateSubscriptionInput) (*Subscription, error) {
+	rawURL, err := validateURL(input.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	eventTypes, err := validateEventTypes(input.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := strings.TrimSpace(input.Secret)
+	if secret == "" {
+		secret, err = generateSecret()
+		if err != nil {
+			return nil, err
+		}
+	} else if err := validateSecret(secret); err != nil {
+		return nil, err
+	}
+
+	sub, err := s.repo.CreateSubscription(ctx, &Subscription{
+		URL:        rawURL,
+		Secret:     secret,
+		EventTypes: eventTypes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+func (s *service) GetByID(ctx context.Context, id int64) (*Subscription, error) {
+	sub, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	sub.Secret = ""
+	return sub, nil
+}
+
+func (s *service) get(ctx context.Context, id int64) (*Subscription, error) {
+	if id <= 0 {
+		return nil, domain.NewValidationError("invalid id")
+	}
+
+	sub, err := s.repo.GetSubscription(ctx, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, domain.ErrNotFound
+		}
+		return nil, fmt.Errorf("get webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+func (s *service) List(ctx context.Context) ([]*Subscription, error) {
+	list, err := s.repo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook subscriptions: %w", err)
+	}
+
+	for _, sub := range list {
+		sub.Secret = ""
+	}
+
+	return list, nil
+}
+
+func (s *service) Update(ctx context.Context, id int64, input UpdateSubscriptionInput) (*Subscription, error) {
+	sub, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.URL != nil {
+		if sub.URL, err = validateURL(*input.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	if input.Secret != nil {
+		secret := strings.TrimSpace(*input.Secret)
+		if err := validateSecret(secret); err != nil {
+			return nil, err
+		}
+		sub.Secret = secret
+	}
+
+	if input.EventTypes != nil {
+		if sub.EventTypes, err = validateEventTypes(input.EventTypes); err != nil {
+			return nil, err
+		}
+	}
+
+	disabling := false
+	if input.Enabled != nil && *input.Enabled != sub.Enabled {
+		sub.Enabled = *input.Enabled
+		if sub.Enabled {
+			sub.ConsecutiveFailures = 0
+			sub.DisabledAt = nil
+		} else {
+			now := time.Now()
+			sub.DisabledAt = &now
+			disabling = true
+		}
+	}
+
+	updated, err := s.repo.UpdateSubscription(ctx, sub)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("update webhook subscription: %w", err)
+	}
+
+	if disabling {
+		if err := s.repo.FailPending(ctx, id, "subscription is disabled"); err != nil {
+			return nil, fmt.Errorf("update webhook subscription: %w", err)
+		}
+	}
+
+	// Only echo the secret back when the caller has just set it.
+	if input.Secret == nil {
+		updated.Secret = ""
+	}
+
+	return updated, nil
+}
+
+func (s *service) Delete(ctx context.Context, id int64) error {
+	if id <= 0 {
+		return domain.NewValidationError("invalid id")
+	}
+
+	if err := s.repo.DeleteSubscription(ctx, id); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("delete webhook subscription: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) ListDeliveries(ctx context.Context, id int64, page pagination.Params) (*pagination.Page[*Delivery], error) {
+	if _, err := s.get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	page = page.WithDefaults()
+	if err := page.Validate(); err != nil {
+		return nil, domain.NewValidationError(err.Error())
+	}
+
+	list, err := s.repo.ListDeliveries(ctx, id, page)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+
+	total, err := s.repo.CountDeliveries(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("count webhook deliveries: %w", err)
+	}
+
+	return pagination.NewPage(list, total, page, func(d *Delivery) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: d.CreatedAt, ID: d.ID}
+	}), nil
+}
+
+func (s *service) SendTest(ctx context.Context, id int64) (*Delivery, error) {
+	sub, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(TestEvent{
+		SubscriptionID: sub.ID,
+		Message:        "This is a test event.",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encode test event: %w", err)
+	}
+
+	// Created already leased, so the poll loop leaves it to us.
+	leasedUntil := s.dispatcher.now().Add(s.dispatcher.lease)
+	delivery, err := s.repo.CreateDelivery(ctx, &Delivery{
+		SubscriptionID: sub.ID,
+		EventType:      EventTest,
+		Payload:        payload,
+		NextAttemptAt:  &leasedUntil,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create test delivery: %w", err)
+	}
+
+	if err := s.dispatcher.attempt(ctx, delivery.ID, leasedUntil); err != nil {
+		return nil, fmt.Errorf("send test event: %w", err)
+	}
+
+	delivery, err = s.repo.GetDelivery(ctx, delivery.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get test delivery: %w", err)
+	}
+
+	return delivery, nil
+}
+
+func validateURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", domain.NewValidationError("url is required")
+	}
+	if len(raw) > maxURLLength {
+		return "", domain.NewValidationError(fmt.Sprintf("url must be at most %d characters", maxURLLength))
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", domain.NewValidationError("url must be an absolute http or https URL")
+	}
+
+	return raw, nil
+}
+
+func validateSecret(secret string) error {
+	if len(secret) < minSecretLength {
+		return domain.NewValidationError(fmt.Sprintf("secret must be at least %d characters", minSecretLength))
+	}
+	return nil
+}
+
+// validateEventTypes checks types against EventTypes and drops duplicates.
+func validateEventTypes(types []string) ([]string, error) {
+	if len(types) == 0 {
+		return nil, domain.NewValidationError("event_types must not be empty")
+	}
+
+	var out []string
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if !slices.Contains(EventTypes, t) {
+			return nil, domain.NewValidationError(fmt.Sprintf("unknown event type %q; must be one of %s", t, strings.Join(EventTypes, ", ")))
+		}
+		if !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+
+	return out, nil
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,730 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-shop-app-backend/internal/domain"
+	"go-shop-app-backend/internal/infra/http/pagination"
+	"go-shop-app-backend/internal/infra/outbox"
+	"go-shop-app-backend/pkg/workerpool"
+)
+
+// memoryRepo mimics both tables, including delivery leases.
+type memoryRepo struct {
+	mu         sync.Mutex
+	subs       []*Subscription
+	deliveries []*Delivery
+	leases     map[int64]time.Time
+}
+
+func newMemoryRepo() *memoryRepo {
+	return &memoryRepo{leases: make(map[int64]time.Time)}
+}
+
+func (r *memoryRepo) CreateSubscription(ctx context.Context, sub *Subscription) (*Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cp := *sub
+	cp.ID = int64(len(r.subs) + 1)
+	cp.Enabled = true
+	r.subs = append(r.subs, &cp)
+	out := cp
+	return &out, nil
+}
+
+func (r *memoryRepo) sub(id int64) *Subscription {
+	for _, s := range r.subs {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+func (r *memoryRepo) GetSubscription(ctx context.Context, id int64) (*Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.sub(id)
+	if s == nil {
+		return nil, domain.ErrNotFound
+	}
+	cp := *s
+	return &cp, nil
+}
+
+func (r *memoryRepo) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	return r.listSubscriptions(func(*Subscription) bool { return true }), nil
+}
+
+func (r *memoryRepo) ListSubscriptionsForEvent(ctx context.Context, eventType string) ([]*Subscription, error) {
+	return r.listSubscriptions(func(s *Subscription) bool {
+		if !s.Enabled {
+			return false
+		}
+		for _, t := range s.EventTypes {
+			if t == eventType {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (r *memoryRepo) listSubscriptions(keep func(*Subscription) bool) []*Subscription {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := []*Subscription{}
+	for _, s := range r.subs {
+		if keep(s) {
+			cp := *s
+			list = append(list, &cp)
+		}
+	}
+	return list
+}
+
+func (r *memoryRepo) UpdateSubscription(ctx context.Context, sub *Subscription) (*Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.sub(sub.ID)
+	if s == nil {
+		return nil, domain.ErrNotFound
+	}
+	*s = *sub
+	cp := *s
+	return &cp, nil
+}
+
+func (r *memoryRepo) DeleteSubscription(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, s := range r.subs {
+		if s.ID == id {
+			r.subs = append(r.subs[:i], r.subs[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (r *memoryRepo) ResetFailures(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sub(id).ConsecutiveFailures = 0
+	return nil
+}
+
+func (r *memoryRepo) AddFailure(ctx context.Context, id int64, disableAfter int, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.sub(id)
+	s.ConsecutiveFailures++
+	if s.Enabled && s.ConsecutiveFailures >= disableAfter {
+		s.Enabled = false
+		s.DisabledAt = &now
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *memoryRepo) CreateDelivery(ctx context.Context, d *Delivery) (*Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.deliveries {
+		if d.EventID != nil && existing.EventID != nil &&
+			*existing.EventID == *d.EventID && existing.SubscriptionID == d.SubscriptionID {
+			return nil, domain.NewConflictError("event is already queued for this subscription")
+		}
+	}
+
+	cp := *d
+	cp.ID = int64(len(r.deliveries) + 1)
+	cp.Status = DeliveryStatusPending
+	cp.CreatedAt = time.Now()
+	r.deliveries = append(r.deliveries, &cp)
+	r.leases[cp.ID] = *d.NextAttemptAt
+	out := cp
+	return &out, nil
+}
+
+func (r *memoryRepo) GetDelivery(ctx context.Context, id int64) (*Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if id <= 0 || int(id) > len(r.deliveries) {
+		return nil, domain.ErrNotFound
+	}
+	cp := *r.deliveries[id-1]
+	return &cp, nil
+}
+
+func (r *memoryRepo) ListDeliveries(ctx context.Context, subscriptionID int64, page pagination.Params) ([]*Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var list []*Delivery
+	for i := len(r.deliveries) - 1; i >= 0; i-- {
+		if r.deliveries[i].SubscriptionID == subscriptionID {
+			cp := *r.deliveries[i]
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+
+func (r *memoryRepo) CountDeliveries(ctx context.Context, subscriptionID int64) (int64, error) {
+	list, _ := r.ListDeliveries(ctx, subscriptionID, pagination.Params{})
+	return int64(len(list)), nil
+}
+
+func (r *memoryRepo) ClaimDeliveries(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []int64
+	for _, d := range r.deliveries {
+		if len(ids) == limit {
+			break
+		}
+		if d.Status != DeliveryStatusPending || r.leases[d.ID].After(now) {
+			continue
+		}
+		r.leases[d.ID] = now.Add(lease)
+		ids = append(ids, d.ID)
+	}
+	return ids, nil
+}
+
+func (r *memoryRepo) RecordAttempt(ctx context.Context, id int64, result AttemptResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := r.deliveries[id-1]
+	d.Status = result.Status
+	d.Attempts++
+	d.LastError = result.Error
+	d.ResponseStatus = nil
+	if result.ResponseStatus != 0 {
+		status := result.ResponseStatus
+		d.ResponseStatus = &status
+	}
+	d.NextAttemptAt = nil
+	if result.Status == DeliveryStatusPending {
+		next := result.NextAttemptAt
+		d.NextAttemptAt = &next
+		r.leases[id] = next
+	}
+	if result.Status == DeliveryStatusSucceeded {
+		at := result.At
+		d.DeliveredAt = &at
+	}
+	return nil
+}
+
+func (r *memoryRepo) FailPending(ctx context.Context, subscriptionID int64, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.deliveries {
+		if d.SubscriptionID == subscriptionID && d.Status == DeliveryStatusPending {
+			d.Status = DeliveryStatusFailed
+			d.LastError = reason
+			d.NextAttemptAt = nil
+		}
+	}
+	return nil
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is an httptest.Server that answers with the queued statuses,
+// then 204.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rcv := &receiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		rcv.requests = append(rcv.requests, receivedRequest{header: req.Header.Clone(), body: body})
+		status := http.StatusNoContent
+		if len(rcv.statuses) > 0 {
+			status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (r *receiver) received() []receivedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedRequest(nil), r.requests...)
+}
+
+func newEvent(t *testing.T, id int64, eventType string) *outbox.Event {
+	t.Helper()
+	msg, err := outbox.NewMessage(eventType, "order", 7, map[string]int64{"order_id": 7})
+	if err != nil {
+		t.Fatalf("new message: %v", err)
+	}
+	return &outbox.Event{ID: id, Type: msg.Type, AggregateType: msg.AggregateType, AggregateID: msg.AggregateID, Payload: msg.Payload}
+}
+
+func TestService_Create_Validation(t *testing.T) {
+	svc := NewService(newMemoryRepo(), NewDispatcher(newMemoryRepo(), nil, Options{}))
+
+	tests := []struct {
+		name  string
+		input CreateSubscriptionInput
+	}{
+		{"missing url", CreateSubscriptionInput{EventTypes: []string{"order.paid"}}},
+		{"relative url", CreateSubscriptionInput{URL: "/hooks", EventTypes: []string{"order.paid"}}},
+		{"unsupported scheme", CreateSubscriptionInput{URL: "ftp://example.com/hooks", EventTypes: []string{"order.paid"}}},
+		{"no event types", CreateSubscriptionInput{URL: "https://example.com/hooks"}},
+		{"unknown event type", CreateSubscriptionInput{URL: "https://example.com/hooks", EventTypes: []string{"order.shipped"}}},
+		{"test event type", CreateSubscriptionInput{URL: "https://example.com/hooks", EventTypes: []string{EventTest}}},
+		{"short secret", CreateSubscriptionInput{URL: "https://example.com/hooks", EventTypes: []string{"order.paid"}, Secret: "short"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Create(context.Background(), tt.input); !domain.IsValidationError(err) {
+				t.Fatalf("expected validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestService_SecretOnlyReturnedWhenSet(t *testing.T) {
+	svc := NewService(newMemoryRepo(), NewDispatcher(newMemoryRepo(), nil, Options{}))
+	ctx := context.Background()
+
+	sub, err := svc.Create(ctx, CreateSubscriptionInput{
+		URL:        "https://example.com/hooks",
+		EventTypes: []string{"order.paid", "order.paid", "order.created"},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !strings.HasPrefix(sub.Secret, "whsec_") {
+		t.Fatalf("expected a generated secret, got %q", sub.Secret)
+	}
+	if len(sub.EventTypes) != 2 {
+		t.Fatalf("expected duplicate event types to be dropped, got %v", sub.EventTypes)
+	}
+
+	got, err := svc.GetByID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.Secret != "" {
+		t.Fatal("get returned the secret")
+	}
+
+	list, _ := svc.List(ctx)
+	if len(list) != 1 || list[0].Secret != "" {
+		t.Fatalf("list returned the secret: %+v", list)
+	}
+
+	newURL := "https://example.com/v2/hooks"
+	updated, err := svc.Update(ctx, sub.ID, UpdateSubscriptionInput{URL: &newURL})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.URL != newURL || updated.Secret != "" {
+		t.Fatalf("unexpected update result: %+v", updated)
+	}
+
+	secret := "a-brand-new-secret-value"
+	updated, err = svc.Update(ctx, sub.ID, UpdateSubscriptionInput{Secret: &secret})
+	if err != nil {
+		t.Fatalf("rotate secret: %v", err)
+	}
+	if updated.Secret != secret {
+		t.Fatalf("expected the new secret to be echoed, got %q", updated.Secret)
+	}
+
+	if _, err := svc.GetByID(ctx, 99); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDispatcher_DeliversSignedEvents(t *testing.T) {
+	rcv := newReceiver(t)
+	repo := newMemoryRepo()
+	dispatcher := NewDispatcher(repo, nil, Options{})
+	svc := NewService(repo, dispatcher)
+	ctx := context.Background()
+
+	const secret = "merchant-secret-0001"
+	sub, err := svc.Create(ctx, CreateSubscriptionInput{URL: rcv.URL, Secret: secret, EventTypes: []string{"order.paid"}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	for _, e := range []*outbox.Event{newEvent(t, 1, "order.paid"), newEvent(t, 2, "order.created"), newEvent(t, 1, "order.paid")} {
+		if err := dispatcher.Deliver(ctx, e); err != nil {
+			t.Fatalf("deliver: %v", err)
+		}
+	}
+
+	n, err := dispatcher.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("run once: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("claimed %d deliveries, want 1", n)
+	}
+
+	requests := rcv.received()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(requests))
+	}
+	req := requests[0]
+
+	if err := Verify(secret, req.body, req.header.Get(TimestampHeader), req.header.Get(SignatureHeader), time.Now()); err != nil {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+	if err := Verify("some-other-secret", req.body, req.header.Get(TimestampHeader), req.header.Get(SignatureHeader), time.Now()); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected a wrong secret to be rejected, got %v", err)
+	}
+	if req.header.Get(EventHeader) != "order.paid" || req.header.Get(IDHeader) != "1" {
+		t.Fatalf("unexpected headers: %v", req.header)
+	}
+
+	var body Body
+	if err := json.Unmarshal(req.body, &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.ID != 1 || body.Type != "order.paid" || string(body.Data) != `{"order_id":7}` {
+		t.Fatalf("unexpected body: %s", req.body)
+	}
+
+	page, err := svc.ListDeliveries(ctx, sub.ID, pagination.Params{})
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	if page.Total != 1 {
+		t.Fatalf("expected one logged delivery, got %d", page.Total)
+	}
+	d := page.Items[0]
+	if d.Status != DeliveryStatusSucceeded || d.Attempts != 1 || d.ResponseStatus == nil || *d.ResponseStatus != http.StatusNoContent {
+		t.Fatalf("unexpected delivery: %+v", d)
+	}
+
+	if n, _ := dispatcher.RunOnce(ctx); n != 0 {
+		t.Fatalf("delivered again: %d", n)
+	}
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	rcv := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	repo := newMemoryRepo()
+	dispatcher := NewDispatcher(repo, nil, Options{
+		MaxAttempts:  3,
+		BackoffBase:  time.Second,
+		BackoffMax:   time.Minute,
+		DisableAfter: 10,
+	})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	dispatcher.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	sub, _ := NewService(repo, dispatcher).Create(ctx, CreateSubscriptionInput{URL: rcv.URL, EventTypes: []string{"order.paid"}})
+	if err := dispatcher.Deliver(ctx, newEvent(t, 1, "order.paid")); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+
+	dispatcher.RunOnce(ctx)
+	d, _ := repo.GetDelivery(ctx, 1)
+	if d.Status != DeliveryStatusPending || d.Attempts != 1 || !d.NextAttemptAt.Equal(now.Add(time.Second)) {
+		t.Fatalf("after first failure: %+v", d)
+	}
+	if d.ResponseStatus == nil || *d.ResponseStatus != http.StatusInternalServerError || d.LastError == "" {
+		t.Fatalf("expected the failure to be logged: %+v", d)
+	}
+
+	if n, _ := dispatcher.RunOnce(ctx); n != 0 {
+		t.Fatalf("retried before backoff elapsed")
+	}
+
+	now = now.Add(time.Second)
+	dispatcher.RunOnce(ctx)
+	d, _ = repo.GetDelivery(ctx, 1)
+	if d.Attempts != 2 || !d.NextAttemptAt.Equal(now.Add(2*time.Second)) {
+		t.Fatalf("after second failure: %+v", d)
+	}
+
+	now = now.Add(2 * time.Second)
+	dispatcher.RunOnce(ctx)
+	d, _ = repo.GetDelivery(ctx, 1)
+	if d.Status != DeliveryStatusSucceeded || d.Attempts != 3 || d.LastError != "" {
+		t.Fatalf("expected success on the third attempt: %+v", d)
+	}
+
+	got, _ := repo.GetSubscription(ctx, sub.ID)
+	if got.ConsecutiveFailures != 0 {
+		t.Fatalf("success did not reset failures: %d", got.ConsecutiveFailures)
+	}
+}
+
+func TestDispatcher_DisablesAfterRepeatedFailures(t *testing.T) {
+	rcv := newReceiver(t, 500, 500, 500, 500, 500, 500)
+	repo := newMemoryRepo()
+	dispatcher := NewDispatcher(repo, nil, Options{
+		MaxAttempts:  2,
+		BackoffBase:  time.Second,
+		DisableAfter: 3,
+	})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	dispatcher.now = func() time.Time { return now }
+	svc := NewService(repo, dispatcher)
+	ctx := context.Background()
+
+	sub, _ := svc.Create(ctx, CreateSubscriptionInput{URL: rcv.URL, EventTypes: []string{"order.paid", "order.cancelled"}})
+
+	dispatcher.Deliver(ctx, newEvent(t, 1, "order.paid"))
+	dispatcher.RunOnce(ctx)
+	now = now.Add(time.Second)
+	dispatcher.RunOnce(ctx)
+
+	if d, _ := repo.GetDelivery(ctx, 1); d.Status != DeliveryStatusFailed || d.Attempts != 2 {
+		t.Fatalf("expected the delivery to give up after 2 attempts: %+v", d)
+	}
+
+	// The third failure in a row disables the subscription and abandons
+	// whatever is still queued for it.
+	dispatcher.Deliver(ctx, newEvent(t, 2, "order.paid"))
+	dispatcher.Deliver(ctx, newEvent(t, 3, "order.cancelled"))
+	dispatcher.opts.BatchSize = 1
+	dispatcher.RunOnce(ctx)
+
+	got, _ := svc.GetByID(ctx, sub.ID)
+	if got.Enabled || got.DisabledAt == nil || got.ConsecutiveFailures != 3 {
+		t.Fatalf("expected subscription to be disabled: %+v", got)
+	}
+	if d, _ := repo.GetDelivery(ctx, 3); d.Status != DeliveryStatusFailed || d.Attempts != 0 || !strings.Contains(d.LastError, "disabled") {
+		t.Fatalf("expected queued delivery to be abandoned: %+v", d)
+	}
+	if n, _ := dispatcher.RunOnce(ctx); n != 0 {
+		t.Fatalf("disabled subscription still has due deliveries: %d", n)
+	}
+
+	dispatcher.Deliver(ctx, newEvent(t, 4, "order.paid"))
+	if page, _ := svc.ListDeliveries(ctx, sub.ID, pagination.Params{}); page.Total != 3 {
+		t.Fatalf("disabled subscription received new events: %d deliveries", page.Total)
+	}
+
+	// Re-enabling resets the failure count.
+	enabled := true
+	got, err := svc.Update(ctx, sub.ID, UpdateSubscriptionInput{Enabled: &enabled})
+	if err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	if !got.Enabled || got.DisabledAt != nil || got.ConsecutiveFailures != 0 {
+		t.Fatalf("unexpected subscription after enabling: %+v", got)
+	}
+}
+
+func TestService_SendTest(t *testing.T) {
+	rcv := newReceiver(t, http.StatusServiceUnavailable)
+	repo := newMemoryRepo()
+	dispatcher := NewDispatcher(repo, nil, Options{DisableAfter: 1})
+	svc := NewService(repo, dispatcher)
+	ctx := context.Background()
+
+	sub, _ := svc.Create(ctx, CreateSubscriptionInput{URL: rcv.URL, EventTypes: []string{"order.paid"}})
+	disabled := false
+	if _, err := svc.Update(ctx, sub.ID, UpdateSubscriptionInput{Enabled: &disabled}); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+
+	// A failed test is logged but neither retried nor counted.
+	d, err := svc.SendTest(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("send test: %v", err)
+	}
+	if d.EventType != EventTest || d.Status != DeliveryStatusFailed || d.Attempts != 1 {
+		t.Fatalf("unexpected failed test delivery: %+v", d)
+	}
+	if got, _ := repo.GetSubscription(ctx, sub.ID); got.ConsecutiveFailures != 0 {
+		t.Fatalf("test failure was counted: %d", got.ConsecutiveFailures)
+	}
+
+	// Test events reach disabled subscriptions, so an endpoint can be
+	// checked before it is enabled again.
+	d, err = svc.SendTest(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("send test: %v", err)
+	}
+	if d.Status != DeliveryStatusSucceeded {
+		t.Fatalf("unexpected test delivery: %+v", d)
+	}
+
+	requests := rcv.received()
+	if len(requests) != 2 || requests[1].header.Get(EventHeader) != EventTest {
+		t.Fatalf("unexpected requests: %d", len(requests))
+	}
+	var body Body
+	if err := json.Unmarshal(requests[1].body, &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	var payload TestEvent
+	if err := json.Unmarshal(body.Data, &payload); err != nil || payload.SubscriptionID != sub.ID {
+		t.Fatalf("unexpected test payload: %s", body.Data)
+	}
+
+	if _, err := svc.SendTest(ctx, 42); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDispatcher_RunsAttemptsOnWorkerPool(t *testing.T) {
+	rcv := newReceiver(t)
+	repo := newMemoryRepo()
+	pool := workerpool.New(2)
+	defer pool.Stop()
+
+	dispatcher := NewDispatcher(repo, pool, Options{Interval: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	NewService(repo, dispatcher).Create(ctx, CreateSubscriptionInput{URL: rcv.URL, EventTypes: []string{"order.created"}})
+	for i := int64(1); i <= 3; i++ {
+		if err := dispatcher.Deliver(ctx, newEvent(t, i, "order.created")); err != nil {
+			t.Fatalf("deliver: %v", err)
+		}
+	}
+
+	dispatcher.Start()
+	deadline := time.Now().Add(time.Second)
+	for len(rcv.received()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := dispatcher.Stop(stopCtx); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	if got := len(rcv.received()); got != 3 {
+		t.Fatalf("receiver got %d requests, want 3", got)
+	}
+}
+
+func TestDispatcher_ClaimsOnlyForIdleWorkers(t *testing.T) {
+	release := make(chan struct{})
+	rcv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer rcv.Close()
+	defer close(release)
+
+	repo := newMemoryRepo()
+	pool := workerpool.New(2)
+	defer pool.Stop()
+
+	dispatcher := NewDispatcher(repo, pool, Options{})
+	ctx := context.Background()
+
+	NewService(repo, dispatcher).Create(ctx, CreateSubscriptionInput{URL: rcv.URL, EventTypes: []string{"order.created"}})
+	for i := int64(1); i <= 5; i++ {
+		if err := dispatcher.Deliver(ctx, newEvent(t, i, "order.created")); err != nil {
+			t.Fatalf("deliver: %v", err)
+		}
+	}
+
+	if n, err := dispatcher.RunOnce(ctx); err != nil || n != 2 {
+		t.Fatalf("first run claimed %d (err %v), want 2", n, err)
+	}
+	if n, err := dispatcher.RunOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("claimed %d (err %v) while every worker is busy", n, err)
+	}
+}
+
+func TestDispatcher_SkipsExpiredLease(t *testing.T) {
+	rcv := newReceiver(t)
+	repo := newMemoryRepo()
+	dispatcher := NewDispatcher(repo, nil, Options{})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	dispatcher.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	NewService(repo, dispatcher).Create(ctx, CreateSubscriptionInput{URL: rcv.URL, EventTypes: []string{"order.paid"}})
+	if err := dispatcher.Deliver(ctx, newEvent(t, 1, "order.paid")); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+
+	if err := dispatcher.attempt(ctx, 1, now); err != nil {
+		t.Fatalf("attempt: %v", err)
+	}
+
+	d, _ := repo.GetDelivery(ctx, 1)
+	if len(rcv.received()) != 0 || d.Status != DeliveryStatusPending || d.Attempts != 0 {
+		t.Fatalf("expected the delivery left alone, got %d requests and %+v", len(rcv.received()), d)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Unix(1700000000, 0)
+	sig := Sign("secret-secret-secret", now.Unix(), body)
+	ts := "1700000000"
+
+	tests := []struct {
+		name    string
+		body    []byte
+		ts      string
+		sig     string
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", body, ts, sig, now, false},
+		{"valid among several signatures", body, ts, "v1=00," + sig, now, false},
+		{"tampered body", []byte(`{"id":2}`), ts, sig, now, true},
+		{"tampered timestamp", body, "1700000001", sig, now, true},
+		{"too old", body, ts, sig, now.Add(SignatureTolerance + time.Second), true},
+		{"missing signature", body, ts, "", now, true},
+		{"missing timestamp", body, "", sig, now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify("secret-secret-secret", tt.body, tt.ts, tt.sig, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
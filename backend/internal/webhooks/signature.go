@@ -0,0 +1,63 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	IDHeader        = "Webhook-Id"
+	EventHeader     = "Webhook-Event"
+	TimestampHeader = "Webhook-Timestamp"
+	SignatureHeader = "Webhook-Signature"
+
+	// SignatureTolerance is how old a request receivers should accept,
+	// limiting replays of captured requests.
+	SignatureTolerance = 5 * time.Minute
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the Webhook-Signature header for body sent at the given
+// Webhook-Timestamp: "v1=" and the hex HMAC-SHA256 of "<timestamp>.<body>".
+func Sign(secret string, timestamp int64, body []byte) string {
+	return "v1=" + hex.EncodeToString(mac(secret, timestamp, body))
+}
+
+// Verify checks the Webhook-Timestamp and Webhook-Signature headers of a
+// received request, as a subscriber would.
+func Verify(secret string, body []byte, timestampHeader, signatureHeader string, now time.Time) error {
+	ts, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return ErrInvalidSignature
+	}
+
+	for _, part := range strings.Split(signatureHeader, ",") {
+		v, sig, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if v != "v1" {
+			continue
+		}
+		got, err := hex.DecodeString(sig)
+		if err == nil && hmac.Equal(got, mac(secret, ts, body)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func mac(secret string, timestamp int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
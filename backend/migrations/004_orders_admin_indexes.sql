@@ -0,0 +1,4 @@
+-- Индексы для админского списка заказов с фильтрами.
+
+CREATE INDEX IF NOT EXISTS idx_orders_status_created_at ON orders (status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_total_price ON orders (total_price);
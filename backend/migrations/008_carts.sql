@@ -0,0 +1,24 @@
+-- Корзины: у пользователя одна корзина, у гостя — корзина по анонимному токену.
+
+CREATE TABLE IF NOT EXISTS carts (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    token      TEXT UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT carts_owner_check CHECK ((user_id IS NULL) <> (token IS NULL))
+);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+    cart_id    BIGINT NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+    product_id BIGINT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity   BIGINT NOT NULL,
+    added_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (cart_id, product_id),
+    CONSTRAINT cart_items_quantity_check CHECK (quantity > 0)
+);
+
+CREATE TRIGGER set_carts_updated_at
+BEFORE UPDATE ON carts
+FOR EACH ROW
+EXECUTE FUNCTION set_timestamp();
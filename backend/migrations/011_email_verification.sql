@@ -0,0 +1,6 @@
+-- Подтверждение email. Уже существующие аккаунты считаем подтверждёнными.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
@@ -0,0 +1,6 @@
+-- Блокировка аккаунтов администратором и индекс для списка пользователей.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users (created_at DESC, id DESC);
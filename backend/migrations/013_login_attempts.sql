@@ -0,0 +1,13 @@
+-- Неудачные попытки входа по аккаунту ("account:<email>") и по адресу ("ip:<addr>").
+-- Используется для экспоненциальной задержки и временной блокировки.
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key              TEXT PRIMARY KEY,
+    failures         INT NOT NULL DEFAULT 0,
+    first_failure_at TIMESTAMPTZ NOT NULL,
+    last_failure_at  TIMESTAMPTZ NOT NULL,
+    locked_until     TIMESTAMPTZ
+);
+
+-- Для очистки устаревших записей
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failure_at ON login_attempts (last_failure_at);
@@ -0,0 +1,18 @@
+-- Ключи идемпотентности (заголовок Idempotency-Key) с сохранённым ответом.
+-- completed_at IS NULL — исходный запрос ещё выполняется.
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key           TEXT NOT NULL,
+    request_hash  TEXT NOT NULL,
+    status_code   INT,
+    content_type  TEXT,
+    response_body BYTEA,
+    locked_at     TIMESTAMPTZ NOT NULL,
+    completed_at  TIMESTAMPTZ,
+    expires_at    TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+-- Для очистки просроченных ключей
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
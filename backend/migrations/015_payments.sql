@@ -0,0 +1,30 @@
+-- Платежи по заказам: каждая попытка оплаты — отдельная строка.
+
+CREATE TABLE IF NOT EXISTS payments (
+    id             BIGSERIAL PRIMARY KEY,
+    order_id       BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider       TEXT NOT NULL,
+    intent_id      TEXT,
+    status         TEXT NOT NULL DEFAULT 'pending',
+    amount         BIGINT NOT NULL,
+    currency       TEXT NOT NULL,
+    failure_reason TEXT,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT payments_status_check CHECK (status IN ('pending', 'processing', 'succeeded', 'failed')),
+    CONSTRAINT payments_amount_check CHECK (amount > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_order_id ON payments (order_id);
+
+-- Вебхуки провайдера находят платёж по идентификатору намерения
+CREATE UNIQUE INDEX IF NOT EXISTS uq_payments_provider_intent ON payments (provider, intent_id);
+
+-- Не более одной незавершённой или успешной оплаты на заказ
+CREATE UNIQUE INDEX IF NOT EXISTS uq_payments_order_active ON payments (order_id)
+    WHERE status IN ('pending', 'processing', 'succeeded');
+
+CREATE TRIGGER set_payments_updated_at
+BEFORE UPDATE ON payments
+FOR EACH ROW
+EXECUTE FUNCTION set_timestamp();
@@ -0,0 +1,60 @@
+-- Возвраты (полные и частичные) по оплаченным заказам.
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled', 'partially_refunded', 'refunded'));
+
+-- Нельзя вернуть больше, чем куплено и оплачено
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS refunded_quantity BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refunded_amount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_amount BIGINT NOT NULL DEFAULT 0;
+
+-- ADD CONSTRAINT не поддерживает IF NOT EXISTS, поэтому проверяем вручную,
+-- чтобы миграцию можно было применить повторно
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'order_items_refunded_quantity_check') THEN
+        ALTER TABLE order_items ADD CONSTRAINT order_items_refunded_quantity_check
+            CHECK (refunded_quantity >= 0 AND refunded_quantity <= quantity);
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'orders_refunded_amount_check') THEN
+        ALTER TABLE orders ADD CONSTRAINT orders_refunded_amount_check
+            CHECK (refunded_amount >= 0 AND refunded_amount <= total_price);
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'payments_refunded_amount_check') THEN
+        ALTER TABLE payments ADD CONSTRAINT payments_refunded_amount_check
+            CHECK (refunded_amount >= 0 AND refunded_amount <= amount);
+    END IF;
+END $$;
+
+-- Заказы, ранее помеченные как возвращённые, считаются возвращёнными полностью
+UPDATE order_items SET refunded_quantity = quantity
+WHERE order_id IN (SELECT id FROM orders WHERE status = 'refunded');
+UPDATE orders SET refunded_amount = total_price WHERE status = 'refunded';
+
+-- Журнал возвратов; payment_id пуст, если заказ оплачен вне платёжного провайдера
+CREATE TABLE IF NOT EXISTS refunds (
+    id                 BIGSERIAL PRIMARY KEY,
+    order_id           BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    payment_id         BIGINT REFERENCES payments(id) ON DELETE RESTRICT,
+    amount             BIGINT NOT NULL,
+    restock            BOOLEAN NOT NULL DEFAULT FALSE,
+    reason             TEXT,
+    provider_refund_id TEXT,
+    created_by         BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT refunds_amount_check CHECK (amount > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_order_id ON refunds (order_id, created_at);
+
+CREATE TABLE IF NOT EXISTS refund_items (
+    refund_id     BIGINT NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    order_item_id BIGINT NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    quantity      BIGINT NOT NULL,
+    amount        BIGINT NOT NULL,
+    PRIMARY KEY (refund_id, order_item_id),
+    CONSTRAINT refund_items_quantity_check CHECK (quantity > 0)
+);
@@ -0,0 +1,22 @@
+-- Транзакционный outbox: доменные события пишутся в той же транзакции,
+-- что и изменение состояния, и доставляются фоновым релеем.
+CREATE TABLE IF NOT EXISTS outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    event_type      TEXT NOT NULL,
+    aggregate_type  TEXT NOT NULL,
+    aggregate_id    BIGINT NOT NULL,
+    payload         JSONB NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at    TIMESTAMPTZ,
+    CONSTRAINT outbox_status_check CHECK (status IN ('pending', 'delivered', 'dead'))
+);
+
+-- Очередь на доставку; next_attempt_at также служит арендой при захвате
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (next_attempt_at, id) WHERE status = 'pending';
+
+-- Недоставленные события для разбора вручную
+CREATE INDEX IF NOT EXISTS idx_outbox_dead ON outbox (created_at) WHERE status = 'dead';
@@ -0,0 +1,42 @@
+-- Подписки мерчантов на доменные события
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id                   BIGSERIAL PRIMARY KEY,
+    url                  TEXT NOT NULL,
+    secret               TEXT NOT NULL,
+    event_types          TEXT[] NOT NULL,
+    enabled              BOOLEAN NOT NULL DEFAULT TRUE,
+    -- Неудачные попытки подряд; при достижении порога подписка отключается
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    disabled_at          TIMESTAMPTZ,
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Журнал доставок; event_id ссылается на событие outbox (NULL для тестовых)
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              BIGSERIAL PRIMARY KEY,
+    subscription_id BIGINT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id        BIGINT,
+    event_type      TEXT NOT NULL,
+    payload         JSONB NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    response_status INT,
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at    TIMESTAMPTZ,
+    CONSTRAINT webhook_deliveries_status_check CHECK (status IN ('pending', 'succeeded', 'failed'))
+);
+
+-- Повторная передача события из outbox не создаёт дубликатов
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event
+    ON webhook_deliveries (subscription_id, event_id) WHERE event_id IS NOT NULL;
+
+-- Очередь на отправку; next_attempt_at также служит арендой при захвате
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending
+    ON webhook_deliveries (next_attempt_at, id) WHERE status = 'pending';
+
+-- Журнал доставок подписки, от новых к старым
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription
+    ON webhook_deliveries (subscription_id, created_at DESC, id DESC);
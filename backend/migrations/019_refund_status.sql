@@ -0,0 +1,15 @@
+-- Возврат сначала записывается как pending и завершается после ответа
+-- провайдера; существующие записи считаются успешными
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'succeeded';
+ALTER TABLE refunds ALTER COLUMN status SET DEFAULT 'pending';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'refunds_status_check') THEN
+        ALTER TABLE refunds ADD CONSTRAINT refunds_status_check
+            CHECK (status IN ('pending', 'succeeded', 'failed'));
+    END IF;
+END $$;
+
+-- Не больше одного незавершённого возврата на заказ
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refunds_pending ON refunds (order_id) WHERE status = 'pending';
@@ -0,0 +1,3 @@
+-- Токен захвата ключа: запрос сохраняет или освобождает ключ, только пока
+-- его не перехватил другой запрос после истечения блокировки
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS token TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Токен аренды: релей записывает итог доставки, только пока событие не
+-- захватил другой релей после истечения аренды
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS lease_token TEXT;
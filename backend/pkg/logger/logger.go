@@ -5,7 +5,8 @@ import (
 	"os"
 )
 
-var Log *slog.Logger
+// Log is slog.Default until Init is called, so packages can log in tests.
+var Log = slog.Default()
 
 func Init() {
 	Log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
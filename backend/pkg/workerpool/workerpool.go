@@ -9,6 +9,7 @@ import (
 type Task func(ctx context.Context)
 
 type Pool struct {
+	size   int
 	tasks  chan Task
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -22,6 +23,7 @@ func New(size int) *Pool {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	p := &Pool{
+		size:   size,
 		tasks:  make(chan Task, size*2),
 		ctx:    ctx,
 		cancel: cancel,
@@ -50,6 +52,11 @@ func New(size int) *Pool {
 	return p
 }
 
+// Size returns the number of workers.
+func (p *Pool) Size() int {
+	return p.size
+}
+
 func (p *Pool) Submit(task Task) error {
 	if task == nil {
 		return nil